@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+)
+
+var errMissingServer = errors.New("missing server after @")
+
+// listFlag 是可以重复给出的参数，每次的值也可以是逗号分隔的列表
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// parseCommandLine 像 dig 一样允许选项、域名和 @server 任意交错：flag 包遇到第一个非选项参数就停止解析，
+// 这里把非选项参数取出后接着解析剩下的选项，"--" 之后的参数都当作域名。
+// 以 @ 开头的参数是引导解析用的服务器，出现多次时以最后一个为准
+func parseCommandLine(fs *flag.FlagSet, args []string) (domains []string, server string, err error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, "", err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		i := 0
+		for i < len(rest) && !isOption(rest[i]) {
+			positional = append(positional, rest[i])
+			i++
+		}
+		if i == len(rest) {
+			break
+		}
+		args = rest[i:]
+	}
+	for _, arg := range positional {
+		if spec, ok := strings.CutPrefix(arg, "@"); ok {
+			if spec == "" {
+				return nil, "", errMissingServer
+			}
+			server = spec
+			continue
+		}
+		domains = append(domains, arg)
+	}
+	return domains, server, nil
+}
+
+func isOption(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-'
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// axfrColumn 描述一台服务器的区传送结果；允许传送时只给出记录数，不输出区内容
+func axfrColumn(s trace.AXFRResult) string {
+	switch s.Status {
+	case trace.AXFRAllowed:
+		if !s.Complete {
+			return fmt.Sprintf("! transfer allowed (%d records before %s)", s.Records, s.Error)
+		}
+		return fmt.Sprintf("! transfer allowed (%d records)", s.Records)
+	case trace.AXFRRefused:
+		if s.Rcode != "" {
+			return "refused (" + s.Rcode + ")"
+		}
+		return "refused (" + s.Error + ")"
+	}
+	return "! connection failed: " + s.Error
+}
+
+func printAXFRCheck(c *trace.AXFRCheck) {
+	fmt.Printf("Zone transfer (AXFR) for %s:\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tRESULT")
+	for _, s := range c.Servers {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", s.Hostname, s.IP, axfrColumn(s))
+	}
+	w.Flush()
+	if c.Open() {
+		fmt.Println("  ! at least one server hands out the whole zone to anyone")
+	}
+}
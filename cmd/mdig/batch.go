@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// batchEntry 是批量模式 JSON 里一个输入对应的值：Domain 是规范化后实际追踪的 FQDN，Status 和 ExitCode 是这个目标自己的结果，
+// Report 里是各级结果、汇总和启用了的各项检查；-f 里无法解析的行状态是 invalid，Error 是解析错误
+type batchEntry struct {
+	Domain     string       `json:"domain"`
+	Status     string       `json:"status"`
+	ExitCode   int          `json:"exit_code"`
+	DurationMs float64      `json:"duration_ms"`
+	Error      string       `json:"error,omitempty"`
+	Report     trace.Report `json:"report"`
+}
+
+// statusInvalid 是 -f 里无法解析、没有追踪的行在批量 JSON 里的状态
+const statusInvalid = "invalid"
+
+// batchWriter 把批量模式的结果写成一个以原始输入为键的 JSON 对象，每完成一个目标就写出一项，
+// 不必等全部追踪结束；目标追踪失败或被中断时同样有一项
+type batchWriter struct {
+	n int
+}
+
+func newBatchEntry(report trace.Report, status trace.Status, code int, elapsed time.Duration) batchEntry {
+	return batchEntry{
+		Domain:     dns.Fqdn(report.Domain),
+		Status:     status.String(),
+		ExitCode:   code,
+		DurationMs: float64(elapsed.Microseconds()) / 1000,
+		Report:     report,
+	}
+}
+
+// newInvalidEntry 为 -f 里无法解析的一行生成批量 JSON 的一项，退出码和命令行参数错误相同
+func newInvalidEntry(bad invalidTarget) batchEntry {
+	return batchEntry{
+		Domain:   bad.Arg,
+		Status:   statusInvalid,
+		ExitCode: exitUsage,
+		Error:    bad.Err.Error(),
+	}
+}
+
+func (b *batchWriter) write(key string, entry batchEntry) {
+	k, err := json.Marshal(key)
+	if err != nil {
+		logger.Error("json encode failed", "error", err)
+		return
+	}
+	v, err := json.MarshalIndent(entry, "  ", "  ")
+	if err != nil {
+		logger.Error("json encode failed", "error", err)
+		return
+	}
+	sep := "{\n"
+	if b.n > 0 {
+		sep = ",\n"
+	}
+	b.n++
+	fmt.Fprintf(os.Stdout, "%s  %s: %s", sep, k, v)
+}
+
+// writeInvalid 为 -f 里每个无法解析的行写出一项，输入重复的行只写一次
+func writeInvalid(b *batchWriter, invalid []invalidTarget) {
+	seen := make(map[string]bool)
+	for _, bad := range invalid {
+		if !seen[bad.Arg] {
+			seen[bad.Arg] = true
+			b.write(bad.Arg, newInvalidEntry(bad))
+		}
+	}
+}
+
+// close 结束 JSON 对象，没有写出任何一项时输出空对象
+func (b *batchWriter) close() {
+	if b.n == 0 {
+		fmt.Println("{}")
+		return
+	}
+	fmt.Println("\n}")
+}
+
+// dedupeTargets 去掉重复的输入，批量 JSON 以输入为键，同一个输入只追踪一次
+func dedupeTargets(targets []traceTarget) []traceTarget {
+	seen := make(map[string]bool)
+	var unique []traceTarget
+	for _, t := range targets {
+		if seen[t.Arg] {
+			logger.Warn("duplicate domain skipped", "domain", t.Arg)
+			continue
+		}
+		seen[t.Arg] = true
+		unique = append(unique, t)
+	}
+	return unique
+}
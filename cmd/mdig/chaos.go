@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatIdentity(replies []trace.ChaosReply) string {
+	var parts []string
+	for _, r := range replies {
+		if r.Error != "" {
+			parts = append(parts, fmt.Sprintf("%s=(%s)", r.Name, r.Error))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=%s", r.Name, strconv.Quote(r.Value)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatCNAMEChain(chain []trace.CNAMEHop) string {
+	var parts []string
+	for _, hop := range chain {
+		parts = append(parts, fmt.Sprintf("%s (%s)", hop.Name, hop.Zone))
+	}
+	s := strings.Join(parts, " → ")
+	if answers := chain[len(chain)-1].Answers; len(answers) > 0 {
+		s += " → " + strings.Join(answers, ", ")
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatResolverAnswers(ans trace.ResolverAnswer) string {
+	switch {
+	case ans.Error != "":
+		return "error: " + ans.Error
+	case len(ans.Answers) == 0:
+		return "(no records)"
+	}
+	return strings.Join(ans.Answers, ", ")
+}
+
+func printResolverComparison(cmp *trace.ResolverComparison) {
+	fmt.Printf("Resolver comparison for %s:\n", cmp.Name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  RESOLVER\tTYPE\tRCODE\tTTL\tANSWERS\t")
+	for _, q := range slices.Sorted(maps.Keys(cmp.Authoritative)) {
+		auth := cmp.Authoritative[q]
+		fmt.Fprintf(w, "  authoritative\t%s\t%s\t-\t%s\t\n", auth.Qtype, auth.Rcode, formatResolverAnswers(*auth))
+	}
+	for _, ans := range cmp.Answers {
+		rcode, ttl, mark := "-", "-", ""
+		if ans.Error == "" {
+			rcode, ttl = ans.Rcode, fmt.Sprint(ans.TTL)
+		}
+		if ans.Disagrees {
+			mark = "! differs from authoritative"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n", ans.Resolver, ans.Qtype, rcode, ttl, formatResolverAnswers(ans), mark)
+	}
+	w.Flush()
+	if cmp.Authoritative == nil {
+		fmt.Println("  * the trace did not reach an authoritative answer, resolvers are not compared against it")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// envPrefix 是提供选项默认值的环境变量前缀：-check-serial 对应 MDIG_CHECK_SERIAL
+const envPrefix = "MDIG_"
+
+// 不能由配置文件和环境变量设置的选项：它们决定的是配置本身
+var configOnlyFlags = map[string]bool{"config": true, "show-config": true}
+
+// flagSources 记录每个没有取默认值的选项来自哪里（command line、配置文件或环境变量），供 -show-config 和表头使用
+var flagSources = make(map[string]string)
+
+// defaultConfigPath 返回 $XDG_CONFIG_HOME/mdig/config.yaml，没有设置时是 ~/.config/mdig/config.yaml
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "mdig", "config.yaml")
+}
+
+// applyDefaults 在解析完命令行之后，用配置文件和 MDIG_* 环境变量填写命令行上没有给出的选项。
+// 优先级从高到低是命令行、环境变量、配置文件、内置默认值，与它们出现的先后无关。
+// 配置文件路径依次取 -config、MDIG_CONFIG 和 defaultConfigPath，只有默认路径不存在时不算错误；
+// 不认识的键和环境变量只输出警告
+func applyDefaults(flags *flag.FlagSet, configPath string) (string, error) {
+	flags.Visit(func(f *flag.Flag) { flagSources[f.Name] = "command line" })
+	explicit := configPath != ""
+	if !explicit {
+		configPath, explicit = os.LookupEnv(envPrefix + "CONFIG")
+	}
+	if !explicit {
+		configPath = defaultConfigPath()
+	}
+	if configPath != "" {
+		values, err := readConfigFile(configPath)
+		switch {
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+			configPath = ""
+		case err != nil:
+			return "", err
+		}
+		for _, v := range values {
+			if err := setDefault(flags, v.key, v.value, fmt.Sprintf("%s:%d", configPath, v.line)); err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		key, ok := strings.CutPrefix(name, envPrefix)
+		if !ok || name == envPrefix+"CONFIG" {
+			continue
+		}
+		key = strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+		if flags.Lookup(key) == nil || configOnlyFlags[key] {
+			fmt.Fprintf(os.Stderr, "warning: unknown environment variable %s ignored\n", name)
+			continue
+		}
+		if err := setDefault(flags, key, value, name); err != nil {
+			return "", err
+		}
+	}
+	return configPath, nil
+}
+
+// setDefault 在选项没有由更高优先级的来源设置时使用 value；环境变量在配置文件之后处理，覆盖配置文件的值
+func setDefault(flags *flag.FlagSet, key, value, source string) error {
+	f := flags.Lookup(key)
+	if f == nil || configOnlyFlags[key] {
+		fmt.Fprintf(os.Stderr, "warning: %s: unknown key %q ignored\n", source, key)
+		return nil
+	}
+	if flagSources[key] == "command line" {
+		return nil
+	}
+	if isBoolFlag(f) {
+		value = yamlBool(value)
+	}
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("%s: invalid value %q for %s: %v", source, value, key, err)
+	}
+	flagSources[key] = source
+	return nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// yamlBool 把 YAML 常见的 yes/no、on/off 写法换成 flag 包认识的 true/false
+func yamlBool(s string) string {
+	switch strings.ToLower(s) {
+	case "yes", "on":
+		return "true"
+	case "no", "off":
+		return "false"
+	}
+	return s
+}
+
+type configValue struct {
+	key, value string
+	line       int
+}
+
+// readConfigFile 读取配置文件。只支持一层 "键: 值" 的 YAML：键是去掉开头 "-" 的选项名（下划线等同于连字符），
+// 值可以加单引号或双引号，# 开始注释；嵌套的映射和列表会报错，多个地址之类的列表写成逗号分隔的字符串
+func readConfigFile(path string) ([]configValue, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var values []configValue
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := stripComment(sc.Text())
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "- ") {
+			return nil, fmt.Errorf("%s:%d: expected \"key: value\", nested values are not supported", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				if value, err = strconv.Unquote(value); err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+				}
+			} else {
+				value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+			}
+		}
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		values = append(values, configValue{key: strings.TrimPrefix(key, "-"), value: value, line: n})
+	}
+	return values, sc.Err()
+}
+
+// stripComment 去掉引号之外、行首或空白之后的 # 注释
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// showConfig 实现 -show-config：按配置文件的格式列出每个选项的最终取值，注释里是它的来源，
+// 输出可以直接作为配置文件使用
+func showConfig(flags *flag.FlagSet, configPath string) {
+	switch {
+	case configPath != "":
+		fmt.Printf("# config file: %s\n", configPath)
+	case defaultConfigPath() != "":
+		fmt.Printf("# config file: none (%s does not exist)\n", defaultConfigPath())
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	flags.VisitAll(func(f *flag.Flag) {
+		if configOnlyFlags[f.Name] {
+			return
+		}
+		source := flagSources[f.Name]
+		if source == "" {
+			source = "default"
+		}
+		fmt.Fprintf(w, "%s: %s\t# %s\n", f.Name, yamlValue(f.Value.String()), source)
+	})
+	w.Flush()
+}
+
+// yamlValue 给空值和会被误解的值加上引号
+func yamlValue(s string) string {
+	if s == "" || strings.ContainsAny(s, "#\"'") || strings.Contains(s, ": ") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	return s
+}
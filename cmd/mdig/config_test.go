@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newConfigFlags 返回只有几个选项的 FlagSet，并清空上一个用例留下的来源
+func newConfigFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	flagSources = make(map[string]string)
+	t.Cleanup(func() { flagSources = make(map[string]string) })
+	fs := flag.NewFlagSet("mdig", flag.ContinueOnError)
+	fs.String("dnstype", "a/aaaa", "")
+	fs.String("iptype", "all", "")
+	fs.Int("retries", 0, "")
+	fs.Bool("check-serial", false, "")
+	fs.String("config", "", "")
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyDefaultsPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		env        map[string]string
+		config     string
+		want       string
+		wantSource string
+	}{
+		{name: "built-in default", want: "a/aaaa"},
+		{name: "config file", config: "dnstype: txt\n", want: "txt", wantSource: "config.yaml:1"},
+		{name: "environment", env: map[string]string{"MDIG_DNSTYPE": "mx"}, want: "mx", wantSource: "MDIG_DNSTYPE"},
+		{name: "environment over config", config: "dnstype: txt\n", env: map[string]string{"MDIG_DNSTYPE": "mx"}, want: "mx", wantSource: "MDIG_DNSTYPE"},
+		{name: "flag over environment and config", args: []string{"-dnstype", "ns"}, config: "dnstype: txt\n", env: map[string]string{"MDIG_DNSTYPE": "mx"}, want: "ns", wantSource: "command line"},
+		{name: "quoted value and comment", config: "# probes\ndnstype: \"soa\" # apex\n", want: "soa", wantSource: "config.yaml:2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			fs := newConfigFlags(t, tt.args...)
+			path := ""
+			if tt.config != "" {
+				path = writeConfig(t, tt.config)
+			}
+			if _, err := applyDefaults(fs, path); err != nil {
+				t.Fatal(err)
+			}
+			if got := fs.Lookup("dnstype").Value.String(); got != tt.want {
+				t.Errorf("dnstype = %q, want %q", got, tt.want)
+			}
+			source := flagSources["dnstype"]
+			if tt.wantSource != "" && filepath.Base(source) != tt.wantSource {
+				t.Errorf("source = %q, want %q", source, tt.wantSource)
+			}
+			if got := source != ""; got != (tt.wantSource != "") {
+				t.Errorf("flag counted as set = %v, want %v", got, !got)
+			}
+		})
+	}
+}
+
+// 配置文件和环境变量给出的值必须和命令行一样算作设置过，否则 com 这类公共后缀的默认 NS 查询会覆盖它们
+func TestFlagSetCountsDefaults(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("MDIG_DNSTYPE", "mx")
+	fs := newConfigFlags(t, "-retries", "2")
+	if _, err := applyDefaults(fs, writeConfig(t, "check-serial: yes\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dnstype", "retries", "check-serial"} {
+		if !flagSet(name) {
+			t.Errorf("flagSet(%q) = false, want true", name)
+		}
+	}
+	if flagSet("iptype") {
+		t.Error(`flagSet("iptype") = true for an option left at its default`)
+	}
+	if got := fs.Lookup("check-serial").Value.String(); got != "true" {
+		t.Errorf("check-serial = %q, want true", got)
+	}
+}
+
+func TestApplyDefaultsConfigPath(t *testing.T) {
+	t.Run("MDIG_CONFIG", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+		path := writeConfig(t, "retries: 3\n")
+		t.Setenv("MDIG_CONFIG", path)
+		fs := newConfigFlags(t)
+		got, err := applyDefaults(fs, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != path || fs.Lookup("retries").Value.String() != "3" {
+			t.Errorf("config %q, retries %s; want %q, 3", got, fs.Lookup("retries").Value, path)
+		}
+	})
+	t.Run("missing default path", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+		if got, err := applyDefaults(newConfigFlags(t), ""); err != nil || got != "" {
+			t.Errorf("applyDefaults = %q, %v; want no config and no error", got, err)
+		}
+	})
+	t.Run("missing explicit path", func(t *testing.T) {
+		t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+		if _, err := applyDefaults(newConfigFlags(t), filepath.Join(t.TempDir(), "none.yaml")); err == nil {
+			t.Error("applyDefaults succeeded for a -config file that does not exist")
+		}
+	})
+}
+
+func TestApplyDefaultsErrors(t *testing.T) {
+	tests := []struct {
+		name, config string
+		env          map[string]string
+		wantErr      bool
+	}{
+		{name: "unknown key only warns", config: "no-such-flag: 1\n"},
+		{name: "unknown environment variable only warns", env: map[string]string{"MDIG_NO_SUCH_FLAG": "1"}},
+		{name: "invalid value", config: "retries: many\n", wantErr: true},
+		{name: "invalid environment value", env: map[string]string{"MDIG_RETRIES": "many"}, wantErr: true},
+		{name: "nested value", config: "dnstype:\n  - a\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.config != "" {
+				path = writeConfig(t, tt.config)
+			}
+			_, err := applyDefaults(newConfigFlags(t), path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applyDefaults error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatCookie(c *trace.CookieInfo) string {
+	var s string
+	switch {
+	case c.Returned == "":
+		s = "not returned"
+	case c.Mismatch:
+		s = "client cookie mismatch"
+	case c.Full:
+		s = "client+server"
+	default:
+		s = "client only"
+	}
+	switch {
+	case c.Retried && c.BadCookie:
+		s += " (BADCOOKIE after retry)"
+	case c.Retried:
+		s += " (retried after BADCOOKIE)"
+	case c.BadCookie:
+		s += " (BADCOOKIE)"
+	}
+	return s
+}
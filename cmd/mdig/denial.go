@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatNegative(n *trace.NegativeAnswer, qtype string) string {
+	var s string
+	if n.Kind == "nxdomain" {
+		s = "NXDOMAIN: name does not exist"
+	} else {
+		s = fmt.Sprintf("NODATA: name exists, no %s records", qtype)
+	}
+	if n.Zone == "" {
+		return s + " (no SOA in authority section)"
+	}
+	return fmt.Sprintf("%s (SOA %s, negative TTL %d)", s, n.Zone, n.TTL)
+}
+
+func printDenial(p *trace.DenialProof) {
+	fmt.Printf("  │   ├─ Denial of existence (zone %s):\n", p.Zone)
+	if p.QNameHash != "" {
+		fmt.Printf("  │   │   ├─ qname hash: %s\n", strings.ToLower(p.QNameHash))
+	}
+	for _, r := range p.NSEC {
+		fmt.Printf("  │   │   ├─ NSEC %s → %s [%s]\n", r.Owner, r.Next, strings.Join(r.Types, " "))
+		if r.Proves != "" {
+			fmt.Printf("  │   │   │   └─ %s\n", r.Proves)
+		}
+	}
+	for _, r := range p.NSEC3 {
+		optOut := ""
+		if r.OptOut {
+			optOut = " (opt-out)"
+		}
+		fmt.Printf("  │   │   ├─ NSEC3 %s → %s [%s]%s\n", strings.ToLower(r.Owner), strings.ToLower(r.Next), strings.Join(r.Types, " "), optOut)
+		if r.Proves != "" {
+			fmt.Printf("  │   │   │   └─ %s\n", r.Proves)
+		}
+	}
+	for _, c := range p.Conclusions {
+		fmt.Printf("  │   │   └─ %s\n", c)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func printDiff(diff *trace.AnswerDiff) {
+	fmt.Printf("Answer diff for %s:\n", diff.Domain)
+	consensus := "(empty)"
+	if len(diff.Consensus) > 0 {
+		consensus = strings.Join(diff.Consensus, ", ")
+	}
+	if len(diff.Deviations) == 0 {
+		fmt.Printf("  all %d servers agree: %s\n", diff.Servers, consensus)
+		return
+	}
+	fmt.Printf("  consensus (%d of %d servers): %s\n", diff.Agreeing, diff.Servers, consensus)
+	for _, dev := range diff.Deviations {
+		fmt.Printf("  ! %s (%s) deviates:\n", dev.Hostname, dev.IP)
+		if dev.Error != "" {
+			fmt.Printf("      error: %s\n", dev.Error)
+			continue
+		}
+		for _, r := range dev.Added {
+			fmt.Printf("      + %s\n", r)
+		}
+		for _, r := range dev.Omitted {
+			fmt.Printf("      - %s\n", r)
+		}
+	}
+}
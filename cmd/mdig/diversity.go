@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// asnColumn 是一个地址的起源 AS，没有查询时为 -
+func asnColumn(c *trace.DiversityCheck, a trace.DiversityAddress) string {
+	switch {
+	case c.ASNNote != "":
+		return "-"
+	case a.ASNError != "":
+		return "? " + a.ASNError
+	}
+	return "AS" + strings.Join(a.ASNs, " AS")
+}
+
+func diversityVerdict(c *trace.DiversityCheck) string {
+	return fmt.Sprintf("no prefix or AS holds all (or all but one) of the %d nameservers", len(c.Servers))
+}
+
+func printDiversityCheck(c *trace.DiversityCheck) {
+	fmt.Printf("Network diversity for %s:\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tADDRESS\tPREFIX\tORIGIN AS")
+	for _, s := range c.Servers {
+		for _, a := range s.Addresses {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", s.Hostname, a.IP, a.Prefix, asnColumn(c, a))
+		}
+	}
+	w.Flush()
+	if c.ASNNote != "" {
+		fmt.Printf("  %s\n", c.ASNNote)
+	}
+	for _, warning := range c.Warnings {
+		fmt.Printf("  ! %s\n", warning)
+	}
+	if len(c.Warnings) == 0 {
+		fmt.Printf("  %s\n", diversityVerdict(c))
+	}
+}
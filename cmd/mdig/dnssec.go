@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func printDelegationKeys(keys *trace.DelegationKeys) {
+	fmt.Printf("  ├─ DS for %s (from parent):\n", keys.Zone)
+	if len(keys.DS) == 0 {
+		fmt.Printf("  │   ├─ none (unsigned delegation)\n")
+	}
+	for _, ds := range keys.DS {
+		fmt.Printf("  │   ├─ key tag %d, algorithm %d (%s), digest type %d (%s) — %s\n",
+			ds.KeyTag, ds.Algorithm, dns.AlgorithmToString[ds.Algorithm], ds.DigestType, dns.HashToString[ds.DigestType], dsMatch(ds))
+	}
+	fmt.Printf("  ├─ DNSKEY for %s (from child):\n", keys.Zone)
+	if len(keys.DNSKEY) == 0 {
+		fmt.Printf("  │   ├─ none\n")
+	}
+	for _, key := range keys.DNSKEY {
+		match := ""
+		if key.Matched {
+			match = " — referenced by DS"
+		}
+		fmt.Printf("  │   ├─ key tag %d, algorithm %d (%s), flags %d (%s)%s\n",
+			key.KeyTag, key.Algorithm, dns.AlgorithmToString[key.Algorithm], key.Flags, trace.KeyRole(key.Flags), match)
+	}
+	for _, e := range keys.Errors {
+		fmt.Printf("  │   ! %s\n", e)
+	}
+}
+
+func dsMatch(ds trace.DSInfo) string {
+	switch ds.Status {
+	case trace.DSMatched:
+		return "matches DNSKEY"
+	case trace.DSDigestMismatch:
+		return "digest does not match the DNSKEY with this key tag"
+	case trace.DSUnsupportedDigest:
+		return "digest type not supported, cannot compare"
+	}
+	return "no matching DNSKEY"
+}
+
+// printDSCheck 按委派列出每个 DS 是否对应子域正在发布的 DNSKEY
+func printDSCheck(results []trace.Result) {
+	fmt.Println("DS check:")
+	found := false
+	for _, res := range results {
+		keys := res.Delegation
+		if keys == nil {
+			continue
+		}
+		found = true
+		switch verdict := keys.Verdict(); verdict {
+		case trace.DelegationInsecure:
+			fmt.Printf("  %s insecure (no DS at the parent)\n", keys.Zone)
+			continue
+		case trace.DelegationBroken:
+			fmt.Printf("  ! %s broken: no DS matches a DNSKEY the child publishes\n", keys.Zone)
+		case trace.DelegationUnknown:
+			fmt.Printf("  ! %s unknown: %s\n", keys.Zone, strings.Join(keys.Errors, "; "))
+		default:
+			fmt.Printf("  %s %s\n", keys.Zone, verdict)
+		}
+		for _, ds := range keys.DS {
+			mark := " "
+			if !ds.Matched {
+				mark = "!"
+			}
+			fmt.Printf("    %s DS key tag %d, algorithm %d, digest type %d (%s): %s\n", mark, ds.KeyTag, ds.Algorithm, ds.DigestType, dns.HashToString[ds.DigestType], dsCheckNote(ds))
+		}
+		for _, key := range keys.DNSKEY {
+			if !key.Matched && key.Flags&dns.SEP != 0 {
+				fmt.Printf("      DNSKEY key tag %d, algorithm %d (KSK) has no DS, fine unless it is meant to be the active KSK\n", key.KeyTag, key.Algorithm)
+			}
+		}
+	}
+	if !found {
+		fmt.Println("  no delegations in the trace")
+	}
+}
+
+func dsCheckNote(ds trace.DSInfo) string {
+	if ds.Status == trace.DSNoKey {
+		return "points at a key the child does not publish"
+	}
+	return dsMatch(ds)
+}
+
+// signedAnswers 返回 qr 的应答，应答区的每条 RRSIG 以 "└ " 开头紧跟在它所签名的 RRset 后面
+func signedAnswers(qr trace.QueryResult) []string {
+	var sigs []trace.SigInfo
+	for _, sig := range qr.RRSIGs {
+		if sig.Section == "answer" {
+			sigs = append(sigs, sig)
+		}
+	}
+	var out []string
+	take := func(rtype string) {
+		rest := sigs[:0]
+		for _, sig := range sigs {
+			if rtype == "" || sig.TypeCovered == rtype {
+				out = append(out, "└ "+sig.String())
+			} else {
+				rest = append(rest, sig)
+			}
+		}
+		sigs = rest
+	}
+	for i, v := range qr.Answers {
+		out = append(out, v)
+		if i >= len(qr.AnswerTypes) {
+			continue
+		}
+		// 到 RRset 的最后一条记录时放上它的签名
+		if t := qr.AnswerTypes[i]; i+1 == len(qr.AnswerTypes) || qr.AnswerTypes[i+1] != t {
+			take(t)
+		}
+	}
+	// 没有对应记录的签名放在最后
+	take("")
+	return out
+}
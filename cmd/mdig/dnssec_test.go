@@ -0,0 +1,33 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func TestSignedAnswers(t *testing.T) {
+	sig := func(section, covered string) trace.SigInfo {
+		return trace.SigInfo{Section: section, TypeCovered: covered, Algorithm: 13, KeyTag: 1, SignerName: "example.com."}
+	}
+	qr := trace.QueryResult{
+		Answers:     []string{"cdn.example.com.", "192.0.2.1", "192.0.2.2"},
+		AnswerTypes: []string{"CNAME", "A", "A"},
+		RRSIGs:      []trace.SigInfo{sig("answer", "CNAME"), sig("answer", "A"), sig("authority", "NSEC"), sig("answer", "DNAME")},
+	}
+	want := []string{
+		"cdn.example.com.",
+		"└ RRSIG CNAME: algorithm 13, key tag 1, signer example.com.",
+		"192.0.2.1",
+		"192.0.2.2",
+		"└ RRSIG A: algorithm 13, key tag 1, signer example.com.",
+		"└ RRSIG DNAME: algorithm 13, key tag 1, signer example.com.",
+	}
+	if got := signedAnswers(qr); !slices.Equal(got, want) {
+		t.Errorf("signedAnswers = %q\nwant            %q", got, want)
+	}
+	if got := signedAnswers(trace.QueryResult{Answers: []string{"192.0.2.1"}}); !slices.Equal(got, []string{"192.0.2.1"}) {
+		t.Errorf("unsigned answers = %q", got)
+	}
+}
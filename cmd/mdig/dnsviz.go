@@ -0,0 +1,364 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// dnsvizVersion 是 dnsviz probe 输出的原始数据格式版本，写在 _meta._dnsviz. 里
+const dnsvizVersion = 1.2
+
+// dnsvizTime 是 DNSViz 的 analysis_start、analysis_end 使用的时间格式
+const dnsvizTime = "2006-01-02 15:04:05 UTC"
+
+// dnsvizName 是 DNSViz 文档里的一个名字：追踪经过的每个区、其他查询名，以及应答里出现的 CNAME 目标和签名者（stub）
+type dnsvizName struct {
+	Type               string              `json:"type"`
+	Stub               bool                `json:"stub"`
+	AnalysisStart      string              `json:"analysis_start"`
+	AnalysisEnd        string              `json:"analysis_end"`
+	ClientsIPv4        []string            `json:"clients_ipv4"`
+	ClientsIPv6        []string            `json:"clients_ipv6"`
+	Parent             string              `json:"parent,omitempty"`
+	ReferralRdtype     string              `json:"referral_rdtype,omitempty"`
+	ExplicitDelegation bool                `json:"explicit_delegation"`
+	AuthNSIPMapping    map[string][]string `json:"auth_ns_ip_mapping,omitempty"`
+	Queries            []*dnsvizQuery      `json:"queries"`
+
+	start, end time.Time
+}
+
+type dnsvizQuery struct {
+	QName     string                               `json:"qname"`
+	QClass    string                               `json:"qclass"`
+	QType     string                               `json:"qtype"`
+	Options   dnsvizOptions                        `json:"options"`
+	Responses map[string]map[string]dnsvizResponse `json:"responses"`
+
+	key string
+}
+
+// dnsvizOptions 描述查询报文本身：头部标志位和 EDNS；没有 EDNS 时 edns_version 为 -1，其余 EDNS 字段省略
+type dnsvizOptions struct {
+	Flags             int      `json:"flags"`
+	EDNSVersion       int      `json:"edns_version"`
+	EDNSMaxUDPPayload *uint16  `json:"edns_max_udp_payload,omitempty"`
+	EDNSFlags         *int     `json:"edns_flags,omitempty"`
+	EDNSOptions       []string `json:"edns_options,omitempty"`
+	TCP               bool     `json:"tcp"`
+}
+
+// dnsvizResponse 是一台服务器的应答：message 是 base64 编码的完整报文，没有应答时为 null 并给出 error
+type dnsvizResponse struct {
+	Message     *string `json:"message"`
+	MsgSize     int     `json:"msg_size,omitempty"`
+	TimeElapsed int64   `json:"time_elapsed"`
+	History     []any   `json:"history"`
+	Error       string  `json:"error,omitempty"`
+	Errno       string  `json:"errno,omitempty"`
+}
+
+// dnsvizWriter 收集 -o dnsviz 的全部目标，最后写出一个文档，dnsviz grok/graph -r 直接读取
+type dnsvizWriter struct {
+	names   []string
+	objects map[string]*dnsvizName
+}
+
+func newDNSVizWriter() *dnsvizWriter {
+	return &dnsvizWriter{objects: make(map[string]*dnsvizName)}
+}
+
+// add 把一次追踪换成 DNSViz 的模型：每个区一个名字，父区来自转介到它的那一级，权威服务器来自查询它的那一级；
+// 每个查询按查询名归到对应的名字下，相同的查询发往不同服务器的应答合在一起
+func (w *dnsvizWriter) add(report trace.Report) {
+	if name := dnsvizKey(report.Domain); !slices.Contains(w.names, name) {
+		w.names = append(w.names, name)
+	}
+	for i, res := range report.Results {
+		if res.Zone == "" {
+			continue
+		}
+		obj := w.object(res.Zone)
+		if obj.AuthNSIPMapping == nil {
+			obj.AuthNSIPMapping = make(map[string][]string)
+		}
+		for _, auth := range res.Authorities {
+			host := dnsvizKey(auth.Hostname)
+			for _, ip := range auth.IPs {
+				if !slices.Contains(obj.AuthNSIPMapping[host], ip.String()) {
+					obj.AuthNSIPMapping[host] = append(obj.AuthNSIPMapping[host], ip.String())
+				}
+			}
+		}
+		if res.Child == "" {
+			continue
+		}
+		child := w.object(res.Child)
+		child.Parent = dnsvizKey(res.Zone)
+		if child.ReferralRdtype == "" {
+			child.ReferralRdtype = referralType(report.Results[i])
+		}
+	}
+	for _, ex := range report.Exchanges {
+		if len(ex.Query.Question) == 0 {
+			continue
+		}
+		q := ex.Query.Question[0]
+		obj := w.object(q.Name)
+		obj.addExchange(ex)
+		if ex.Response != nil {
+			w.addStubs(ex.Response)
+		}
+	}
+	// 不是区顶点的名字挂在最近的上级区下面
+	for name, obj := range w.objects {
+		if obj.Parent != "" || obj.Stub || name == "." || obj.AuthNSIPMapping != nil {
+			continue
+		}
+		for parent := name; parent != "."; {
+			parent = dnsvizKey(parentName(parent))
+			if p := w.objects[parent]; p != nil && p.AuthNSIPMapping != nil {
+				obj.Parent = parent
+				break
+			}
+		}
+	}
+}
+
+// referralType 是向父区发出、得到转介的查询类型；-qmin 时是 NS
+func referralType(res trace.Result) string {
+	for _, auth := range res.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Qtype != "" {
+				return qr.Qtype
+			}
+		}
+	}
+	return "NS"
+}
+
+func parentName(name string) string {
+	if i, end := dns.NextLabel(name, 0); !end {
+		return name[i:]
+	}
+	return "."
+}
+
+// addStubs 为应答里的 CNAME 目标和签名者补上 stub 名字，DNSViz 读取文档时会按名字找它们
+func (w *dnsvizWriter) addStubs(r *dns.Msg) {
+	for _, rr := range slices.Concat(r.Answer, r.Ns) {
+		var name string
+		switch rec := rr.(type) {
+		case *dns.CNAME:
+			name = rec.Target
+		case *dns.RRSIG:
+			name = rec.SignerName
+		default:
+			continue
+		}
+		if _, ok := w.objects[dnsvizKey(name)]; !ok {
+			obj := w.object(name)
+			obj.Stub = true
+		}
+	}
+}
+
+func (w *dnsvizWriter) object(name string) *dnsvizName {
+	key := dnsvizKey(name)
+	obj := w.objects[key]
+	if obj == nil {
+		obj = &dnsvizName{Type: "authoritative", ClientsIPv4: []string{}, ClientsIPv6: []string{}, Queries: []*dnsvizQuery{}}
+		w.objects[key] = obj
+	}
+	if obj.Stub {
+		// 后来又有了自己的查询，不再是 stub
+		obj.Stub = false
+	}
+	return obj
+}
+
+func (obj *dnsvizName) addExchange(ex trace.Exchange) {
+	q := ex.Query.Question[0]
+	opts := dnsvizQueryOptions(ex)
+	key := strings.Join([]string{dnsvizKey(q.Name), dns.Class(q.Qclass).String(), dns.Type(q.Qtype).String()}, " ")
+	if raw, err := json.Marshal(opts); err == nil {
+		key += " " + string(raw)
+	}
+	var query *dnsvizQuery
+	for _, existing := range obj.Queries {
+		if existing.key == key {
+			query = existing
+			break
+		}
+	}
+	if query == nil {
+		query = &dnsvizQuery{
+			QName:     dnsvizKey(q.Name),
+			QClass:    dns.Class(q.Qclass).String(),
+			QType:     dns.Type(q.Qtype).String(),
+			Options:   opts,
+			Responses: make(map[string]map[string]dnsvizResponse),
+			key:       key,
+		}
+		obj.Queries = append(obj.Queries, query)
+	}
+	client := dnsvizClient(ex.Server)
+	if query.Responses[ex.Server] == nil {
+		query.Responses[ex.Server] = make(map[string]dnsvizResponse)
+	}
+	// 同一个查询重复发给同一台服务器（-verify、-check-tcp 等）时只保留第一次的应答
+	if _, ok := query.Responses[ex.Server][client]; !ok {
+		query.Responses[ex.Server][client] = dnsvizResponseFor(ex)
+	}
+	if net.ParseIP(client).To4() != nil {
+		if !slices.Contains(obj.ClientsIPv4, client) {
+			obj.ClientsIPv4 = append(obj.ClientsIPv4, client)
+		}
+	} else if !slices.Contains(obj.ClientsIPv6, client) {
+		obj.ClientsIPv6 = append(obj.ClientsIPv6, client)
+	}
+	if obj.start.IsZero() || ex.Start.Before(obj.start) {
+		obj.start = ex.Start
+	}
+	if end := ex.Start.Add(ex.RTT); end.After(obj.end) {
+		obj.end = end
+	}
+}
+
+func dnsvizQueryOptions(ex trace.Exchange) dnsvizOptions {
+	m := ex.Query
+	opts := dnsvizOptions{Flags: headerFlags(m.MsgHdr), EDNSVersion: -1, TCP: ex.Protocol == "tcp"}
+	if opt := m.IsEdns0(); opt != nil {
+		size, flags := opt.UDPSize(), int(opt.Hdr.Ttl&0xffff)
+		opts.EDNSVersion = int(opt.Version())
+		opts.EDNSMaxUDPPayload, opts.EDNSFlags = &size, &flags
+		opts.EDNSOptions = ednsOptionsWire(opt)
+	}
+	return opts
+}
+
+// headerFlags 是报文头第二个 16 位字段去掉 rcode 的部分，和 dnspython 的 flags 相同
+func headerFlags(h dns.MsgHdr) int {
+	flags := 0
+	for _, f := range []struct {
+		set bool
+		bit int
+	}{
+		{h.Response, 0x8000}, {h.Authoritative, 0x0400}, {h.Truncated, 0x0200}, {h.RecursionDesired, 0x0100},
+		{h.RecursionAvailable, 0x0080}, {h.Zero, 0x0040}, {h.AuthenticatedData, 0x0020}, {h.CheckingDisabled, 0x0010},
+	} {
+		if f.set {
+			flags |= f.bit
+		}
+	}
+	return flags | (h.Opcode&0xf)<<11
+}
+
+// ednsOptionsWire 按线上格式取出 OPT 里的每个选项（类型、长度、数据），各自 base64 编码
+func ednsOptionsWire(opt *dns.OPT) []string {
+	m := new(dns.Msg)
+	m.Extra = []dns.RR{opt}
+	wire, err := m.Pack()
+	// 报文头 12 字节，OPT 的名字、类型、类、TTL 和 RDLENGTH 共 11 字节，后面就是选项
+	if err != nil || len(wire) < 23 {
+		return nil
+	}
+	rdata := wire[23:]
+	var options []string
+	for len(rdata) >= 4 {
+		n := 4 + int(binary.BigEndian.Uint16(rdata[2:4]))
+		if n > len(rdata) {
+			break
+		}
+		options = append(options, base64.StdEncoding.EncodeToString(rdata[:n]))
+		rdata = rdata[n:]
+	}
+	return options
+}
+
+func dnsvizResponseFor(ex trace.Exchange) dnsvizResponse {
+	resp := dnsvizResponse{TimeElapsed: ex.RTT.Milliseconds(), History: []any{}}
+	if ex.Response == nil {
+		switch {
+		case ex.TimedOut:
+			resp.Error = "TIMEOUT"
+		case strings.Contains(ex.Error, "connection refused"):
+			resp.Error, resp.Errno = "NETWORK_ERROR", "ECONNREFUSED"
+		case strings.Contains(ex.Error, "unreachable"):
+			resp.Error, resp.Errno = "NETWORK_ERROR", "EHOSTUNREACH"
+		case strings.Contains(ex.Error, "dns: "):
+			resp.Error = "FORMERR"
+		default:
+			resp.Error = "NETWORK_ERROR"
+		}
+		return resp
+	}
+	wire, err := ex.Response.Pack()
+	if err != nil {
+		resp.Error = "FORMERR"
+		return resp
+	}
+	msg := base64.StdEncoding.EncodeToString(wire)
+	resp.Message, resp.MsgSize = &msg, len(wire)
+	return resp
+}
+
+// dnsvizClient 是发出查询的本地地址；没有 -source/-source6 时不知道内核选的地址，写未指定地址
+func dnsvizClient(server string) string {
+	v4 := net.ParseIP(server).To4() != nil
+	src := source6Flag
+	if v4 {
+		src = sourceFlag
+	}
+	if host, _, err := net.SplitHostPort(src); err == nil {
+		src = host
+	}
+	if ip := net.ParseIP(src); ip != nil && (ip.To4() != nil) == v4 {
+		return ip.String()
+	}
+	if v4 {
+		return "0.0.0.0"
+	}
+	return "::"
+}
+
+func dnsvizKey(name string) string {
+	return dns.CanonicalName(name)
+}
+
+// write 把文档写到 out：每个名字一项，加上 _meta._dnsviz. 列出追踪的名字；
+// 每个名字下的查询按查询名、类型和选项排序，并发的检查不会让同一次追踪的输出顺序不同
+func (w *dnsvizWriter) write(out io.Writer) {
+	doc := make(map[string]any, len(w.objects)+1)
+	now := time.Now().UTC()
+	for name, obj := range w.objects {
+		start, end := obj.start, obj.end
+		if start.IsZero() {
+			start, end = now, now
+		}
+		obj.AnalysisStart, obj.AnalysisEnd = start.UTC().Format(dnsvizTime), end.UTC().Format(dnsvizTime)
+		slices.SortFunc(obj.Queries, func(a, b *dnsvizQuery) int { return cmp.Compare(a.key, b.key) })
+		slices.SortFunc(obj.ClientsIPv4, cmp.Compare)
+		slices.SortFunc(obj.ClientsIPv6, cmp.Compare)
+		for host := range obj.AuthNSIPMapping {
+			slices.Sort(obj.AuthNSIPMapping[host])
+		}
+		doc[name] = obj
+	}
+	doc["_meta._dnsviz."] = map[string]any{"version": dnsvizVersion, "names": w.names}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		logger.Error("json encode failed", "error", err)
+	}
+}
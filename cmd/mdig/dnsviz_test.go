@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// vizZone 是 -o dnsviz 测试用的一个权威区；key 不为 nil 时区是签名的，应答带 RRSIG
+type vizZone struct {
+	apex    string
+	records []dns.RR
+	key     *dns.DNSKEY
+	priv    ed25519.PrivateKey
+}
+
+// vizNet 是内存里的假层级：根委派 test.，test. 委派签名的 signed.test. 和不签名的 plain.test.，
+// 127.0.53.53 是递归服务器。签名用固定种子的 Ed25519 密钥和固定的有效期，输出每次都相同
+type vizNet map[string]*vizZone
+
+func newVizNet(t *testing.T) vizNet {
+	t.Helper()
+	priv := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{0x53}, ed25519.SeedSize))
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "signed.test.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ED25519,
+		PublicKey: base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+	}
+	zone := func(apex, data string) *vizZone {
+		z := &vizZone{apex: apex}
+		zp := dns.NewZoneParser(strings.NewReader(data), apex, "")
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			z.records = append(z.records, rr)
+		}
+		if err := zp.Err(); err != nil {
+			t.Fatalf("zone %s: %v", apex, err)
+		}
+		return z
+	}
+	signed := zone("signed.test.", `
+signed.test. 3600 IN SOA ns.signed.test. hostmaster.signed.test. 1 7200 3600 1209600 300
+signed.test. 3600 IN NS ns.signed.test.
+ns.signed.test. 3600 IN A 127.0.53.3
+www.signed.test. 300 IN A 192.0.2.1`)
+	signed.records = append(signed.records, key)
+	signed.key, signed.priv = key, priv
+	tld := zone("test.", `
+test. 86400 IN SOA ns.nic.test. hostmaster.nic.test. 1 7200 3600 1209600 300
+test. 86400 IN NS ns.nic.test.
+ns.nic.test. 86400 IN A 127.0.53.2
+signed.test. 3600 IN NS ns.signed.test.
+ns.signed.test. 3600 IN A 127.0.53.3
+plain.test. 3600 IN NS ns.plain.test.
+ns.plain.test. 3600 IN A 127.0.53.4`)
+	tld.records = append(tld.records, key.ToDS(dns.SHA256))
+	n := vizNet{
+		"127.0.53.1": zone(".", `
+. 86400 IN SOA a.root.test. hostmaster.root.test. 1 7200 3600 1209600 300
+. 86400 IN NS a.root.test.
+test. 86400 IN NS ns.nic.test.
+ns.nic.test. 86400 IN A 127.0.53.2`),
+		"127.0.53.2": tld,
+		"127.0.53.3": signed,
+		"127.0.53.4": zone("plain.test.", `
+plain.test. 3600 IN SOA ns.plain.test. hostmaster.plain.test. 1 7200 3600 1209600 300
+plain.test. 3600 IN NS ns.plain.test.
+ns.plain.test. 3600 IN A 127.0.53.4
+www.plain.test. 300 IN A 192.0.2.2`),
+	}
+	all := &vizZone{apex: "."}
+	for _, z := range n {
+		all.records = append(all.records, z.records...)
+	}
+	n["127.0.53.53"] = all
+	return n
+}
+
+func (n vizNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	z := n[host]
+	if z == nil || len(m.Question) != 1 {
+		return nil, 0, &net.OpError{Op: "read", Net: network, Err: os.ErrDeadlineExceeded}
+	}
+	r := new(dns.Msg)
+	r.SetReply(m)
+	do := m.IsEdns0() != nil && m.IsEdns0().Do()
+	if opt := m.IsEdns0(); opt != nil {
+		r.SetEdns0(1232, do)
+	}
+	if host == "127.0.53.53" {
+		r.RecursionAvailable = true
+		r.Answer = z.lookup(m.Question[0].Name, m.Question[0].Qtype)
+		return r, time.Millisecond, nil
+	}
+	z.answer(r, m.Question[0], do)
+	return r, time.Millisecond, nil
+}
+
+func (z *vizZone) lookup(name string, qtype uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range z.records {
+		if strings.EqualFold(rr.Header().Name, name) && rr.Header().Rrtype == qtype {
+			out = append(out, dns.Copy(rr))
+		}
+	}
+	return out
+}
+
+// answer 按区数据给出转介、应答、NODATA 或 NXDOMAIN；签名的区在 DO 时给每个 RRset 加上 RRSIG
+func (z *vizZone) answer(r *dns.Msg, q dns.Question, do bool) {
+	qname := dns.CanonicalName(q.Name)
+	for cut := qname; dns.IsSubDomain(z.apex, cut) && cut != z.apex; cut = parentName(cut) {
+		ns := z.lookup(cut, dns.TypeNS)
+		if len(ns) == 0 {
+			continue
+		}
+		if q.Qtype == dns.TypeDS && cut == qname {
+			r.Authoritative = true
+			r.Answer = z.signed(z.lookup(cut, dns.TypeDS), do)
+			return
+		}
+		r.Ns = append(ns, z.signed(z.lookup(cut, dns.TypeDS), do)...)
+		for _, rr := range ns {
+			r.Extra = append(r.Extra, z.lookup(rr.(*dns.NS).Ns, dns.TypeA)...)
+		}
+		return
+	}
+	r.Authoritative = true
+	if r.Answer = z.signed(z.lookup(qname, q.Qtype), do); len(r.Answer) > 0 {
+		return
+	}
+	exists := false
+	for _, rr := range z.records {
+		exists = exists || dns.IsSubDomain(qname, dns.CanonicalName(rr.Header().Name))
+	}
+	if !exists {
+		r.Rcode = dns.RcodeNameError
+	}
+	r.Ns = z.signed(z.lookup(z.apex, dns.TypeSOA), do)
+}
+
+func (z *vizZone) signed(rrset []dns.RR, do bool) []dns.RR {
+	// DS 由父区签名，这里只有 signed.test. 自己签名
+	if z.key == nil || !do || len(rrset) == 0 || rrset[0].Header().Rrtype == dns.TypeDS {
+		return rrset
+	}
+	h := rrset[0].Header()
+	sig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: h.Ttl},
+		TypeCovered: h.Rrtype,
+		Algorithm:   z.key.Algorithm,
+		Labels:      uint8(dns.CountLabel(h.Name)),
+		OrigTtl:     h.Ttl,
+		Inception:   1735689600, // 2025-01-01
+		Expiration:  4102444800, // 2100-01-01
+		KeyTag:      z.key.KeyTag(),
+		SignerName:  z.key.Hdr.Name,
+	}
+	if err := sig.Sign(z.priv, rrset); err != nil {
+		panic(err)
+	}
+	return append(rrset, sig)
+}
+
+// normalizeDNSViz 去掉文档里每次运行都不同的部分：分析时间、耗时和报文 ID
+func normalizeDNSViz(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	var doc map[string]map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("-o dnsviz is not JSON: %v\n%s", err, raw)
+	}
+	for name, obj := range doc {
+		if name == "_meta._dnsviz." {
+			continue
+		}
+		obj["analysis_start"], obj["analysis_end"] = "", ""
+		queries, _ := obj["queries"].([]any)
+		for _, q := range queries {
+			for _, clients := range q.(map[string]any)["responses"].(map[string]any) {
+				for _, resp := range clients.(map[string]any) {
+					resp := resp.(map[string]any)
+					resp["time_elapsed"] = 0
+					msg, ok := resp["message"].(string)
+					if !ok {
+						continue
+					}
+					wire, err := base64.StdEncoding.DecodeString(msg)
+					if err != nil || len(wire) < 2 {
+						t.Fatalf("bad message %q", msg)
+					}
+					wire[0], wire[1] = 0, 0
+					resp["message"] = base64.StdEncoding.EncodeToString(wire)
+				}
+			}
+		}
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(out, '\n')
+}
+
+// -o dnsviz 的输出和 testdata 里的文件逐字节相同；用 go test -run DNSViz -update 重新生成
+func TestDNSVizGolden(t *testing.T) {
+	n := newVizNet(t)
+	hints := filepath.Join(t.TempDir(), "named.root")
+	if err := os.WriteFile(hints, []byte(". 3600000 IN NS a.root.test.\na.root.test. 3600000 IN A 127.0.53.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		domain string
+		golden string
+	}{
+		{"www.signed.test", "dnsviz-signed.json"},
+		{"www.plain.test", "dnsviz-unsigned.json"},
+	} {
+		t.Run(tt.domain, func(t *testing.T) {
+			tr, err := trace.New(trace.Options{
+				HintsFile:      hints,
+				Resolver:       "127.0.53.53",
+				AddressFamily:  "4",
+				Timeout:        time.Second,
+				NoDNS64Check:   true,
+				Exchanger:      n,
+				QueryType:      "a",
+				DNSSEC:         true,
+				DelegationKeys: true,
+				KeepMessages:   true,
+				QMin:           true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tr.Close()
+			report, status := tr.Run(context.Background(), tt.domain, "a", nil)
+			if status != trace.StatusAnswer {
+				t.Fatalf("status = %v, want %v", status, trace.StatusAnswer)
+			}
+			w := newDNSVizWriter()
+			w.add(report)
+			var buf bytes.Buffer
+			w.write(&buf)
+			got := normalizeDNSViz(t, buf.Bytes())
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.MkdirAll("testdata", 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("-o dnsviz differs from %s (rerun with -update to accept):\n%s", path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatScope(subnet *dns.EDNS0_SUBNET, scope *uint8) string {
+	source := fmt.Sprintf("%s/%d", subnet.Address, subnet.SourceNetmask)
+	if scope == nil {
+		return source + ", not echoed by server"
+	}
+	return fmt.Sprintf("%s, scope /%d", source, *scope)
+}
+
+// readSubnetList 解析 -ecs-probe 的值：带逗号或者本身是一个前缀时是前缀列表，否则是文件名，逐行读取前缀（忽略空行和 # 注释）。
+// 按写法而不是按文件是否存在来区分，写错的文件名报告打不开，而不是被当成一个无效的前缀
+func readSubnetList(value string) ([]string, error) {
+	var prefixes []string
+	if _, err := trace.ParseSubnet(value); err == nil || strings.Contains(value, ",") {
+		for _, p := range strings.Split(value, ",") {
+			prefixes = append(prefixes, strings.TrimSpace(p))
+		}
+		return prefixes, nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		prefixes = append(prefixes, strings.Fields(line)...)
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("%s contains no prefixes", value)
+	}
+	return prefixes, nil
+}
+
+// ecsScopes 列出一组子网收到的不同 scope，没有回显 ECS 选项的写作 "-"
+func ecsScopes(g trace.ECSGroup) string {
+	var scopes []string
+	for _, s := range g.Subnets {
+		scope := "-"
+		if s.Scope != nil {
+			scope = fmt.Sprintf("/%d", *s.Scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, ", ")
+}
+
+func ecsSubnets(g trace.ECSGroup) string {
+	subnets := make([]string, len(g.Subnets))
+	for i, s := range g.Subnets {
+		subnets[i] = s.Subnet
+	}
+	return strings.Join(subnets, ", ")
+}
+
+func ecsAnswer(g trace.ECSGroup) string {
+	if g.Error != "" {
+		return "! " + g.Error
+	}
+	return g.Answer
+}
+
+// ecsIgnored 是忽略 ECS 的服务器的一行说明，没有收到应答的子网单独注明
+func ecsIgnored(c *trace.ECSProbe, s trace.ECSServer) string {
+	var answer string
+	failed := 0
+	for _, g := range s.Groups {
+		if g.Error != "" {
+			failed += len(g.Subnets)
+		} else {
+			answer = g.Answer
+		}
+	}
+	note := fmt.Sprintf("ignores ECS: %s for all %d subnets", answer, len(c.Subnets)-failed)
+	if failed > 0 {
+		note += fmt.Sprintf(" (%d without answer)", failed)
+	}
+	return note
+}
+
+func printECSProbe(c *trace.ECSProbe) {
+	fmt.Printf("ECS probe for %s %s (%d subnets):\n", c.Name, c.Qtype, len(c.Subnets))
+	if len(c.Servers) == 0 {
+		fmt.Println("  no servers to probe")
+		return
+	}
+	for _, s := range c.Servers {
+		if s.IgnoresECS {
+			fmt.Printf("  %s (%s) %s\n", s.Hostname, s.IP, ecsIgnored(c, s))
+			continue
+		}
+		fmt.Printf("  %s (%s):\n", s.Hostname, s.IP)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "    SUBNETS\tSCOPE\tANSWER")
+		for _, g := range s.Groups {
+			fmt.Fprintf(w, "    %s\t%s\t%s\n", ecsSubnets(g), ecsScopes(g), ecsAnswer(g))
+		}
+		w.Flush()
+	}
+}
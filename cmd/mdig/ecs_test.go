@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// -ecs-probe 的值按写法区分前缀列表和文件：带逗号或者是前缀的是列表，其他的是文件，不存在的文件报告打不开
+func TestReadSubnetList(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "subnets.txt")
+	if err := os.WriteFile(file, []byte("# europe\n81.2.69.0/24\n\n2001:db8::/48 # lab\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr string
+	}{
+		{"10.0.0.0/8", []string{"10.0.0.0/8"}, ""},
+		{"1.0.0.0/24, 2001:db8::/48", []string{"1.0.0.0/24", "2001:db8::/48"}, ""},
+		{"1.0.0.0/24,bogus", []string{"1.0.0.0/24", "bogus"}, ""},
+		{file, []string{"81.2.69.0/24", "2001:db8::/48"}, ""},
+		{filepath.Join(dir, "missing.txt"), nil, "no such file"},
+	}
+	for _, tt := range tests {
+		got, err := readSubnetList(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readSubnetList(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("readSubnetList(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func ednsCell(p trace.EDNSProbe) string {
+	switch {
+	case p.Pass:
+		return "ok"
+	case p.NoResponse:
+		return "timeout"
+	}
+	return "FAIL"
+}
+
+// ednsFailures 每个没有通过的测试一行说明
+func ednsFailures(c *trace.EDNSCheck) []string {
+	var lines []string
+	for _, s := range c.Servers {
+		for _, p := range s.Probes {
+			if !p.Pass {
+				lines = append(lines, fmt.Sprintf("%s (%s) %s: %s", s.Hostname, s.IP, p.Name, p.Problem))
+			}
+		}
+	}
+	return lines
+}
+
+func printEDNSCheck(c *trace.EDNSCheck) {
+	fmt.Printf("EDNS compliance for %s:\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "  SERVER\tIP\t%s\n", strings.ToUpper(strings.Join(trace.EDNSProbeNames(), "\t")))
+	for _, s := range c.Servers {
+		cells := make([]string, len(s.Probes))
+		for i, p := range s.Probes {
+			cells[i] = ednsCell(p)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", s.Hostname, s.IP, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	for _, line := range ednsFailures(c) {
+		fmt.Printf("  ! %s\n", line)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// events 为 nil 时不产生任何事件
+var events chan trace.Event
+
+// startEventWriter 启动唯一的写 goroutine，保证每个事件完整地写成一行
+func startEventWriter(w io.Writer) (stop func()) {
+	events = make(chan trace.Event, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(w)
+		for ev := range events {
+			enc.Encode(ev)
+		}
+	}()
+	return func() {
+		close(events)
+		<-done
+		events = nil
+	}
+}
+
+// writeEvent 把事件放进 startEventWriter 的队列，没有启动写 goroutine 时丢弃
+func writeEvent(ev trace.Event) {
+	if events == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	events <- ev
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// parseExpectations 把 -expect-addr、-expect-ns 和 -expect-rcode 换成断言
+func parseExpectations(addrs, ns []string, rcode string) (trace.Expectations, error) {
+	var e trace.Expectations
+	for _, s := range addrs {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return e, fmt.Errorf("invalid -expect-addr %q", s)
+		}
+		e.Addrs = append(e.Addrs, ip)
+	}
+	for _, s := range ns {
+		if _, ok := dns.IsDomainName(s); !ok {
+			return e, fmt.Errorf("invalid -expect-ns %q", s)
+		}
+		e.NS = append(e.NS, s)
+	}
+	if rcode != "" {
+		if _, ok := dns.StringToRcode[strings.ToUpper(rcode)]; !ok {
+			return e, fmt.Errorf("invalid -expect-rcode %q, use a name such as noerror, nxdomain or servfail", rcode)
+		}
+		e.Rcode = rcode
+	}
+	return e, nil
+}
+
+// printExpect 输出断言结果：全部通过时是一行 OK，否则逐项列出没有通过的断言、期望的值和实际看到的值
+func printExpect(r *trace.ExpectResult) {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		var parts []string
+		for _, a := range r.Assertions {
+			parts = append(parts, a.Kind+" "+a.Expected)
+		}
+		fmt.Printf("EXPECT OK: %s %s\n", r.Name, strings.Join(parts, ", "))
+		return
+	}
+	fmt.Printf("EXPECT FAILED: %s %d of %d assertions failed\n", r.Name, len(failed), len(r.Assertions))
+	for _, a := range failed {
+		fmt.Printf("  %s %s: expected %s, observed %s\n", a.Kind, a.Expected, expectedNote(a), a.Observed)
+	}
+}
+
+// expectedNote 说明一项断言期望看到什么
+func expectedNote(a trace.Assertion) string {
+	switch a.Kind {
+	case trace.ExpectAddr:
+		return "in the answer"
+	case trace.ExpectNS:
+		return "in the delegation"
+	}
+	return "from every answering server"
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseExpectations(t *testing.T) {
+	e, err := parseExpectations([]string{"192.0.2.1", "2001:db8::1"}, []string{"ns1.example.com"}, "nxdomain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(e.Addrs, []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}, net.IP.Equal) {
+		t.Errorf("addrs = %v", e.Addrs)
+	}
+	if !slices.Equal(e.NS, []string{"ns1.example.com"}) || e.Rcode != "nxdomain" {
+		t.Errorf("ns = %v, rcode = %q", e.NS, e.Rcode)
+	}
+	if e, err := parseExpectations(nil, nil, ""); err != nil || !e.Empty() {
+		t.Errorf("no flags: %+v, %v", e, err)
+	}
+	for _, tt := range []struct {
+		addrs, ns []string
+		rcode     string
+		want      string
+	}{
+		{addrs: []string{"192.0.2.300"}, want: `invalid -expect-addr "192.0.2.300"`},
+		{ns: []string{"bad..name"}, want: `invalid -expect-ns "bad..name"`},
+		{rcode: "nosuch", want: `invalid -expect-rcode "nosuch"`},
+	} {
+		if _, err := parseExpectations(tt.addrs, tt.ns, tt.rcode); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("error = %v, want %s", err, tt.want)
+		}
+	}
+}
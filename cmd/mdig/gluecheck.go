@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// glueMismatches 返回所有胶水不一致的地址，用于追踪结束后的汇总
+func glueMismatches(c *trace.GlueCheck) []string {
+	var out []string
+	for _, srv := range c.Servers {
+		out = append(out, trace.GlueMismatchesFor(srv)...)
+	}
+	return out
+}
+
+func printGlueCheck(c *trace.GlueCheck) {
+	fmt.Printf("  ├─ Glue check for %s:\n", c.Zone)
+	for _, srv := range c.Servers {
+		for _, a := range srv.Addresses {
+			fmt.Printf("  │   ├─ %s: %s\n", srv.Name, trace.FormatGlueAddress(a))
+		}
+		if len(srv.Addresses) == 0 && srv.Error == "" {
+			fmt.Printf("  │   ├─ %s: no glue and no addresses at the child\n", srv.Name)
+		}
+		if srv.Error != "" {
+			fmt.Printf("  │   ! %s: %s\n", srv.Name, srv.Error)
+		}
+	}
+}
+
+// printDelegationGlue 输出部分有胶水或没有胶水的委派：一行结论，然后是每个没有胶水的 NS 查询地址花了多少查询、是否失败
+func printDelegationGlue(g trace.DelegationGlue) {
+	fmt.Printf("! %s\n", g)
+	for _, ns := range g.Unglued {
+		note := fmt.Sprintf("%d queries", ns.Queries)
+		if ns.Queries == 1 {
+			note = "1 query"
+		}
+		if ns.Cached {
+			note += ", cached"
+		}
+		if ns.InZone {
+			note += ", in-zone"
+		}
+		if ns.Error != "" {
+			fmt.Printf("    %s: looked up via %s (%s), failed: %s\n", ns.Hostname, ns.Source, note, ns.Error)
+			continue
+		}
+		fmt.Printf("    %s: looked up via %s (%s)\n", ns.Hostname, ns.Source, note)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// healthZone 是问题涉及的区，根区写成 root，和整个追踪有关的写成 -
+func healthZone(f trace.Finding) string {
+	switch f.Zone {
+	case "":
+		return "-"
+	case ".":
+		return "root"
+	}
+	return f.Zone
+}
+
+func printHealth(h *trace.Health) {
+	if len(h.Findings) == 0 {
+		fmt.Printf("Health: %s (score %d), no problems found\n", h.Status, h.Score)
+		return
+	}
+	fmt.Printf("Health: %s (score %d)\n", h.Status, h.Score)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range h.Findings {
+		mark := " "
+		if f.Severity != trace.SeverityInfo {
+			mark = "!"
+		}
+		fmt.Fprintf(w, "  %s %s\t%s\t%s\t%s\n", mark, f.Severity, f.Check, healthZone(f), f.Message)
+	}
+	w.Flush()
+}
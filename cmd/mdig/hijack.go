@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func hijackVerdict(c *trace.HijackCheck) string {
+	if n := len(c.Tampered()); n > 0 {
+		return fmt.Sprintf("%d of %d resolver answers differ from the authoritative answer, possible DNS tampering", n, len(c.Results))
+	}
+	return fmt.Sprintf("no tampering: %d resolver answers checked", len(c.Results))
+}
+
+func printHijackCheck(c *trace.HijackCheck) {
+	fmt.Printf("Hijack check for %s:\n", c.Name)
+	if c.Error != "" {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "    RESOLVER\tTYPE\tRCODE\tVERDICT\tANSWERS\t")
+	for _, q := range slices.Sorted(maps.Keys(c.Authoritative)) {
+		auth := c.Authoritative[q]
+		fmt.Fprintf(w, "    authoritative\t%s\t%s\t-\t%s\t\n", auth.Qtype, auth.Rcode, formatResolverAnswers(*auth))
+	}
+	for _, r := range c.Results {
+		mark, rcode := " ", "-"
+		if r.Verdict != trace.HijackMatch && r.Verdict != trace.HijackError {
+			mark = "!"
+		}
+		if r.Error == "" {
+			rcode = r.Rcode
+		}
+		fmt.Fprintf(w, "  %s %s\t%s\t%s\t%s\t%s\t\n", mark, r.Resolver, r.Qtype, rcode, r.Verdict, formatResolverAnswers(r.ResolverAnswer))
+	}
+	w.Flush()
+	for _, r := range c.Tampered() {
+		fmt.Printf("  ! %s %s\n", r.Resolver, c.Describe(r))
+	}
+	fmt.Printf("  %s\n", hijackVerdict(c))
+}
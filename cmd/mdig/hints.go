@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// rootHintsURL 是 IANA 发布的根提示文件
+const rootHintsURL = "https://www.internic.net/domain/named.root"
+
+// defaultHintsPath 是 -hints-update 没有指定 -hints 时缓存根提示文件的位置
+func defaultHintsPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mdig", "named.root"), nil
+}
+
+// hintsPath 返回追踪使用的根提示文件：-hints 优先，没有指定时使用 -hints-update 下载到默认位置的文件，
+// 都没有时返回空字符串，使用内置的根服务器
+func hintsPath(explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	path, err := defaultHintsPath()
+	if err != nil {
+		return ""
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return path
+}
+
+// updateRootHints 从 IANA 下载最新的根提示文件，解析通过后原子地写入 path
+func updateRootHints(path string) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(rootHintsURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: HTTP %d %s", rootHintsURL, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	servers, addrs, err := trace.ParseRootHints(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", rootHintsURL, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".named.root-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	v4, v6 := 0, 0
+	for _, list := range addrs {
+		for _, a := range list {
+			if net.ParseIP(a).To4() != nil {
+				v4++
+			} else {
+				v6++
+			}
+		}
+	}
+	fmt.Printf("Saved root hints to %s: %d servers, %d IPv4 and %d IPv6 addresses\n", path, len(servers), v4, v6)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 没有 -hints 时使用 -hints-update 保存在默认位置的文件，文件不存在时使用内置的根服务器
+func TestHintsPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	cached, err := defaultHintsPath()
+	if err != nil {
+		t.Skipf("no user cache directory: %v", err)
+	}
+	if got := hintsPath(""); got != "" {
+		t.Errorf("hintsPath without a saved file = %q, want the built-in roots", got)
+	}
+	if err := os.MkdirAll(filepath.Dir(cached), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cached, []byte(". 3600000 IN NS a.root.test.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := hintsPath(""); got != cached {
+		t.Errorf("hintsPath with a saved file = %q, want %q", got, cached)
+	}
+	if got := hintsPath("/etc/mdig/named.root"); got != "/etc/mdig/named.root" {
+		t.Errorf("hintsPath with -hints = %q, want the -hints file", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func v6Column(s trace.V6Server) string {
+	switch s.Verdict {
+	case trace.V6Reachable:
+		return "v6-capable and reachable"
+	case trace.V6Unreachable:
+		return "! has AAAA but unreachable over IPv6"
+	case trace.V6Only4:
+		return "! v4-only (no AAAA)"
+	}
+	return "! AAAA lookup failed: " + s.Error
+}
+
+// v6Addresses 列出每个 IPv6 地址的查询结果
+func v6Addresses(s trace.V6Server) string {
+	var parts []string
+	for _, a := range s.Addresses {
+		if a.Reachable {
+			parts = append(parts, fmt.Sprintf("%s ok %.1fms", a.IP, a.RTTMs))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s", a.IP, a.Error))
+		}
+	}
+	for _, ip := range s.DNS64 {
+		parts = append(parts, ip+" DNS64-synthesized, ignored")
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func v6Verdict(c *trace.V6Check) string {
+	if c.Resolvable {
+		return "resolvable from an IPv6-only client: yes"
+	}
+	return "resolvable from an IPv6-only client: no"
+}
+
+func printV6Check(c *trace.V6Check) {
+	fmt.Printf("IPv6 reachability for %s:\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIPV6\tVERDICT")
+	for _, s := range c.Servers {
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", s.Hostname, v6Addresses(s), v6Column(s))
+	}
+	w.Flush()
+	mark := " "
+	if !c.Resolvable {
+		mark = "!"
+	}
+	fmt.Printf("  %s %s\n", mark, v6Verdict(c))
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// lameSummary 返回形如 "2 of 4 delegated nameservers are lame for example.com." 的提示，没有 lame 服务器时为空
+func lameSummary(result trace.Result) string {
+	if len(result.Lame) == 0 {
+		return ""
+	}
+	verb := "are"
+	if len(result.Lame) == 1 {
+		verb = "is"
+	}
+	if result.Zone == "" {
+		// -servers 时不知道服务器负责哪个区
+		return fmt.Sprintf("%d of %d listed nameservers %s lame (%s)",
+			len(result.Lame), len(result.Authorities), verb, strings.Join(result.Lame, ", "))
+	}
+	return fmt.Sprintf("%d of %d delegated nameservers %s lame for %s (%s)",
+		len(result.Lame), len(result.Authorities), verb, result.Zone, strings.Join(result.Lame, ", "))
+}
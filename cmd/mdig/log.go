@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+)
+
+// logger 把 Tracer 和命令行自己的日志写到标准错误，标准输出只留给 -o 选定的格式；
+// 在 run 里按 -loglevel 重新创建，之前的日志用默认的 warn 级别
+var logger = newLogger(slog.LevelWarn)
+
+// logWriter 先擦掉终端上的进度行再写，slog 每条日志只调用一次 Write
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (n int, err error) {
+	progress.hide(func() { n, err = os.Stderr.Write(p) })
+	return n, err
+}
+
+func newLogger(level slog.Level) *slog.Logger {
+	return slog.New(slog.NewTextHandler(logWriter{}, &slog.HandlerOptions{Level: level}))
+}
+
+// parseLogLevel 解析 -loglevel：error、warn、info 或 debug
+func parseLogLevel(s string) (slog.Level, error) {
+	switch s {
+	case "error":
+		return slog.LevelError, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	}
+	return 0, errors.New("-loglevel must be error, warn, info or debug")
+}
@@ -0,0 +1,1180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+const (
+	exitOK = iota
+	exitUsage
+	exitNXDomain
+	exitNoData
+	exitNetworkError
+	exitDiffMismatch
+	exitBogus
+	exitAborted
+	exitServerFailure
+	exitBrokenDelegation
+	exitInconsistent
+	exitSlow
+	exitChanged
+	exitHijack
+	exitExpect
+)
+
+var (
+	dnsServer        string
+	resolverOrigin   string
+	dnstype          string
+	iptype           string
+	output           string
+	summary          bool
+	diffMode         bool
+	rankMode         bool
+	fastMode         bool
+	treeMode         bool
+	healthMode       bool
+	qmin             bool
+	reverse          bool
+	showDS           bool
+	checkDS          bool
+	tlsaPort         string
+	domainFile       string
+	configFile       string
+	showConfigMode   bool
+	saveFile         string
+	diffAgainst      string
+	hintsFile        string
+	rootsFlag        string
+	fromFlag         string
+	serversFlag      string
+	watchInterval    time.Duration
+	logLevel         string
+	listenAddr       string
+	serveAddr        string
+	serveMax         int
+	tuiMode          bool
+	compareMode      bool
+	servfailFailover bool
+	checkSerial      bool
+	checkAXFR        bool
+	checkRecursion   bool
+	checkEDNS        bool
+	checkTCP         bool
+	checkV6          bool
+	checkDiversity   bool
+	noASN            bool
+	checkRFC2182     bool
+	checkHijack      bool
+	checkWildcard    bool
+	checkTTL         bool
+	propagation      bool
+	hintsUpdate      bool
+	cacheDir         string
+	noCache          bool
+	cacheFlush       bool
+	identify         bool
+	ptrNames         bool
+	bufsize          uint
+	dnssec           bool
+	ignoreTC         bool
+	noTCPRecovery    bool
+	noHappyEyeballs  bool
+	forceTCP         bool
+	useCookie        bool
+	nsid             bool
+	ednsOpts         listFlag
+	subnet           string
+	ecsProbeFlag     string
+	noDNS64Check     bool
+	use0x20          bool
+	sourceFlag       string
+	source6Flag      string
+	proxyFlag        string
+	expectAddrs      listFlag
+	expectNS         listFlag
+	expectRcode      string
+	expect           trace.Expectations
+	port             int
+	netFamily        string
+	retries          int
+	verifyRepeats    int
+	probeCount       int
+	probeInterval    time.Duration
+	rrsigWarn        time.Duration
+	ttlMin           time.Duration
+	ttlMax           time.Duration
+	queryTimeout     time.Duration
+	warnRTT          time.Duration
+	levelTimeout     time.Duration
+	deadline         time.Duration
+	concurrency      int
+	maxDepth         int
+	maxNS            int
+	nsSample         string
+	noSort           bool
+	short            bool
+	strict           bool
+	noRecursor       bool
+	checkingDisabled bool
+	recursionDesired bool
+	qps              float64
+	validate         bool
+	anchorFile       string
+	// ecsOption 和 resolverAddr 只用于显示，追踪用的是 Tracer 自己的设置
+	ecsOption    *dns.EDNS0_SUBNET
+	resolverAddr string
+)
+
+// optionFlags 把 OptionError 里的选项名换成对应的命令行参数，不在表里的选项错误本身已经说清楚了
+var optionFlags = map[string]string{
+	"Resolver":          "-dns",
+	"CompareResolvers":  "-dns",
+	"Count":             "-count",
+	"CountInterval":     "-count-interval",
+	"FallbackResolvers": "-dns",
+	"PTRNames":          "-ptr-names",
+	"Subnet":            "-subnet",
+	"EDNSOptions":       "-ednsopt",
+	"Proxy":             "-proxy",
+	"ECSProbe":          "-ecs-probe",
+	"HintsFile":         "-hints",
+	"TrustAnchors":      "trust anchor",
+	"Servers":           "-servers",
+	"Roots":             "-roots",
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.StringVar(&dnsServer, "dns", "", "DNS server (host or host:port) to use for initial queries (prefix with tls:// for DNS-over-TLS, or give an https:// DoH URL); a comma-separated list is tried in order, failing over on timeouts, and is compared with -compare-resolvers (default: the nameservers in /etc/resolv.conf, or "+builtinResolver+")")
+	flag.BoolVar(&checkSerial, "check-serial", false, "Query SOA from every authoritative server of the zone and compare the serials with the primary's")
+	flag.BoolVar(&checkAXFR, "check-axfr", false, "Attempt a zone transfer from every authoritative server of the zone and report which ones allow it")
+	flag.BoolVar(&checkRecursion, "check-recursion", false, "Send every authoritative server a recursive query for an outside name and report open resolvers")
+	flag.BoolVar(&checkEDNS, "check-edns", false, "Probe every authoritative server of the zone with plain, EDNS0, unknown option, EDNS version 1 and DO queries")
+	flag.BoolVar(&checkTCP, "check-tcp", false, "Repeat every UDP query of the trace over TCP and report servers that only answer over UDP")
+	flag.BoolVar(&checkV6, "check-v6", false, "Check whether every authoritative server of the zone has AAAA records and answers over IPv6")
+	flag.BoolVar(&checkDiversity, "check-diversity", false, "Group the zone's nameserver addresses by /24, /48 and origin AS and warn when all (or all but one) of them share one")
+	flag.BoolVar(&noASN, "no-asn", false, "With -check-diversity, compare address prefixes only and skip the origin AS lookups")
+	flag.BoolVar(&checkRFC2182, "check-rfc2182", false, "Check the zone's delegation against RFC 2182: at least two NS, not all on one host, one NS outside the zone and no NS that is a CNAME")
+	flag.BoolVar(&checkWildcard, "check-wildcard", false, "Repeat the final queries for a random label under the same parent to detect wildcard answers")
+	flag.BoolVar(&propagation, "propagation", false, "Report the TTLs of the parent's NS and glue and the child's NS for the name's zone, and how long old data can linger after an NS change")
+	flag.BoolVar(&checkTTL, "check-ttl", false, "Compare the TTL of every RRset across the servers of each level and check delegation NS and apex TTLs against -ttl-min/-ttl-max")
+	flag.DurationVar(&ttlMin, "ttl-min", 5*time.Minute, "With -check-ttl, warn about delegation NS and apex records with a TTL below this")
+	flag.DurationVar(&ttlMax, "ttl-max", 7*24*time.Hour, "With -check-ttl, warn about delegation NS and apex records with a TTL above this (0 means no limit)")
+	flag.BoolVar(&servfailFailover, "failover-servfail", false, "Also move on to the next -dns resolver when one answers SERVFAIL, not only on timeouts and network errors")
+	flag.BoolVar(&checkHijack, "check-hijack", false, "Query the final name at the -dns resolvers and flag answers that differ from the authoritative ones (redirected, NXDOMAIN or filtered)")
+	flag.BoolVar(&compareMode, "compare-resolvers", false, "Query the final name at every -dns resolver and compare their answers with the authoritative one")
+	flag.StringVar(&dnstype, "dnstype", "a/aaaa", "DNS types to test, separated by , or / (a, aaaa, mx, txt, ns, soa, srv, caa, ptr, any type mnemonic or TYPEnnn)")
+	flag.StringVar(&iptype, "iptype", "4/6", "IP version to test (4, 6, all or 4/6)")
+	flag.StringVar(&output, "o", "text", "Output format (text, json, markdown, ndjson, zone, dnsviz); dnsviz always traces with -qmin")
+	flag.BoolVar(&summary, "summary", false, "Print a per-server summary table after the trace")
+	flag.BoolVar(&diffMode, "diff", false, "Compare the final answers of all authoritative servers")
+	flag.BoolVar(&fastMode, "fast", false, "Race the servers at every level and follow the first usable referral or answer, like a resolver would")
+	flag.BoolVar(&qmin, "qmin", false, "Minimize query names (RFC 9156): ask each zone only for the next label's NS instead of the full name")
+	flag.BoolVar(&healthMode, "health", false, "Finish with an overall verdict (healthy/degraded/broken), a score and the problems found by the trace and the enabled checks")
+	flag.BoolVar(&treeMode, "tree", false, "Follow every server's referral separately and show the delegation tree, so diverging delegations are visible")
+	flag.BoolVar(&rankMode, "rank", false, "Rank the servers at every level by latency and show the fastest path through the delegation chain")
+	flag.BoolVar(&reverse, "x", false, "Reverse lookup: trace the PTR record of an IP address")
+	flag.BoolVar(&showDS, "ds", false, "Show DS (from the parent) and DNSKEY (from the child) at each zone cut")
+	flag.BoolVar(&checkDS, "check-ds", false, "Check that every DS at each zone cut matches a DNSKEY the child publishes")
+	flag.UintVar(&bufsize, "bufsize", 1232, "EDNS0 UDP buffer size to advertise (0 disables EDNS)")
+	flag.BoolVar(&dnssec, "dnssec", false, "Set the DO bit on all queries and show RRSIG records")
+	flag.BoolVar(&validate, "validate", false, "Validate the DNSSEC chain of trust from the root (implies -dnssec)")
+	flag.StringVar(&anchorFile, "trust-anchor", "", "File with root DS/DNSKEY trust anchors (default: built-in root KSKs)")
+	flag.BoolVar(&forceTCP, "tcp", false, "Use TCP for every query instead of UDP")
+	flag.BoolVar(&useCookie, "cookie", false, "Send DNS cookies (RFC 7873) and echo server cookies back to each server")
+	flag.BoolVar(&nsid, "nsid", false, "Request the NSID option to show which anycast instance answered")
+	flag.Var(&ednsOpts, "ednsopt", "Attach an EDNS option to every query, dig-style code[:hexvalue] (repeatable, e.g. 65001:c0ffee)")
+	flag.StringVar(&subnet, "subnet", "", "Send an EDNS Client Subnet option with this prefix (e.g. 203.0.113.0/24, 0.0.0.0/0 to opt out)")
+	flag.BoolVar(&noDNS64Check, "no-dns64-check", false, "Use AAAA records synthesized by a DNS64 resolver (64:ff9b::/96 or the prefix found via ipv4only.arpa) as real nameserver addresses")
+	flag.StringVar(&ecsProbeFlag, "ecs-probe", "", "Query every final-level server once per client subnet (a comma-separated list of prefixes, or a file with one per line) and group the subnets by the answer they get")
+	flag.BoolVar(&use0x20, "0x20", false, "Randomize the query name case and check that servers echo it unchanged")
+	flag.Float64Var(&qps, "qps", 0, "Maximum queries per second across the whole trace (0 means unlimited)")
+	flag.IntVar(&maxDepth, "maxdepth", 16, "Maximum number of delegation levels to follow")
+	flag.IntVar(&maxNS, "max-ns", 0, "Query at most this many nameservers per level (0 = all); the rest are listed as not queried")
+	flag.StringVar(&nsSample, "ns-sample", "first", "Which nameservers -max-ns queries: first (in sorted order) or random")
+	flag.BoolVar(&recursionDesired, "rd", false, "Set the RD (recursion desired) bit on queries to authoritative servers")
+	flag.BoolVar(&noRecursor, "no-recursor", false, "Resolve glueless nameserver addresses iteratively from the roots instead of via -dns")
+	flag.BoolVar(&checkingDisabled, "cd", false, "Set the CD (checking disabled) bit on address lookups via -dns so bogus names still resolve")
+	flag.BoolVar(&strict, "strict", false, "Exit with an error when the parent and child disagree on the NS set or glue addresses")
+	flag.BoolVar(&short, "short", false, "Leave the Additional section records out of the per-server output")
+	flag.BoolVar(&noSort, "no-sort", false, "Keep authorities and records in arrival order instead of sorting them")
+	flag.IntVar(&concurrency, "concurrency", 10, "Maximum number of queries in flight at once within a level")
+	flag.DurationVar(&deadline, "deadline", 0, "Total time budget for the whole trace (e.g. 30s, 0 means no limit)")
+	flag.DurationVar(&rrsigWarn, "rrsig-warn", 72*time.Hour, "With -dnssec, warn about RRSIGs that expire within this window")
+	flag.DurationVar(&queryTimeout, "timeout", 3*time.Second, "Timeout for each query (e.g. 1500ms)")
+	flag.DurationVar(&levelTimeout, "level-timeout", 0, "Total time budget for each level; servers that have not answered by then are given up on and the trace continues (e.g. 8s)")
+	flag.DurationVar(&warnRTT, "warn-rtt", 0, "Mark queries slower than this (timeouts included) as SLOW and exit with 11 when a final-level authoritative answer breaches it (e.g. 100ms)")
+	flag.IntVar(&retries, "retries", 2, "Times to retry a query that timed out or hit a network error")
+	flag.IntVar(&probeCount, "count", 0, "Send n identical queries to every final-level server IP and report packet loss and min/avg/max/stddev RTT")
+	flag.DurationVar(&probeInterval, "count-interval", time.Second, "Interval between the -count queries to one server")
+	flag.IntVar(&verifyRepeats, "verify", 0, "Repeat every final-level query n more times per server and flag servers whose answers disagree")
+	flag.BoolVar(&noHappyEyeballs, "no-happy-eyeballs", false, "Query a dual-stacked nameserver's addresses one by one instead of racing IPv6 against IPv4")
+	flag.StringVar(&netFamily, "net", "any", "Address family to send queries over (4, 6, any)")
+	flag.IntVar(&port, "port", 53, "Port to send queries to authoritative servers on")
+	flag.StringVar(&sourceFlag, "source", "", "Source address to send queries from")
+	flag.StringVar(&source6Flag, "source6", "", "IPv6 source address to send queries from (used with a v4 -source)")
+	flag.StringVar(&proxyFlag, "proxy", "", "Send every query over TCP through this SOCKS5 proxy (socks5://[user:pass@]host:port), including DoT and DoH to -dns")
+	flag.BoolVar(&ignoreTC, "ignore-tc", false, "Do not retry truncated UDP responses over TCP")
+	flag.BoolVar(&noTCPRecovery, "no-tcp-recovery", false, "Do not retry malformed, FORMERR or NOTIMP UDP responses over TCP")
+	flag.BoolVar(&ptrNames, "ptr-names", false, "Reverse-resolve every authoritative server IP via -dns and show its PTR name next to the IP")
+	flag.BoolVar(&identify, "identify", false, "Send CHAOS TXT identity queries (version.bind, hostname.bind, id.server) to every server")
+	flag.StringVar(&rootsFlag, "roots", "", "Root servers to start at: a count picks that many at random (3), or a list of letters or hostnames (a,k,m)")
+	flag.StringVar(&hintsFile, "hints", "", "Root hints file in named.root format to use instead of the built-in root servers")
+	flag.BoolVar(&hintsUpdate, "hints-update", false, "Download the current root hints from IANA into the -hints file (default: the user cache directory)")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Keep root and TLD referral data in this directory between runs so later traces skip the root servers")
+	flag.BoolVar(&noCache, "no-cache", false, "Ignore -cache-dir for this run")
+	flag.BoolVar(&cacheFlush, "cache-flush", false, "Delete the referral cache in -cache-dir before tracing (or just delete it when no domain is given)")
+	flag.StringVar(&serversFlag, "servers", "", "Skip the trace and query these nameservers (comma-separated hostnames or IPs) directly")
+	flag.StringVar(&fromFlag, "from", "", "Start the trace at this zone instead of the root (zone, or zone=ns1,ns2 to give its nameservers)")
+	flag.StringVar(&logLevel, "loglevel", "warn", "Log to stderr at this level: error, warn, info (each level traced) or debug (each query and response)")
+	flag.DurationVar(&watchInterval, "watch", 0, "Re-trace on this interval and print only what changed (e.g. 60s)")
+	flag.StringVar(&listenAddr, "listen", "", "Serve Prometheus metrics on this address (e.g. :9953) while -watch is running")
+	flag.StringVar(&serveAddr, "serve", "", "Run an HTTP API on this address (e.g. :8080): GET /trace?domain=example.com&type=a&dnssec=1 returns the JSON trace")
+	flag.IntVar(&serveMax, "serve-max", 4, "Maximum number of traces -serve runs at once; further requests get 503")
+	flag.BoolVar(&tuiMode, "tui", false, "Explore the trace in an interactive, collapsible tree (falls back to normal output when stdout is not a terminal)")
+	flag.StringVar(&domainFile, "f", "", "Read domains to trace from this file, one per line (- for stdin)")
+	flag.StringVar(&saveFile, "save", "", "Write the JSON trace to this file (same format as -o json) for a later -diff-against")
+	flag.StringVar(&diffAgainst, "diff-against", "", "Compare with a trace saved by -save (or -o json): NS, addresses, answers, serials and reachability; exit 12 on changes")
+	flag.Var(&expectAddrs, "expect-addr", "Assert that the final answer contains this address (repeatable or comma-separated); exit 14 when an assertion fails")
+	flag.Var(&expectNS, "expect-ns", "Assert that the final zone's delegation includes this nameserver (repeatable or comma-separated)")
+	flag.StringVar(&expectRcode, "expect-rcode", "", "Assert that every answering final-level server returns this rcode (noerror, nxdomain, servfail, ...)")
+	flag.StringVar(&tlsaPort, "tlsa", "", "Trace the TLSA record for port/proto (e.g. 443/tcp), prefixing the domain with _443._tcp")
+	flag.StringVar(&configFile, "config", "", "Read flag defaults from this file instead of ~/.config/mdig/config.yaml (MDIG_* environment variables override it, command-line flags override both)")
+	flag.BoolVar(&showConfigMode, "show-config", false, "Print the effective configuration after merging the config file, MDIG_* variables and flags, then exit")
+	args, server, err := parseCommandLine(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		// flag 包自己已经输出了选项错误
+		if err == errMissingServer {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitUsage
+	}
+	configPath, err := applyDefaults(flag.CommandLine, configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config:", err)
+		return exitUsage
+	}
+	if showConfigMode {
+		showConfig(flag.CommandLine, configPath)
+		return exitOK
+	}
+	level, err := parseLogLevel(logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	logger = newLogger(level)
+	if server != "" {
+		if flagSources["dns"] == "command line" {
+			logger.Warn("@server overrides -dns", "server", server, "dns", dnsServer)
+		}
+		dnsServer, flagSources["dns"] = server, "command line"
+	}
+	resolverOrigin = "flag"
+	if src := flagSources["dns"]; src != "command line" {
+		resolverOrigin = "from " + src
+	}
+	if dnsServer == "" {
+		dnsServer, resolverOrigin = systemResolvers()
+	}
+	// 列表里的服务器依次用于查询 NS 地址（前一个超时或网络错误时换下一个），-compare-resolvers 时全部参与比较
+	var dnsList []string
+	for _, spec := range strings.Split(dnsServer, ",") {
+		dnsList = append(dnsList, strings.TrimSpace(spec))
+	}
+	if iptype, err = trace.NormalizeIPType(iptype); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if err := trace.ValidateQueryTypes(dnstype); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	switch {
+	case netFamily != "4" && netFamily != "6" && netFamily != "any":
+		fmt.Fprintln(os.Stderr, "-net must be 4, 6 or any")
+		return exitUsage
+	case netFamily != "any" && (iptype == "4" || iptype == "6") && iptype != netFamily:
+		fmt.Fprintf(os.Stderr, "-net %s cannot reach any server when only -iptype %s addresses are looked up\n", netFamily, iptype)
+		return exitUsage
+	}
+	if warnRTT < 0 {
+		fmt.Fprintln(os.Stderr, "-warn-rtt cannot be negative")
+		return exitUsage
+	}
+	if levelTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "-level-timeout cannot be negative")
+		return exitUsage
+	}
+	if queryTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "-timeout must be positive")
+		return exitUsage
+	}
+	if qps < 0 {
+		fmt.Fprintln(os.Stderr, "-qps cannot be negative")
+		return exitUsage
+	}
+	if maxNS < 0 {
+		fmt.Fprintln(os.Stderr, "-max-ns cannot be negative")
+		return exitUsage
+	}
+	if nsSample != "first" && nsSample != "random" {
+		fmt.Fprintln(os.Stderr, "-ns-sample must be first or random")
+		return exitUsage
+	}
+	if maxDepth < 1 {
+		fmt.Fprintln(os.Stderr, "-maxdepth must be at least 1")
+		return exitUsage
+	}
+	if concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be at least 1")
+		return exitUsage
+	}
+	if retries < 0 {
+		fmt.Fprintln(os.Stderr, "-retries cannot be negative")
+		return exitUsage
+	}
+	if rrsigWarn < 0 {
+		fmt.Fprintln(os.Stderr, "-rrsig-warn cannot be negative")
+		return exitUsage
+	}
+	if fastMode && diffMode {
+		fmt.Fprintln(os.Stderr, "-fast queries only one server at the final level, there is nothing for -diff to compare")
+		return exitUsage
+	}
+	if fastMode && treeMode {
+		fmt.Fprintln(os.Stderr, "-fast follows only one referral per level and cannot be combined with -tree")
+		return exitUsage
+	}
+	if ttlMin < 0 || ttlMax < 0 {
+		fmt.Fprintln(os.Stderr, "-ttl-min and -ttl-max cannot be negative")
+		return exitUsage
+	}
+	if ttlMax > 0 && ttlMin > ttlMax {
+		fmt.Fprintln(os.Stderr, "-ttl-min cannot be greater than -ttl-max")
+		return exitUsage
+	}
+	if verifyRepeats < 0 {
+		fmt.Fprintln(os.Stderr, "-verify cannot be negative")
+		return exitUsage
+	}
+	if port < 1 || port > 65535 {
+		fmt.Fprintln(os.Stderr, "-port must be between 1 and 65535")
+		return exitUsage
+	}
+	if bufsize > 65535 {
+		fmt.Fprintln(os.Stderr, "-bufsize must be between 0 and 65535")
+		return exitUsage
+	}
+	var anchors []*dns.DS
+	if validate {
+		dnssec = true
+	}
+	// -serve 的请求可以单独要求 validate，信任锚事先读好
+	if validate || serveAddr != "" {
+		if anchors, err = trace.LoadTrustAnchors(anchorFile); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid trust anchor:", err)
+			return exitUsage
+		}
+	}
+	if dnssec && bufsize == 0 {
+		fmt.Fprintln(os.Stderr, "-dnssec needs EDNS, it cannot be combined with -bufsize 0")
+		return exitUsage
+	}
+	if len(ednsOpts) > 0 && bufsize == 0 {
+		fmt.Fprintln(os.Stderr, "-ednsopt needs EDNS, it cannot be combined with -bufsize 0")
+		return exitUsage
+	}
+	if nsid && bufsize == 0 {
+		fmt.Fprintln(os.Stderr, "-nsid needs EDNS, it cannot be combined with -bufsize 0")
+		return exitUsage
+	}
+	if subnet != "" {
+		if bufsize == 0 {
+			fmt.Fprintln(os.Stderr, "-subnet needs EDNS, it cannot be combined with -bufsize 0")
+			return exitUsage
+		}
+		// 追踪时由 Tracer 自己解析，这里保留一份用于显示
+		if ecsOption, err = trace.ParseSubnet(subnet); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -subnet:", err)
+			return exitUsage
+		}
+	}
+	var ecsProbe []string
+	if ecsProbeFlag != "" {
+		if bufsize == 0 {
+			fmt.Fprintln(os.Stderr, "-ecs-probe needs EDNS, it cannot be combined with -bufsize 0")
+			return exitUsage
+		}
+		if ecsProbe, err = readSubnetList(ecsProbeFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -ecs-probe:", err)
+			return exitUsage
+		}
+	}
+	if expect, err = parseExpectations(expectAddrs, expectNS, expectRcode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if useCookie && bufsize == 0 {
+		fmt.Fprintln(os.Stderr, "-cookie needs EDNS, it cannot be combined with -bufsize 0")
+		return exitUsage
+	}
+	if serversFlag != "" {
+		switch {
+		case fromFlag != "":
+			fmt.Fprintln(os.Stderr, "-servers queries the listed nameservers directly and cannot be combined with -from")
+			return exitUsage
+		case validate:
+			fmt.Fprintln(os.Stderr, "-validate builds the chain of trust from the root and cannot be combined with -servers")
+			return exitUsage
+		}
+	}
+	if ptrNames && noRecursor {
+		fmt.Fprintln(os.Stderr, "-ptr-names looks the names up via -dns and cannot be combined with -no-recursor")
+		return exitUsage
+	}
+	if fromFlag != "" {
+		switch {
+		case validate:
+			fmt.Fprintln(os.Stderr, "-validate builds the chain of trust from the root and cannot be combined with -from")
+			return exitUsage
+		case noRecursor && !strings.Contains(fromFlag, "="):
+			fmt.Fprintln(os.Stderr, "-from without nameservers looks them up via -dns; give -from zone=ns1,ns2 with -no-recursor")
+			return exitUsage
+		}
+	}
+	switch {
+	case watchInterval < 0:
+		fmt.Fprintln(os.Stderr, "-watch cannot be negative")
+		return exitUsage
+	case watchInterval > 0 && output != "text":
+		fmt.Fprintln(os.Stderr, "-watch only supports -o text")
+		return exitUsage
+	case listenAddr != "" && watchInterval == 0:
+		fmt.Fprintln(os.Stderr, "-listen requires -watch")
+		return exitUsage
+	}
+	if (saveFile != "" || diffAgainst != "") && (watchInterval > 0 || serveAddr != "" || tuiMode) {
+		fmt.Fprintln(os.Stderr, "-save and -diff-against cannot be combined with -watch, -serve or -tui")
+		return exitUsage
+	}
+	if !expect.Empty() && (watchInterval > 0 || serveAddr != "" || tuiMode) {
+		fmt.Fprintln(os.Stderr, "-expect-addr, -expect-ns and -expect-rcode cannot be combined with -watch, -serve or -tui")
+		return exitUsage
+	}
+	if tuiMode {
+		switch {
+		case output != "text" || watchInterval > 0 || serveAddr != "":
+			fmt.Fprintln(os.Stderr, "-tui only works with -o text and cannot be combined with -watch or -serve")
+			return exitUsage
+		case domainFile != "" || len(args) > 1:
+			fmt.Fprintln(os.Stderr, "-tui explores a single trace, give one domain")
+			return exitUsage
+		case treeMode:
+			fmt.Fprintln(os.Stderr, "-tui shows the levels of one trace and cannot be combined with -tree")
+			return exitUsage
+		}
+		// 输出被重定向时照常输出文本
+		tuiMode = isTerminal(os.Stdin) && isTerminal(os.Stdout)
+	}
+	if serveAddr != "" {
+		switch {
+		case serveMax < 1:
+			fmt.Fprintln(os.Stderr, "-serve-max must be at least 1")
+			return exitUsage
+		case watchInterval > 0 || domainFile != "" || len(args) > 0:
+			fmt.Fprintln(os.Stderr, "-serve takes the domains from HTTP requests and cannot be combined with -watch, -f or domain arguments")
+			return exitUsage
+		case output != "text" && output != "json":
+			fmt.Fprintln(os.Stderr, "-serve always answers in JSON, -o is not used")
+			return exitUsage
+		}
+	}
+	if hintsUpdate {
+		path := hintsFile
+		if path == "" {
+			if path, err = defaultHintsPath(); err != nil {
+				fmt.Fprintln(os.Stderr, "cannot locate the root hints cache:", err)
+				return exitUsage
+			}
+		}
+		if err := updateRootHints(path); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot update root hints:", err)
+			return exitNetworkError
+		}
+		if len(args) == 0 && domainFile == "" {
+			return exitOK
+		}
+	}
+	if cacheFlush {
+		if cacheDir == "" {
+			fmt.Fprintln(os.Stderr, "-cache-flush needs -cache-dir")
+			return exitUsage
+		}
+		n, err := trace.FlushCache(cacheDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot flush the cache:", err)
+			return exitUsage
+		}
+		logger.Info("cache flushed", "dir", cacheDir, "files", n)
+		if len(args) == 0 && domainFile == "" {
+			return exitOK
+		}
+	}
+	if noCache {
+		cacheDir = ""
+	}
+	if path := hintsPath(hintsFile); path != hintsFile {
+		logger.Debug("using the root hints saved by -hints-update", "path", path)
+		hintsFile = path
+	}
+	if len(args) < 1 && domainFile == "" && serveAddr == "" {
+		fmt.Println("Usage: mdig [@server] [-dns server] [-dnstype a|aaaa|mx|txt|ns|soa|srv|caa|ptr] [-iptype 4|6|all] [-o text|json|markdown|ndjson|zone|dnsviz] [-summary] [-diff] [-fast] [-tree] [-health] [-qmin] [-rank] [-x] [-ds] [-check-ds] [-tlsa port/proto] [-identify] [-ptr-names] [-bufsize n] [-dnssec] [-rrsig-warn d] [-validate] [-ignore-tc] [-no-tcp-recovery] [-tcp] [-cookie] [-nsid] [-ednsopt code[:hex]] [-subnet prefix] [-ecs-probe prefixes|file] [-0x20] [-source ip] [-source6 ip] [-proxy socks5://host:port] [-port n] [-net 4|6|any] [-no-happy-eyeballs] [-retries n] [-timeout d] [-level-timeout d] [-warn-rtt d] [-deadline d] [-concurrency n] [-qps n] [-maxdepth n] [-max-ns n] [-ns-sample first|random] [-no-sort] [-short] [-strict] [-no-recursor] [-no-dns64-check] [-cd] [-rd] [-f file] [-config file] [-show-config] [-save file] [-diff-against file] [-expect-addr ip] [-expect-ns host] [-expect-rcode rcode] [-hints file] [-roots n|a,k,m] [-hints-update] [-cache-dir dir] [-no-cache] [-cache-flush] [-from zone[=ns,...]] [-servers ns,...] [-watch d] [-listen addr] [-serve addr] [-serve-max n] [-tui] [-loglevel level] [-failover-servfail] [-compare-resolvers] [-check-hijack] [-check-serial] [-check-axfr] [-check-recursion] [-check-edns] [-check-tcp] [-check-v6] [-check-diversity] [-no-asn] [-check-rfc2182] [-check-wildcard] [-check-ttl] [-ttl-min d] [-ttl-max d] [-propagation] [-verify n] [-count n] [-count-interval d] <domain|ip>...")
+		return exitUsage
+	}
+	if listenAddr != "" {
+		metrics = newMetricsRegistry()
+	}
+	var serverList []string
+	if serversFlag != "" {
+		serverList = strings.Split(serversFlag, ",")
+	}
+	opts := trace.Options{
+		Resolver:           dnsList[0],
+		FallbackResolvers:  dnsList[1:],
+		FailoverOnServfail: servfailFailover,
+		QueryType:          dnstype,
+		AddressFamily:      iptype,
+		Network:            netFamily,
+		Timeout:            queryTimeout,
+		WarnRTT:            warnRTT,
+		LevelTimeout:       levelTimeout,
+		Retries:            retries,
+		Verify:             verifyRepeats,
+		Count:              probeCount,
+		CountInterval:      probeInterval,
+		RRSIGWarn:          rrsigWarn,
+		Concurrency:        concurrency,
+		MaxDepth:           maxDepth,
+		MaxNS:              maxNS,
+		NSSample:           nsSample,
+		Port:               port,
+		BufSize:            uint16(bufsize),
+		NoEDNS:             bufsize == 0,
+		DNSSEC:             dnssec,
+		Validate:           validate,
+		TrustAnchors:       anchors,
+		DelegationKeys:     showDS || checkDS,
+		Diff:               diffMode,
+		Rank:               rankMode,
+		Fast:               fastMode,
+		Tree:               treeMode,
+		Health:             healthMode,
+		KeepRecords:        output == "zone",
+		KeepMessages:       output == "dnsviz",
+		QMin:               qmin || output == "dnsviz", // DNSViz 按区逐级询问 NS 来还原委派
+		CheckSerial:        checkSerial,
+		CheckAXFR:          checkAXFR,
+		CheckRecursion:     checkRecursion,
+		CheckEDNS:          checkEDNS,
+		CheckTCP:           checkTCP,
+		CheckV6:            checkV6,
+		CheckDiversity:     checkDiversity,
+		NoASN:              noASN,
+		CheckRFC2182:       checkRFC2182,
+		CheckHijack:        checkHijack,
+		CheckWildcard:      checkWildcard,
+		CheckTTL:           checkTTL,
+		Propagation:        propagation,
+		TTLMin:             ttlMin,
+		TTLMax:             ttlMax,
+		TCP:                forceTCP,
+		IgnoreTC:           ignoreTC,
+		NoTCPRecovery:      noTCPRecovery,
+		NoHappyEyeballs:    noHappyEyeballs,
+		Cookies:            useCookie,
+		NSID:               nsid,
+		EDNSOptions:        ednsOpts,
+		Subnet:             subnet,
+		ECSProbe:           ecsProbe,
+		NoDNS64Check:       noDNS64Check,
+		Use0x20:            use0x20,
+		Source:             sourceFlag,
+		Source6:            source6Flag,
+		Proxy:              proxyFlag,
+		QPS:                qps,
+		NoRecursor:         noRecursor,
+		CheckingDisabled:   checkingDisabled,
+		RecursionDesired:   recursionDesired,
+		NoSort:             noSort,
+		Identify:           identify,
+		PTRNames:           ptrNames,
+		HintsFile:          hintsFile,
+		CacheDir:           cacheDir,
+		ShareReferrals:     len(args) > 1 || domainFile != "",
+		Roots:              rootsFlag,
+		From:               fromFlag,
+		Servers:            serverList,
+		Logger:             logger,
+	}
+	if metrics != nil {
+		opts.OnQuery = metrics.recordQuery
+	}
+	if compareMode {
+		opts.CompareResolvers = dnsList
+	}
+	if serveAddr != "" {
+		return serveTraces(serveConfig{addr: serveAddr, base: opts, max: serveMax, deadline: deadline, typeSet: flagSet("dnstype"), logger: logger})
+	}
+	startProgress()
+	defer stopProgress()
+	switch {
+	case output == "ndjson":
+		opts.OnEvent = writeEvent
+	case progress != nil:
+		opts.OnEvent = progress.event
+	}
+	tr, err := trace.New(opts)
+	if err != nil {
+		printOptionError(err)
+		return exitUsage
+	}
+	defer tr.Close()
+	resolverAddr = tr.ResolverAddr()
+
+	var targets []traceTarget
+	for _, arg := range args {
+		t, err := parseTarget(tr, arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		targets = append(targets, t)
+	}
+	var invalid []invalidTarget
+	if domainFile != "" {
+		more, bad, err := readTargetFile(tr, domainFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cannot read -f:", err)
+			return exitUsage
+		}
+		targets, invalid = append(targets, more...), bad
+		if len(targets) == 0 {
+			if output == "json" && len(invalid) > 0 {
+				batch := &batchWriter{}
+				writeInvalid(batch, invalid)
+				batch.close()
+			}
+			fmt.Fprintln(os.Stderr, "no domains to trace")
+			return exitUsage
+		}
+	}
+	if output == "ndjson" {
+		stop := startEventWriter(os.Stdout)
+		defer stop()
+	}
+	// Ctrl-C、SIGTERM 和 -deadline 都会取消 ctx，已完成的各级结果仍然照常输出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop) // 再按一次 Ctrl-C 直接退出
+	if err := tr.Prepare(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "cannot start at -from zone:", err)
+		return exitNetworkError
+	}
+	if watchInterval > 0 {
+		if listenAddr != "" {
+			stopMetrics, err := startMetricsServer(listenAddr)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "cannot serve metrics:", err)
+				return exitUsage
+			}
+			defer stopMetrics()
+		}
+		// -watch 时 -deadline 限制的是每一轮追踪
+		return watchTargets(ctx, tr, targets, watchInterval)
+	}
+	if tuiMode {
+		return exploreTarget(ctx, tr, targets[0])
+	}
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	// 批量模式（多个域名或 -f）的 JSON 不论有几个目标都是同样的结构：以原始输入为键的对象
+	var batch *batchWriter
+	if output == "json" && (len(targets) > 1 || domainFile != "") {
+		targets = dedupeTargets(targets)
+		batch = &batchWriter{}
+		writeInvalid(batch, invalid)
+	}
+	var dv *dnsvizWriter
+	if output == "dnsviz" {
+		dv = newDNSVizWriter()
+	}
+	var saved *savedTraces
+	if diffAgainst != "" {
+		if saved, err = loadSavedTraces(diffAgainst); err != nil {
+			fmt.Fprintln(os.Stderr, "cannot read -diff-against:", err)
+			return exitUsage
+		}
+	}
+	saveEntries := make(map[string]batchEntry)
+	codes := make([]int, len(targets))
+	printed := 0
+	traceAll(ctx, tr, targets, func(i int, report trace.Report, status trace.Status, elapsed time.Duration) {
+		if saved != nil {
+			report.Since = saved.compare(targets[i], report, status)
+		}
+		if !expect.Empty() && status != trace.StatusAborted {
+			report.Expect = expect.Check(report)
+		}
+		codes[i] = exitCode(report, status)
+		if saveFile != "" {
+			saveEntries[targets[i].Arg] = newBatchEntry(report, status, codes[i], elapsed)
+		}
+		if output == "text" && report.Expect != nil {
+			progress.hide(func() { printExpect(report.Expect) })
+		}
+		switch {
+		case output == "text" && report.Since != nil:
+			progress.hide(func() { printChanges(report.Since) })
+		case batch != nil:
+			batch.write(targets[i].Arg, newBatchEntry(report, status, codes[i], elapsed))
+		case output == "json":
+			printJSON(report)
+		case output == "markdown":
+			if printed > 0 {
+				fmt.Println()
+			}
+			printMarkdown(report)
+		case output == "zone":
+			if printed > 0 {
+				fmt.Println()
+			}
+			printZone(report)
+		case dv != nil:
+			dv.add(report)
+		}
+		printed++
+	})
+	if output == "text" && len(targets) > 1 {
+		fmt.Println()
+		printUsage(fmt.Sprintf("Total cost of all %d targets", len(targets)), tr.Usage())
+	}
+	if batch != nil {
+		batch.close()
+	}
+	if dv != nil {
+		dv.write(os.Stdout)
+	}
+	if saveFile != "" {
+		switch {
+		case slices.Contains(codes, exitAborted):
+			// 不完整的追踪不能作为之后比较的基准，保留原来的文件
+			fmt.Fprintln(os.Stderr, "trace aborted, -save file not written")
+		default:
+			if err := saveTraces(saveFile, saveEntries); err != nil {
+				fmt.Fprintln(os.Stderr, "cannot write -save:", err)
+				return exitUsage
+			}
+		}
+	}
+	// -f 批量模式下个别目标失败只在 -strict 时影响退出码（中断除外）；其他情况返回第一个失败目标的退出码
+	if domainFile != "" && !strict {
+		if slices.Contains(codes, exitAborted) {
+			return exitAborted
+		}
+		if slices.Contains(codes, exitChanged) {
+			return exitChanged
+		}
+		if slices.Contains(codes, exitExpect) {
+			return exitExpect
+		}
+		return exitOK
+	}
+	for _, code := range codes {
+		if code != exitOK {
+			return code
+		}
+	}
+	if len(invalid) > 0 {
+		return exitUsage
+	}
+	return exitOK
+}
+
+// printOptionError 把 trace.New 的错误写到标准错误，选项错误换成对应的命令行参数
+func printOptionError(err error) {
+	var optErr *trace.OptionError
+	switch {
+	case !errors.As(err, &optErr):
+		fmt.Fprintln(os.Stderr, err)
+	case optionFlags[optErr.Option] != "":
+		fmt.Fprintf(os.Stderr, "invalid %s: %v\n", optionFlags[optErr.Option], optErr.Err)
+	default:
+		fmt.Fprintln(os.Stderr, optErr.Err)
+	}
+}
+
+// flagSet 表示选项是否给出过：命令行、配置文件和 MDIG_* 环境变量都算，来源由 applyDefaults 记在 flagSources
+func flagSet(name string) bool {
+	return flagSources[name] != ""
+}
+
+// tlsaPrefix 把 443/tcp 转换成 _443._tcp. 前缀
+func tlsaPrefix(spec string) (string, error) {
+	port, proto, ok := strings.Cut(spec, "/")
+	if !ok {
+		proto = "tcp"
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", fmt.Errorf("invalid -tlsa port %q", port)
+	}
+	switch proto = strings.ToLower(proto); proto {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", fmt.Errorf("invalid -tlsa protocol %q (tcp, udp, sctp)", proto)
+	}
+	return fmt.Sprintf("_%s._%s.", port, proto), nil
+}
+
+// levelLabel 返回某一级的区切分说明，例如 "root → com." 或 "example.com."
+func levelLabel(res trace.Result) string {
+	if res.Zone == "" {
+		return ""
+	}
+	label := res.Zone
+	if label == "." {
+		label = "root"
+	}
+	if res.Child != "" {
+		label += " → " + res.Child
+	}
+	return label
+}
+
+// levelName 是某一级标题里的名字；-qmin 时写实际发出的最小化查询名
+func levelName(res trace.Result) string {
+	if res.QName == "" || strings.EqualFold(res.QName, res.Domain) {
+		return res.Domain
+	}
+	return fmt.Sprintf("%s NS (minimized, tracing %s)", res.QName, res.Domain)
+}
+
+// printServerResults 输出一台服务器某个 IP 上的全部查询结果
+func printServerResults(auth trace.AuthorityServer, qrs []trace.QueryResult) {
+	var addrNotes []string
+	if name := auth.PTRNames[qrs[0].ServerIP]; name != "" {
+		addrNotes = append(addrNotes, auth.Hostname+" → "+name)
+	}
+	switch auth.AddrSource {
+	case "glue":
+		addrNotes = append(addrNotes, "from glue")
+	case "recursor":
+		via := auth.AddrResolver
+		if via == "" {
+			via = resolverAddr
+		}
+		addrNotes = append(addrNotes, "looked up via "+via)
+		// -cd 时递归服务器不做验证，没有 AD 位正是要看的信息
+		switch {
+		case auth.AddrAD:
+			addrNotes = append(addrNotes, "ad")
+		case checkingDisabled:
+			addrNotes = append(addrNotes, "no ad")
+		}
+		for _, e := range auth.AddrEDE {
+			addrNotes = append(addrNotes, "resolver "+e.String())
+		}
+	case "iterative":
+		addrNotes = append(addrNotes, "resolved iteratively")
+	}
+	if auth.AddrCached {
+		addrNotes = append(addrNotes, "cached")
+	}
+	if port != 53 {
+		addrNotes = append(addrNotes, fmt.Sprintf("port %d", port))
+	}
+	for _, qr := range qrs {
+		if qr.RTT == 0 {
+			continue
+		}
+		if len(qrs) > 1 {
+			addrNotes = append(addrNotes, qr.Qtype+" "+rttNote(qr))
+		} else {
+			addrNotes = append(addrNotes, rttNote(qr))
+		}
+	}
+	if len(addrNotes) > 0 {
+		fmt.Printf("  │   ├─ NS IP: %s (%s)\n", qrs[0].ServerIP, strings.Join(addrNotes, ", "))
+	} else {
+		fmt.Printf("  │   ├─ NS IP: %s\n", qrs[0].ServerIP)
+	}
+	multi := len(qrs) > 1
+	var failures []string
+	for _, qr := range qrs {
+		prefix := ""
+		if multi {
+			prefix = qr.Qtype + " "
+		}
+		if qr.Error != "" {
+			// 出错的查询没有报头可显示，错误就写在这次查询的位置上
+			fmt.Printf("  │   ├─ %s! %s\n", prefix, qr.Error)
+			continue
+		}
+		if trace.RcodeFailure(qr.Rcode) {
+			// SERVFAIL/REFUSED 只算这个 IP 失败，不影响本级其他服务器的结果
+			failures = append(failures, prefix+"server failure: "+trace.RcodeText(qr.Rcode, qr.EDE))
+		}
+		nsidNote := ""
+		if qr.NSID != "" {
+			nsidNote = fmt.Sprintf(" (nsid: %s)", qr.NSID)
+		}
+		fmt.Printf("  │   ├─ %sflags: %s; status: %s; sent %s%s\n", prefix, qr.Flags, trace.RcodeText(qr.Rcode, qr.EDE), sentFlags(qr), nsidNote)
+		fmt.Printf("  │   ├─ %s\n", queryStats(qr))
+		if qr.Denial != nil {
+			printDenial(qr.Denial)
+		}
+		if qr.Class == trace.ClassLame {
+			fmt.Printf("  │   ├─ ! lame: %s\n", qr.LameReason)
+		}
+		for _, ig := range qr.Ignored {
+			fmt.Printf("  │   ├─ ! ignored %s (%s)\n", ig.Record, ig.Reason)
+		}
+		if qr.CaseMismatch {
+			fmt.Printf("  │   ├─ ! 0x20 mismatch — response may be spoofed or rewritten\n")
+		}
+		if ecsOption != nil {
+			fmt.Printf("  │   ├─ ecs: %s\n", formatScope(ecsOption, qr.ECSScope))
+		}
+		if qr.Cookie != nil {
+			fmt.Printf("  │   ├─ cookie: %s\n", formatCookie(qr.Cookie))
+		}
+		for _, o := range qr.EDNSOptions {
+			fmt.Printf("  │   ├─ edns %s\n", o)
+		}
+		if len(qr.Identity) > 0 {
+			fmt.Printf("  │   ├─ identity: %s\n", formatIdentity(qr.Identity))
+		}
+		if qr.Flags.TC {
+			fmt.Printf("  │   ├─ ! response truncated (tc), records may be incomplete\n")
+		}
+	}
+
+	// 每个查询类型分开显示转介或应答，多类型查询时在标签前注明类型
+	for _, qr := range qrs {
+		prefix := ""
+		if multi {
+			prefix = qr.Qtype + " "
+		}
+		fmt.Printf("  │   ├─ %s%s\n", prefix, responseLabel(qr))
+		responses := slices.Concat(qr.NS, signedAnswers(qr))
+		if len(responses) == 0 {
+			fmt.Printf("  │   │   ├─ %s\n", emptyResponse(qr))
+		}
+		for _, resp := range responses {
+			fmt.Printf("  │   │   ├─ %s\n", resp)
+		}
+		if len(qr.Additional) > 0 && !short {
+			fmt.Printf("  │   ├─ %sAdditional:\n", prefix)
+			for _, rec := range qr.Additional {
+				fmt.Printf("  │   │   ├─ %s\n", rec)
+			}
+		}
+	}
+
+	for _, f := range failures {
+		fmt.Printf("  │       ├─ %s\n", f)
+	}
+}
+
+// responseLabel 区分授权区里的转介和应答区里的最终应答，应答再注明是否带 AA 位；
+// 父区和子区在同一批服务器上时，带 AA 的应答说明服务器直接替子区作答而没有转介
+func responseLabel(qr trace.QueryResult) string {
+	switch {
+	case qr.Error != "":
+		return "Responses:"
+	case len(qr.NS) > 0:
+		return "Referral to " + qr.Referral + ":"
+	case qr.Flags.AA:
+		return "Answer (authoritative):"
+	}
+	return "Answer (not authoritative):"
+}
+
+// emptyResponse 说明一个结果为什么没有记录：查询失败、NODATA 还是 NXDOMAIN
+func emptyResponse(qr trace.QueryResult) string {
+	switch {
+	case qr.Error != "":
+		return "no response (query failed)"
+	case qr.Negative != nil:
+		return formatNegative(qr.Negative, qr.Qtype)
+	}
+	return "No responses found"
+}
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// notQueried 返回没有发出查询的地址，例如被 -net 过滤掉或追踪已被取消
+func notQueried(auth trace.AuthorityServer) []net.IP {
+	queried := make(map[string]bool)
+	for _, qr := range auth.QueryResults {
+		queried[qr.ServerIP] = true
+	}
+	var ips []net.IP
+	for _, ip := range auth.IPs {
+		if !queried[ip.String()] {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// printDNS64 列出 -dns 服务器合成的 DNS64 地址，它们不是服务器真实的 IPv6 地址，没有查询
+func printDNS64(auth trace.AuthorityServer) {
+	for _, ip := range auth.DNS64 {
+		fmt.Printf("  │   ├─ NS IP: %s (DNS64-synthesized by the resolver, not queried)\n", ip)
+	}
+}
+
+func printDNSResult(res trace.Result) {
+	if label := levelLabel(res); label != "" {
+		fmt.Printf("Level %d: %s [%s]\n", res.Level, levelName(res), label)
+	} else {
+		fmt.Printf("Level %d: %s\n", res.Level, levelName(res))
+	}
+	if res.Error != "" {
+		fmt.Printf("  ! Error: %s\n", res.Error)
+	}
+	if lame := lameSummary(res); lame != "" {
+		fmt.Printf("  ! %s\n", lame)
+	}
+	if len(res.Unreachable) > 0 {
+		fmt.Printf("  ! unreachable: %s\n", strings.Join(res.Unreachable, ", "))
+	}
+	for _, note := range res.Notes {
+		fmt.Printf("  * %s\n", note)
+	}
+	if v := res.Validation; v != nil {
+		marker := "*"
+		if v.Status == trace.ValidationBogus {
+			marker = "!"
+		}
+		if v.Reason != "" {
+			fmt.Printf("  %s DNSSEC (%s): %s — %s\n", marker, v.Zone, v.Status, v.Reason)
+		} else {
+			fmt.Printf("  %s DNSSEC (%s): %s\n", marker, v.Zone, v.Status)
+		}
+	}
+	if res.Delegation != nil && showDS {
+		printDelegationKeys(res.Delegation)
+	}
+	if res.NSCheck != nil {
+		printNSConsistency(res.NSCheck)
+	}
+	if res.GlueCheck != nil {
+		printGlueCheck(res.GlueCheck)
+	}
+
+	for _, auth := range res.Authorities {
+		fmt.Printf("  ├─ NS: %s\n", auth.Hostname)
+		if auth.Error != "" {
+			if len(auth.IPs) > 0 {
+				fmt.Printf("  │   ├─ NS IP: %s\n", joinIPs(auth.IPs))
+			}
+			printDNS64(auth)
+			fmt.Printf("  │       ├─ %s\n", auth.Error)
+			if !strings.Contains(auth.Error, "EDE") {
+				// NXDOMAIN 和 NODATA 的错误信息里没有应答码，EDE 单独列出
+				for _, e := range auth.AddrEDE {
+					fmt.Printf("  │       ├─ resolver %s\n", e)
+				}
+			}
+			continue
+		}
+		for _, qrs := range trace.GroupByIP(auth.QueryResults) {
+			printServerResults(auth, qrs)
+		}
+		for _, ip := range notQueried(auth) {
+			fmt.Printf("  │   ├─ NS IP: %s (not queried)\n", ip)
+		}
+		printDNS64(auth)
+	}
+	fmt.Println("───")
+}
+
+// sentFlags 显示查询里发出的 RD 位，应答里的 rd 只是服务器照抄回来的
+func sentFlags(qr trace.QueryResult) string {
+	if qr.SentRD {
+		return "rd=1"
+	}
+	return "rd=0"
+}
+
+// rttNote 描述一个查询等了多久，超时要和连接被拒绝这类很快就失败的情况区分开
+func rttNote(qr trace.QueryResult) string {
+	ms := fmt.Sprintf("%.1fms", qr.RTTMs)
+	if qr.Slow {
+		ms += " SLOW"
+	}
+	switch {
+	case qr.Error == "":
+		return "answered in " + ms
+	case qr.TimedOut:
+		return "timed out after " + ms
+	}
+	return "failed after " + ms
+}
+
+func queryStats(qr trace.QueryResult) string {
+	edns := "no EDNS"
+	if qr.EDNSBufSize > 0 {
+		edns = fmt.Sprintf("EDNS udp: %d", qr.EDNSBufSize)
+	}
+	transport := qr.Protocol
+	switch {
+	case qr.UDPMalformed != "" && qr.FallbackError != "":
+		transport += ", UDP response malformed (" + qr.UDPMalformed + "); tcp retry failed: " + qr.FallbackError
+	case qr.UDPMalformed != "":
+		transport += ", UDP response malformed (" + qr.UDPMalformed + "), recovered via TCP"
+	case qr.TCPFallback:
+		if qr.FallbackError != "" {
+			transport += ", truncated; tcp retry failed: " + qr.FallbackError
+		} else {
+			transport += ", retried after truncation"
+		}
+	}
+	if qr.Attempts > 1 {
+		transport += fmt.Sprintf(", %d attempts", qr.Attempts)
+	}
+	return fmt.Sprintf(";; MSG SIZE rcvd: %d (%s), %s", qr.MsgSize, transport, edns)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// rttBuckets 是查询耗时直方图的上界（秒）
+var rttBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type histogram struct {
+	counts []uint64 // 每个桶的累计计数，最后一个是 +Inf
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(rttBuckets)+1)
+	}
+	for i, le := range rttBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(rttBuckets)]++
+	h.sum += v
+}
+
+// metricsRegistry 收集 -listen 时导出的 Prometheus 指标；键是按固定顺序排列的标签值
+type metricsRegistry struct {
+	mu           sync.Mutex
+	traces       map[string]float64
+	traceErrors  map[[2]string]float64
+	rtt          map[[3]string]*histogram
+	levelNS      map[[2]string]float64
+	nsConsistent map[[2]string]float64
+}
+
+// metrics 为 nil 时不收集任何指标
+var metrics *metricsRegistry
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		traces:       make(map[string]float64),
+		traceErrors:  make(map[[2]string]float64),
+		rtt:          make(map[[3]string]*histogram),
+		levelNS:      make(map[[2]string]float64),
+		nsConsistent: make(map[[2]string]float64),
+	}
+}
+
+// statusClass 是 trace_errors_total 的 class 标签，得到应答时为空
+func statusClass(status trace.Status) string {
+	if status == trace.StatusAnswer {
+		return ""
+	}
+	return status.String()
+}
+
+// recordQuery 记录一次对权威服务器的查询，zone 是这一级负责的区；没有收到应答的查询没有耗时，不计入直方图
+func (m *metricsRegistry) recordQuery(zone, host string, qr trace.QueryResult) {
+	if m == nil || qr.Error != "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [3]string{dns.CanonicalName(host), qr.ServerIP, zone}
+	h := m.rtt[key]
+	if h == nil {
+		h = &histogram{}
+		m.rtt[key] = h
+	}
+	h.observe(qr.RTT.Seconds())
+}
+
+// recordTrace 记录一次完整的追踪，并用这次的结果替换该域名各级的 NS 数量和一致性
+func (m *metricsRegistry) recordTrace(domain string, report trace.Report, status trace.Status) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.traces[domain]++
+	if class := statusClass(status); class != "" {
+		m.traceErrors[[2]string{domain, class}]++
+	}
+	for _, gauge := range []map[[2]string]float64{m.levelNS, m.nsConsistent} {
+		for k := range gauge {
+			if k[0] == domain {
+				delete(gauge, k)
+			}
+		}
+	}
+	for _, res := range report.Results {
+		m.levelNS[[2]string{domain, res.Zone}] = float64(len(res.Authorities))
+		if c := res.NSCheck; c != nil && c.Error == "" {
+			v := 1.0
+			if c.Mismatch() {
+				v = 0
+			}
+			m.nsConsistent[[2]string{domain, c.Zone}] = v
+		}
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(names []string, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func sortedLabelKeys[K [2]string | [3]string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for n := range len(keys[i]) {
+			if keys[i][n] != keys[j][n] {
+				return keys[i][n] < keys[j][n]
+			}
+		}
+		return false
+	})
+	return keys
+}
+
+// writeTo 按 Prometheus 文本格式输出全部指标
+func (m *metricsRegistry) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintln(w, "# HELP mdig_traces_total Completed traces.")
+	fmt.Fprintln(w, "# TYPE mdig_traces_total counter")
+	for _, domain := range slices.Sorted(maps.Keys(m.traces)) {
+		fmt.Fprintf(w, "mdig_traces_total%s %g\n", labels([]string{"domain"}, []string{domain}), m.traces[domain])
+	}
+	fmt.Fprintln(w, "# HELP mdig_trace_errors_total Traces that did not end in an answer, by failure class.")
+	fmt.Fprintln(w, "# TYPE mdig_trace_errors_total counter")
+	for _, k := range sortedLabelKeys(m.traceErrors) {
+		fmt.Fprintf(w, "mdig_trace_errors_total%s %g\n", labels([]string{"domain", "class"}, k[:]), m.traceErrors[k])
+	}
+	fmt.Fprintln(w, "# HELP mdig_query_rtt_seconds Round-trip time of queries to authoritative servers.")
+	fmt.Fprintln(w, "# TYPE mdig_query_rtt_seconds histogram")
+	for _, k := range sortedLabelKeys(m.rtt) {
+		h := m.rtt[k]
+		names := []string{"nameserver", "address", "level", "le"}
+		for i, le := range rttBuckets {
+			fmt.Fprintf(w, "mdig_query_rtt_seconds_bucket%s %d\n", labels(names, []string{k[0], k[1], k[2], fmt.Sprint(le)}), h.counts[i])
+		}
+		count := h.counts[len(rttBuckets)]
+		fmt.Fprintf(w, "mdig_query_rtt_seconds_bucket%s %d\n", labels(names, []string{k[0], k[1], k[2], "+Inf"}), count)
+		fmt.Fprintf(w, "mdig_query_rtt_seconds_sum%s %g\n", labels(names[:3], k[:]), h.sum)
+		fmt.Fprintf(w, "mdig_query_rtt_seconds_count%s %d\n", labels(names[:3], k[:]), count)
+	}
+	fmt.Fprintln(w, "# HELP mdig_level_nameservers Nameservers found at each level of the last trace.")
+	fmt.Fprintln(w, "# TYPE mdig_level_nameservers gauge")
+	for _, k := range sortedLabelKeys(m.levelNS) {
+		fmt.Fprintf(w, "mdig_level_nameservers%s %g\n", labels([]string{"domain", "zone"}, k[:]), m.levelNS[k])
+	}
+	fmt.Fprintln(w, "# HELP mdig_ns_consistent Whether the parent and child NS sets of a zone matched in the last trace.")
+	fmt.Fprintln(w, "# TYPE mdig_ns_consistent gauge")
+	for _, k := range sortedLabelKeys(m.nsConsistent) {
+		fmt.Fprintf(w, "mdig_ns_consistent%s %g\n", labels([]string{"domain", "zone"}, k[:]), m.nsConsistent[k])
+	}
+}
+
+// startMetricsServer 在 addr 上提供 /metrics，端口无法监听时立即返回错误；返回的函数等待进行中的请求完成后关闭服务
+func startMetricsServer(addr string) (stop func(), err error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writeTo(w)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	logger.Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", ln.Addr()))
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
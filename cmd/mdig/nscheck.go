@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func formatNSMismatch(c *trace.NSConsistency) string {
+	var parts []string
+	if len(c.ParentOnly) > 0 {
+		parts = append(parts, "parent only: "+strings.Join(c.ParentOnly, ", "))
+	}
+	if len(c.ChildOnly) > 0 {
+		parts = append(parts, "child only: "+strings.Join(c.ChildOnly, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func printNSConsistency(c *trace.NSConsistency) {
+	switch {
+	case c.Error != "":
+		fmt.Printf("  ├─ NS consistency for %s:\n", c.Zone)
+		fmt.Printf("  │   ! %s\n", c.Error)
+	case !c.Mismatch():
+		fmt.Printf("  ├─ NS consistency for %s: parent and child agree (%s)\n", c.Zone, strings.Join(c.Both, ", "))
+	default:
+		fmt.Printf("  ├─ NS consistency for %s: parent and child differ\n", c.Zone)
+		if len(c.Both) > 0 {
+			fmt.Printf("  │   ├─ both: %s\n", strings.Join(c.Both, ", "))
+		}
+		if len(c.ParentOnly) > 0 {
+			fmt.Printf("  │   ├─ parent only: %s\n", strings.Join(c.ParentOnly, ", "))
+		}
+		if len(c.ChildOnly) > 0 {
+			fmt.Printf("  │   ├─ child only: %s\n", strings.Join(c.ChildOnly, ", "))
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func printJSON(report any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		logger.Error("json encode failed", "error", err)
+	}
+}
+
+func printMarkdown(report trace.Report) {
+	if report.UnicodeDomain != "" {
+		fmt.Printf("# mdig trace: %s (%s)\n", report.UnicodeDomain, report.Domain)
+	} else {
+		fmt.Printf("# mdig trace: %s\n", report.Domain)
+	}
+	if len(report.CNAMEChain) > 0 {
+		fmt.Printf("\n**CNAME chain:** %s\n", markdownEscape(formatCNAMEChain(report.CNAMEChain)))
+	}
+	if report.CNAMEError != "" {
+		fmt.Printf("\n> **Error:** %s\n", markdownEscape(report.CNAMEError))
+	}
+	if exp := report.RRSIGExpiry; exp != nil {
+		for _, w := range exp.Warnings {
+			fmt.Printf("\n> **Warning:** %s\n", markdownEscape(sigExpiryNote(w)))
+		}
+	}
+	for _, d := range report.Dangling {
+		fmt.Printf("\n> **Warning:** dangling NS for %s: %s\n", d.Zone, markdownEscape(d.String()))
+	}
+	for _, g := range report.DelegationGlue {
+		if g.Verdict != trace.GlueFull {
+			fmt.Printf("\n> **Note:** %s\n", markdownEscape(g.String()))
+		}
+	}
+	for _, res := range report.Results {
+		if label := levelLabel(res); label != "" {
+			fmt.Printf("\n## Level %d: %s (%s)\n\n", res.Level, levelName(res), label)
+		} else {
+			fmt.Printf("\n## Level %d: %s\n\n", res.Level, levelName(res))
+		}
+		if res.Error != "" {
+			fmt.Printf("> **Error:** %s\n\n", res.Error)
+		}
+		if lame := lameSummary(res); lame != "" {
+			fmt.Printf("> **Warning:** %s\n\n", markdownEscape(lame))
+		}
+		if len(res.Unreachable) > 0 {
+			fmt.Printf("> **Warning:** unreachable: %s\n\n", markdownEscape(strings.Join(res.Unreachable, ", ")))
+		}
+		if c := res.NSCheck; c != nil {
+			switch {
+			case c.Error != "":
+				fmt.Printf("> **NS consistency (%s):** %s\n\n", c.Zone, markdownEscape(c.Error))
+			case c.Mismatch():
+				fmt.Printf("> **Warning:** NS mismatch between parent and child for %s: %s\n\n", c.Zone, markdownEscape(formatNSMismatch(c)))
+			default:
+				fmt.Printf("> **NS consistency (%s):** parent and child agree\n\n", c.Zone)
+			}
+		}
+		if c := res.GlueCheck; c.Mismatch() {
+			fmt.Printf("> **Warning:** glue mismatch for %s: %s\n\n", c.Zone, markdownEscape(strings.Join(glueMismatches(c), "; ")))
+		}
+		for _, note := range res.Notes {
+			fmt.Printf("> **Note:** %s\n\n", markdownEscape(note))
+		}
+
+		for _, auth := range res.Authorities {
+			source := ""
+			if auth.AddrSource != "" {
+				notes := []string{auth.AddrSource}
+				if auth.AddrAD {
+					notes = append(notes, "ad")
+				}
+				if auth.AddrCached {
+					notes = append(notes, "cached")
+				}
+				source = " (" + strings.Join(notes, ", ") + ")"
+			}
+			fmt.Printf("- **%s**%s\n", auth.Hostname, source)
+			if auth.Error != "" {
+				fmt.Printf("  - error: %s\n", markdownEscape(auth.Error))
+			}
+			for _, qrs := range trace.GroupByIP(auth.QueryResults) {
+				var rtts []string
+				for _, qr := range qrs {
+					switch {
+					case qr.RTT == 0:
+					case len(qrs) > 1:
+						rtts = append(rtts, qr.Qtype+" "+rttNote(qr))
+					default:
+						rtts = append(rtts, rttNote(qr))
+					}
+				}
+				if len(rtts) > 0 {
+					fmt.Printf("  - `%s` (%s)\n", qrs[0].ServerIP, strings.Join(rtts, ", "))
+				} else {
+					fmt.Printf("  - `%s`\n", qrs[0].ServerIP)
+				}
+				var answers, referrals, additional []string
+				aa := true
+				for _, qr := range qrs {
+					if qr.Error != "" {
+						fmt.Printf("    - error: %s\n", markdownEscape(qr.Error))
+						continue
+					}
+					fmt.Printf("    - flags: `%s`; status: `%s`; sent `%s`\n", qr.Flags, trace.RcodeText(qr.Rcode, qr.EDE), sentFlags(qr))
+					fmt.Printf("    - `%s`\n", queryStats(qr))
+					if qr.Class == trace.ClassLame {
+						fmt.Printf("    - **lame:** %s\n", markdownEscape(qr.LameReason))
+					}
+					if qr.Negative != nil {
+						fmt.Printf("    - %s\n", markdownEscape(formatNegative(qr.Negative, qr.Qtype)))
+					}
+					if len(qr.NS) > 0 {
+						referrals = append(referrals, fmt.Sprintf("%s NS %s", qr.Referral, strings.Join(qr.NS, " ")))
+					}
+					additional = append(additional, qr.Additional...)
+					if len(qr.Answers) > 0 {
+						answers = append(answers, signedAnswers(qr)...)
+						aa = aa && qr.Flags.AA
+					}
+				}
+				if len(referrals) > 0 {
+					printMarkdownRecords("referral", referrals)
+				}
+				switch {
+				case len(answers) > 0 && aa:
+					printMarkdownRecords("answer (authoritative)", answers)
+				case len(answers) > 0:
+					printMarkdownRecords("answer (not authoritative)", answers)
+				case len(referrals) == 0:
+					fmt.Printf("    - responses: _none_\n")
+				}
+				if len(additional) > 0 && !short {
+					printMarkdownRecords("additional", additional)
+				}
+			}
+			for _, ip := range notQueried(auth) {
+				fmt.Printf("  - `%s` (not queried)\n", ip)
+			}
+		}
+	}
+	if checkDS {
+		printDSMarkdown(report.Results)
+	}
+	if report.Serial != nil {
+		printSerialMarkdown(report.Serial)
+	}
+	if report.AXFR != nil {
+		printAXFRMarkdown(report.AXFR)
+	}
+	if report.Recursion != nil {
+		printRecursionMarkdown(report.Recursion)
+	}
+	if report.EDNS != nil {
+		printEDNSMarkdown(report.EDNS)
+	}
+	if report.TCP != nil {
+		printTCPMarkdown(report.TCP)
+	}
+	if report.IPv6 != nil {
+		printV6Markdown(report.IPv6)
+	}
+	if report.Diversity != nil {
+		printDiversityMarkdown(report.Diversity)
+	}
+	if report.RFC2182 != nil {
+		printRFC2182Markdown(report.RFC2182)
+	}
+	if report.Wildcard != nil {
+		printWildcardMarkdown(report.Wildcard)
+	}
+	if report.Verify != nil {
+		printVerifyMarkdown(report.Verify)
+	}
+	if report.Probe != nil {
+		printProbeMarkdown(report.Probe)
+	}
+	if report.ECSProbe != nil {
+		printECSProbeMarkdown(report.ECSProbe)
+	}
+	if report.TTL != nil {
+		printTTLMarkdown(report.TTL)
+	}
+	if report.Propagation != nil {
+		printPropagationMarkdown(report.Propagation)
+	}
+	if report.Rank != nil {
+		printRankMarkdown(report.Rank)
+	}
+	if report.Tree != nil {
+		printTreeMarkdown(report.Tree)
+	}
+	if cmp := report.Resolvers; cmp != nil {
+		fmt.Printf("\n## Resolver comparison: %s\n\n", cmp.Name)
+		fmt.Printf("| Resolver | Type | Rcode | TTL | Answers | |\n| --- | --- | --- | --- | --- | --- |\n")
+		for _, q := range slices.Sorted(maps.Keys(cmp.Authoritative)) {
+			auth := cmp.Authoritative[q]
+			fmt.Printf("| _authoritative_ | %s | %s | - | %s | |\n", auth.Qtype, auth.Rcode, markdownEscape(formatResolverAnswers(*auth)))
+		}
+		for _, ans := range cmp.Answers {
+			rcode, ttl, mark := "-", "-", ""
+			if ans.Error == "" {
+				rcode, ttl = ans.Rcode, fmt.Sprint(ans.TTL)
+			}
+			if ans.Disagrees {
+				mark = "**differs**"
+			}
+			fmt.Printf("| `%s` | %s | %s | %s | %s | %s |\n", ans.Resolver, ans.Qtype, rcode, ttl, markdownEscape(formatResolverAnswers(ans)), mark)
+		}
+	}
+	if report.Hijack != nil {
+		printHijackMarkdown(report.Hijack)
+	}
+	if report.Slow != nil {
+		printSlowMarkdown(report.Slow)
+	}
+	if report.Health != nil {
+		printHealthMarkdown(report.Health)
+	}
+	if report.Since != nil {
+		printChangesMarkdown(report.Since)
+	}
+	if report.Expect != nil {
+		printExpectMarkdown(report.Expect)
+	}
+}
+
+func printExpectMarkdown(r *trace.ExpectResult) {
+	fmt.Printf("\n## Assertions: %s\n\n", r.Name)
+	fmt.Printf("| Assertion | Expected | Observed | Result |\n| --- | --- | --- | --- |\n")
+	for _, a := range r.Assertions {
+		result := "pass"
+		if !a.Passed {
+			result = "**FAIL**"
+		}
+		fmt.Printf("| %s | `%s` | %s | %s |\n", a.Kind, a.Expected, markdownEscape(a.Observed), result)
+	}
+	if failed := r.Failed(); len(failed) > 0 {
+		fmt.Printf("\n> **Warning:** %d of %d assertions failed\n", len(failed), len(r.Assertions))
+	}
+}
+
+func printSerialMarkdown(c *trace.SerialCheck) {
+	fmt.Printf("\n## SOA serials: %s\n\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Server | IP | Serial | |\n| --- | --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		serial, mark := serialColumns(c, s)
+		fmt.Printf("| %s | `%s` | %s | %s |\n", s.Hostname, s.IP, serial, markdownEscape(mark))
+	}
+	if c.Error != "" {
+		fmt.Printf("\n> **Warning:** %s\n", markdownEscape(c.Error))
+	} else {
+		fmt.Printf("\n%s\n", markdownEscape(serialSummary(c)))
+	}
+}
+
+func markdownEscape(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]", "<", "&lt;", ">", "&gt;")
+	return r.Replace(s)
+}
+
+func printAXFRMarkdown(c *trace.AXFRCheck) {
+	fmt.Printf("\n## Zone transfer (AXFR): %s\n\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Server | IP | Result |\n| --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		fmt.Printf("| %s | `%s` | %s |\n", s.Hostname, s.IP, markdownEscape(axfrColumn(s)))
+	}
+	if c.Open() {
+		fmt.Printf("\n> **Warning:** at least one server hands out the whole zone to anyone\n")
+	}
+}
+
+func printRecursionMarkdown(c *trace.RecursionCheck) {
+	fmt.Printf("\n## Recursion check: `%s`\n\n", c.Probe)
+	fmt.Printf("| Server | IP | Zone | Result |\n| --- | --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		fmt.Printf("| %s | `%s` | %s | %s |\n", s.Hostname, s.IP, s.Zone, markdownEscape(recursionColumn(s)))
+	}
+	if c.Open() {
+		fmt.Printf("\n> **Warning:** some authoritative servers also resolve for anyone\n")
+	}
+}
+
+func printEDNSMarkdown(c *trace.EDNSCheck) {
+	fmt.Printf("\n## EDNS compliance: %s\n\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	names := trace.EDNSProbeNames()
+	fmt.Printf("| Server | IP | %s |\n|%s\n", strings.Join(names, " | "), strings.Repeat(" --- |", len(names)+2))
+	for _, s := range c.Servers {
+		cells := make([]string, len(s.Probes))
+		for i, p := range s.Probes {
+			cells[i] = ednsCell(p)
+		}
+		fmt.Printf("| %s | `%s` | %s |\n", s.Hostname, s.IP, strings.Join(cells, " | "))
+	}
+	if failures := ednsFailures(c); len(failures) > 0 {
+		fmt.Println()
+		for _, line := range failures {
+			fmt.Printf("- %s\n", markdownEscape(line))
+		}
+	}
+}
+
+func printTCPMarkdown(c *trace.TCPCheck) {
+	fmt.Printf("\n## TCP check\n\n")
+	if len(c.Queries) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Server | IP | Zone | Query | Result |\n| --- | --- | --- | --- | --- |\n")
+	for _, q := range c.Queries {
+		fmt.Printf("| %s | `%s` | %s | %s %s | %s |\n", q.Hostname, q.IP, q.Zone, q.Domain, q.Qtype, markdownEscape(tcpColumn(q)))
+	}
+	if list := udpOnlyList(c); list != "" {
+		fmt.Printf("\n> **Warning:** UDP-only servers: %s\n", markdownEscape(list))
+	}
+}
+
+func printV6Markdown(c *trace.V6Check) {
+	fmt.Printf("\n## IPv6 reachability: %s\n\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Server | IPv6 | Verdict |\n| --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		fmt.Printf("| %s | %s | %s |\n", s.Hostname, markdownEscape(v6Addresses(s)), markdownEscape(v6Column(s)))
+	}
+	fmt.Printf("\n**%s**\n", v6Verdict(c))
+}
+
+func printDiversityMarkdown(c *trace.DiversityCheck) {
+	fmt.Printf("\n## Network diversity: %s\n\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Server | Address | Prefix | Origin AS |\n| --- | --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		for _, a := range s.Addresses {
+			fmt.Printf("| %s | `%s` | `%s` | %s |\n", s.Hostname, a.IP, a.Prefix, markdownEscape(asnColumn(c, a)))
+		}
+	}
+	if c.ASNNote != "" {
+		fmt.Printf("\n%s\n", markdownEscape(c.ASNNote))
+	}
+	for _, w := range c.Warnings {
+		fmt.Printf("\n> **Warning:** %s\n", markdownEscape(w))
+	}
+	if len(c.Warnings) == 0 {
+		fmt.Printf("\n**%s**\n", diversityVerdict(c))
+	}
+}
+
+func printRFC2182Markdown(c *trace.RFC2182Check) {
+	fmt.Printf("\n## RFC 2182 compliance: %s\n\n", c.Zone)
+	if len(c.Criteria) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Criterion | Result | Evidence |\n| --- | --- | --- |\n")
+	for _, cr := range c.Criteria {
+		fmt.Printf("| %s | %s | %s |\n", cr.Title, passFail(cr.Pass), markdownEscape(cr.Evidence))
+	}
+	fmt.Printf("\n**%s**\n", rfc2182Verdict(c))
+}
+
+func printHijackMarkdown(c *trace.HijackCheck) {
+	fmt.Printf("\n## Hijack check: %s\n\n", c.Name)
+	if c.Error != "" {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("| Resolver | Type | Rcode | Verdict | Answers |\n| --- | --- | --- | --- | --- |\n")
+	for _, q := range slices.Sorted(maps.Keys(c.Authoritative)) {
+		auth := c.Authoritative[q]
+		fmt.Printf("| _authoritative_ | %s | %s | - | %s |\n", auth.Qtype, auth.Rcode, markdownEscape(formatResolverAnswers(*auth)))
+	}
+	for _, r := range c.Results {
+		verdict, rcode := r.Verdict, "-"
+		if verdict != trace.HijackMatch && verdict != trace.HijackError {
+			verdict = "**" + verdict + "**"
+		}
+		if r.Error == "" {
+			rcode = r.Rcode
+		}
+		fmt.Printf("| `%s` | %s | %s | %s | %s |\n", r.Resolver, r.Qtype, rcode, verdict, markdownEscape(formatResolverAnswers(r.ResolverAnswer)))
+	}
+	fmt.Println()
+	for _, r := range c.Tampered() {
+		fmt.Printf("> **Warning:** `%s` %s\n\n", r.Resolver, markdownEscape(c.Describe(r)))
+	}
+	fmt.Printf("**%s**\n", hijackVerdict(c))
+}
+
+func printWildcardMarkdown(c *trace.WildcardCheck) {
+	fmt.Printf("\n## Wildcard check: %s\n\n", c.Domain)
+	if len(c.Servers) == 0 {
+		fmt.Printf("> **Warning:** %s\n", markdownEscape(c.Error))
+		return
+	}
+	fmt.Printf("Probe: `%s`\n\n", c.Probe)
+	fmt.Printf("| Server | IP | Type | Result |\n| --- | --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		fmt.Printf("| %s | `%s` | %s | %s |\n", s.Hostname, s.IP, s.Qtype, markdownEscape(wildcardColumn(c, s)))
+	}
+}
+
+func printVerifyMarkdown(c *trace.VerifyCheck) {
+	fmt.Printf("\n## Verification (%d repeats per query)\n\n", c.Repeats)
+	fmt.Printf("| Server | IP | Type | Result |\n| --- | --- | --- | --- |\n")
+	for _, q := range c.Queries {
+		fmt.Printf("| %s | `%s` | %s | %s |\n", q.Hostname, q.IP, q.Qtype, markdownEscape(verifyColumn(q)))
+	}
+}
+
+func printProbeMarkdown(c *trace.ProbeCheck) {
+	fmt.Printf("\n## Packet loss and RTT (%s)\n\n", probeTitle(c))
+	if len(c.Servers) == 0 {
+		fmt.Printf("No servers to probe.\n")
+		return
+	}
+	fmt.Printf("| Server | IP | Sent | Received | Loss | Min | Avg | Max | Stddev |\n| --- | --- | --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, p := range c.Servers {
+		fmt.Printf("| %s | `%s` | %d | %d | %s | %s |\n", p.Hostname, p.IP, p.Sent, p.Received, probeLoss(p), strings.Join(probeRTTs(p), " | "))
+	}
+}
+
+func printECSProbeMarkdown(c *trace.ECSProbe) {
+	fmt.Printf("\n## ECS probe: `%s %s` (%d subnets)\n\n", c.Name, c.Qtype, len(c.Subnets))
+	if len(c.Servers) == 0 {
+		fmt.Printf("No servers to probe.\n")
+		return
+	}
+	fmt.Printf("| Server | IP | Subnets | Scope | Answer |\n| --- | --- | --- | --- | --- |\n")
+	for _, s := range c.Servers {
+		if s.IgnoresECS {
+			fmt.Printf("| %s | `%s` | all | | %s |\n", s.Hostname, s.IP, markdownEscape(ecsIgnored(c, s)))
+			continue
+		}
+		for _, g := range s.Groups {
+			fmt.Printf("| %s | `%s` | %s | %s | %s |\n", s.Hostname, s.IP, ecsSubnets(g), ecsScopes(g), markdownEscape(ecsAnswer(g)))
+		}
+	}
+}
+
+func printTTLMarkdown(c *trace.TTLCheck) {
+	fmt.Printf("\n## TTL check (%d RRsets, %s)\n\n", c.Checked, ttlBounds(c))
+	if !c.Problems() {
+		fmt.Printf("All servers agree and every TTL is within range.\n")
+		return
+	}
+	fmt.Printf("| Zone | RRset | Kind | TTL | Result | Servers |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, set := range c.RRsets {
+		for _, v := range set.Values {
+			fmt.Printf("| %s | %s %s | %s | %d | %s | %s |\n", set.Zone, set.Name, set.Type, set.Kind, v.TTL, markdownEscape(ttlColumn(set, v)), markdownEscape(ttlServers(set, v)))
+		}
+	}
+}
+
+func printPropagationMarkdown(c *trace.Propagation) {
+	fmt.Printf("\n## Delegation TTLs: %s\n\n", c.Zone)
+	if len(c.TTLs) > 0 {
+		fmt.Printf("| Source | RRset | TTL | Servers |\n| --- | --- | --- | --- |\n")
+		for _, t := range c.TTLs {
+			fmt.Printf("| %s | %s %s | %s | %s |\n", markdownEscape(propagationKind(c, t)), t.Name, t.Type, propagationSeconds(t.TTL), strings.Join(t.Servers, ", "))
+		}
+	}
+	if c.Error != "" {
+		fmt.Printf("\n> **Warning:** %s\n", markdownEscape(c.Error))
+	}
+	if s := propagationSummary(c); s != "" {
+		fmt.Printf("\n%s\n", markdownEscape(s))
+	}
+}
+
+// printMarkdownRecords 把一组记录放进代码块，去掉多个 IP 之间重复的部分
+func printMarkdownRecords(label string, records []string) {
+	slices.Sort(records)
+	records = slices.Compact(records)
+	fmt.Printf("    - %s:\n\n", label)
+	fmt.Printf("      ```\n")
+	for _, rec := range records {
+		fmt.Printf("      %s\n", rec)
+	}
+	fmt.Printf("      ```\n")
+}
+
+func printSlowMarkdown(c *trace.SlowCheck) {
+	fmt.Printf("\n## Slow queries (over %s)\n\n", slowThreshold(c))
+	if len(c.Queries) == 0 {
+		fmt.Printf("None.\n")
+		return
+	}
+	fmt.Printf("| Zone | Server | IP | Type | RTT | |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, q := range c.Queries {
+		rtt := fmt.Sprintf("%.1fms", q.RTTMs)
+		if q.TimedOut {
+			rtt = "timed out after " + rtt
+		}
+		mark := ""
+		if q.Final {
+			mark = "**final answer**"
+		}
+		fmt.Printf("| %s | %s | `%s` | %s | %s | %s |\n", levelZone(q.Level, q.Zone), q.Hostname, q.IP, q.Qtype, rtt, mark)
+	}
+}
+
+func printHealthMarkdown(h *trace.Health) {
+	fmt.Printf("\n## Health: %s (score %d)\n\n", h.Status, h.Score)
+	if len(h.Findings) == 0 {
+		fmt.Printf("No problems found.\n")
+		return
+	}
+	fmt.Printf("| Severity | Check | Zone | Finding |\n| --- | --- | --- | --- |\n")
+	for _, f := range h.Findings {
+		fmt.Printf("| %s | %s | %s | %s |\n", f.Severity, f.Check, healthZone(f), markdownEscape(f.Message))
+	}
+}
+
+func printTreeMarkdown(tree *trace.Result) {
+	fmt.Printf("\n## Delegation tree\n\n```\n")
+	writeTreeLevel(os.Stdout, tree, "", expandedSubtrees(tree, nil))
+	fmt.Printf("```\n")
+}
+
+func printRankMarkdown(r *trace.LatencyRank) {
+	fmt.Printf("\n## Latency ranking\n\n")
+	fmt.Printf("| Level | Rank | Server | IP | Avg | Min | OK | |\n| --- | --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, l := range r.Levels {
+		for i, s := range l.Servers {
+			rtt := "- | -"
+			if s.Successes > 0 {
+				rtt = fmt.Sprintf("%.1fms | %.1fms", s.AvgRTTMs, s.MinRTTMs)
+			}
+			fmt.Printf("| %s | %d | %s | `%s` | %s | %d/%d | %s |\n", rankZone(l), i+1, s.Hostname, s.IP, rtt, s.Successes, s.Queries, rankColumn(s))
+		}
+	}
+	fmt.Printf("\n**Best path:** %s\n", markdownEscape(bestPath(r)))
+}
+
+func printDSMarkdown(results []trace.Result) {
+	fmt.Printf("\n## DS check\n\n")
+	fmt.Printf("| Zone | Verdict | DS | Result |\n| --- | --- | --- | --- |\n")
+	for _, res := range results {
+		keys := res.Delegation
+		if keys == nil {
+			continue
+		}
+		verdict := keys.Verdict()
+		if len(keys.DS) == 0 {
+			fmt.Printf("| %s | %s | - | %s |\n", keys.Zone, verdict, markdownEscape(strings.Join(keys.Errors, "; ")))
+		}
+		for _, ds := range keys.DS {
+			fmt.Printf("| %s | %s | key tag %d, algorithm %d, digest type %d | %s |\n", keys.Zone, verdict, ds.KeyTag, ds.Algorithm, ds.DigestType, dsCheckNote(ds))
+		}
+	}
+}
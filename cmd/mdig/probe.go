@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func probeTitle(c *trace.ProbeCheck) string {
+	interval := time.Duration(c.IntervalMs * float64(time.Millisecond))
+	return fmt.Sprintf("%d %s queries per server over %s, every %s", c.Count, c.Qtype, c.Protocol, interval)
+}
+
+func probeLoss(p trace.ProbeResult) string {
+	return fmt.Sprintf("%.0f%%", p.LossPct)
+}
+
+// probeRTTs 返回 min、avg、max 和 stddev 四列，没有收到应答时都是 "-"
+func probeRTTs(p trace.ProbeResult) []string {
+	if p.Received == 0 {
+		return []string{"-", "-", "-", "-"}
+	}
+	return []string{fmt.Sprintf("%.1fms", p.MinMs), fmt.Sprintf("%.1fms", p.AvgMs), fmt.Sprintf("%.1fms", p.MaxMs), fmt.Sprintf("%.1fms", p.StddevMs)}
+}
+
+func printProbeCheck(c *trace.ProbeCheck) {
+	fmt.Printf("Packet loss and RTT (%s):\n", probeTitle(c))
+	if len(c.Servers) == 0 {
+		fmt.Println("  no servers to probe")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tSENT\tRECV\tLOSS\tMIN\tAVG\tMAX\tSTDDEV\t")
+	for _, p := range c.Servers {
+		mark := ""
+		if p.Received < p.Sent {
+			mark = "! last error: " + p.LastError
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%s\t%s\t%s\n", p.Hostname, p.IP, p.Sent, p.Received, probeLoss(p), strings.Join(probeRTTs(p), "\t"), mark)
+	}
+	w.Flush()
+}
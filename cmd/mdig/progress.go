@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// progress 为 nil 时不显示进度行
+var progress *progressLine
+
+// progressLine 在终端的标准错误上维护一行不断刷新的状态：当前级别和区、本级服务器数、已发出和已收到应答的查询数、耗时。
+// 其他输出都要经过 hide，先擦掉这一行再写，写完之后由下一次刷新重新画出来
+type progressLine struct {
+	mu       sync.Mutex
+	out      io.Writer
+	width    int
+	domain   string
+	level    int
+	zone     string
+	servers  int
+	sent     int
+	answered int
+	start    time.Time
+	shown    bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// isTerminal 判断文件是不是字符设备，不依赖额外的包
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress 只在文本输出、标准输出和标准错误都是终端时启动；输出被重定向或是机器格式时不显示
+func startProgress() {
+	if output != "text" || watchInterval > 0 || os.Getenv("TERM") == "dumb" || !isTerminal(os.Stdout) || !isTerminal(os.Stderr) {
+		return
+	}
+	width := 80
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		width = n
+	}
+	p := &progressLine{out: os.Stderr, width: width, stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		tick := time.NewTicker(200 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				p.mu.Lock()
+				p.draw()
+				p.mu.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	progress = p
+}
+
+// stopProgress 擦掉状态行并停止刷新
+func stopProgress() {
+	p := progress
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.done
+	p.mu.Lock()
+	p.clear()
+	p.level = 0
+	p.mu.Unlock()
+	progress = nil
+}
+
+// event 按追踪事件更新计数；Tracer 会并发调用
+func (p *progressLine) event(ev trace.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch ev.Event {
+	case "level_started":
+		p.domain, p.level, p.zone, p.servers = ev.Domain, ev.Level, ev.Zone, ev.Authorities
+		p.sent, p.answered, p.start = 0, 0, time.Now()
+	case "query_sent":
+		p.sent++
+	case "response_received":
+		if ev.Error == "" {
+			p.answered++
+		}
+	case "trace_complete":
+		p.clear()
+		p.level = 0
+	}
+}
+
+// hide 擦掉状态行后执行 f，f 运行期间不会刷新，用于写出结果和进度信息
+func (p *progressLine) hide(f func()) {
+	if p == nil {
+		f()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	f()
+}
+
+func (p *progressLine) clear() {
+	if p.shown {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.shown = false
+	}
+}
+
+func (p *progressLine) draw() {
+	if p.level == 0 {
+		return
+	}
+	zone := p.zone
+	switch zone {
+	case "":
+		zone = "listed servers"
+	case ".":
+		zone = "root"
+	}
+	line := fmt.Sprintf("%s level %d (%s): %d servers, %d queries sent, %d answered, %.1fs",
+		p.domain, p.level, zone, p.servers, p.sent, p.answered, time.Since(p.start).Seconds())
+	// 超过终端宽度会折行，\r 就只能擦掉最后一行
+	if r := []rune(line); len(r) > p.width-1 {
+		line = string(r[:p.width-1])
+	}
+	fmt.Fprint(p.out, "\r\033[K"+line)
+	p.shown = true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// propagationKind 是 TTL 来源的说明：在哪一侧、哪些服务器上看到的
+func propagationKind(c *trace.Propagation, t trace.PropagationTTL) string {
+	switch t.Kind {
+	case trace.PropagationParentNS:
+		return "parent NS (" + c.Parent + ")"
+	case trace.PropagationGlue:
+		return "glue (" + c.Parent + ")"
+	}
+	return "child NS"
+}
+
+// propagationSeconds 写成 "172800s (48h0m0s)"
+func propagationSeconds(sec uint32) string {
+	return fmt.Sprintf("%ds (%s)", sec, time.Duration(sec)*time.Second)
+}
+
+// propagationSummary 是最后的结论，指出最坏时间由哪一项决定
+func propagationSummary(c *trace.Propagation) string {
+	worst, ok := c.Worst()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("worst case for an NS change to fully propagate: %s, set by the %s %s %s TTL", propagationSeconds(c.WorstSec), propagationKind(c, worst), worst.Name, worst.Type)
+}
+
+func printPropagation(c *trace.Propagation) {
+	fmt.Printf("Delegation TTLs for %s:\n", c.Zone)
+	if len(c.TTLs) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  SOURCE\tRRSET\tTTL\tSERVERS")
+		for _, t := range c.TTLs {
+			fmt.Fprintf(w, "  %s\t%s %s\t%s\t%s\n", propagationKind(c, t), t.Name, t.Type, propagationSeconds(t.TTL), strings.Join(t.Servers, ", "))
+		}
+		w.Flush()
+	}
+	if c.Error != "" {
+		fmt.Printf("  ! %s\n", c.Error)
+	}
+	if s := propagationSummary(c); s != "" {
+		fmt.Printf("  %s\n", s)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// levelPrinter 返回文本输出给 Run 的 emit 和等待输出结束的 wait。-ptr-names 时每一级先等它的服务器 IP 反向解析完（最多几秒）再输出，
+// 等待放在单独的 goroutine 里，追踪不必停下来等；各级仍按完成的顺序输出
+func levelPrinter(ctx context.Context, tr *trace.Tracer, print func(trace.Result)) (emit func(trace.Result), wait func()) {
+	if !ptrNames {
+		return print, func() {}
+	}
+	queue := make(chan trace.Result, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range queue {
+			tr.ReverseNames(ctx, &res)
+			print(res)
+		}
+	}()
+	return func(res trace.Result) { queue <- res }, func() {
+		close(queue)
+		<-done
+	}
+}
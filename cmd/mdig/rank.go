@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// rankZone 是排名里显示的级别名，根区写成 root
+func rankZone(l trace.LevelRank) string {
+	return levelZone(l.Level, l.Zone)
+}
+
+// levelZone 用区名指代一级，根区写成 root，区未知时写级别号
+func levelZone(level int, zone string) string {
+	switch zone {
+	case "":
+		return fmt.Sprintf("level %d", level)
+	case ".":
+		return "root"
+	}
+	return zone
+}
+
+func rankColumn(s trace.RankedServer) string {
+	switch {
+	case s.Successes == 0:
+		return "! no answer"
+	case s.Outlier:
+		return "! outlier, more than 3× the level median"
+	}
+	return ""
+}
+
+// bestPath 把每一级最快的服务器连成一条路径，级别里没有服务器应答时写成 ?
+func bestPath(r *trace.LatencyRank) string {
+	hops := make([]string, len(r.Levels))
+	for i, l := range r.Levels {
+		hops[i] = "?"
+		if s := l.Fastest(); s != nil {
+			hops[i] = fmt.Sprintf("%s (%.1fms)", s.Hostname, s.AvgRTTMs)
+		}
+	}
+	total := fmt.Sprintf("%.1fms", r.BestPathMs)
+	if !r.Complete {
+		total += " (levels without any answer not counted)"
+	}
+	return strings.Join(hops, " → ") + " = " + total
+}
+
+func printRank(r *trace.LatencyRank) {
+	fmt.Println("Latency ranking:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, l := range r.Levels {
+		fmt.Fprintf(w, "  %s (median %.1fms)\n", rankZone(l), l.MedianMs)
+		for i, s := range l.Servers {
+			rtt := "-\t-"
+			if s.Successes > 0 {
+				rtt = fmt.Sprintf("avg %.1fms\tmin %.1fms", s.AvgRTTMs, s.MinRTTMs)
+			}
+			line := fmt.Sprintf("    %d.\t%s\t%s\t%s\t%d/%d ok", i+1, s.Hostname, s.IP, rtt, s.Successes, s.Queries)
+			if note := rankColumn(s); note != "" {
+				line += "\t" + note
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	w.Flush()
+	fmt.Printf("  best path: %s\n", bestPath(r))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func recursionColumn(s trace.RecursionResult) string {
+	switch s.Status {
+	case trace.RecursionOpen:
+		if s.Answers > 0 {
+			return fmt.Sprintf("! open resolver: answered recursively (%s, %d records)", s.Rcode, s.Answers)
+		}
+		return fmt.Sprintf("! open resolver: answered recursively (%s)", s.Rcode)
+	case trace.RecursionNoAnswer:
+		return fmt.Sprintf("recursion advertised (RA) but no answer (%s)", s.Rcode)
+	case trace.RecursionRefused:
+		return "no recursion (" + s.Rcode + ")"
+	}
+	return "! no response: " + s.Error
+}
+
+func printRecursionCheck(c *trace.RecursionCheck) {
+	fmt.Printf("Recursion check (probe %s):\n", c.Probe)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tZONE\tRESULT")
+	for _, s := range c.Servers {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", s.Hostname, s.IP, s.Zone, recursionColumn(s))
+	}
+	w.Flush()
+	if c.Open() {
+		fmt.Println("  ! authoritative servers that also resolve for anyone can be abused for amplification and may mask delegation problems in this trace")
+	}
+}
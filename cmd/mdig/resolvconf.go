@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net"
+	"runtime"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// builtinResolver 是读不到系统解析配置时查询 NS 地址用的递归服务器
+const builtinResolver = "8.8.8.8"
+
+// resolvConfPath 是系统解析配置文件
+const resolvConfPath = "/etc/resolv.conf"
+
+// systemResolvers 返回没有给出 -dns 时使用的递归服务器（逗号分隔）和它的来源：/etc/resolv.conf 里的 nameserver，
+// 文件不存在、无法解析、没有 nameserver 或者在 Windows 上时用 builtinResolver
+func systemResolvers() (servers, origin string) {
+	if runtime.GOOS == "windows" {
+		return builtinResolver, "builtin default"
+	}
+	conf, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil || len(conf.Servers) == 0 {
+		logger.Debug("no usable nameserver in "+resolvConfPath+", using the builtin default", "resolver", builtinResolver, "error", err)
+		return builtinResolver, "builtin default"
+	}
+	list := make([]string, 0, len(conf.Servers))
+	for _, s := range conf.Servers {
+		list = append(list, net.JoinHostPort(s, conf.Port))
+	}
+	return strings.Join(list, ","), "from resolv.conf"
+}
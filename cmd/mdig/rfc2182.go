@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func passFail(pass bool) string {
+	if pass {
+		return "pass"
+	}
+	return "FAIL"
+}
+
+func rfc2182Verdict(c *trace.RFC2182Check) string {
+	if c.Pass {
+		return "RFC 2182: all criteria met"
+	}
+	return fmt.Sprintf("RFC 2182: %d of %d criteria not met", len(c.Failed()), len(c.Criteria))
+}
+
+func printRFC2182Check(c *trace.RFC2182Check) {
+	fmt.Printf("RFC 2182 compliance for %s:\n", c.Zone)
+	if len(c.Criteria) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, cr := range c.Criteria {
+		mark := " "
+		if !cr.Pass {
+			mark = "!"
+		}
+		fmt.Fprintf(w, "  %s %s\t%s\t%s\n", mark, passFail(cr.Pass), cr.Title, cr.Evidence)
+	}
+	w.Flush()
+	mark := " "
+	if !c.Pass {
+		mark = "!"
+	}
+	fmt.Printf("  %s %s\n", mark, rfc2182Verdict(c))
+}
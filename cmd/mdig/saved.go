@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// savedTraces 是 -diff-against 读入的之前的追踪。文件和 -o json 的输出格式相同：一个目标时是报告本身，
+// 多个目标时是以原始输入为键的批量对象，所以以前用 -o json 保存的结果也可以直接拿来比较
+type savedTraces struct {
+	path     string
+	byArg    map[string]trace.Report
+	byDomain map[string]trace.Report
+}
+
+func loadSavedTraces(path string) (*savedTraces, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s is not an mdig JSON trace: %v", path, err)
+	}
+	s := &savedTraces{path: path, byArg: make(map[string]trace.Report), byDomain: make(map[string]trace.Report)}
+	if _, ok := fields["results"]; ok {
+		var report trace.Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		s.byDomain[dns.CanonicalName(report.Domain)] = report
+		return s, nil
+	}
+	for arg, raw := range fields {
+		var entry batchEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, arg, err)
+		}
+		s.byArg[arg] = entry.Report
+		s.byDomain[dns.CanonicalName(entry.Report.Domain)] = entry.Report
+	}
+	if len(s.byDomain) == 0 {
+		return nil, fmt.Errorf("%s contains no traces", path)
+	}
+	return s, nil
+}
+
+// compare 找到目标之前的追踪并比较，先按原始输入再按域名查找；没有之前的追踪或这次追踪被中断时返回 nil
+func (s *savedTraces) compare(t traceTarget, report trace.Report, status trace.Status) *trace.SnapshotDiff {
+	prev, ok := s.byArg[t.Arg]
+	if !ok {
+		prev, ok = s.byDomain[dns.CanonicalName(t.Domain)]
+	}
+	switch {
+	case !ok:
+		fmt.Fprintf(os.Stderr, "%s is not in %s, nothing to compare\n", t.Domain, s.path)
+		return nil
+	case status == trace.StatusAborted:
+		// 不完整的追踪会被当成大量 NS 和应答消失
+		fmt.Fprintf(os.Stderr, "%s: trace aborted, not compared with %s\n", t.Domain, s.path)
+		return nil
+	}
+	return &trace.SnapshotDiff{Against: s.path, Changes: trace.CompareReports(prev, report)}
+}
+
+// saveTraces 按 -o json 的格式写出 -save 文件：一个目标时是报告本身，多个目标时是批量对象。
+// 先写临时文件再改名，写到一半时原来的文件仍然完整，-save 和 -diff-against 可以是同一个文件
+func saveTraces(path string, entries map[string]batchEntry) error {
+	var v any = entries
+	if len(entries) == 1 {
+		for _, entry := range entries {
+			v = entry.Report
+		}
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func printChanges(d *trace.SnapshotDiff) {
+	if len(d.Changes) == 0 {
+		fmt.Printf("No changes since %s\n", d.Against)
+		return
+	}
+	fmt.Printf("Changes since %s:\n", d.Against)
+	for _, c := range d.Changes {
+		fmt.Printf("  %s\n", c)
+	}
+}
+
+func printChangesMarkdown(d *trace.SnapshotDiff) {
+	fmt.Printf("\n## Changes since `%s`\n\n", d.Against)
+	if len(d.Changes) == 0 {
+		fmt.Printf("None.\n")
+		return
+	}
+	for _, c := range d.Changes {
+		fmt.Printf("- %s\n", markdownEscape(c.String()))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// serialColumns 返回表格里的 serial 和备注；不可达和非权威的服务器与 serial 落后分开标注
+func serialColumns(c *trace.SerialCheck, s trace.ServerSerial) (serial, mark string) {
+	switch {
+	case s.Unreachable:
+		return "-", "! unreachable: " + s.Error
+	case s.Error != "":
+		return "-", "! no SOA: " + s.Error
+	case s.NotAuthoritative:
+		return fmt.Sprint(s.Serial), "! answered without AA, not compared"
+	case s.Lagging:
+		return fmt.Sprint(s.Serial), fmt.Sprintf("! differs from primary (%d)", c.PrimarySerial)
+	case s.Hostname == c.Primary:
+		return fmt.Sprint(s.Serial), "primary"
+	}
+	return fmt.Sprint(s.Serial), "ok"
+}
+
+func serialSummary(c *trace.SerialCheck) string {
+	var ref string
+	switch {
+	case c.PrimaryError != "":
+		ref = fmt.Sprintf("primary %s unreachable (%s), compared against the highest serial %d", c.Primary, c.PrimaryError, c.PrimarySerial)
+	default:
+		ref = fmt.Sprintf("primary %s serial %d", c.Primary, c.PrimarySerial)
+	}
+	if c.MinSerial == c.MaxSerial {
+		return ref + "; all authoritative servers agree"
+	}
+	return fmt.Sprintf("%s; serials range from %d to %d (spread %d)", ref, c.MinSerial, c.MaxSerial, c.Spread())
+}
+
+func printSerialCheck(c *trace.SerialCheck) {
+	fmt.Printf("SOA serials for %s:\n", c.Zone)
+	if len(c.Servers) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tSERIAL\t")
+	for _, s := range c.Servers {
+		serial, mark := serialColumns(c, s)
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", s.Hostname, s.IP, serial, mark)
+	}
+	w.Flush()
+	if c.Error != "" {
+		fmt.Printf("  ! %s\n", c.Error)
+	} else {
+		fmt.Printf("  %s\n", serialSummary(c))
+	}
+}
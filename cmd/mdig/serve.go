@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// serveDeadline 是 -serve 时没有给出 -deadline 的单次追踪时限
+const serveDeadline = 30 * time.Second
+
+// serveError 是 -serve 出错时返回的 JSON
+type serveError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// serveConfig 是启动 -serve 时从命令行解析好的设置，请求处理只读这里，不读命令行的全局变量
+type serveConfig struct {
+	addr string
+	// base 是每个请求的 Options 的起点
+	base trace.Options
+	// max 是同时进行的追踪数上限（-serve-max），deadline 是单次追踪的时限（-deadline），为 0 时用 serveDeadline
+	max      int
+	deadline time.Duration
+	// typeSet 表示命令行给出了 -dnstype，这时追踪顶级域也不改查 NS
+	typeSet bool
+	logger  *slog.Logger
+}
+
+// traceServer 处理 -serve 的请求。每个请求在 cfg.base 的基础上按查询参数改出自己的 Options，新建一个 Tracer 追踪，
+// 请求之间不共用任何追踪状态
+type traceServer struct {
+	cfg   serveConfig
+	slots chan struct{}
+}
+
+// serveTraces 运行 -serve，直到收到 Ctrl-C 或 SIGTERM；-deadline 限制的是每个请求的追踪
+func serveTraces(cfg serveConfig) int {
+	// 先用命令行的设置建一次 Tracer，选项错误在启动时就报告
+	tr, err := trace.New(cfg.base)
+	if err != nil {
+		printOptionError(err)
+		return exitUsage
+	}
+	tr.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopServer, err := startTraceServer(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cannot serve:", err)
+		return exitUsage
+	}
+	<-ctx.Done()
+	stopServer()
+	return exitOK
+}
+
+// startTraceServer 在 cfg.addr 上提供 GET /trace 和 GET /healthz
+func startTraceServer(cfg serveConfig) (stop func(), err error) {
+	ln, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.deadline <= 0 {
+		cfg.deadline = serveDeadline
+	}
+	s := &traceServer{cfg: cfg, slots: make(chan struct{}, cfg.max)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trace", s.handleTrace)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, "ok")
+	})
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		// 写应答的时限要留出整次追踪的时间
+		WriteTimeout:   cfg.deadline + 10*time.Second,
+		IdleTimeout:    60 * time.Second,
+		MaxHeaderBytes: 8 << 10,
+	}
+	go srv.Serve(ln)
+	cfg.logger.Warn("serving traces", "url", fmt.Sprintf("http://%s/trace?domain=example.com", ln.Addr()), "max", cfg.max, "deadline", cfg.deadline)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
+
+func (s *traceServer) handleTrace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.writeError(w, http.StatusMethodNotAllowed, "bad_request", "only GET is supported")
+		return
+	}
+	opts, domain, types, err := s.requestOptions(r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	// 名额用完时直接拒绝，不让请求排队占着连接
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		s.writeError(w, http.StatusServiceUnavailable, "busy", fmt.Sprintf("%d traces already running (-serve-max)", cap(s.slots)))
+		return
+	}
+	tr, err := trace.New(opts)
+	if err != nil {
+		var optErr *trace.OptionError
+		if errors.As(err, &optErr) {
+			err = optErr.Err
+		}
+		s.writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	defer tr.Close()
+	// 客户端断开时 r.Context() 取消，追踪随之停止
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.deadline)
+	defer cancel()
+	if err := tr.Prepare(ctx); err != nil {
+		s.writeError(w, http.StatusBadGateway, "network_error", "cannot start at -from zone: "+err.Error())
+		return
+	}
+	start := time.Now()
+	report, status := tr.Run(ctx, domain, types, nil)
+	elapsed := time.Since(start)
+	switch {
+	case r.Context().Err() != nil:
+		s.cfg.logger.Info("client went away, trace abandoned", "domain", domain, "remote", r.RemoteAddr)
+		return
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		s.writeError(w, http.StatusGatewayTimeout, "timeout", fmt.Sprintf("trace did not finish within %s (-deadline)", s.cfg.deadline))
+		return
+	}
+	entry := batchEntry{
+		Domain:     dns.Fqdn(report.Domain),
+		Status:     status.String(),
+		ExitCode:   exitCode(report, status),
+		DurationMs: float64(elapsed.Microseconds()) / 1000,
+		Report:     report,
+	}
+	s.writeJSON(w, http.StatusOK, entry)
+}
+
+// requestOptions 校验查询参数：domain 必须给出，type、dnssec、validate 和 iptype 覆盖命令行上的设置
+func (s *traceServer) requestOptions(r *http.Request) (trace.Options, string, string, error) {
+	opts := s.cfg.base
+	q := r.URL.Query()
+	arg := q.Get("domain")
+	if arg == "" {
+		return opts, "", "", errors.New("missing domain parameter")
+	}
+	types := opts.QueryType
+	typeSet := q.Has("type")
+	if typeSet {
+		types = q.Get("type")
+		if err := trace.ValidateQueryTypes(types); err != nil {
+			return opts, "", "", err
+		}
+	}
+	var domain string
+	if net.ParseIP(arg) != nil {
+		arpa, err := dns.ReverseAddr(arg)
+		if err != nil {
+			return opts, "", "", fmt.Errorf("invalid address: %v", err)
+		}
+		domain, types = arpa, "ptr"
+	} else {
+		var err error
+		if domain, err = trace.ToASCII(arg); err != nil {
+			return opts, "", "", err
+		}
+		if _, ok := dns.IsDomainName(domain); !ok {
+			return opts, "", "", fmt.Errorf("invalid domain %q", arg)
+		}
+		// 和命令行一样，追踪根或顶级域时没指定类型就查 NS
+		if trace.IsPublicSuffix(domain) && !typeSet && !s.cfg.typeSet {
+			types = "ns"
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *bool
+	}{{"dnssec", &opts.DNSSEC}, {"validate", &opts.Validate}} {
+		if !q.Has(p.name) {
+			continue
+		}
+		v, err := strconv.ParseBool(q.Get(p.name))
+		if err != nil {
+			return opts, "", "", fmt.Errorf("invalid %s parameter %q", p.name, q.Get(p.name))
+		}
+		*p.dst = v
+	}
+	if q.Has("iptype") {
+		ipt, err := trace.NormalizeIPType(q.Get("iptype"))
+		if err != nil {
+			return opts, "", "", err
+		}
+		opts.AddressFamily = ipt
+	}
+	if opts.Validate {
+		if opts.From != "" || len(opts.Servers) > 0 {
+			return opts, "", "", errors.New("validate builds the chain of trust from the root, mdig was started with -from or -servers")
+		}
+		opts.DNSSEC = true
+	}
+	if opts.DNSSEC && opts.NoEDNS {
+		return opts, "", "", errors.New("dnssec needs EDNS, mdig was started with -bufsize 0")
+	}
+	opts.QueryType = types
+	return opts, domain, types, nil
+}
+
+func (s *traceServer) writeError(w http.ResponseWriter, code int, kind, msg string) {
+	s.writeJSON(w, code, serveError{Error: msg, Code: kind})
+}
+
+func (s *traceServer) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		s.cfg.logger.Debug("cannot write response", "error", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// 请求的 Options 只由 serveConfig 和查询参数决定：命令行的 -dnstype 通过 typeSet 传进来
+func TestServeRequestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     serveConfig
+		query   string
+		domain  string
+		types   string
+		wantErr string
+	}{
+		{name: "default type", cfg: serveConfig{base: trace.Options{QueryType: "a"}}, query: "domain=example.com", domain: "example.com", types: "a"},
+		{name: "type parameter", cfg: serveConfig{base: trace.Options{QueryType: "a"}}, query: "domain=example.com&type=mx", domain: "example.com", types: "mx"},
+		{name: "address", cfg: serveConfig{base: trace.Options{QueryType: "a"}}, query: "domain=192.0.2.1", domain: "1.2.0.192.in-addr.arpa.", types: "ptr"},
+		{name: "public suffix", cfg: serveConfig{base: trace.Options{QueryType: "a"}}, query: "domain=com", domain: "com", types: "ns"},
+		{name: "public suffix with -dnstype", cfg: serveConfig{base: trace.Options{QueryType: "a"}, typeSet: true}, query: "domain=com", domain: "com", types: "a"},
+		{name: "missing domain", query: "type=a", wantErr: "missing domain"},
+		{name: "validate with -from", cfg: serveConfig{base: trace.Options{From: "com."}}, query: "domain=example.com&validate=1", wantErr: "-from"},
+		{name: "bad bool", query: "domain=example.com&dnssec=maybe", wantErr: "invalid dnssec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &traceServer{cfg: tt.cfg}
+			opts, domain, types, err := s.requestOptions(httptest.NewRequest(http.MethodGet, "/trace?"+tt.query, nil))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if domain != tt.domain || types != tt.types || opts.QueryType != tt.types {
+				t.Errorf("domain %q, types %q (options %q); want %q, %q", domain, types, opts.QueryType, tt.domain, tt.types)
+			}
+		})
+	}
+}
+
+// 名额用完时直接返回 503，错误写成 JSON
+func TestServeBusy(t *testing.T) {
+	s := &traceServer{cfg: serveConfig{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}, slots: make(chan struct{})}
+	w := httptest.NewRecorder()
+	s.handleTrace(w, httptest.NewRequest(http.MethodGet, "/trace?domain=example.com", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"code": "busy"`) {
+		t.Errorf("status %d, body %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// sigExpiryNote 描述一个签名还有多久过期，精确时间用 UTC 显示
+func sigExpiryNote(w trace.SigWarning) string {
+	at := w.Expiration.UTC().Format(time.RFC3339)
+	if w.Expired {
+		return fmt.Sprintf("RRSIG for %s/%s (key tag %d) expired at %s", w.Owner, w.TypeCovered, w.KeyTag, at)
+	}
+	in := time.Duration(w.ExpiresInSec) * time.Second
+	return fmt.Sprintf("RRSIG for %s/%s (key tag %d) expires in %s at %s", w.Owner, w.TypeCovered, w.KeyTag, in, at)
+}
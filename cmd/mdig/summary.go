@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func printSummary(summary []trace.ServerSummary, rate *trace.QueryRate) {
+	fmt.Println("Summary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tQUERIES\tOK\tFAIL\tMIN\tAVG\tMAX")
+	for _, s := range summary {
+		rtt := "-\t-\t-"
+		if s.Successes > 0 {
+			rtt = fmt.Sprintf("%.1fms\t%.1fms\t%.1fms", s.MinRTTMs, s.AvgRTTMs, s.MaxRTTMs)
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%d\t%d\t%s\n", s.Hostname, s.IP, s.Queries, s.Successes, s.Failures, rtt)
+	}
+	w.Flush()
+	if rate != nil {
+		limit := ""
+		if rate.Limit > 0 {
+			limit = fmt.Sprintf(", limit %g qps", rate.Limit)
+		}
+		conns := ""
+		if rate.Connections > 0 {
+			conns = fmt.Sprintf(" over %d connections", rate.Connections)
+		}
+		// 查询数、耗时和缓存命中在 printUsage 的开销里
+		fmt.Printf("  average %.1f qps%s%s\n", rate.QPS, conns, limit)
+		if rate.DiskHits > 0 || rate.DiskMisses > 0 {
+			fmt.Printf("  disk cache (-cache-dir): %d hits, %d misses\n", rate.DiskHits, rate.DiskMisses)
+		}
+		if rate.BudgetHits > 0 {
+			fmt.Printf("  level budget (-level-timeout) used up at %d levels\n", rate.BudgetHits)
+		}
+	}
+}
+
+// usageCounts 按 keys 的顺序列出 counts 里不为 0 的项，例如 "3 root, 30 authoritative"
+func usageCounts(counts map[string]int64, keys ...string) string {
+	var parts []string
+	for _, k := range keys {
+		if n := counts[k]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, k))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printUsage 输出报告末尾的资源开销，what 说明统计的范围
+func printUsage(what string, u *trace.Usage) {
+	fmt.Printf("%s: %d queries in %.0fms (%s)\n", what, u.Total, u.ElapsedMs,
+		usageCounts(u.Queries, trace.DestRoot, trace.DestTLD, trace.DestAuthoritative, trace.DestResolver))
+	fmt.Printf("  %d bytes sent, %d bytes received over %s\n", u.BytesSent, u.BytesReceived, usageCounts(u.Exchanges, "udp", "tcp", "tls", "https"))
+	fmt.Printf("  %d retries, %d tcp fallbacks, %d cache hits\n", u.Retries, u.TCPFallbacks, u.CacheHits)
+}
+
+// slowThreshold 把 JSON 里的毫秒数还原成 -warn-rtt 的写法
+func slowThreshold(c *trace.SlowCheck) time.Duration {
+	return time.Duration(c.ThresholdMs * float64(time.Millisecond))
+}
+
+// printSlow 列出超过 -warn-rtt 的查询；最终一级的权威应答超过阈值时退出码是 11
+func printSlow(c *trace.SlowCheck) {
+	threshold := slowThreshold(c)
+	if len(c.Queries) == 0 {
+		fmt.Printf("Slow queries: none over %s\n", threshold)
+		return
+	}
+	fmt.Printf("Slow queries (over %s):\n", threshold)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, q := range c.Queries {
+		rtt := fmt.Sprintf("%.1fms", q.RTTMs)
+		if q.TimedOut {
+			rtt = "timed out after " + rtt
+		}
+		line := fmt.Sprintf("  %s\t%s\t%s\t%s\t%s", levelZone(q.Level, q.Zone), q.Hostname, q.IP, q.Qtype, rtt)
+		if q.Final {
+			line += "\t! final answer"
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+}
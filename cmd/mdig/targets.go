@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// traceTarget 是命令行上的一个追踪目标：Domain 是实际查询的名字（A-label 或 in-addr.arpa），
+// Types 是这个目标要查的类型，IP 地址和 TLSA 目标会改变默认类型
+type traceTarget struct {
+	Arg           string
+	Domain        string
+	UnicodeDomain string
+	Types         string
+	header        string
+}
+
+// parseTarget 把一个命令行参数转换成追踪目标，参数无效时返回错误
+func parseTarget(tr *trace.Tracer, arg string) (traceTarget, error) {
+	t := traceTarget{Arg: arg, Types: dnstype}
+	if net.ParseIP(arg) != nil {
+		arpa, err := dns.ReverseAddr(arg)
+		if err != nil {
+			return t, fmt.Errorf("invalid address: %v", err)
+		}
+		if zone := tr.StartZone(); !dns.IsSubDomain(zone, arpa) {
+			return t, fmt.Errorf("-from %s is not an ancestor of %s", zone, arpa)
+		}
+		t.Domain, t.Types = arpa, "ptr"
+		t.header = fmt.Sprintf("Tracing DNS for domain:  %s (%s)", arg, arpa)
+		return t, nil
+	}
+	if reverse {
+		return t, fmt.Errorf("-x requires an IP address, got %q", arg)
+	}
+	// 国际化域名统一转成 A-label 后再查询和比较
+	domain, err := trace.ToASCII(arg)
+	if err != nil {
+		return t, err
+	}
+	if tlsaPort != "" {
+		prefix, err := tlsaPrefix(tlsaPort)
+		if err != nil {
+			return t, err
+		}
+		domain = prefix + domain
+		if !flagSet("dnstype") {
+			t.Types = "tlsa"
+		}
+	}
+	// 追踪根或顶级域时通常是想看它的 NS 集合，没指定 -dnstype 就改查 NS
+	if trace.IsPublicSuffix(domain) && !flagSet("dnstype") {
+		t.Types = "ns"
+	}
+	if zone := tr.StartZone(); !dns.IsSubDomain(zone, dns.Fqdn(domain)) {
+		return t, fmt.Errorf("-from %s is not an ancestor of %s", zone, domain)
+	}
+	t.Domain = domain
+	if u := trace.ToUnicode(domain); u != domain {
+		t.UnicodeDomain = u
+		t.header = fmt.Sprintf("Tracing DNS for domain:  %s (%s)", u, domain)
+	} else {
+		t.header = fmt.Sprintf("Tracing DNS for domain:  %s", domain)
+	}
+	return t, nil
+}
+
+// printHeader 输出文本格式里每个目标的开头：追踪的名字、-proxy 和查询 NS 地址用的递归服务器及其来源
+func (t traceTarget) printHeader() {
+	fmt.Println(t.header)
+	if proxyFlag != "" {
+		fmt.Printf("Proxy:                   %s (all queries over TCP)\n", redactProxy(proxyFlag))
+	}
+	list := strings.Split(dnsServer, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	if len(list) == 1 {
+		fmt.Printf("Bootstrap resolver:      %s (%s)\n", list[0], resolverOrigin)
+		return
+	}
+	fmt.Printf("Bootstrap resolvers:     %s (%s, in failover order)\n", strings.Join(list, ", "), resolverOrigin)
+}
+
+// redactProxy 隐去 -proxy 里的密码
+func redactProxy(spec string) string {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return spec
+	}
+	return u.Redacted()
+}
+
+// traceAll 追踪全部目标，每个目标完成时调用 done（不会并发调用），i 是目标在 targets 里的下标。
+// 文本输出边追踪边打印，目标依次追踪；其他格式最多同时追踪 -concurrency 个目标，一个目标失败不影响其余目标。
+// ctx 取消后尚未开始的目标不再追踪，直接以中断状态报告
+func traceAll(ctx context.Context, tr *trace.Tracer, targets []traceTarget, done func(i int, report trace.Report, status trace.Status, elapsed time.Duration)) {
+	if output == "text" {
+		for i, t := range targets {
+			if ctx.Err() != nil {
+				done(i, trace.Report{Domain: t.Domain, UnicodeDomain: t.UnicodeDomain}, trace.StatusAborted, 0)
+				continue
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			t.printHeader()
+			start := time.Now()
+			emit, wait := levelPrinter(ctx, tr, func(res trace.Result) {
+				progress.hide(func() { printDNSResult(res) })
+			})
+			report, status := tr.Run(ctx, t.Domain, t.Types, emit)
+			wait()
+			progress.hide(func() { printTextReport(report) })
+			done(i, report, status, time.Since(start))
+		}
+		return
+	}
+	var emit func(trace.Result)
+	if output == "ndjson" {
+		emit = func(res trace.Result) {
+			writeEvent(trace.Event{Event: "level_complete", Domain: res.Domain, Level: res.Level, Authorities: len(res.Authorities), Error: res.Error})
+		}
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, concurrency)
+	for i, t := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			done(i, trace.Report{Domain: t.Domain, UnicodeDomain: t.UnicodeDomain}, trace.StatusAborted, 0)
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			report, status := tr.Run(ctx, t.Domain, t.Types, emit)
+			mu.Lock()
+			defer mu.Unlock()
+			done(i, report, status, time.Since(start))
+		}()
+	}
+	wg.Wait()
+}
+
+// invalidTarget 是 -f 文件里无法解析的一行，Err 带文件名和行号
+type invalidTarget struct {
+	Arg string
+	Err error
+}
+
+// readTargetFile 从 path（"-" 表示标准输入）逐行读取追踪目标，忽略空行和 # 开头的注释行；
+// 无法解析的行带行号报告到标准错误，不追踪，单独返回以便批量 JSON 为它们各写一项
+func readTargetFile(tr *trace.Tracer, path string) ([]traceTarget, []invalidTarget, error) {
+	var r io.Reader = os.Stdin
+	name := "stdin"
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r, name = f, path
+	}
+	var targets []traceTarget
+	var invalid []invalidTarget
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var err error
+		if fields := strings.Fields(line); len(fields) > 1 {
+			err = fmt.Errorf("%s:%d: expected one domain per line, got %q", name, n, line)
+		} else if t, perr := parseTarget(tr, line); perr != nil {
+			err = fmt.Errorf("%s:%d: %v", name, n, perr)
+		} else {
+			targets = append(targets, t)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, err)
+		invalid = append(invalid, invalidTarget{Arg: line, Err: err})
+	}
+	if err := scanner.Err(); err != nil {
+		return targets, invalid, fmt.Errorf("%s: %v", name, err)
+	}
+	return targets, invalid, nil
+}
+
+// printTextReport 输出文本格式里各级结果之后的 CNAME 链、不一致警告、比较结果和汇总表
+func printTextReport(report trace.Report) {
+	if len(report.CNAMEChain) > 0 {
+		fmt.Printf("CNAME chain: %s\n", formatCNAMEChain(report.CNAMEChain))
+	}
+	if report.CNAMEError != "" {
+		fmt.Printf("! %s\n", report.CNAMEError)
+	}
+	for _, res := range report.Results {
+		if res.NSCheck.Mismatch() {
+			fmt.Printf("! NS mismatch between parent and child for %s: %s\n", res.NSCheck.Zone, formatNSMismatch(res.NSCheck))
+		}
+		if res.GlueCheck.Mismatch() {
+			fmt.Printf("! glue mismatch for %s: %s\n", res.GlueCheck.Zone, strings.Join(glueMismatches(res.GlueCheck), "; "))
+		}
+	}
+	for _, d := range report.Dangling {
+		fmt.Printf("! dangling NS for %s: %s\n", d.Zone, d)
+	}
+	for _, g := range report.DelegationGlue {
+		if g.Verdict != trace.GlueFull {
+			printDelegationGlue(g)
+		}
+	}
+	if exp := report.RRSIGExpiry; exp != nil {
+		for _, w := range exp.Warnings {
+			fmt.Printf("! %s\n", sigExpiryNote(w))
+		}
+	}
+	if report.Diff != nil {
+		printDiff(report.Diff)
+	}
+	if report.Resolvers != nil {
+		printResolverComparison(report.Resolvers)
+	}
+	if report.Hijack != nil {
+		printHijackCheck(report.Hijack)
+	}
+	if checkDS {
+		printDSCheck(report.Results)
+	}
+	if report.Serial != nil {
+		printSerialCheck(report.Serial)
+	}
+	if report.AXFR != nil {
+		printAXFRCheck(report.AXFR)
+	}
+	if report.Recursion != nil {
+		printRecursionCheck(report.Recursion)
+	}
+	if report.EDNS != nil {
+		printEDNSCheck(report.EDNS)
+	}
+	if report.TCP != nil {
+		printTCPCheck(report.TCP)
+	}
+	if report.IPv6 != nil {
+		printV6Check(report.IPv6)
+	}
+	if report.Diversity != nil {
+		printDiversityCheck(report.Diversity)
+	}
+	if report.RFC2182 != nil {
+		printRFC2182Check(report.RFC2182)
+	}
+	if report.Wildcard != nil {
+		printWildcardCheck(report.Wildcard)
+	}
+	if report.Verify != nil {
+		printVerifyCheck(report.Verify)
+	}
+	if report.Probe != nil {
+		printProbeCheck(report.Probe)
+	}
+	if report.ECSProbe != nil {
+		printECSProbe(report.ECSProbe)
+	}
+	if report.TTL != nil {
+		printTTLCheck(report.TTL)
+	}
+	if report.Propagation != nil {
+		printPropagation(report.Propagation)
+	}
+	if report.Rank != nil {
+		printRank(report.Rank)
+	}
+	if report.Tree != nil {
+		printTree(report.Tree)
+	}
+	if report.Slow != nil {
+		printSlow(report.Slow)
+	}
+	if summary {
+		printSummary(report.Summary, report.Rate)
+		if exp := report.RRSIGExpiry; exp != nil && exp.Soonest != nil {
+			fmt.Printf("  soonest expiring signature: %s\n", sigExpiryNote(*exp.Soonest))
+		}
+	}
+	if report.Health != nil {
+		printHealth(report.Health)
+	}
+	if report.Usage != nil {
+		printUsage("Cost of this trace, including checks", report.Usage)
+	}
+}
+
+// exitCode 把一个目标的追踪结果换算成退出码
+func exitCode(report trace.Report, status trace.Status) int {
+	// 给出断言时只看断言：期望 NXDOMAIN 的名字不存在是成功
+	if report.Expect != nil {
+		if len(report.Expect.Failed()) > 0 {
+			return exitExpect
+		}
+		return exitOK
+	}
+	switch status {
+	case trace.StatusNXDomain:
+		return exitNXDomain
+	case trace.StatusNoData:
+		return exitNoData
+	case trace.StatusNetworkError:
+		return exitNetworkError
+	case trace.StatusInvalid:
+		return exitUsage
+	case trace.StatusAborted:
+		return exitAborted
+	case trace.StatusServerFailure:
+		return exitServerFailure
+	case trace.StatusBrokenDelegation:
+		return exitBrokenDelegation
+	}
+	for _, res := range report.Results {
+		if res.Validation != nil && res.Validation.Status == trace.ValidationBogus {
+			return exitBogus
+		}
+		if checkDS && res.Delegation != nil && res.Delegation.Verdict() == trace.DelegationBroken {
+			return exitBogus
+		}
+	}
+	if strict {
+		for _, res := range report.Results {
+			if res.NSCheck.Mismatch() || res.GlueCheck.Mismatch() {
+				return exitInconsistent
+			}
+		}
+		if report.Serial.Mismatch() || len(report.RFC2182.Failed()) > 0 {
+			return exitInconsistent
+		}
+	}
+	if len(report.Hijack.Tampered()) > 0 {
+		return exitHijack
+	}
+	if report.Diff != nil && len(report.Diff.Deviations) > 0 {
+		return exitDiffMismatch
+	}
+	if report.Resolvers != nil {
+		for _, ans := range report.Resolvers.Answers {
+			if ans.Disagrees {
+				return exitDiffMismatch
+			}
+		}
+	}
+	if report.Verify.Disagrees() {
+		return exitDiffMismatch
+	}
+	if report.Slow != nil && report.Slow.FinalBreach {
+		return exitSlow
+	}
+	if report.Since != nil && len(report.Since.Changes) > 0 {
+		return exitChanged
+	}
+	return exitOK
+}
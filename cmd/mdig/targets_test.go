@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		report trace.Report
+		status trace.Status
+		want   int
+	}{
+		{name: "answer", status: trace.StatusAnswer, want: 0},
+		{name: "NXDOMAIN", status: trace.StatusNXDomain, want: 2},
+		{name: "NODATA", status: trace.StatusNoData, want: 3},
+		{name: "every server at a level failed", status: trace.StatusNetworkError, want: 4},
+		{name: "aborted", status: trace.StatusAborted, want: 7},
+		{name: "every server answered SERVFAIL", status: trace.StatusServerFailure, want: 8},
+		{name: "every server lame", status: trace.StatusBrokenDelegation, want: 9},
+		{name: "assertions passed", report: trace.Report{Expect: &trace.ExpectResult{Assertions: []trace.Assertion{{Kind: trace.ExpectAddr, Passed: true}}}}, status: trace.StatusAnswer, want: 0},
+		// 断言只看断言：期望 NXDOMAIN 的名字不存在是成功，而应答正常但断言不通过是失败
+		{name: "expected NXDOMAIN", report: trace.Report{Expect: &trace.ExpectResult{Assertions: []trace.Assertion{{Kind: trace.ExpectRcode, Passed: true}}}}, status: trace.StatusNXDomain, want: 0},
+		{name: "assertion failed", report: trace.Report{Expect: &trace.ExpectResult{Assertions: []trace.Assertion{{Kind: trace.ExpectAddr, Passed: true}, {Kind: trace.ExpectNS}}}}, status: trace.StatusAnswer, want: 14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.report, tt.status); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// -f 里无法解析的行不追踪，但每行都有一项状态为 invalid、带解析错误和参数错误退出码的批量结果
+func TestReadTargetFileInvalid(t *testing.T) {
+	tr, err := trace.New(trace.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("# comment\nexample.com\n\nexample.org extra\nbad..name\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	targets, invalid, err := readTargetFile(tr, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].Arg != "example.com" {
+		t.Errorf("targets = %+v, want example.com", targets)
+	}
+	if len(invalid) != 2 || invalid[0].Arg != "example.org extra" || invalid[1].Arg != "bad..name" {
+		t.Fatalf("invalid = %+v, want lines 4 and 5", invalid)
+	}
+	if msg := invalid[0].Err.Error(); !strings.HasPrefix(msg, path+":4: ") {
+		t.Errorf("error = %q, want the file name and line number", msg)
+	}
+	data, err := json.Marshal(newInvalidEntry(invalid[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["status"] != "invalid" || entry["exit_code"] != float64(exitUsage) || !strings.Contains(entry["error"].(string), ":5: ") {
+		t.Errorf("batch entry = %s", data)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func tcpColumn(q trace.TCPResult) string {
+	switch q.Status {
+	case trace.TCPMatch:
+		if q.UDPFailed {
+			return "ok (UDP had no answer)"
+		}
+		return "ok, same answer as UDP"
+	case trace.TCPMismatch:
+		return fmt.Sprintf("! answer differs: udp %s, tcp %s", q.UDP, q.TCP)
+	case trace.TCPConnectFailed:
+		return "! " + q.Error
+	}
+	return "! no answer over TCP: " + q.Error
+}
+
+// udpOnlyList 把只能用 UDP 访问的服务器列成一行
+func udpOnlyList(c *trace.TCPCheck) string {
+	var servers []string
+	for _, q := range c.UDPOnly() {
+		servers = append(servers, fmt.Sprintf("%s (%s)", q.Hostname, q.IP))
+	}
+	return strings.Join(servers, ", ")
+}
+
+func printTCPCheck(c *trace.TCPCheck) {
+	fmt.Println("TCP check:")
+	if len(c.Queries) == 0 {
+		fmt.Printf("  ! %s\n", c.Error)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tZONE\tQUERY\tRESULT")
+	for _, q := range c.Queries {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s %s\t%s\n", q.Hostname, q.IP, q.Zone, q.Domain, q.Qtype, tcpColumn(q))
+	}
+	w.Flush()
+	if list := udpOnlyList(c); list != "" {
+		fmt.Printf("  ! UDP-only servers, answers larger than the UDP limit will fail: %s\n", list)
+	}
+}
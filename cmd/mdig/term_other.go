@@ -0,0 +1,18 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoRawTerminal = errors.New("-tui is not supported on this platform")
+
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errNoRawTerminal
+}
+
+func terminalSize(f *os.File) (width, height int, err error) {
+	return 0, 0, errNoRawTerminal
+}
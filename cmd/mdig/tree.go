@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// treeGroup 是一级里给出相同结果的服务器，next 是它们共同的下一级（子树已在别处展开或没有展开时为 nil），
+// subtree 是转介的 QueryResult.Subtree
+type treeGroup struct {
+	outcome string
+	hosts   []string
+	next    *trace.Result
+	subtree string
+}
+
+// treeOutcome 把一个查询结果归纳成一句话，结果相同的服务器合并成一行
+func treeOutcome(qr trace.QueryResult) string {
+	switch {
+	case qr.Error != "":
+		return "! " + qr.Error
+	case len(qr.NS) > 0:
+		return fmt.Sprintf("referral to %s (%s)", qr.Referral, strings.Join(qr.NS, ", "))
+	case len(qr.Answers) > 0:
+		return fmt.Sprintf("%s answer: %s", qr.Qtype, strings.Join(qr.Answers, ", "))
+	}
+	return fmt.Sprintf("%s %s", qr.Qtype, trace.RcodeText(qr.Rcode, qr.EDE))
+}
+
+func treeGroups(res *trace.Result) []treeGroup {
+	var groups []treeGroup
+	index := make(map[string]int)
+	group := func(outcome, host string) *treeGroup {
+		i, ok := index[outcome]
+		if !ok {
+			i = len(groups)
+			index[outcome] = i
+			groups = append(groups, treeGroup{outcome: outcome})
+		}
+		g := &groups[i]
+		if len(g.hosts) == 0 || g.hosts[len(g.hosts)-1] != host {
+			g.hosts = append(g.hosts, host)
+		}
+		return g
+	}
+	for _, auth := range res.Authorities {
+		if auth.Code == trace.ErrLimited {
+			// -max-ns 没有查询的服务器合成一行，它们不是出了问题
+			group(auth.Error, auth.Hostname)
+			continue
+		}
+		if auth.Error != "" {
+			groups = append(groups, treeGroup{outcome: "! " + auth.Error, hosts: []string{auth.Hostname}})
+			continue
+		}
+		for _, qr := range auth.QueryResults {
+			g := group(treeOutcome(qr), auth.Hostname)
+			if qr.NextLevel != nil {
+				g.next = qr.NextLevel
+			}
+			if qr.Subtree != "" {
+				g.subtree = qr.Subtree
+			}
+		}
+	}
+	return groups
+}
+
+// treeHosts 服务器太多时只写首尾两台和总数，例如 a.root-servers.net. … m.root-servers.net. (13 servers)
+func treeHosts(hosts []string) string {
+	if len(hosts) <= 3 {
+		return strings.Join(hosts, ", ")
+	}
+	return fmt.Sprintf("%s … %s (%d servers)", hosts[0], hosts[len(hosts)-1], len(hosts))
+}
+
+// expandedSubtrees 返回树里确实展开过的子树；到了 -maxdepth 或追踪被中断时没有展开的子树不在其中
+func expandedSubtrees(res *trace.Result, expanded map[string]bool) map[string]bool {
+	if expanded == nil {
+		expanded = make(map[string]bool)
+	}
+	for _, auth := range res.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.NextLevel != nil {
+				expanded[qr.Subtree] = true
+				expandedSubtrees(qr.NextLevel, expanded)
+			}
+		}
+	}
+	return expanded
+}
+
+func writeTreeNode(w io.Writer, res *trace.Result, indent string, expanded map[string]bool) {
+	groups := treeGroups(res)
+	for i, g := range groups {
+		branch, child := "├─ ", "│  "
+		if i == len(groups)-1 {
+			branch, child = "└─ ", "   "
+		}
+		note := ""
+		if g.next == nil && expanded[g.subtree] {
+			note = " (expanded above)"
+		}
+		fmt.Fprintf(w, "%s%s%s: %s%s\n", indent, branch, treeHosts(g.hosts), g.outcome, note)
+		if g.next != nil {
+			writeTreeLevel(w, g.next, indent+child, expanded)
+		}
+	}
+}
+
+// writeTreeLevel 先写出这一级的区切分，再写出它下面按结果分组的服务器；
+// 各服务器的错误会逐个列出，级别本身的错误只在一台服务器都没有时才写
+func writeTreeLevel(w io.Writer, res *trace.Result, indent string, expanded map[string]bool) {
+	label := levelLabel(*res)
+	if res.Error != "" && len(res.Authorities) == 0 {
+		label += " ! " + res.Error
+	}
+	fmt.Fprintf(w, "%s%s\n", indent, label)
+	writeTreeNode(w, res, indent, expanded)
+}
+
+func printTree(tree *trace.Result) {
+	fmt.Printf("Delegation tree for %s:\n", tree.Domain)
+	writeTreeLevel(os.Stdout, tree, "  ", expandedSubtrees(tree, nil))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// 只有在树里别处确实展开过的子树才注明 (expanded above)；到了 -maxdepth 没有展开的子树不注明
+func TestWriteTreeExpandedNote(t *testing.T) {
+	referral := func(zone string, next *trace.Result, ns ...string) trace.QueryResult {
+		return trace.QueryResult{Qtype: "A", Referral: zone, NS: ns, Subtree: zone + " " + strings.Join(ns, " "), NextLevel: next}
+	}
+	level := func(zone string, qrs ...trace.QueryResult) *trace.Result {
+		return &trace.Result{Zone: zone, Authorities: []trace.AuthorityServer{{Hostname: "ns." + zone, QueryResults: qrs}}}
+	}
+	// ns1.test. 和 ns2.test. 给出 example.test. 的两组不同的 NS，两个子树里都有 sub.example.test. 的同一个转介，
+	// 只在 ns1.test. 下面展开；ns2.test. 下面的 deep.example.test. 到了最大深度没有展开
+	sub := level("sub.example.test.")
+	tree := &trace.Result{Domain: "www.sub.example.test.", Zone: "test.", Authorities: []trace.AuthorityServer{
+		{Hostname: "ns1.test.", QueryResults: []trace.QueryResult{
+			referral("example.test.", level("example.test.", referral("sub.example.test.", sub, "ns.sub.example.test.")), "ns1.example.test."),
+		}},
+		{Hostname: "ns2.test.", QueryResults: []trace.QueryResult{
+			referral("example.test.", level("example.test.",
+				referral("sub.example.test.", nil, "ns.sub.example.test."),
+				referral("deep.example.test.", nil, "ns.deep.example.test.")), "ns2.example.test."),
+		}},
+	}}
+	var b strings.Builder
+	writeTreeLevel(&b, tree, "", expandedSubtrees(tree, nil))
+	var marked []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if strings.HasSuffix(line, "(expanded above)") {
+			marked = append(marked, line)
+		}
+	}
+	if len(marked) != 1 || !strings.Contains(marked[0], "referral to sub.example.test.") {
+		t.Errorf("lines marked as expanded above: %q\n%s", marked, b.String())
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// ttlBounds 描述检查用的 TTL 范围，上限为 0 时不检查
+func ttlBounds(c *trace.TTLCheck) string {
+	if c.MaxSec == 0 {
+		return fmt.Sprintf("min %ds", c.MinSec)
+	}
+	return fmt.Sprintf("min %ds, max %ds", c.MinSec, c.MaxSec)
+}
+
+// ttlServers 列出给出某个取值的服务器；所有服务器一致时只给出数量
+func ttlServers(set trace.TTLRRset, v trace.TTLValue) string {
+	if !set.Disagree && len(v.Servers) > 2 {
+		return fmt.Sprintf("all %d servers", len(v.Servers))
+	}
+	servers := make([]string, len(v.Servers))
+	for i, s := range v.Servers {
+		servers[i] = s.Hostname + " " + s.IP
+	}
+	return strings.Join(servers, ", ")
+}
+
+// ttlColumn 说明一个 TTL 取值的问题；不一致时每一项都标出，超出范围时写明越过了哪个界限
+func ttlColumn(set trace.TTLRRset, v trace.TTLValue) string {
+	var notes []string
+	if set.Disagree {
+		notes = append(notes, "differs")
+	}
+	if v.Problem != "" {
+		notes = append(notes, v.Problem)
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "! " + strings.Join(notes, ", ")
+}
+
+func printTTLCheck(c *trace.TTLCheck) {
+	fmt.Printf("TTL check (%d RRsets compared, %s for delegation NS and apex records):\n", c.Checked, ttlBounds(c))
+	if !c.Problems() {
+		fmt.Println("  all servers agree and every TTL is within range")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ZONE\tRRSET\tKIND\tTTL\tRESULT\tSERVERS")
+	for _, set := range c.RRsets {
+		kind := set.Kind
+		if kind == "" {
+			kind = "-"
+		}
+		for i, v := range set.Values {
+			zone, rrset := set.Zone, set.Name+" "+set.Type
+			if i > 0 {
+				zone, rrset, kind = "", "", ""
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%ds\t%s\t%s\n", zone, rrset, kind, v.TTL, ttlColumn(set, v), ttlServers(set, v))
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// tuiKey 标识 -tui 树里的一个节点：一级、一台服务器或者服务器的一次查询，用不到的下标为 -1
+type tuiKey struct {
+	level, auth, query int
+}
+
+// tuiRow 是屏幕上的一行，detail 行是展开的节点下面的说明，光标可以停在上面但不能再展开
+type tuiRow struct {
+	key    tuiKey
+	detail bool
+	text   string
+}
+
+// tuiState 是交互界面的状态，节点直接对应 report 里的 Results、Authorities 和 QueryResults；
+// 重新查询的结果写回 report，其他输出用的也是同一个模型
+type tuiState struct {
+	tr        *trace.Tracer
+	domain    string
+	report    *trace.Report
+	expanded  map[tuiKey]bool
+	requeried map[tuiKey]bool
+	cursor    int
+	top       int
+	view      int
+	message   string
+	out       *bufio.Writer
+}
+
+const tuiHelp = "↑↓ move  ←→ collapse/expand  enter toggle  r re-run query  q quit"
+
+// exploreTarget 追踪 t 后进入 -tui；终端无法切换到原始模式时照常输出文本结果
+func exploreTarget(ctx context.Context, tr *trace.Tracer, t traceTarget) int {
+	runCtx := ctx
+	if deadline > 0 {
+		// -deadline 只限制追踪本身，之后在界面里重新查询不受影响
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	report, status := tr.Run(runCtx, t.Domain, t.Types, nil)
+	stopProgress()
+	if err := exploreReport(ctx, tr, &report); err != nil {
+		logger.Warn("cannot start the interactive view, printing the trace", "error", err)
+		t.printHeader()
+		for _, res := range report.Results {
+			printDNSResult(res)
+		}
+		printTextReport(report)
+	}
+	return exitCode(report, status)
+}
+
+func exploreReport(ctx context.Context, tr *trace.Tracer, report *trace.Report) error {
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	s := &tuiState{
+		tr:        tr,
+		domain:    report.Domain,
+		report:    report,
+		expanded:  make(map[tuiKey]bool),
+		requeried: make(map[tuiKey]bool),
+		out:       bufio.NewWriter(os.Stdout),
+	}
+	if report.UnicodeDomain != "" {
+		s.domain = report.UnicodeDomain
+	}
+	// 一开始展开每一级、折叠每台服务器，整条委派链在一屏里
+	for i := range report.Results {
+		s.expanded[tuiKey{i, -1, -1}] = true
+	}
+	// 使用备用屏幕并隐藏光标，退出后终端恢复原来的内容
+	fmt.Fprint(s.out, "\033[?1049h\033[?25l")
+	defer func() {
+		fmt.Fprint(s.out, "\033[?25h\033[?1049l")
+		s.out.Flush()
+	}()
+	buf := make([]byte, 64)
+	for {
+		s.draw(s.rows())
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil
+		}
+		for b := buf[:n]; len(b) > 0; {
+			key, size := readKey(b)
+			b = b[size:]
+			if !s.handle(ctx, key) {
+				return nil
+			}
+		}
+	}
+}
+
+// rows 按当前的展开状态列出所有可见的行
+func (s *tuiState) rows() []tuiRow {
+	var rows []tuiRow
+	for i, res := range s.report.Results {
+		lk := tuiKey{i, -1, -1}
+		rows = append(rows, tuiRow{key: lk, text: s.marker(lk) + tuiLevelLine(res)})
+		if !s.expanded[lk] {
+			continue
+		}
+		for _, line := range tuiLevelDetails(res) {
+			rows = append(rows, tuiRow{key: lk, detail: true, text: "    " + line})
+		}
+		for j, auth := range res.Authorities {
+			ak := tuiKey{i, j, -1}
+			rows = append(rows, tuiRow{key: ak, text: "  " + s.marker(ak) + tuiServerLine(auth)})
+			if !s.expanded[ak] {
+				continue
+			}
+			for k, qr := range auth.QueryResults {
+				qk := tuiKey{i, j, k}
+				line := tuiQueryLine(qr)
+				if s.requeried[qk] {
+					line += "  (re-run)"
+				}
+				rows = append(rows, tuiRow{key: qk, text: "    " + s.marker(qk) + line})
+				if !s.expanded[qk] {
+					continue
+				}
+				for _, d := range tuiQueryDetails(qr) {
+					rows = append(rows, tuiRow{key: qk, detail: true, text: "        " + d})
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func (s *tuiState) marker(k tuiKey) string {
+	switch {
+	case !s.hasChildren(k):
+		return "· "
+	case s.expanded[k]:
+		return "▾ "
+	}
+	return "▸ "
+}
+
+// hasChildren 判断节点能否展开：一级总有服务器或说明，服务器要有查询结果，查询总有详细信息
+func (s *tuiState) hasChildren(k tuiKey) bool {
+	switch {
+	case k.query >= 0:
+		return true
+	case k.auth >= 0:
+		return len(s.report.Results[k.level].Authorities[k.auth].QueryResults) > 0
+	}
+	res := s.report.Results[k.level]
+	return len(res.Authorities) > 0 || len(tuiLevelDetails(res)) > 0
+}
+
+func (s *tuiState) draw(rows []tuiRow) {
+	width, height, err := terminalSize(os.Stdout)
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	s.view = max(height-1, 1)
+	s.cursor = min(max(s.cursor, 0), len(rows)-1)
+	if s.cursor < s.top {
+		s.top = s.cursor
+	}
+	if s.cursor >= s.top+s.view {
+		s.top = s.cursor - s.view + 1
+	}
+	s.top = max(min(s.top, len(rows)-s.view), 0)
+	fmt.Fprint(s.out, "\033[H")
+	for i := s.top; i < min(len(rows), s.top+s.view); i++ {
+		line := truncateRunes(rows[i].text, width)
+		if i == s.cursor {
+			line = "\033[7m" + line + strings.Repeat(" ", width-len([]rune(line))) + "\033[0m"
+		}
+		fmt.Fprint(s.out, line+"\033[K\n")
+	}
+	// 最后一行是状态栏：写到最后一列之前为止，避免整屏上滚
+	status := s.message
+	if status == "" {
+		status = fmt.Sprintf("%s — %d/%d — %s", s.domain, s.cursor+1, len(rows), tuiHelp)
+	}
+	fmt.Fprintf(s.out, "\033[J\033[%d;1H\033[7m%s\033[0m", height, truncateRunes(status, width-1))
+	s.out.Flush()
+}
+
+// handle 处理一个按键，返回 false 表示退出
+func (s *tuiState) handle(ctx context.Context, key string) bool {
+	rows := s.rows()
+	if len(rows) == 0 {
+		return key != "q" && key != "ctrl-c" && key != "esc"
+	}
+	s.cursor = min(max(s.cursor, 0), len(rows)-1)
+	cur := rows[s.cursor]
+	s.message = ""
+	switch key {
+	case "q", "ctrl-c", "esc":
+		return false
+	case "up", "k":
+		s.cursor--
+	case "down", "j":
+		s.cursor++
+	case "pgup":
+		s.cursor -= s.view
+	case "pgdn":
+		s.cursor += s.view
+	case "home", "g":
+		s.cursor = 0
+	case "end", "G":
+		s.cursor = len(rows) - 1
+	case "right", "l":
+		switch {
+		case cur.detail || !s.hasChildren(cur.key):
+		case !s.expanded[cur.key]:
+			s.expanded[cur.key] = true
+		default:
+			s.cursor++
+		}
+	case "left", "h":
+		if !cur.detail && s.expanded[cur.key] {
+			delete(s.expanded, cur.key)
+		} else {
+			s.focus(tuiParent(cur))
+		}
+	case "enter", " ":
+		if !cur.detail && s.hasChildren(cur.key) {
+			s.expanded[cur.key] = !s.expanded[cur.key]
+		}
+	case "r":
+		s.requery(ctx, cur.key)
+	}
+	return true
+}
+
+// tuiParent 是光标向左移动时要去的节点：说明行回到它所属的节点，其他节点回到上一层
+func tuiParent(row tuiRow) tuiKey {
+	k := row.key
+	switch {
+	case row.detail:
+	case k.query >= 0:
+		k.query = -1
+	case k.auth >= 0:
+		k.auth = -1
+	}
+	return k
+}
+
+func (s *tuiState) focus(k tuiKey) {
+	for i, row := range s.rows() {
+		if row.key == k && !row.detail {
+			s.cursor = i
+			return
+		}
+	}
+}
+
+// requery 重新发出选中的查询；选中的是服务器时重新发出它的全部查询
+func (s *tuiState) requery(ctx context.Context, k tuiKey) {
+	if k.auth < 0 {
+		s.message = "select a server or one of its queries to re-run"
+		return
+	}
+	res := s.report.Results[k.level]
+	auth := &s.report.Results[k.level].Authorities[k.auth]
+	var idx []int
+	if k.query >= 0 {
+		idx = []int{k.query}
+	} else {
+		for i := range auth.QueryResults {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) == 0 {
+		s.message = "no queries were sent to " + auth.Hostname
+		return
+	}
+	s.message = fmt.Sprintf("re-running %d queries to %s…", len(idx), auth.Hostname)
+	s.draw(s.rows())
+	failed := 0
+	for _, i := range idx {
+		old := auth.QueryResults[i]
+		qr, err := s.tr.Requery(ctx, res, old.ServerIP, old.Qtype)
+		if err != nil {
+			s.message = "cannot re-run: " + err.Error()
+			return
+		}
+		auth.QueryResults[i] = qr
+		s.requeried[tuiKey{k.level, k.auth, i}] = true
+		if qr.Error != "" || trace.RcodeFailure(qr.Rcode) {
+			failed++
+		}
+	}
+	s.message = fmt.Sprintf("re-ran %d queries to %s, %d failed", len(idx), auth.Hostname, failed)
+	if k.query < 0 {
+		s.expanded[k] = true
+	}
+}
+
+func tuiLevelLine(res trace.Result) string {
+	line := fmt.Sprintf("Level %d: %s", res.Level, levelName(res))
+	if label := levelLabel(res); label != "" {
+		line += " [" + label + "]"
+	}
+	line += fmt.Sprintf("  %d servers", len(res.Authorities))
+	if res.Error != "" {
+		line += "  ! " + res.Error
+	}
+	return line
+}
+
+func tuiLevelDetails(res trace.Result) []string {
+	var lines []string
+	if lame := lameSummary(res); lame != "" {
+		lines = append(lines, "! "+lame)
+	}
+	if len(res.Unreachable) > 0 {
+		lines = append(lines, "! unreachable: "+strings.Join(res.Unreachable, ", "))
+	}
+	for _, note := range res.Notes {
+		lines = append(lines, "* "+note)
+	}
+	if v := res.Validation; v != nil {
+		line := fmt.Sprintf("DNSSEC (%s): %s", v.Zone, v.Status)
+		if v.Reason != "" {
+			line += " — " + v.Reason
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func tuiServerLine(auth trace.AuthorityServer) string {
+	line := auth.Hostname
+	if len(auth.IPs) > 0 {
+		line += " (" + joinIPs(auth.IPs) + ")"
+	}
+	failed := 0
+	for _, qr := range auth.QueryResults {
+		if qr.Error != "" || trace.RcodeFailure(qr.Rcode) {
+			failed++
+		}
+	}
+	switch {
+	case auth.Error != "":
+		return line + "  ! " + auth.Error
+	case len(auth.Answers) > 0:
+		line += "  " + strings.Join(auth.Answers, ", ")
+	case len(auth.Referrals) > 0:
+		line += "  → " + strings.Join(auth.Referrals, ", ")
+	default:
+		// NXDOMAIN、NODATA 这类没有记录的应答显示第一个应答的状态
+		for _, qr := range auth.QueryResults {
+			if qr.Error == "" {
+				line += "  " + trace.RcodeText(qr.Rcode, qr.EDE) + ", no records"
+				break
+			}
+		}
+	}
+	if failed > 0 {
+		line += fmt.Sprintf("  ! %d of %d queries failed", failed, len(auth.QueryResults))
+	}
+	return line
+}
+
+func tuiQueryLine(qr trace.QueryResult) string {
+	line := qr.ServerIP + " " + qr.Qtype + "  "
+	if qr.Error != "" {
+		line += "! " + qr.Error
+	} else {
+		line += trace.RcodeText(qr.Rcode, qr.EDE)
+		if flags := qr.Flags.String(); flags != "" {
+			line += " [" + flags + "]"
+		}
+	}
+	if qr.RTT > 0 {
+		line += "  " + rttNote(qr)
+	}
+	return line
+}
+
+func tuiQueryDetails(qr trace.QueryResult) []string {
+	if qr.Error != "" {
+		lines := []string{"! " + qr.Error}
+		if qr.Attempts > 0 {
+			lines = append(lines, fmt.Sprintf("%d attempts, %s", qr.Attempts, rttNote(qr)))
+		}
+		return lines
+	}
+	lines := []string{
+		fmt.Sprintf("flags: %s; status: %s; sent %s", qr.Flags, trace.RcodeText(qr.Rcode, qr.EDE), sentFlags(qr)),
+		queryStats(qr),
+	}
+	if qr.NSID != "" {
+		lines = append(lines, "nsid: "+qr.NSID)
+	}
+	for _, o := range qr.EDNSOptions {
+		lines = append(lines, "edns "+o.String())
+	}
+	for _, a := range signedAnswers(qr) {
+		lines = append(lines, "answer: "+a)
+	}
+	if qr.Referral != "" {
+		lines = append(lines, fmt.Sprintf("referral to %s: %s", qr.Referral, strings.Join(qr.NS, ", ")))
+	}
+	for _, g := range qr.Glue {
+		lines = append(lines, fmt.Sprintf("glue: %s %s (ttl %d)", g.Name, g.Address, g.TTL))
+	}
+	if qr.Class == trace.ClassLame {
+		lines = append(lines, "! lame: "+qr.LameReason)
+	}
+	for _, ig := range qr.Ignored {
+		lines = append(lines, fmt.Sprintf("! ignored %s (%s)", ig.Record, ig.Reason))
+	}
+	if qr.CaseMismatch {
+		lines = append(lines, "! 0x20 mismatch — response may be spoofed or rewritten")
+	}
+	return lines
+}
+
+// escapeKeys 是方向键等按键的转义序列（去掉开头的 ESC [ 或 ESC O）
+var escapeKeys = map[string]string{
+	"A": "up", "B": "down", "C": "right", "D": "left",
+	"5~": "pgup", "6~": "pgdn",
+	"H": "home", "1~": "home", "F": "end", "4~": "end",
+}
+
+// readKey 从 b 的开头解析出一个按键，返回按键名和占用的字节数；不认识的转义序列整个跳过
+func readKey(b []byte) (string, int) {
+	if b[0] == 0x1b && len(b) >= 3 && (b[1] == '[' || b[1] == 'O') {
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return escapeKeys[string(b[2:i+1])], i + 1
+			}
+		}
+	}
+	switch b[0] {
+	case 0x1b:
+		return "esc", 1
+	case 3:
+		return "ctrl-c", 1
+	case '\r', '\n':
+		return "enter", 1
+	}
+	return string(b[:1]), 1
+}
+
+func truncateRunes(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:max(width, 0)])
+	}
+	return s
+}
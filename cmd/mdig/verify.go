@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// verifyColumn 一致的重复查询合并成一项，不一致时并排列出每种应答和出现次数
+func verifyColumn(q trace.VerifyResult) string {
+	var note string
+	switch {
+	case len(q.Answers) == 0:
+		note = "! no answer in any attempt"
+	case q.Consistent():
+		note = fmt.Sprintf("verified ×%d: %s", q.Answers[0].Count, q.Answers[0].Answer)
+	default:
+		sets := make([]string, len(q.Answers))
+		for i, a := range q.Answers {
+			sets[i] = fmt.Sprintf("%d× %s", a.Count, a.Answer)
+		}
+		note = "! answers disagree: " + strings.Join(sets, " | ")
+	}
+	if q.Failures > 0 {
+		note += fmt.Sprintf(" (%d without answer, last: %s)", q.Failures, q.LastError)
+	}
+	return note
+}
+
+func printVerifyCheck(c *trace.VerifyCheck) {
+	fmt.Printf("Verification (%d repeats per query):\n", c.Repeats)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tTYPE\tRESULT")
+	for _, q := range c.Queries {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", q.Hostname, q.IP, q.Qtype, verifyColumn(q))
+	}
+	w.Flush()
+}
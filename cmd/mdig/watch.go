@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// watchTargets 实现 -watch：第一次完整输出追踪结果，之后每隔 interval 重新追踪并只输出带时间戳的变化，
+// Ctrl-C 结束时汇总整个会话里出现过的全部变化
+func watchTargets(ctx context.Context, tr *trace.Tracer, targets []traceTarget, interval time.Duration) int {
+	start := time.Now()
+	prev := make([]*trace.Snapshot, len(targets))
+	var history []string
+	for run := 0; ; run++ {
+		for i, t := range targets {
+			tctx, cancel := ctx, context.CancelFunc(func() {})
+			if deadline > 0 {
+				tctx, cancel = context.WithTimeout(ctx, deadline)
+			}
+			var report trace.Report
+			var status trace.Status
+			if run == 0 {
+				if i > 0 {
+					fmt.Println()
+				}
+				t.printHeader()
+				emit, wait := levelPrinter(tctx, tr, printDNSResult)
+				report, status = tr.Run(tctx, t.Domain, t.Types, emit)
+				wait()
+				printTextReport(report)
+			} else {
+				report, status = tr.Run(tctx, t.Domain, t.Types, nil)
+			}
+			cancel()
+			if ctx.Err() != nil {
+				printWatchSummary(history, run, time.Since(start))
+				return exitOK
+			}
+			metrics.recordTrace(t.Domain, report, status)
+			now := time.Now().Format("15:04:05")
+			if status == trace.StatusAborted {
+				// 超过 -deadline 的追踪不完整，不拿它和上一次比较
+				fmt.Printf("[%s] %s: trace aborted, keeping the previous result\n", now, t.Domain)
+				continue
+			}
+			snap := trace.NewSnapshot(report)
+			if prev[i] != nil {
+				changes := trace.CompareSnapshots(prev[i], snap)
+				if len(changes) == 0 {
+					fmt.Printf("[%s] %s: no changes\n", now, t.Domain)
+				}
+				for _, c := range changes {
+					line := fmt.Sprintf("[%s] %s: %s", now, t.Domain, c)
+					fmt.Println(line)
+					history = append(history, line)
+				}
+			}
+			prev[i] = snap
+		}
+		if run == 0 {
+			// 之后的追踪只输出变化
+			fmt.Printf("\nWatching every %s, press Ctrl-C to stop\n", interval)
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			printWatchSummary(history, run+1, time.Since(start))
+			return exitOK
+		}
+	}
+}
+
+func printWatchSummary(history []string, runs int, elapsed time.Duration) {
+	fmt.Printf("\nWatch summary: %d traces over %s", runs, elapsed.Round(time.Second))
+	if len(history) == 0 {
+		fmt.Println(", no changes")
+		return
+	}
+	fmt.Printf(", %d changes:\n", len(history))
+	fmt.Println(strings.Join(history, "\n"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yooyoo41/mdig/trace"
+)
+
+func wildcardColumn(c *trace.WildcardCheck, s trace.WildcardResult) string {
+	var note string
+	switch s.Status {
+	case trace.WildcardMatch:
+		note = "matches wildcard " + c.Wildcard
+	case trace.WildcardDiffers:
+		note = "probe got different records (" + strings.Join(s.Answers, ", ") + "), answer is a real record"
+	case trace.WildcardNone:
+		note = "no wildcard (probe got " + s.Rcode + " without records)"
+	default:
+		note = "probe failed: " + s.Error
+	}
+	if s.Synthesized {
+		note += "; RRSIG labels confirm wildcard synthesis"
+	}
+	return note
+}
+
+func printWildcardCheck(c *trace.WildcardCheck) {
+	if len(c.Servers) == 0 {
+		fmt.Printf("Wildcard check for %s:\n  ! %s\n", c.Domain, c.Error)
+		return
+	}
+	fmt.Printf("Wildcard check for %s (probe %s):\n", c.Domain, c.Probe)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SERVER\tIP\tTYPE\tRESULT")
+	for _, s := range c.Servers {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", s.Hostname, s.IP, s.Qtype, wildcardColumn(c, s))
+	}
+	w.Flush()
+	if c.Matches() {
+		fmt.Printf("  the answer for %s matches wildcard %s\n", c.Domain, c.Wildcard)
+	}
+}
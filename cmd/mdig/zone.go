@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/yooyoo41/mdig/trace"
+)
+
+// zoneRRset 是 -o zone 里同一属主名、类别和类型的记录，servers 是给出过这些记录的服务器
+type zoneRRset struct {
+	owner   string
+	class   uint16
+	rrtype  uint16
+	records []dns.RR
+	seen    map[string]bool
+	servers []string
+}
+
+// zoneRecordKey 去重时不看 TTL：不同服务器给出的同一条记录 TTL 可能已经递减，只保留第一次见到的
+func zoneRecordKey(rr dns.RR) string {
+	c := dns.Copy(rr)
+	c.Header().Ttl = 0
+	return c.String()
+}
+
+// canonicalCompare 按 RFC 4034 6.1 的规范顺序比较两个名字：从最右边的标签开始逐个比较，忽略大小写
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(strings.ToLower(a)), dns.SplitDomainName(strings.ToLower(b))
+	slices.Reverse(la)
+	slices.Reverse(lb)
+	return slices.Compare(la, lb)
+}
+
+// printZone 把追踪中收到的全部记录按 RFC 1035 的主文件格式输出，记录一律用 rr.String() 写出，
+// 任何类型的转义和 rdata 格式都和 miekg/dns 一致；每个 RRset 前的注释写明它来自哪些服务器
+func printZone(report trace.Report) {
+	index := make(map[string]*zoneRRset)
+	var sets []*zoneRRset
+	for _, res := range report.Results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				server := fmt.Sprintf("%s (%s)", auth.Hostname, qr.ServerIP)
+				for _, rr := range qr.Records {
+					h := rr.Header()
+					owner := strings.ToLower(h.Name)
+					key := fmt.Sprintf("%s %d %d", owner, h.Class, h.Rrtype)
+					set, ok := index[key]
+					if !ok {
+						set = &zoneRRset{owner: owner, class: h.Class, rrtype: h.Rrtype, seen: make(map[string]bool)}
+						index[key] = set
+						sets = append(sets, set)
+					}
+					if k := zoneRecordKey(rr); !set.seen[k] {
+						set.seen[k] = true
+						set.records = append(set.records, rr)
+					}
+					if !slices.Contains(set.servers, server) {
+						set.servers = append(set.servers, server)
+					}
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(sets, func(a, b *zoneRRset) int {
+		return cmp.Or(canonicalCompare(a.owner, b.owner), cmp.Compare(a.class, b.class), cmp.Compare(a.rrtype, b.rrtype))
+	})
+	fmt.Printf("; records received while tracing %s\n", dns.Fqdn(report.Domain))
+	if len(sets) == 0 {
+		fmt.Println("; no records")
+		return
+	}
+	for i, set := range sets {
+		if i == 0 || set.owner != sets[i-1].owner {
+			fmt.Println()
+		}
+		fmt.Printf("; %s from %s\n", dns.Type(set.rrtype), strings.Join(set.servers, ", "))
+		records := set.records
+		if !noSort {
+			records = slices.Clone(records)
+			slices.SortStableFunc(records, func(a, b dns.RR) int { return strings.Compare(a.String(), b.String()) })
+		}
+		for _, rr := range records {
+			fmt.Println(rr.String())
+		}
+	}
+}
@@ -1,14 +1,18 @@
-module mdig
+module github.com/yooyoo41/mdig
 
 go 1.23.0
 
 toolchain go1.24.6
 
 require (
-	github.com/miekg/dns v1.1.68 // indirect
-	golang.org/x/mod v0.24.0 // indirect
-	golang.org/x/net v0.43.0 // indirect
-	golang.org/x/sync v0.14.0 // indirect
-	golang.org/x/sys v0.35.0 // indirect
-	golang.org/x/tools v0.33.0 // indirect
+	github.com/miekg/dns v1.1.68
+	golang.org/x/net v0.43.0
+	golang.org/x/sys v0.35.0
+)
+
+require (
+	golang.org/x/mod v0.26.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+	golang.org/x/tools v0.35.0 // indirect
 )
@@ -0,0 +1,118 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// addrKey 按小写主机名和地址类型（A/AAAA）区分缓存条目
+type addrKey struct {
+	host  string
+	qtype uint16
+}
+
+// addrAnswer 是一次地址查询的结果：ad 表示递归服务器在应答里设置了 AD 位，nxdomain 表示名字不存在，resolver 是给出应答的 -dns 服务器
+type addrAnswer struct {
+	ips      []net.IP
+	ad       bool
+	nxdomain bool
+	resolver string
+	// dns64 是 -dns 服务器给出的 DNS64 合成地址，不在 ips 里
+	dns64 []net.IP
+	// ede 是 -dns 服务器应答里的 EDE，成功、NODATA 和 NXDOMAIN 的应答也可能带（例如 Stale Answer、DNSSEC Indeterminate）
+	ede []ExtendedError
+	// queries 是得到这个结果实际发出的查询数
+	queries int64
+	// fromDisk 表示结果来自 Options.CacheDir 的磁盘缓存
+	fromDisk bool
+}
+
+type addrEntry struct {
+	answer  addrAnswer
+	expires time.Time
+	done    chan struct{} // 查询进行中时非空，结束后关闭
+	err     error
+}
+
+// addrCache 缓存 NS 主机名的地址查询结果，按应答 TTL 过期；同一名字的并发查询只发一次
+type addrCache struct {
+	mu      sync.Mutex
+	entries map[addrKey]*addrEntry
+}
+
+// lookup 返回 host 的 qtype 地址，缓存有效时直接返回并报告命中，否则调用 fetch 查询；
+// fetch 返回查询结果、可缓存的秒数和错误，出错的结果不缓存
+func (c *addrCache) lookup(ctx context.Context, host string, qtype uint16, fetch func() (addrAnswer, uint32, error)) (addrAnswer, bool, error) {
+	key := addrKey{strings.ToLower(dns.Fqdn(host)), qtype}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	switch {
+	case ok && e.done != nil:
+		// 其他 goroutine 正在查询同一个名字，等它的结果
+		done := e.done
+		c.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return addrAnswer{}, false, ctx.Err()
+		}
+		if e.err != nil {
+			return addrAnswer{}, false, e.err
+		}
+		return e.answer, true, nil
+	case ok && time.Now().Before(e.expires):
+		c.mu.Unlock()
+		return e.answer, true, nil
+	}
+	e = &addrEntry{done: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	answer, ttl, err := fetch()
+	c.mu.Lock()
+	e.answer, e.err = answer, err
+	e.expires = time.Now().Add(time.Duration(ttl) * time.Second)
+	done := e.done
+	e.done = nil
+	if err != nil || ttl == 0 {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(done)
+	return answer, false, err
+}
+
+// seed 放入一个从磁盘缓存读到的条目，它被用到时计入 Usage.DiskHits
+func (c *addrCache) seed(host string, qtype uint16, answer addrAnswer, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	answer.fromDisk = true
+	c.entries[addrKey{strings.ToLower(dns.Fqdn(host)), qtype}] = &addrEntry{answer: answer, expires: expires}
+}
+
+// peek 返回 host 仍然有效的 qtype 地址和过期时间，不计入命中
+func (c *addrCache) peek(host string, qtype uint16) (addrAnswer, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[addrKey{strings.ToLower(dns.Fqdn(host)), qtype}]
+	if !ok || e.done != nil || e.err != nil || !time.Now().Before(e.expires) {
+		return addrAnswer{}, time.Time{}, false
+	}
+	return e.answer, e.expires, true
+}
+
+// minTTL 返回一组记录里最小的 TTL，没有记录时为 0
+func minTTL(rrs []dns.RR) uint32 {
+	var ttl uint32
+	for i, rr := range rrs {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
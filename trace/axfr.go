@@ -0,0 +1,162 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// axfrTimeout 限制单台服务器的整个区传送，超时时已经收到的记录仍然说明传送是开放的
+const axfrTimeout = 10 * time.Second
+
+// 每个服务器 IP 的区传送结果
+const (
+	AXFRRefused = "refused"
+	AXFRAllowed = "allowed"
+	AXFRFailed  = "failed"
+)
+
+// AXFRCheck 记录对区的每台权威服务器尝试 AXFR 的结果，不保存传送得到的记录本身
+type AXFRCheck struct {
+	Zone    string       `json:"zone"`
+	Servers []AXFRResult `json:"servers"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type AXFRResult struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Status   string `json:"status"`
+	// Records 是收到的记录数（不含结尾重复的 SOA），Complete 表示收到了结尾的 SOA
+	Records  int    `json:"records,omitempty"`
+	Complete bool   `json:"complete,omitempty"`
+	Rcode    string `json:"rcode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Open 判断是否有服务器允许向任何人传送区
+func (c *AXFRCheck) Open() bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Servers {
+		if s.Status == AXFRAllowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAXFR 通过 TCP 向 domain 所在区的每台权威服务器的每个 IP 请求 AXFR；区传送是数据流，不经过 Exchanger
+func (tr *Tracer) checkAXFR(ctx context.Context, domain string, results []Result) *AXFRCheck {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &AXFRCheck{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	check := &AXFRCheck{Zone: level.Zone}
+	targets := tr.authTargets(level)
+	if len(targets) == 0 {
+		check.Error = "no addresses for the authoritative servers of " + level.Zone
+		return check
+	}
+	check.Servers = make([]AXFRResult, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			check.Servers[i] = tr.tryAXFR(ctx, check.Zone, t)
+		}()
+	}
+	wg.Wait()
+	return check
+}
+
+func (tr *Tracer) tryAXFR(ctx context.Context, zone string, t authTarget) AXFRResult {
+	res := AXFRResult{Hostname: t.host, IP: t.ip.String(), Status: AXFRFailed}
+	if err := tr.beforeSend(ctx); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	actx, cancel := context.WithTimeout(ctx, axfrTimeout)
+	defer cancel()
+	addr := tr.authAddr(res.IP)
+	c := &dns.Client{Net: "tcp", Timeout: tr.queryTimeout}
+	if err := tr.useSource(c, addr); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	conn, err := tr.dialConn(actx, c, addr)
+	if err != nil {
+		res.Error = classifyTCPError(err).Error()
+		return res
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(actx, func() { conn.Close() })
+	defer stop()
+
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+	conn.SetWriteDeadline(time.Now().Add(tr.queryTimeout))
+	if err := conn.WriteMsg(m); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	tr.meterExchange(ctx, "tcp", addr, m.Len(), 0)
+	records, soas := 0, 0
+	for {
+		conn.SetReadDeadline(time.Now().Add(tr.queryTimeout))
+		r, err := conn.ReadMsg()
+		if r != nil {
+			tr.meter(ctx, func(u *Usage) { u.BytesReceived += int64(r.Len()) })
+		}
+		switch {
+		case err != nil && records > 0:
+			// 已经收到记录，传送是开放的，只是没有完整结束
+			res.Status, res.Records = AXFRAllowed, records
+			res.Error = "transfer interrupted: " + axfrError(ctx, actx, err)
+			return res
+		case err != nil && errors.Is(err, io.EOF):
+			res.Status, res.Error = AXFRRefused, "connection closed without an answer"
+			return res
+		case err != nil:
+			res.Error = axfrError(ctx, actx, err)
+			return res
+		case r.Rcode != dns.RcodeSuccess:
+			res.Status, res.Rcode = AXFRRefused, dns.RcodeToString[r.Rcode]
+			return res
+		case records == 0 && (len(r.Answer) == 0 || r.Answer[0].Header().Rrtype != dns.TypeSOA):
+			res.Status, res.Error = AXFRRefused, "answer does not start with the zone's SOA"
+			return res
+		}
+		for _, rr := range r.Answer {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				soas++
+				if soas == 2 {
+					res.Status, res.Records, res.Complete = AXFRAllowed, records, true
+					return res
+				}
+			}
+			records++
+		}
+	}
+}
+
+// axfrError 区分整个追踪被取消、单台服务器的传送超时和其他网络错误
+func axfrError(ctx, actx context.Context, err error) string {
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err().Error()
+	case actx.Err() != nil:
+		return fmt.Sprintf("timeout after %s", axfrTimeout)
+	}
+	return err.Error()
+}
@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// IgnoredRecord 是应答里因为超出服务器管辖范围（bailiwick）而没有采信的记录
+type IgnoredRecord struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Record string `json:"record"`
+	Reason string `json:"reason"`
+}
+
+func newIgnoredRecord(rr dns.RR, reason string) IgnoredRecord {
+	return IgnoredRecord{
+		Name:   strings.ToLower(rr.Header().Name),
+		Type:   dns.TypeToString[rr.Header().Rrtype],
+		Record: strings.ReplaceAll(rr.String(), "\t", " "),
+		Reason: reason,
+	}
+}
+
+// nsOutOfBailiwick 检查负责 zone 的服务器给出的委派 NS 的属主名 owner：必须在 zone 之内、且在查询名 qname 之上，
+// 不符合时返回原因；zone 未知时不做检查
+func nsOutOfBailiwick(owner, zone, qname string) string {
+	switch {
+	case zone == "":
+		return ""
+	case !dns.IsSubDomain(zone, owner):
+		return fmt.Sprintf("NS owner %s is outside the server's zone %s", owner, zone)
+	case !dns.IsSubDomain(owner, qname):
+		return fmt.Sprintf("NS owner %s is not an ancestor of %s", owner, qname)
+	}
+	return ""
+}
+
+// glueOutOfBailiwick 检查附加区地址记录的属主名 name：必须是委派里的 NS 主机名，且在服务器的区 zone 之内。
+// 根给 com 的委派里带 a.gtld-servers.net 这类同级胶水，根对它同样有权威，所以只按 zone 判断而不要求在子区之内
+func glueOutOfBailiwick(name, zone string, nsNames map[string]bool) string {
+	switch {
+	case !nsNames[name]:
+		return fmt.Sprintf("%s is not a nameserver in the referral", name)
+	case zone != "" && !dns.IsSubDomain(zone, name):
+		return fmt.Sprintf("glue for %s is outside the server's zone %s", name, zone)
+	}
+	return ""
+}
+
+// ignoredReferral 返回被全部忽略的委派的属主名，用于把只给出越界委派的服务器判为 lame
+func ignoredReferral(qr QueryResult) string {
+	if qr.Referral != "" {
+		return ""
+	}
+	for _, ig := range qr.Ignored {
+		if ig.Type == "NS" {
+			return ig.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,255 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// bootstrapResolver 负责查询 NS 主机名的地址，-dns 带 tls:// 前缀时走 DNS-over-TLS，
+// 带 https:// 前缀时走 DNS-over-HTTPS（RFC 8484）
+type bootstrapResolver struct {
+	tr     *Tracer
+	scheme string
+	addr   string
+	client *dns.Client
+	idle   chan *dns.Conn
+	http   *http.Client
+	// down 在超时或网络错误后设置，之后的查询先用其他服务器，直到它再次应答
+	down atomic.Bool
+}
+
+// dohError 是 HTTP 层面的失败，和 DNS 应答里的错误区分开
+type dohError struct {
+	URL    string
+	Status int
+	Err    error
+}
+
+func (e *dohError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("DoH %s: HTTP %d %s", e.URL, e.Status, http.StatusText(e.Status))
+	}
+	if isCertError(e.Err) {
+		return fmt.Sprintf("DoH %s: certificate verification failed: %v", e.URL, e.Err)
+	}
+	return fmt.Sprintf("DoH %s: %v", e.URL, e.Err)
+}
+
+func (e *dohError) Unwrap() error {
+	return e.Err
+}
+
+func (tr *Tracer) newBootstrapResolver(spec string) (*bootstrapResolver, error) {
+	if strings.HasPrefix(spec, "https://") {
+		u, err := url.Parse(spec)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid DoH URL %q", spec)
+		}
+		return &bootstrapResolver{tr: tr, scheme: "https", addr: spec, http: tr.httpClient()}, nil
+	}
+	if rest, ok := strings.CutPrefix(spec, "tls://"); ok {
+		host, port := rest, "853"
+		if h, p, err := net.SplitHostPort(rest); err == nil {
+			host, port = h, p
+		}
+		if host == "" {
+			return nil, fmt.Errorf("missing host in %q", spec)
+		}
+		b := &bootstrapResolver{
+			tr:     tr,
+			scheme: "tls",
+			addr:   net.JoinHostPort(host, port),
+			client: &dns.Client{Net: "tcp-tls", Timeout: tr.queryTimeout, TLSConfig: &tls.Config{ServerName: host}},
+			idle:   make(chan *dns.Conn, 10),
+		}
+		if err := tr.useSource(b.client, b.addr); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if strings.Contains(spec, "://") {
+		return nil, fmt.Errorf("unsupported scheme in %q", spec)
+	}
+	// 支持 host:port 和 [v6]:port，不带端口的 IPv6 地址直接当作主机
+	addr := net.JoinHostPort(strings.Trim(spec, "[]"), "53")
+	if host, p, err := net.SplitHostPort(spec); err == nil {
+		if host == "" || p == "" {
+			return nil, fmt.Errorf("invalid server %q", spec)
+		}
+		addr = net.JoinHostPort(host, p)
+	}
+	return &bootstrapResolver{tr: tr, scheme: "udp", addr: addr}, nil
+}
+
+// queryBootstrap 向引导解析服务器发出 m（每台照常重试），超时或网络错误时换下一台，FailoverOnServfail 时 SERVFAIL 也换下一台；
+// 失败过的服务器排到最后，全部失败过时仍按原来的顺序逐台尝试。返回应答和给出应答的服务器
+func (tr *Tracer) queryBootstrap(ctx context.Context, m *dns.Msg) (*dns.Msg, *bootstrapResolver, error) {
+	order := make([]*bootstrapResolver, 0, len(tr.bootstraps))
+	var down []*bootstrapResolver
+	for _, b := range tr.bootstraps {
+		if b.down.Load() {
+			down = append(down, b)
+		} else {
+			order = append(order, b)
+		}
+	}
+	order = append(order, down...)
+	for i, b := range order {
+		var resp *dns.Msg
+		_, err := tr.retry(ctx, func() (err error) {
+			resp, err = b.exchange(ctx, m)
+			return err
+		})
+		last := i == len(order)-1
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// 调用方的时限到了，不能算作服务器的问题
+			return nil, b, err
+		case err != nil && last:
+			b.down.Store(len(order) > 1)
+			return nil, b, err
+		case err != nil:
+			if !b.down.Swap(true) {
+				tr.logger.Warn("resolver not answering, failing over", "resolver", b.addr, "next", order[i+1].addr, "error", err)
+			}
+			continue
+		case resp.Rcode == dns.RcodeServerFailure && tr.failoverServfail && !last:
+			b.down.Store(false)
+			tr.logger.Debug("resolver returned SERVFAIL, trying the next one", "resolver", b.addr, "name", m.Question[0].Name, "next", order[i+1].addr)
+			continue
+		}
+		if b.down.Swap(false) {
+			tr.logger.Info("resolver is answering again", "resolver", b.addr)
+		}
+		return resp, b, nil
+	}
+	return nil, nil, errors.New("no resolver configured")
+}
+
+func (b *bootstrapResolver) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	ctx = withDestination(ctx, DestResolver)
+	switch b.scheme {
+	case "udp":
+		r, _, err := b.tr.exchange(ctx, m, b.addr, b.tr.queryTimeout)
+		return r, err
+	case "https":
+		return b.exchangeHTTPS(ctx, m)
+	}
+
+	if err := b.tr.beforeSend(ctx); err != nil {
+		return nil, err
+	}
+	qctx, cancel := context.WithTimeout(ctx, b.tr.queryTimeout)
+	defer cancel()
+
+	// 复用空闲的 TLS 连接，避免每次查询 NS 地址都重新握手；复用的连接可能已被对端关闭，失败后换新连接再试一次
+	select {
+	case conn := <-b.idle:
+		r, _, err := exchangeConn(qctx, b.client, m, conn)
+		b.meterTLS(ctx, m, r)
+		if err == nil {
+			b.release(conn)
+			return r, nil
+		}
+		conn.Close()
+	default:
+	}
+	conn, err := b.tr.dialConn(qctx, b.client, b.addr)
+	if err != nil {
+		return nil, tlsError(b.addr, err)
+	}
+	r, _, err := exchangeConn(qctx, b.client, m, conn)
+	b.meterTLS(ctx, m, r)
+	if err != nil {
+		conn.Close()
+		return nil, tlsError(b.addr, err)
+	}
+	b.release(conn)
+	return r, nil
+}
+
+func (b *bootstrapResolver) meterTLS(ctx context.Context, m, r *dns.Msg) {
+	received := 0
+	if r != nil {
+		received = r.Len()
+	}
+	b.tr.meterExchange(ctx, "tls", b.addr, m.Len(), received)
+}
+
+func (b *bootstrapResolver) release(conn *dns.Conn) {
+	select {
+	case b.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func isCertError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var verify *tls.CertificateVerificationError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &verify)
+}
+
+func tlsError(addr string, err error) error {
+	switch {
+	case isCertError(err):
+		return fmt.Errorf("DoT %s: certificate verification failed: %w", addr, err)
+	case errors.As(err, new(tls.RecordHeaderError)):
+		return fmt.Errorf("DoT %s: tls handshake failed (not a TLS server?): %w", addr, err)
+	}
+	return fmt.Errorf("DoT %s: %w", addr, err)
+}
+
+func (b *bootstrapResolver) exchangeHTTPS(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 建议 DoH 查询的 ID 置 0，便于 HTTP 缓存
+	if err := b.tr.beforeSend(ctx); err != nil {
+		return nil, err
+	}
+	q := m.Copy()
+	q.Id = 0
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	received := 0
+	defer func() { b.tr.meterExchange(ctx, "https", b.addr, len(packed), received) }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.addr, bytes.NewReader(packed))
+	if err != nil {
+		return nil, &dohError{URL: b.addr, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return nil, &dohError{URL: b.addr, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &dohError{URL: b.addr, Status: resp.StatusCode}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	received = len(body)
+	if err != nil {
+		return nil, &dohError{URL: b.addr, Status: resp.StatusCode, Err: err}
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(body); err != nil {
+		return nil, fmt.Errorf("DoH %s: invalid DNS message: %w", b.addr, err)
+	}
+	r.Id = m.Id
+	return r, nil
+}
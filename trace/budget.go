@@ -0,0 +1,43 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errLevelBudget 是 Options.LevelTimeout 用完时取消本级查询的原因
+var errLevelBudget = errors.New("not answered within level budget")
+
+// levelContext 给一级的全部查询加上 -level-timeout 的总时限；时限到了只取消这一级还没完成的查询，
+// 已经收到的转介照常用于下一级，整个追踪不受影响
+func (tr *Tracer) levelContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if tr.levelTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, tr.levelTimeout, errLevelBudget)
+}
+
+// overBudget 判断 ctx 是不是因为本级时限用完而取消的，和 Ctrl-C、-deadline 以及 -fast 的取消区分开
+func overBudget(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errLevelBudget)
+}
+
+// noteLevelBudget 在本级有服务器因为时限用完没有应答时做标记，-summary 据此统计时限被用完的次数
+func (tr *Tracer) noteLevelBudget(result *Result) {
+	n := 0
+	for _, auth := range result.Authorities {
+		missed := auth.Code == ErrLevelBudget
+		for _, qr := range auth.QueryResults {
+			missed = missed || qr.Code == ErrLevelBudget
+		}
+		if missed {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	result.BudgetExceeded = true
+	result.Notes = append(result.Notes, fmt.Sprintf("level budget of %s used up: %d servers did not answer in time (-level-timeout)", tr.levelTimeout, n))
+}
@@ -0,0 +1,19 @@
+package trace
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// randomizeCase 随机翻转查询名中字母的大小写（dns-0x20），服务器应原样回显问题区的名字
+func randomizeCase(name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, c := range []byte(name) {
+		if ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && rand.IntN(2) == 0 {
+			c ^= 0x20
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var chaosNames = []string{"version.bind.", "hostname.bind.", "id.server."}
+
+// chaosTimeout 单独设置较短的超时，丢弃 CHAOS 查询的服务器不会拖慢主流程
+const chaosTimeout = time.Second
+
+type ChaosReply struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// probeIdentity 在后台并发发送 CHAOS TXT 查询，结果按 chaosNames 的顺序返回
+func (tr *Tracer) probeIdentity(ctx context.Context, server string) <-chan []ChaosReply {
+	out := make(chan []ChaosReply, 1)
+	go func() {
+		replies := make([]ChaosReply, len(chaosNames))
+		done := make(chan struct{})
+		for i, name := range chaosNames {
+			go func(i int, name string) {
+				replies[i] = tr.queryChaos(ctx, name, server)
+				done <- struct{}{}
+			}(i, name)
+		}
+		for range chaosNames {
+			<-done
+		}
+		out <- replies
+	}()
+	return out
+}
+
+func (tr *Tracer) queryChaos(ctx context.Context, name, server string) ChaosReply {
+	reply := ChaosReply{Name: strings.TrimSuffix(name, ".")}
+	m := tr.newQuery(name, dns.TypeTXT, dns.ClassCHAOS)
+	m.RecursionDesired = tr.recursionDesired
+	qctx, cancel := context.WithTimeout(ctx, chaosTimeout)
+	defer cancel()
+	r, _, err := tr.exchangeOnce(qctx, "udp", m, tr.authAddr(server))
+	switch {
+	case err != nil:
+		reply.Error = "timeout"
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			reply.Error = err.Error()
+		}
+	case r.Rcode != dns.RcodeSuccess:
+		reply.Error = strings.ToLower(dns.RcodeToString[r.Rcode])
+	default:
+		var values []string
+		for _, rr := range r.Answer {
+			if txt, ok := rr.(*dns.TXT); ok {
+				values = append(values, strings.Join(txt.Txt, ""))
+			}
+		}
+		if len(values) == 0 {
+			reply.Error = "no data"
+		}
+		reply.Value = strings.Join(values, " ")
+	}
+	return reply
+}
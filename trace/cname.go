@@ -0,0 +1,203 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain 是跟随 CNAME 的最大跳数
+const maxCNAMEChain = 10
+
+type CNAMEHop struct {
+	Name    string   `json:"name"`
+	Zone    string   `json:"zone"`
+	Answers []string `json:"answers,omitempty"`
+}
+
+// followCNAMEs 从 qname 开始沿应答区的 CNAME 走到底，返回依次经过的目标名，
+// 以及最后一个名字在应答中是否已有所查询类型的记录
+func followCNAMEs(qname string, qtype uint16, answer []dns.RR) ([]string, bool) {
+	var targets []string
+	seen := map[string]bool{strings.ToLower(qname): true}
+	name := qname
+	for {
+		next := ""
+		for _, rr := range answer {
+			if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+				next = c.Target
+				break
+			}
+		}
+		if next == "" || seen[strings.ToLower(next)] {
+			break
+		}
+		seen[strings.ToLower(next)] = true
+		targets = append(targets, next)
+		name = next
+	}
+	if len(targets) == 0 {
+		return nil, false
+	}
+	for _, rr := range answer {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, name) {
+			return targets, true
+		}
+	}
+	return targets, false
+}
+
+// answerZone 返回最终一级应答所在的区
+func answerZone(results []Result) string {
+	if len(results) > 0 && results[len(results)-1].Zone != "" {
+		return results[len(results)-1].Zone
+	}
+	return "."
+}
+
+// terminalCNAME 在最终一级中找出第一个带 CNAME 的成功应答
+func terminalCNAME(results []Result) (QueryResult, bool) {
+	if len(results) == 0 {
+		return QueryResult{}, false
+	}
+	for _, auth := range results[len(results)-1].Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Error == "" && len(qr.CNAMEs) > 0 {
+				return qr, true
+			}
+		}
+	}
+	return QueryResult{}, false
+}
+
+// traceCNAMEChain 追踪 domain，如果最终应答是 CNAME，就对链上的最后一个目标重新追踪，直到拿到记录或超过跳数限制
+func (tr *Tracer) traceCNAMEChain(ctx context.Context, domain, types string, emit func(Result)) ([]Result, Status, []CNAMEHop, string) {
+	results, status := tr.traceDNS(ctx, domain, types, emit)
+	qr, ok := terminalCNAME(results)
+	if !ok {
+		return results, status, nil, ""
+	}
+
+	chain := []CNAMEHop{{Name: dns.Fqdn(domain), Zone: answerZone(results)}}
+	seen := map[string]bool{strings.ToLower(dns.Fqdn(domain)): true}
+	for {
+		zone := answerZone(results)
+		for _, target := range qr.CNAMEs {
+			if seen[strings.ToLower(target)] {
+				return results, status, chain, fmt.Sprintf("CNAME loop detected at %s", target)
+			}
+			seen[strings.ToLower(target)] = true
+			chain = append(chain, CNAMEHop{Name: target, Zone: zone})
+		}
+		if len(chain)-1 > maxCNAMEChain {
+			return results, status, chain, fmt.Sprintf("CNAME chain longer than %d hops", maxCNAMEChain)
+		}
+		if qr.CNAMEDone {
+			chain[len(chain)-1].Answers = chainAnswers(qr)
+			return results, status, chain, ""
+		}
+
+		// 目标不在同一应答中，从根开始重新追踪目标名
+		target := chain[len(chain)-1].Name
+		more, moreStatus := tr.traceDNS(ctx, target, types, emit)
+		results = append(results, more...)
+		status = moreStatus
+		chain[len(chain)-1].Zone = answerZone(more)
+		next, ok := terminalCNAME(more)
+		if !ok {
+			if len(more) > 0 {
+				chain[len(chain)-1].Answers = terminalAnswers(more[len(more)-1])
+			}
+			return results, status, chain, ""
+		}
+		qr = next
+	}
+}
+
+// chainAnswers 返回应答中除 CNAME 目标以外的记录
+func chainAnswers(qr QueryResult) []string {
+	cnames := make(map[string]bool)
+	for _, c := range qr.CNAMEs {
+		cnames[c] = true
+	}
+	var answers []string
+	for _, a := range qr.Answers {
+		if !cnames[a] {
+			answers = append(answers, a)
+		}
+	}
+	return answers
+}
+
+func terminalAnswers(res Result) []string {
+	for _, auth := range res.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Error == "" && len(qr.Answers) > 0 {
+				return qr.Answers
+			}
+		}
+	}
+	return nil
+}
+
+// ApexCNAME 是最终一级的服务器在区顶点返回 CNAME：区顶点必须有 SOA 和 NS，不能再有 CNAME（RFC 1034 3.6.2、RFC 2181 10.1），
+// 递归服务器对这种区的处理各不相同，表现为时好时坏的解析失败。Servers 返回了 CNAME，Others 是正常应答、没有 CNAME 的服务器
+type ApexCNAME struct {
+	Zone    string   `json:"zone"`
+	Target  string   `json:"target"`
+	Servers []string `json:"servers"`
+	Others  []string `json:"others,omitempty"`
+}
+
+func (a *ApexCNAME) String() string {
+	s := fmt.Sprintf("invalid CNAME at zone apex %s on %s (to %s)", a.Zone, strings.Join(a.Servers, ", "), a.Target)
+	if len(a.Others) > 0 {
+		s += "; " + strings.Join(a.Others, ", ") + " answered without it"
+	}
+	return s
+}
+
+// findApexCNAME 检查最终一级是否在区顶点返回 CNAME。名字是不是区顶点看服务器负责的区：转介给出的本级区名，
+// 或者服务器在权威应答里自称负责的区（QueryResult.Zone），不按名字的标签数猜测
+func findApexCNAME(result Result, domain string) *ApexCNAME {
+	domain = dns.Fqdn(domain)
+	apex := strings.EqualFold(result.Zone, domain)
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			apex = apex || strings.EqualFold(qr.Zone, domain)
+		}
+	}
+	if !apex {
+		return nil
+	}
+	found := &ApexCNAME{Zone: strings.ToLower(domain)}
+	for _, auth := range result.Authorities {
+		cname, answered := "", false
+		for _, qr := range auth.QueryResults {
+			if qr.Error != "" || RcodeFailure(qr.Rcode) {
+				continue
+			}
+			answered = true
+			if len(qr.CNAMEs) > 0 && cname == "" {
+				cname = qr.CNAMEs[0]
+			}
+		}
+		switch {
+		case cname != "":
+			found.Servers = append(found.Servers, auth.Hostname)
+			if found.Target == "" {
+				found.Target = cname
+			}
+		case answered:
+			found.Others = append(found.Others, auth.Hostname)
+		}
+	}
+	if len(found.Servers) == 0 {
+		return nil
+	}
+	found.Others = uniqueStrings(found.Others)
+	found.Servers = uniqueStrings(found.Servers)
+	return found
+}
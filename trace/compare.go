@@ -0,0 +1,119 @@
+package trace
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ResolverComparison 对比各递归服务器对最终名字的应答和追踪得到的权威应答
+type ResolverComparison struct {
+	Name string `json:"name"`
+	// Authoritative 按类型记录权威应答，追踪没有得到结论时为空，不做比较
+	Authoritative map[string]*ResolverAnswer `json:"authoritative,omitempty"`
+	Answers       []ResolverAnswer           `json:"answers"`
+}
+
+type ResolverAnswer struct {
+	Resolver  string   `json:"resolver,omitempty"`
+	Qtype     string   `json:"qtype"`
+	Rcode     string   `json:"rcode,omitempty"`
+	Answers   []string `json:"answers,omitempty"`
+	TTL       uint32   `json:"ttl,omitempty"`
+	RTTMs     float64  `json:"rtt_ms,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Disagrees bool     `json:"disagrees,omitempty"`
+}
+
+// authoritativeAnswers 从追踪的最后一级取出每个类型的权威应答，CNAME 目标不参与比较；RRSIG 不在 Answers 里
+func authoritativeAnswers(report Report, status Status) map[string]*ResolverAnswer {
+	if len(report.Results) == 0 {
+		return nil
+	}
+	auth := make(map[string]*ResolverAnswer)
+	for _, a := range report.Results[len(report.Results)-1].Authorities {
+		for _, qr := range a.QueryResults {
+			if qr.Error != "" || RcodeFailure(qr.Rcode) || !qr.Flags.AA {
+				continue
+			}
+			ans := auth[qr.Qtype]
+			if ans == nil {
+				ans = &ResolverAnswer{Qtype: qr.Qtype, Rcode: dns.RcodeToString[qr.Rcode]}
+				auth[qr.Qtype] = ans
+			}
+			for _, v := range qr.Answers {
+				if !slices.Contains(qr.CNAMEs, v) {
+					ans.Answers = append(ans.Answers, v)
+				}
+			}
+		}
+	}
+	if len(auth) == 0 || status == StatusNetworkError || status == StatusAborted {
+		return nil
+	}
+	for _, ans := range auth {
+		ans.Answers = uniqueStrings(ans.Answers)
+		sort.Strings(ans.Answers)
+	}
+	return auth
+}
+
+// compareResolvers 向每个递归服务器查询 name 的各个类型；查询并发进行，一个服务器无响应只会让它自己的查询超时
+func (tr *Tracer) compareResolvers(ctx context.Context, name, types string, report Report, status Status) *ResolverComparison {
+	cmp := &ResolverComparison{Name: dns.Fqdn(name), Authoritative: authoritativeAnswers(report, status)}
+	qtypes := parseQueryTypes(types)
+	cmp.Answers = make([]ResolverAnswer, len(tr.resolvers)*len(qtypes))
+	var wg sync.WaitGroup
+	for i, r := range tr.resolvers {
+		for j, qtype := range qtypes {
+			wg.Add(1)
+			go func(slot int, r *bootstrapResolver, qtype uint16) {
+				defer wg.Done()
+				cmp.Answers[slot] = tr.queryResolver(ctx, r, cmp.Name, qtype)
+			}(i*len(qtypes)+j, r, qtype)
+		}
+	}
+	wg.Wait()
+	for i := range cmp.Answers {
+		ans := &cmp.Answers[i]
+		if auth := cmp.Authoritative[ans.Qtype]; auth != nil && ans.Error == "" {
+			ans.Disagrees = ans.Rcode != auth.Rcode || !slices.Equal(ans.Answers, auth.Answers)
+		}
+	}
+	return cmp
+}
+
+func (tr *Tracer) queryResolver(ctx context.Context, r *bootstrapResolver, name string, qtype uint16) ResolverAnswer {
+	ans := ResolverAnswer{Resolver: r.addr, Qtype: dns.TypeToString[qtype]}
+	m := tr.newQuery(name, qtype, dns.ClassINET)
+	start := time.Now()
+	var resp *dns.Msg
+	_, err := tr.retry(ctx, func() (err error) {
+		resp, err = r.exchange(ctx, m)
+		return err
+	})
+	if err != nil {
+		ans.Error = err.Error()
+		return ans
+	}
+	ans.RTTMs = millis(time.Since(start))
+	ans.Rcode = dns.RcodeToString[resp.Rcode]
+	var rrs []dns.RR
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype != qtype {
+			continue
+		}
+		if v, ok := formatRecord(rr); ok {
+			ans.Answers = append(ans.Answers, v)
+			rrs = append(rrs, rr)
+		}
+	}
+	ans.Answers = uniqueStrings(ans.Answers)
+	sort.Strings(ans.Answers)
+	ans.TTL = minTTL(rrs)
+	return ans
+}
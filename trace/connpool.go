@@ -0,0 +1,357 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// udpIdle 是共用的 UDP 套接字没有查询多久后关闭
+	udpIdle = 30 * time.Second
+	// udpMaxQueries 和 udpMaxAge 限制一个 UDP 套接字的使用：发出这么多查询或用了这么久后换新的源端口，
+	// 长时间运行（-watch、-serve）时源端口不会一直不变，猜中端口和 ID 伪造应答更难
+	udpMaxQueries = 100
+	udpMaxAge     = time.Minute
+	// tcpIdle 是空闲的 TCP 连接最多保留多久；服务器一般几秒后就会关闭空闲连接（RFC 7766 6.2.3）
+	tcpIdle = 5 * time.Second
+	// tcpIdlePerAddr 是每个地址最多保留的空闲 TCP 连接数
+	tcpIdlePerAddr = 2
+)
+
+// freshConnKey 标记必须使用新连接的查询，见 withFreshConn
+type freshConnKey struct{}
+
+// withFreshConn 让 ctx 里的查询不复用连接，每次都从新的源端口发出；-verify 的重复查询靠它检验应答是否随连接变化
+func withFreshConn(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshConnKey{}, true)
+}
+
+// connPool 是 clientExchanger 共用的连接：每个目标地址一个 UDP 套接字，并发的查询按报文 ID 和问题分发应答；
+// TCP 连接用完后短暂保留，同一地址的下一个 TCP 查询直接复用。close 关闭全部套接字和连接
+type connPool struct {
+	tr  *Tracer
+	mu  sync.Mutex
+	udp map[string]*udpMux
+	tcp map[string][]idleConn
+}
+
+type idleConn struct {
+	conn  *dns.Conn
+	since time.Time
+}
+
+func newConnPool(tr *Tracer) *connPool {
+	return &connPool{tr: tr, udp: make(map[string]*udpMux), tcp: make(map[string][]idleConn)}
+}
+
+// udpMux 是发往一个地址的共用 UDP 套接字，后台 goroutine 读取应答并按 ID 和问题交给等待的查询。
+// 到了 udpMaxQueries 或 udpMaxAge 后套接字退役：不再接受新查询，等已发出的查询结束后关闭
+type udpMux struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	pending map[uint16]udpPending
+	created time.Time
+	lastUse time.Time
+	sent    int
+	retired bool
+	closed  bool
+}
+
+// udpPending 是一个等待应答的查询，只有问题相同的应答才交给它
+type udpPending struct {
+	q  dns.Question
+	ch chan udpReply
+}
+
+type udpReply struct {
+	msg *dns.Msg
+	err error
+}
+
+// dial 按 -source/-source6 或 -proxy 建立一个新连接，并计入 Usage.Connections
+func (p *connPool) dial(ctx context.Context, c *dns.Client, addr string) (*dns.Conn, error) {
+	if err := p.tr.useSource(c, addr); err != nil {
+		return nil, err
+	}
+	conn, err := p.tr.dialConn(ctx, c, addr)
+	if err != nil {
+		return nil, err
+	}
+	p.tr.meter(ctx, func(u *Usage) { u.Connections++ })
+	return conn, nil
+}
+
+// errMuxRetired 表示查询还没发出，套接字就已经退役，换一个套接字重发即可
+var errMuxRetired = errors.New("udp socket retired")
+
+// exchangeUDP 通过 addr 的共用套接字发送查询，套接字不存在、已经因为空闲关闭或退役时新建一个
+func (p *connPool) exchangeUDP(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	for {
+		mux, err := p.muxFor(ctx, addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if r, rtt, err := mux.exchange(ctx, m); err != errMuxRetired {
+			return r, rtt, err
+		}
+	}
+}
+
+// muxFor 返回 addr 当前的共用套接字，用够了次数或时间的套接字在这里退役
+func (p *connPool) muxFor(ctx context.Context, addr string) (*udpMux, error) {
+	p.mu.Lock()
+	mux := p.udp[addr]
+	if mux != nil && mux.expired() {
+		delete(p.udp, addr)
+		mux.retire()
+		mux = nil
+	}
+	p.mu.Unlock()
+	if mux == nil {
+		conn, err := p.dial(ctx, &dns.Client{Net: "udp"}, addr)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		mux = &udpMux{conn: conn.Conn, pending: make(map[uint16]udpPending), created: now, lastUse: now}
+		p.mu.Lock()
+		if existing := p.udp[addr]; existing != nil {
+			// 另一个查询同时建好了套接字，用它的
+			p.mu.Unlock()
+			conn.Close()
+			mux = existing
+		} else {
+			p.udp[addr] = mux
+			p.mu.Unlock()
+			go mux.read(p, addr)
+		}
+	}
+	return mux, nil
+}
+
+// expired 报告套接字是否已经用够了次数或时间，调用时持有 connPool.mu
+func (x *udpMux) expired() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.sent >= udpMaxQueries || time.Since(x.created) >= udpMaxAge
+}
+
+// retire 让套接字不再接受新查询，没有等待中的查询时立即关闭，否则由最后一个结束的查询关闭
+func (x *udpMux) retire() {
+	x.mu.Lock()
+	x.retired = true
+	drained := len(x.pending) == 0
+	x.mu.Unlock()
+	if drained {
+		x.conn.Close()
+	}
+}
+
+func (x *udpMux) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	q := m
+	x.mu.Lock()
+	if x.closed {
+		x.mu.Unlock()
+		return nil, 0, net.ErrClosed
+	}
+	if x.retired {
+		x.mu.Unlock()
+		return nil, 0, errMuxRetired
+	}
+	// 同一个套接字上同时进行的查询 ID 不能重复，重复时换一个 ID 发出，收到后再换回来
+	for _, busy := x.pending[q.Id]; busy; _, busy = x.pending[q.Id] {
+		if q == m {
+			q = m.Copy()
+		}
+		q.Id = dns.Id()
+	}
+	ch := make(chan udpReply, 1)
+	var question dns.Question
+	if len(q.Question) > 0 {
+		question = q.Question[0]
+	}
+	x.pending[q.Id] = udpPending{q: question, ch: ch}
+	x.sent++
+	x.lastUse = time.Now()
+	x.mu.Unlock()
+	defer func() {
+		x.mu.Lock()
+		if x.pending[q.Id].ch == ch {
+			delete(x.pending, q.Id)
+		}
+		drained := x.retired && len(x.pending) == 0
+		x.mu.Unlock()
+		if drained {
+			x.conn.Close()
+		}
+	}()
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	start := time.Now()
+	if _, err := x.conn.Write(packed); err != nil {
+		return nil, 0, err
+	}
+	select {
+	case reply := <-ch:
+		rtt := time.Since(start)
+		if reply.err != nil {
+			return nil, rtt, reply.err
+		}
+		reply.msg.Id = m.Id
+		return reply.msg, rtt, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, time.Since(start), os.ErrDeadlineExceeded
+		}
+		return nil, time.Since(start), ctx.Err()
+	}
+}
+
+// read 把收到的应答交给 ID 和问题都对应的查询，超时后才到的应答、不认识的 ID 和问题不符的应答直接丢弃，
+// 问题不符时查询继续等待真正的应答；连接被拒绝这类套接字错误属于整个目标地址，交给所有正在等待的查询
+func (x *udpMux) read(p *connPool, addr string) {
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		x.conn.SetReadDeadline(time.Now().Add(udpIdle))
+		n, err := x.conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			x.mu.Lock()
+			idle := len(x.pending) == 0 && time.Since(x.lastUse) >= udpIdle
+			if errors.As(err, &netErr) && netErr.Timeout() && !idle {
+				x.mu.Unlock()
+				continue
+			}
+			for id, pending := range x.pending {
+				pending.ch <- udpReply{err: err}
+				delete(x.pending, id)
+			}
+			if idle || errors.Is(err, net.ErrClosed) {
+				x.closed = true
+				x.mu.Unlock()
+				p.mu.Lock()
+				if p.udp[addr] == x {
+					delete(p.udp, addr)
+				}
+				p.mu.Unlock()
+				x.conn.Close()
+				return
+			}
+			x.mu.Unlock()
+			continue
+		}
+		if n < 2 {
+			continue
+		}
+		id := binary.BigEndian.Uint16(buf)
+		x.mu.Lock()
+		pending, ok := x.pending[id]
+		x.mu.Unlock()
+		if !ok {
+			continue
+		}
+		// 无法解析的应答同样交给这个查询，由 exchange 决定是否改用 TCP 重试；
+		// Unpack 出错时已经解析出的问题仍然要对得上
+		r := new(dns.Msg)
+		err = r.Unpack(buf[:n])
+		if !replyMatches(pending.q, r) {
+			continue
+		}
+		x.mu.Lock()
+		if x.pending[id].ch == pending.ch {
+			delete(x.pending, id)
+		}
+		x.mu.Unlock()
+		if err != nil {
+			pending.ch <- udpReply{err: err}
+			continue
+		}
+		pending.ch <- udpReply{msg: r}
+	}
+}
+
+// replyMatches 报告应答的问题是否和查询的问题相同。名字不区分大小写，0x20 的大小写由上层检查；
+// 没有问题节的应答照常接受，不少服务器的 FORMERR、NOTIMP 应答不带问题节
+func replyMatches(q dns.Question, r *dns.Msg) bool {
+	if len(r.Question) == 0 {
+		return true
+	}
+	rq := r.Question[0]
+	return len(r.Question) == 1 && rq.Qtype == q.Qtype && rq.Qclass == q.Qclass && strings.EqualFold(rq.Name, q.Name)
+}
+
+// exchangeTCP 优先复用 addr 最近用过的 TCP 连接；复用的连接可能已被对端关闭，失败后换新连接再试一次
+func (p *connPool) exchangeTCP(ctx context.Context, c *dns.Client, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	if conn := p.takeTCP(addr); conn != nil {
+		if r, rtt, err := exchangeConn(ctx, c, m, conn); err == nil {
+			p.putTCP(addr, conn)
+			return r, rtt, nil
+		}
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+	}
+	conn, err := p.dial(ctx, c, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, rtt, err := exchangeConn(ctx, c, m, conn)
+	if err != nil {
+		conn.Close()
+		return nil, rtt, err
+	}
+	p.putTCP(addr, conn)
+	return r, rtt, nil
+}
+
+func (p *connPool) takeTCP(addr string) *dns.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for idle := p.tcp[addr]; len(idle) > 0; idle = p.tcp[addr] {
+		ic := idle[len(idle)-1]
+		p.tcp[addr] = idle[:len(idle)-1]
+		if time.Since(ic.since) < tcpIdle {
+			return ic.conn
+		}
+		ic.conn.Close()
+	}
+	return nil
+}
+
+func (p *connPool) putTCP(addr string, conn *dns.Conn) {
+	conn.SetDeadline(time.Time{})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tcp[addr]) >= tcpIdlePerAddr {
+		conn.Close()
+		return
+	}
+	p.tcp[addr] = append(p.tcp[addr], idleConn{conn, time.Now()})
+}
+
+// close 关闭全部 UDP 套接字和空闲的 TCP 连接，正在等待的查询收到 net.ErrClosed
+func (p *connPool) close() {
+	p.mu.Lock()
+	udp, tcp := p.udp, p.tcp
+	p.udp, p.tcp = make(map[string]*udpMux), make(map[string][]idleConn)
+	p.mu.Unlock()
+	for _, mux := range udp {
+		mux.conn.Close()
+	}
+	for _, idle := range tcp {
+		for _, ic := range idle {
+			ic.conn.Close()
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// freePort 返回 127.0.53.1 上一个空闲的端口，假层级的所有服务器都监听这个端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.53.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.53.1: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// 多个类型、多次追踪同一批服务器时，同一地址的查询共用 UDP 套接字和 TCP 连接。
+// withFreshConn 的查询每次新建连接，相当于没有连接池时的情况，用来对比
+func TestConnPoolReusesConnections(t *testing.T) {
+	n := newFakeNet(t, freePort(t))
+	names := []string{"www.example.test", "alias.example.test", "www.other.test"}
+	for _, tt := range []struct {
+		name  string
+		tcp   bool
+		fresh bool
+	}{
+		{"udp without pool", false, true},
+		{"udp", false, false},
+		{"tcp without pool", true, true},
+		{"tcp", true, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newFakeTracer(t, n, func(o *Options) { o.TCP = tt.tcp })
+			ctx := context.Background()
+			if tt.fresh {
+				ctx = withFreshConn(ctx)
+			}
+			for _, name := range names {
+				if _, status := tr.traceDNS(ctx, name, "a,txt,mx", nil); status != StatusAnswer && status != StatusNoData {
+					t.Fatalf("%s: status %v", name, status)
+				}
+			}
+			u := tr.Usage()
+			queries, conns := u.Total, u.Connections
+			t.Logf("%d queries over %d connections", queries, conns)
+			switch {
+			case tt.fresh && conns != queries:
+				t.Errorf("%d connections for %d queries without the pool, want one per query", conns, queries)
+			case !tt.fresh && conns >= queries/2:
+				t.Errorf("%d connections for %d queries, want them shared", conns, queries)
+			case !tt.fresh && !tt.tcp && conns > int64(len(n.servers)):
+				// 每个地址一个 UDP 套接字
+				t.Errorf("%d UDP sockets for %d servers", conns, len(n.servers))
+			}
+		})
+	}
+}
+
+// udpResponder 在 127.0.0.1 上监听 UDP，把收到的每个查询交给 handle，返回监听地址和见过的源地址
+func udpResponder(t *testing.T, handle func(pc net.PacketConn, from net.Addr, m *dns.Msg)) (string, func() []string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.1: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var sources []string
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			m := new(dns.Msg)
+			if m.Unpack(buf[:n]) != nil {
+				continue
+			}
+			mu.Lock()
+			if !seen[from.String()] {
+				seen[from.String()] = true
+				sources = append(sources, from.String())
+			}
+			mu.Unlock()
+			handle(pc, from, m)
+		}
+	}()
+	return pc.LocalAddr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(sources)
+	}
+}
+
+func replyTo(pc net.PacketConn, from net.Addr, r *dns.Msg) {
+	packed, _ := r.Pack()
+	pc.WriteTo(packed, from)
+}
+
+func newPoolTracer(t *testing.T) *Tracer {
+	t.Helper()
+	tr, err := New(Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tr.Close)
+	return tr
+}
+
+// 共用套接字上 ID 相同但问题不同的应答是伪造或错发的，丢弃后继续等问题相同的应答
+func TestUDPMuxMatchesQuestion(t *testing.T) {
+	addr, _ := udpResponder(t, func(pc net.PacketConn, from net.Addr, m *dns.Msg) {
+		spoof := new(dns.Msg)
+		spoof.SetReply(m)
+		spoof.Question[0].Name = "evil.test."
+		spoof.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "evil.test.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.IPv4(192, 0, 2, 66)}}
+		replyTo(pc, from, spoof)
+		r := new(dns.Msg)
+		r.SetReply(m)
+		r.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.IPv4(192, 0, 2, 1)}}
+		replyTo(pc, from, r)
+	})
+	tr := newPoolTracer(t)
+	m := new(dns.Msg)
+	m.SetQuestion("WwW.example.test.", dns.TypeA)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, _, err := tr.pool.exchangeUDP(ctx, m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Answer) != 1 || !r.Answer[0].(*dns.A).A.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("answer = %v, want the reply to the question asked", r.Answer)
+	}
+}
+
+// 一个套接字发出 udpMaxQueries 个查询后换新的源端口；Close 关闭套接字，等待中的查询立即失败
+func TestUDPMuxRotateAndClose(t *testing.T) {
+	silent := make(chan bool, 1)
+	addr, sources := udpResponder(t, func(pc net.PacketConn, from net.Addr, m *dns.Msg) {
+		if m.Question[0].Name == "silent.test." {
+			silent <- true
+			return
+		}
+		r := new(dns.Msg)
+		r.SetReply(m)
+		replyTo(pc, from, r)
+	})
+	tr := newPoolTracer(t)
+	ctx := context.Background()
+	for i := 0; i <= udpMaxQueries; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("www.example.test.", dns.TypeA)
+		if _, _, err := tr.pool.exchangeUDP(ctx, m, addr); err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+	}
+	if got := sources(); len(got) != 2 {
+		t.Errorf("%d queries came from %v, want two source ports", udpMaxQueries+1, got)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		m := new(dns.Msg)
+		m.SetQuestion("silent.test.", dns.TypeA)
+		_, _, err := tr.pool.exchangeUDP(ctx, m, addr)
+		errc <- err
+	}()
+	<-silent
+	tr.Close()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("pending query after Close: %v, want net.ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending query still waiting after Close")
+	}
+	tr.pool.mu.Lock()
+	open := len(tr.pool.udp)
+	tr.pool.mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d UDP sockets still in the pool after Close", open)
+	}
+}
@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// CookieInfo 记录一次查询中 DNS Cookie（RFC 7873）的交换情况
+type CookieInfo struct {
+	Sent      string `json:"sent"`
+	Returned  string `json:"returned,omitempty"`
+	Full      bool   `json:"full,omitempty"`
+	Mismatch  bool   `json:"client_mismatch,omitempty"`
+	BadCookie bool   `json:"badcookie,omitempty"`
+	Retried   bool   `json:"retried,omitempty"`
+}
+
+// cookieJar 在整个追踪过程中使用同一个客户端 cookie，并按服务器 IP 记住返回的服务器 cookie
+type cookieJar struct {
+	mu     sync.Mutex
+	client string
+	server map[string]string
+}
+
+func newCookieJar() (*cookieJar, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &cookieJar{client: hex.EncodeToString(b), server: make(map[string]string)}, nil
+}
+
+// attach 给查询加上 COOKIE 选项，已经拿到过该服务器的 cookie 时一并带上
+func (j *cookieJar) attach(m *dns.Msg, server string) string {
+	j.mu.Lock()
+	value := j.client + j.server[server]
+	j.mu.Unlock()
+
+	opt := m.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: value})
+	return value
+}
+
+// store 从应答中取出服务器 cookie 并记下来，供后续对同一 IP 的查询回显
+func (j *cookieJar) store(server, sent string, r *dns.Msg) *CookieInfo {
+	info := &CookieInfo{Sent: sent, BadCookie: r.Rcode == dns.RcodeBadCookie}
+	opt := r.IsEdns0()
+	if opt == nil {
+		return info
+	}
+	for _, o := range opt.Option {
+		c, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+		info.Returned = strings.ToLower(c.Cookie)
+		if !strings.HasPrefix(info.Returned, j.client) {
+			info.Mismatch = true
+			return info
+		}
+		// 前 8 字节是客户端 cookie，后面 8 到 32 字节是服务器 cookie
+		if len(info.Returned) > len(j.client) {
+			info.Full = true
+			j.mu.Lock()
+			j.server[server] = info.Returned[len(j.client):]
+			j.mu.Unlock()
+		}
+	}
+	return info
+}
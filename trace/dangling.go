@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AuthorityServer.AddrStatus 的取值：NS 主机名的地址查询结果
+const (
+	AddrResolved = "resolved"
+	// AddrNXDomain 表示 NS 主机名本身不存在，这样的委派就是悬空的
+	AddrNXDomain = "nxdomain"
+	// AddrNoData 表示名字存在但没有所查地址族的记录
+	AddrNoData = "nodata"
+	AddrFailed = "failed"
+)
+
+// DanglingNS 是一个指向不存在的主机名的 NS 记录。Domain 是主机名的可注册域，
+// DomainNXDomain 表示它也不存在：任何人都可以注册这个域，接管委派
+type DanglingNS struct {
+	Zone           string `json:"zone"`
+	Hostname       string `json:"hostname"`
+	Evidence       string `json:"evidence"`
+	Domain         string `json:"domain,omitempty"`
+	DomainNXDomain bool   `json:"domain_nxdomain,omitempty"`
+}
+
+// findDangling 收集追踪中地址查询得到 NXDOMAIN 的 NS 主机名，同一区的同一主机名只列一次
+func (tr *Tracer) findDangling(ctx context.Context, results []Result) []DanglingNS {
+	var dangling []DanglingNS
+	seen := make(map[string]bool)
+	for _, res := range results {
+		for _, auth := range res.Authorities {
+			if auth.AddrStatus != AddrNXDomain {
+				continue
+			}
+			host := normalizeName(auth.Hostname)
+			key := res.Zone + " " + host
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			d := DanglingNS{Zone: res.Zone, Hostname: host, Evidence: "NXDOMAIN for " + dns.Fqdn(host)}
+			if auth.AddrResolver != "" {
+				d.Evidence = auth.AddrResolver + " answered NXDOMAIN for " + dns.Fqdn(host)
+			}
+			if d.Domain = registrableDomain(host); d.Domain != "" {
+				d.DomainNXDomain = tr.domainMissing(ctx, host, d.Domain)
+			}
+			dangling = append(dangling, d)
+		}
+	}
+	return dangling
+}
+
+// domainMissing 判断 NS 主机名的可注册域是否也不存在；主机名就是可注册域时 NXDOMAIN 已经说明了这一点
+func (tr *Tracer) domainMissing(ctx context.Context, host, domain string) bool {
+	if strings.EqualFold(host, domain) {
+		return true
+	}
+	if tr.noRecursor || ctx.Err() != nil {
+		return false
+	}
+	resp, _, err := tr.queryBootstrap(ctx, tr.newQuery(dns.Fqdn(domain), dns.TypeNS, dns.ClassINET))
+	if err != nil {
+		tr.logger.Debug("registrable domain lookup failed", "domain", domain, "error", err)
+		return false
+	}
+	return resp.Rcode == dns.RcodeNameError
+}
+
+// String 返回一行说明，包括为什么判断为悬空
+func (d DanglingNS) String() string {
+	s := fmt.Sprintf("%s does not exist (%s)", d.Hostname, d.Evidence)
+	if d.DomainNXDomain {
+		s += fmt.Sprintf("; its domain %s is not registered, anyone could register it and take over %s", d.Domain, d.Zone)
+	}
+	return s
+}
@@ -0,0 +1,244 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type DenialProof struct {
+	Zone        string        `json:"zone,omitempty"`
+	QNameHash   string        `json:"qname_hash,omitempty"`
+	NSEC        []DenialRange `json:"nsec,omitempty"`
+	NSEC3       []DenialRange `json:"nsec3,omitempty"`
+	Conclusions []string      `json:"conclusions"`
+}
+
+type DenialRange struct {
+	Owner  string   `json:"owner"`
+	Next   string   `json:"next"`
+	Types  []string `json:"types"`
+	OptOut bool     `json:"opt_out,omitempty"`
+	Proves string   `json:"proves,omitempty"`
+}
+
+// NegativeAnswer 说明一个空应答是 NODATA（名字存在但没有该类型）还是 NXDOMAIN（名字不存在）
+type NegativeAnswer struct {
+	Kind    string `json:"kind"`
+	Zone    string `json:"zone,omitempty"`
+	TTL     uint32 `json:"negative_ttl,omitempty"`
+	Minimum uint32 `json:"soa_minimum,omitempty"`
+}
+
+// negativeAnswer 根据应答码和授权区的 SOA 判断否定应答类型，否定缓存时间取 SOA 自身 TTL 和 minimum 中较小的一个（RFC 2308）
+func negativeAnswer(r *dns.Msg) *NegativeAnswer {
+	neg := &NegativeAnswer{}
+	switch {
+	case r.Rcode == dns.RcodeNameError:
+		neg.Kind = "nxdomain"
+	case r.Rcode == dns.RcodeSuccess && len(r.Answer) == 0:
+		neg.Kind = "nodata"
+	default:
+		return nil
+	}
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			neg.Zone = strings.ToLower(soa.Hdr.Name)
+			neg.Minimum = soa.Minttl
+			neg.TTL = min(soa.Hdr.Ttl, soa.Minttl)
+			return neg
+		}
+	}
+	if neg.Kind == "nodata" {
+		// 没有 SOA 只有 NS 的空应答是委派，不是否定应答
+		for _, rr := range r.Ns {
+			if rr.Header().Rrtype == dns.TypeNS {
+				return nil
+			}
+		}
+	}
+	return neg
+}
+
+// analyzeDenial 解析否定应答授权区里的 SOA、NSEC 和 NSEC3，说明它们构成了哪种不存在证明
+func analyzeDenial(qname string, qtype uint16, rcode int, ns []dns.RR) *DenialProof {
+	proof := &DenialProof{}
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	for _, rr := range ns {
+		switch r := rr.(type) {
+		case *dns.SOA:
+			proof.Zone = r.Hdr.Name
+		case *dns.NSEC:
+			nsecs = append(nsecs, r)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, r)
+		}
+	}
+	if len(nsecs) == 0 && len(nsec3s) == 0 {
+		return nil
+	}
+	if len(nsecs) > 0 {
+		analyzeNSEC(proof, qname, qtype, rcode, nsecs)
+	}
+	if len(nsec3s) > 0 {
+		analyzeNSEC3(proof, qname, qtype, rcode, nsec3s)
+	}
+	if len(proof.Conclusions) == 0 {
+		proof.Conclusions = append(proof.Conclusions, "records do not form a complete proof for this name")
+	}
+	return proof
+}
+
+func analyzeNSEC(proof *DenialProof, qname string, qtype uint16, rcode int, nsecs []*dns.NSEC) {
+	qname = strings.ToLower(qname)
+	closest := 0
+	for _, n := range nsecs {
+		rng := DenialRange{Owner: n.Hdr.Name, Next: n.NextDomain, Types: typeNames(n.TypeBitMap)}
+		switch {
+		case strings.EqualFold(n.Hdr.Name, qname):
+			if !hasType(n.TypeBitMap, qtype) && !hasType(n.TypeBitMap, dns.TypeCNAME) {
+				rng.Proves = fmt.Sprintf("%s exists but has no %s records (NODATA)", qname, dns.Type(qtype))
+			}
+		case nsecCovers(n.Hdr.Name, n.NextDomain, qname):
+			rng.Proves = fmt.Sprintf("%s does not exist", qname)
+		}
+		for _, name := range []string{n.Hdr.Name, n.NextDomain} {
+			if c := dns.CompareDomainName(name, qname); c > closest && c < dns.CountLabel(qname) {
+				closest = c
+			}
+		}
+		proof.NSEC = append(proof.NSEC, rng)
+	}
+
+	if rcode == dns.RcodeNameError {
+		// 最近祖先由 NSEC 区间两端与 qname 的公共后缀决定
+		labels := dns.SplitDomainName(qname)
+		ce := dns.Fqdn(strings.Join(labels[len(labels)-closest:], "."))
+		wildcard := "*." + ce
+		if ce == "." {
+			wildcard = "*."
+		}
+		for i, n := range nsecs {
+			if nsecCovers(n.Hdr.Name, n.NextDomain, wildcard) {
+				if proof.NSEC[i].Proves != "" {
+					proof.NSEC[i].Proves += "; "
+				}
+				proof.NSEC[i].Proves += fmt.Sprintf("no wildcard %s", wildcard)
+			}
+		}
+	}
+	proof.Conclusions = append(proof.Conclusions, nsecConclusions(proof.NSEC)...)
+}
+
+func nsecConclusions(ranges []DenialRange) []string {
+	var out []string
+	for _, r := range ranges {
+		for _, p := range strings.Split(r.Proves, "; ") {
+			if p != "" {
+				out = append(out, "NSEC proves "+p)
+			}
+		}
+	}
+	return out
+}
+
+func analyzeNSEC3(proof *DenialProof, qname string, qtype uint16, rcode int, nsec3s []*dns.NSEC3) {
+	first := nsec3s[0]
+	proof.QNameHash = dns.HashName(qname, first.Hash, first.Iterations, first.Salt)
+	for _, n := range nsec3s {
+		proof.NSEC3 = append(proof.NSEC3, DenialRange{
+			Owner:  n.Hdr.Name,
+			Next:   n.NextDomain,
+			Types:  typeNames(n.TypeBitMap),
+			OptOut: n.Flags&1 == 1,
+		})
+	}
+	mark := func(i int, text string) {
+		if proof.NSEC3[i].Proves != "" {
+			proof.NSEC3[i].Proves += "; "
+		}
+		proof.NSEC3[i].Proves += text
+	}
+
+	for i, n := range nsec3s {
+		if n.Match(qname) {
+			if !hasType(n.TypeBitMap, qtype) && !hasType(n.TypeBitMap, dns.TypeCNAME) {
+				mark(i, fmt.Sprintf("%s exists but has no %s records (NODATA)", qname, dns.Type(qtype)))
+				proof.Conclusions = append(proof.Conclusions, fmt.Sprintf("NSEC3 proves %s exists but has no %s records (NODATA)", qname, dns.Type(qtype)))
+			}
+			return
+		}
+	}
+
+	// 最近祖先证明：找到哈希匹配的最近祖先，并确认下一个更近的名字和通配符都被覆盖
+	labels := dns.SplitDomainName(qname)
+	for k := 1; k < len(labels); k++ {
+		ce := dns.Fqdn(strings.Join(labels[k:], "."))
+		ceIdx := -1
+		for i, n := range nsec3s {
+			if n.Match(ce) {
+				ceIdx = i
+				break
+			}
+		}
+		if ceIdx < 0 {
+			continue
+		}
+		mark(ceIdx, fmt.Sprintf("closest encloser %s", ce))
+		nextCloser := dns.Fqdn(strings.Join(labels[k-1:], "."))
+		for i, n := range nsec3s {
+			if n.Cover(nextCloser) {
+				mark(i, fmt.Sprintf("covers next closer name %s", nextCloser))
+				if n.Flags&1 == 1 {
+					proof.Conclusions = append(proof.Conclusions, fmt.Sprintf("NSEC3 opt-out: %s may be an unsigned delegation, its existence is not proven either way", nextCloser))
+				} else if rcode == dns.RcodeNameError {
+					proof.Conclusions = append(proof.Conclusions, fmt.Sprintf("NSEC3 proves %s does not exist", qname))
+				}
+			}
+			if n.Cover("*." + ce) {
+				mark(i, fmt.Sprintf("no wildcard *.%s", ce))
+				proof.Conclusions = append(proof.Conclusions, fmt.Sprintf("NSEC3 proves no wildcard *.%s", ce))
+			}
+		}
+		return
+	}
+}
+
+// nsecCovers 判断 name 是否按规范顺序落在 (owner, next) 区间内，最后一条 NSEC 的区间会回绕到区顶点
+func nsecCovers(owner, next, name string) bool {
+	if canonicalCompare(owner, next) < 0 {
+		return canonicalCompare(owner, name) < 0 && canonicalCompare(name, next) < 0
+	}
+	return canonicalCompare(owner, name) < 0 || canonicalCompare(name, next) < 0
+}
+
+// canonicalCompare 按 RFC 4034 6.1 的规范顺序比较域名：从右到左逐个标签、不区分大小写
+func canonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+func typeNames(bitmap []uint16) []string {
+	names := make([]string, 0, len(bitmap))
+	for _, t := range bitmap {
+		names = append(names, dns.Type(t).String())
+	}
+	return names
+}
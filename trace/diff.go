@@ -0,0 +1,116 @@
+package trace
+
+import (
+	"sort"
+	"strings"
+)
+
+type AnswerDiff struct {
+	Domain     string            `json:"domain"`
+	Servers    int               `json:"servers"`
+	Agreeing   int               `json:"agreeing"`
+	Consensus  []string          `json:"consensus"`
+	Deviations []ServerDeviation `json:"deviations,omitempty"`
+}
+
+type ServerDeviation struct {
+	Hostname string   `json:"hostname"`
+	IP       string   `json:"ip"`
+	Added    []string `json:"added,omitempty"`
+	Omitted  []string `json:"omitted,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// diffAnswers 比较最后一级每个权威服务器 IP 返回的记录集
+func diffAnswers(results []Result) *AnswerDiff {
+	if len(results) == 0 {
+		return nil
+	}
+	final := results[len(results)-1]
+	diff := &AnswerDiff{Domain: final.Domain}
+
+	type answerSet struct {
+		hostname, ip string
+		records      []string
+		err          string
+	}
+	var sets []answerSet
+	counts := make(map[string]int)
+	for _, auth := range final.Authorities {
+		// 同一 IP 上多种类型的应答合并成一个记录集，并以类型作前缀区分
+		for _, qrs := range GroupByIP(auth.QueryResults) {
+			set := answerSet{hostname: auth.Hostname, ip: qrs[0].ServerIP}
+			multi := len(qrs) > 1
+			for _, qr := range qrs {
+				if qr.Error != "" {
+					set.err = qr.Error
+				}
+				for _, a := range qr.Answers {
+					if multi {
+						a = qr.Qtype + " " + a
+					}
+					set.records = append(set.records, a)
+				}
+			}
+			sort.Strings(set.records)
+			sets = append(sets, set)
+			if set.err == "" {
+				counts[strings.Join(set.records, "\n")]++
+			}
+		}
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].hostname != sets[j].hostname {
+			return sets[i].hostname < sets[j].hostname
+		}
+		return sets[i].ip < sets[j].ip
+	})
+	diff.Servers = len(sets)
+
+	// 出现次数最多的记录集作为共识，次数相同时取字典序最小的，保证结果稳定
+	var consensusKey string
+	best := -1
+	for key, n := range counts {
+		if n > best || (n == best && key < consensusKey) {
+			consensusKey, best = key, n
+		}
+	}
+	if best > 0 {
+		diff.Agreeing = best
+		if consensusKey != "" {
+			diff.Consensus = strings.Split(consensusKey, "\n")
+		}
+	}
+
+	for _, set := range sets {
+		if set.err != "" {
+			diff.Deviations = append(diff.Deviations, ServerDeviation{Hostname: set.hostname, IP: set.ip, Omitted: diff.Consensus, Error: set.err})
+			continue
+		}
+		added, omitted := compareRecords(set.records, diff.Consensus)
+		if len(added) > 0 || len(omitted) > 0 {
+			diff.Deviations = append(diff.Deviations, ServerDeviation{Hostname: set.hostname, IP: set.ip, Added: added, Omitted: omitted})
+		}
+	}
+	return diff
+}
+
+func compareRecords(got, want []string) (added, omitted []string) {
+	wantSet := make(map[string]struct{}, len(want))
+	for _, r := range want {
+		wantSet[r] = struct{}{}
+	}
+	gotSet := make(map[string]struct{}, len(got))
+	for _, r := range got {
+		gotSet[r] = struct{}{}
+		if _, ok := wantSet[r]; !ok {
+			added = append(added, r)
+		}
+	}
+	for _, r := range want {
+		if _, ok := gotSet[r]; !ok {
+			omitted = append(omitted, r)
+		}
+	}
+	return added, omitted
+}
@@ -0,0 +1,132 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// parseServerList 解析一组服务器：主机名之后照常查询地址，直接写的 IP 作为它自己的胶水原样使用
+func parseServerList(names []string) ([]string, glueAddrs, error) {
+	var servers []string
+	glue := make(glueAddrs)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if ip := net.ParseIP(name); ip != nil {
+			glue[name+"."] = []net.IP{ip}
+			servers = append(servers, name)
+			continue
+		}
+		if _, ok := dns.IsDomainName(name); !ok {
+			return nil, nil, fmt.Errorf("invalid nameserver %q", name)
+		}
+		servers = append(servers, normalizeName(name))
+	}
+	return servers, glue, nil
+}
+
+// queryDirect 不从根追踪，直接向 Options.Servers 列出的服务器查询 domain，结果是单独的一级；
+// 服务器负责哪个区事先不知道，取权威应答里 SOA 或 NS 的属主名，应答里都没有时再单独要一次 SOA
+func (tr *Tracer) queryDirect(ctx context.Context, domain, types string, emit func(Result)) ([]Result, Status) {
+	domain = dns.Fqdn(domain)
+	tr.logger.Info("querying listed servers", "domain", domain, "servers", len(tr.servers))
+	result := Result{Level: 1, Domain: domain}
+	tr.emitLevelStarted(domain, "", 1, len(tr.servers))
+	finish := func(status Status) ([]Result, Status) {
+		if emit != nil {
+			emit(result)
+		}
+		return []Result{result}, status
+	}
+	var authorities []AuthorityServer
+	for _, qt := range parseQueryTypes(types) {
+		more, _, _, err := tr.getAuthorities(ctx, domain, "", tr.servers, tr.serverGlue, qt)
+		authorities = mergeAuthorities(authorities, more)
+		if err != nil {
+			break
+		}
+	}
+	for i := range authorities {
+		if _, listed := tr.serverGlue[authorities[i].Hostname+"."]; listed {
+			authorities[i].AddrSource = "listed"
+		}
+	}
+	result.Authorities = tr.sortAuthorities(authorities)
+	if ctx.Err() != nil {
+		result.Error, result.Code = abortMessage(ctx.Err()), ErrAborted
+		return finish(StatusAborted)
+	}
+	if result.Zone = directZone(result); result.Zone == "" {
+		result.Zone = tr.probeZone(ctx, domain, result)
+	}
+	classifyLevel(&result)
+	note, failure := levelFailures(result)
+	if failure != "" {
+		result.Error, result.Code = failure, levelErrorCode(result)
+		return finish(failedLevelStatus(result))
+	}
+	if note != "" {
+		result.Notes = append(result.Notes, note)
+	}
+	if servers := nxdomainServers(result.Authorities); len(servers) > 0 {
+		result.Notes = append(result.Notes, fmt.Sprintf("NXDOMAIN: %s does not exist (authoritative answer from %s)", domain, strings.Join(servers, ", ")))
+	}
+	if child := delegatedZone(result); child != "" {
+		// 列出的服务器不负责这个名字，只给出了转介；-servers 不会沿转介继续
+		result.Notes = append(result.Notes, fmt.Sprintf("referral to %s: the listed servers are not authoritative for %s", child, domain))
+	}
+	return finish(finalStatus([]Result{result}))
+}
+
+// directZone 返回权威应答里出现最多的区名，没有权威应答时为空
+func directZone(result Result) string {
+	counts := make(map[string]int)
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Zone != "" {
+				counts[qr.Zone]++
+			}
+		}
+	}
+	zones := make([]string, 0, len(counts))
+	for z := range counts {
+		zones = append(zones, z)
+	}
+	slices.Sort(zones)
+	best := ""
+	for _, z := range zones {
+		if counts[z] > counts[best] {
+			best = z
+		}
+	}
+	return best
+}
+
+// probeZone 向第一台给出权威应答的服务器查询 domain 的 SOA，肯定应答和否定应答里 SOA 的属主名都是区名
+func (tr *Tracer) probeZone(ctx context.Context, domain string, result Result) string {
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Error != "" || !qr.Flags.AA {
+				continue
+			}
+			r, _, err := tr.queryAuthorities(ctx, domain, qr.ServerIP, dns.TypeSOA)
+			if err != nil {
+				return ""
+			}
+			for _, rr := range slices.Concat(r.Answer, r.Ns) {
+				if soa, ok := rr.(*dns.SOA); ok {
+					return strings.ToLower(soa.Hdr.Name)
+				}
+			}
+			return ""
+		}
+	}
+	return ""
+}
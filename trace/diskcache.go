@@ -0,0 +1,297 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// diskCacheVersion 是缓存文件的格式版本，读到其他版本的文件时当作没有缓存，下次保存时重写
+const diskCacheVersion = 1
+
+// diskCacheData 是缓存文件的内容：Referrals 是根区给出的顶级域转介，Addrs 是 -dns 查到的根服务器地址
+type diskCacheData struct {
+	Version   int                       `json:"version"`
+	Referrals map[string]cachedReferral `json:"referrals"`
+	Addrs     []cachedAddr              `json:"root_addrs,omitempty"`
+}
+
+type cachedReferral struct {
+	Servers []string            `json:"servers"`
+	Glue    map[string][]string `json:"glue,omitempty"`
+	Expires time.Time           `json:"expires"`
+}
+
+type cachedAddr struct {
+	Host    string    `json:"host"`
+	Type    string    `json:"type"`
+	IPs     []string  `json:"ips"`
+	AD      bool      `json:"ad,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// diskCache 在多次运行之间保存根区和顶级域的委派：追踪从根开始时先找顶级域的转介，命中就不再查询根服务器；
+// 根服务器的地址放进 NS 地址缓存。条目按记录的 TTL 过期，过期后照常查询并更新。path 为空时只在内存里（Options.ShareReferrals）
+type diskCache struct {
+	path   string
+	logger *slog.Logger
+	mu     sync.Mutex
+	data   diskCacheData
+	dirty  bool
+}
+
+// diskCachePrefix 是缓存文件名的前缀，FlushCache 删除所有这样命名的文件
+const diskCachePrefix = "delegations-"
+
+// diskCacheScope 区分不同根提示、递归服务器和端口下学到的数据，各用一个文件，实验环境的假根不会混进真实的缓存
+func (tr *Tracer) diskCacheScope() string {
+	h := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(tr.rootHintAddrs)) {
+		fmt.Fprintf(h, "%s %s\n", name, strings.Join(tr.rootHintAddrs[name], ","))
+	}
+	fmt.Fprintf(h, "resolver %s port %d\n", tr.bootstrap.addr, tr.port)
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// openDiskCache 读取 dir 下的缓存文件；文件不存在、无法解析或版本不同时从空缓存开始，不影响追踪
+func (tr *Tracer) openDiskCache(dir string) *diskCache {
+	c := &diskCache{
+		path:   filepath.Join(dir, diskCachePrefix+tr.diskCacheScope()+".json"),
+		logger: tr.logger,
+		data:   diskCacheData{Version: diskCacheVersion, Referrals: make(map[string]cachedReferral)},
+	}
+	raw, err := os.ReadFile(c.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Warn("cannot read the disk cache, starting empty", "path", c.path, "error", err)
+		}
+		return c
+	}
+	var data diskCacheData
+	switch err := json.Unmarshal(raw, &data); {
+	case err != nil:
+		c.logger.Warn("ignoring corrupt disk cache, it will be rebuilt", "path", c.path, "error", err)
+		c.dirty = true
+		return c
+	case data.Version != diskCacheVersion:
+		c.logger.Warn("ignoring disk cache with a different format version, it will be rebuilt", "path", c.path, "version", data.Version)
+		c.dirty = true
+		return c
+	}
+	if data.Referrals == nil {
+		data.Referrals = make(map[string]cachedReferral)
+	}
+	c.data = data
+	now := time.Now()
+	for _, a := range c.data.Addrs {
+		qtype, ok := dns.StringToType[a.Type]
+		if !ok || !now.Before(a.Expires) {
+			continue
+		}
+		var ips []net.IP
+		for _, s := range a.IPs {
+			if ip := net.ParseIP(s); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+		tr.nsAddrCache.seed(a.Host, qtype, addrAnswer{ips: ips, ad: a.AD}, a.Expires)
+	}
+	return c
+}
+
+// newMemoryCache 返回不读写文件的缓存，只在一个 Tracer 的多次追踪之间共用顶级域转介
+func newMemoryCache(logger *slog.Logger) *diskCache {
+	return &diskCache{logger: logger, data: diskCacheData{Version: diskCacheVersion, Referrals: make(map[string]cachedReferral)}}
+}
+
+// onDisk 区分 Options.CacheDir 的缓存和 Options.ShareReferrals 的内存缓存，只有前者计入 Usage.DiskHits 和 DiskMisses
+func (c *diskCache) onDisk() bool {
+	return c.path != ""
+}
+
+// referral 返回缓存里 tld 的转介，过期或没有时 ok 为 false，调用方把它记作一次未命中
+func (c *diskCache) referral(tld string) ([]string, glueAddrs, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ref, ok := c.data.Referrals[tld]
+	if !ok || !time.Now().Before(ref.Expires) || len(ref.Servers) == 0 {
+		return nil, nil, false
+	}
+	glue := make(glueAddrs)
+	for name, addrs := range ref.Glue {
+		for _, s := range addrs {
+			if ip := net.ParseIP(s); ip != nil {
+				glue[name] = append(glue[name], ip)
+			}
+		}
+	}
+	return slices.Clone(ref.Servers), glue, true
+}
+
+// storeReferral 记下根区给出的 tld 转介，ttl 是转介里 NS 和胶水最小的 TTL
+func (c *diskCache) storeReferral(tld string, servers []string, glue glueAddrs, ttl uint32) {
+	if ttl == 0 || len(servers) == 0 {
+		return
+	}
+	ref := cachedReferral{Servers: servers, Glue: make(map[string][]string), Expires: time.Now().Add(time.Duration(ttl) * time.Second)}
+	for name, ips := range glue {
+		for _, ip := range ips {
+			ref.Glue[name] = append(ref.Glue[name], ip.String())
+		}
+	}
+	c.mu.Lock()
+	c.data.Referrals[tld] = ref
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// storeRootAddrs 把 NS 地址缓存里根服务器的地址记下来，下次运行不必再向 -dns 查询
+func (c *diskCache) storeRootAddrs(addrs *addrCache, hosts []string) {
+	var entries []cachedAddr
+	for _, host := range hosts {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			answer, expires, ok := addrs.peek(host, qtype)
+			if !ok || answer.nxdomain {
+				continue
+			}
+			a := cachedAddr{Host: normalizeName(host), Type: dns.TypeToString[qtype], AD: answer.ad, Expires: expires}
+			for _, ip := range answer.ips {
+				a.IPs = append(a.IPs, ip.String())
+			}
+			entries = append(entries, a)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keep := slices.DeleteFunc(slices.Clone(c.data.Addrs), func(old cachedAddr) bool {
+		return slices.ContainsFunc(entries, func(a cachedAddr) bool { return a.Host == old.Host && a.Type == old.Type })
+	})
+	c.data.Addrs = append(keep, entries...)
+	c.dirty = true
+}
+
+// save 在有变化时写回缓存文件：先写临时文件再改名，并发运行的 mdig 不会读到写了一半的文件
+func (c *diskCache) save() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty || !c.onDisk() {
+		return
+	}
+	now := time.Now()
+	for tld, ref := range c.data.Referrals {
+		if !now.Before(ref.Expires) {
+			delete(c.data.Referrals, tld)
+		}
+	}
+	c.data.Addrs = slices.DeleteFunc(c.data.Addrs, func(a cachedAddr) bool { return !now.Before(a.Expires) })
+	raw, err := json.MarshalIndent(c.data, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(c.path, raw)
+	}
+	if err != nil {
+		c.logger.Warn("cannot write the disk cache", "path", c.path, "error", err)
+		return
+	}
+	c.dirty = false
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// FlushCache 删除 dir 下 Options.CacheDir 写入的全部缓存文件，返回删除的文件数
+func FlushCache(dir string) (int, error) {
+	files, err := filepath.Glob(filepath.Join(dir, diskCachePrefix+"*.json"))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// useDiskCache 判断本级能否直接用缓存的顶级域转介代替查询根服务器；校验信任链、取 DS 和展开委派树都需要根服务器的真实应答，
+// 追踪顶级域自己时要看根服务器给出的委派
+func (tr *Tracer) useDiskCache(zone, domain string) (string, bool) {
+	if tr.diskCache == nil || zone != "." || tr.validate || tr.showDS || tr.tree || dns.CountLabel(domain) < 2 {
+		return "", false
+	}
+	labels := dns.SplitDomainName(domain)
+	return strings.ToLower(labels[len(labels)-1]) + ".", true
+}
+
+// rememberRootLevel 在根区这一级查询完成后更新缓存：顶级域的转介和根服务器的地址
+func (tr *Tracer) rememberRootLevel(result Result, nextServers []string, nextGlue glueAddrs) {
+	if result.Error != "" || dns.CountLabel(result.Child) != 1 || len(nextServers) == 0 {
+		return
+	}
+	var ttl uint32
+	first := true
+	hosts := make([]string, 0, len(result.Authorities))
+	for _, auth := range result.Authorities {
+		hosts = append(hosts, auth.Hostname)
+		for _, qr := range auth.QueryResults {
+			if !strings.EqualFold(qr.Referral, result.Child) {
+				continue
+			}
+			for _, t := range qr.TTLs {
+				if t.Type == "NS" && t.Section == "authority" && (first || t.TTL < ttl) {
+					ttl, first = t.TTL, false
+				}
+			}
+			for _, g := range qr.Glue {
+				if first || g.TTL < ttl {
+					ttl, first = g.TTL, false
+				}
+			}
+		}
+	}
+	glue := make(glueAddrs)
+	for _, name := range nextServers {
+		if ips := nextGlue[normalizeName(name)]; len(ips) > 0 {
+			glue[normalizeName(name)] = ips
+		}
+	}
+	tr.diskCache.storeReferral(strings.ToLower(result.Child), nextServers, glue, ttl)
+	if tr.diskCache.onDisk() {
+		// 内存缓存不需要：根服务器的地址本来就在 NS 地址缓存里
+		tr.diskCache.storeRootAddrs(tr.nsAddrCache, hosts)
+	}
+}
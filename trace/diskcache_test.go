@@ -0,0 +1,75 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+// 缓存文件损坏、被截断或者版本不同时当作没有缓存：追踪照常从根开始并成功，结束时重写文件，之后的运行能用上它
+func TestDiskCacheRebuilt(t *testing.T) {
+	n := newFakeNet(t, 0)
+	valid := func(t *testing.T) []byte {
+		dir := t.TempDir()
+		tr := newFakeTracer(t, n, func(o *Options) { o.CacheDir = dir })
+		if _, status := tr.Run(context.Background(), "www.example.test", "a", nil); status != StatusAnswer {
+			t.Fatalf("status = %v", status)
+		}
+		raw, err := os.ReadFile(tr.diskCache.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}(t)
+	tests := []struct {
+		name string
+		data []byte
+		warn string
+	}{
+		{"corrupt", []byte("{not json"), "corrupt"},
+		{"truncated", valid[:len(valid)/2], "corrupt"},
+		{"empty", nil, "corrupt"},
+		{"wrong version", bytes.Replace(valid, []byte(`"version": 1`), []byte(`"version": 99`), 1), "different format version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := newFakeTracer(t, n, func(o *Options) { o.CacheDir = dir }).diskCache.path
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var log strings.Builder
+			tr := newFakeTracer(t, n, func(o *Options) {
+				o.CacheDir = dir
+				o.Logger = slog.New(slog.NewTextHandler(&log, nil))
+			})
+			if !strings.Contains(log.String(), tt.warn) {
+				t.Errorf("log = %q, want a warning about a %s cache", log.String(), tt.warn)
+			}
+			report, status := tr.Run(context.Background(), "www.example.test", "a", nil)
+			if status != StatusAnswer {
+				t.Fatalf("status = %v, want %v", status, StatusAnswer)
+			}
+			if report.Results[0].FromCache || report.Usage.DiskHits != 0 {
+				t.Errorf("first level from cache = %v, %d disk hits; want the root queried", report.Results[0].FromCache, report.Usage.DiskHits)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data diskCacheData
+			if err := json.Unmarshal(raw, &data); err != nil || data.Version != diskCacheVersion || len(data.Referrals["test."].Servers) == 0 {
+				t.Fatalf("cache file not rebuilt (%v):\n%s", err, raw)
+			}
+			again := newFakeTracer(t, n, func(o *Options) { o.CacheDir = dir })
+			report, _ = again.Run(context.Background(), "www.example.test", "a", nil)
+			if !report.Results[0].FromCache {
+				t.Error("next run does not use the rebuilt cache")
+			}
+		})
+	}
+}
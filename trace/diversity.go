@@ -0,0 +1,259 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// 比较网络位置时 IPv4 和 IPv6 地址所取的前缀长度
+const (
+	diversityPrefix4 = 24
+	diversityPrefix6 = 48
+)
+
+// DiversityCheck 是区的权威服务器在网络上的分布（RFC 2182 第 3.1 节）：按地址前缀和起源 AS 分组，
+// 全部或只差一台服务器落在同一组里时给出 Warnings
+type DiversityCheck struct {
+	Zone     string            `json:"zone"`
+	Servers  []DiversityServer `json:"servers"`
+	Prefixes []DiversityGroup  `json:"prefixes"`
+	ASNs     []DiversityGroup  `json:"asns,omitempty"`
+	// ASNNote 说明为什么没有按 AS 比较（没有查询或查询全部失败），这时只按前缀比较
+	ASNNote  string   `json:"asn_note,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type DiversityServer struct {
+	Hostname  string             `json:"hostname"`
+	Addresses []DiversityAddress `json:"addresses"`
+}
+
+// DiversityAddress 是一个地址所在的前缀和起源 AS，ASNError 是查询 AS 失败的原因
+type DiversityAddress struct {
+	IP       string   `json:"ip"`
+	Prefix   string   `json:"prefix"`
+	ASNs     []string `json:"asns,omitempty"`
+	ASNError string   `json:"asn_error,omitempty"`
+}
+
+// DiversityGroup 是落在同一个前缀或 AS 里的服务器
+type DiversityGroup struct {
+	Key     string   `json:"key"`
+	Servers []string `json:"servers"`
+}
+
+// asnLookup 是一个 IP 的起源 AS 查询结果；同一个 Tracer 里查到的 AS 只查一次，查询失败的不缓存，下次再查
+type asnLookup struct {
+	done chan struct{}
+	asns []string
+	err  error
+}
+
+type asnCache struct {
+	mu      sync.Mutex
+	entries map[string]*asnLookup
+}
+
+// checkDiversity 比较最终一级各台服务器的地址；地址来自追踪本身，按 IPType 只有一种地址族时只比较这一种
+func (tr *Tracer) checkDiversity(ctx context.Context, domain string, results []Result) *DiversityCheck {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &DiversityCheck{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	check := &DiversityCheck{Zone: level.Zone}
+	for _, auth := range level.Authorities {
+		s := DiversityServer{Hostname: normalizeName(auth.Hostname)}
+		for _, ip := range auth.IPs {
+			s.Addresses = append(s.Addresses, DiversityAddress{IP: ip.String(), Prefix: addressPrefix(ip)})
+		}
+		if len(s.Addresses) > 0 {
+			check.Servers = append(check.Servers, s)
+		}
+	}
+	if len(check.Servers) == 0 {
+		check.Error = "no addresses for the authoritative servers of " + level.Zone
+		return check
+	}
+	switch {
+	case tr.noASN:
+		check.ASNNote = "origin AS not looked up (-no-asn)"
+	case tr.noRecursor:
+		check.ASNNote = "origin AS not looked up, it needs a recursive resolver (-no-recursor)"
+	default:
+		tr.lookupASNs(ctx, check)
+	}
+	check.Prefixes = groupServers(check.Servers, func(a DiversityAddress) []string { return []string{a.Prefix} })
+	if check.ASNNote == "" {
+		check.ASNs = groupServers(check.Servers, func(a DiversityAddress) []string {
+			keys := make([]string, len(a.ASNs))
+			for i, asn := range a.ASNs {
+				keys[i] = "AS" + asn
+			}
+			return keys
+		})
+	}
+	n := len(check.Servers)
+	for _, g := range check.Prefixes {
+		if w := concentration(check.Zone, n, g, "are in "+g.Key); w != "" {
+			check.Warnings = append(check.Warnings, w)
+		}
+	}
+	for _, g := range check.ASNs {
+		if w := concentration(check.Zone, n, g, "originate from "+g.Key); w != "" {
+			check.Warnings = append(check.Warnings, w)
+		}
+	}
+	return check
+}
+
+// concentration 在一组服务器占了全部（或至少三台里只差一台）时返回警告
+func concentration(zone string, total int, g DiversityGroup, where string) string {
+	switch k := len(g.Servers); {
+	case total > 1 && k == total:
+		return fmt.Sprintf("all %d nameservers for %s %s", total, zone, where)
+	case total > 2 && k == total-1:
+		return fmt.Sprintf("%d of %d nameservers for %s %s", k, total, zone, where)
+	}
+	return ""
+}
+
+// groupServers 按 keys 给出的分组统计服务器，只列出有两台以上服务器的组，按服务器数从多到少排列
+func groupServers(servers []DiversityServer, keys func(DiversityAddress) []string) []DiversityGroup {
+	members := make(map[string][]string)
+	var order []string
+	for _, s := range servers {
+		for _, a := range s.Addresses {
+			for _, key := range keys(a) {
+				if _, ok := members[key]; !ok {
+					order = append(order, key)
+				}
+				if !slices.Contains(members[key], s.Hostname) {
+					members[key] = append(members[key], s.Hostname)
+				}
+			}
+		}
+	}
+	groups := []DiversityGroup{}
+	for _, key := range order {
+		if len(members[key]) > 1 {
+			groups = append(groups, DiversityGroup{Key: key, Servers: members[key]})
+		}
+	}
+	slices.SortStableFunc(groups, func(a, b DiversityGroup) int { return len(b.Servers) - len(a.Servers) })
+	return groups
+}
+
+// addressPrefix 返回 ip 所在的 /24（IPv4）或 /48（IPv6）
+func addressPrefix(ip net.IP) string {
+	bits, size := diversityPrefix6, 128
+	if ip.To4() != nil {
+		ip, bits, size = ip.To4(), diversityPrefix4, 32
+	}
+	n := net.IPNet{IP: ip.Mask(net.CIDRMask(bits, size)), Mask: net.CIDRMask(bits, size)}
+	return n.String()
+}
+
+// lookupASNs 查询每个地址的起源 AS；全部失败时在 ASNNote 里说明，只按前缀比较
+func (tr *Tracer) lookupASNs(ctx context.Context, check *DiversityCheck) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Servers {
+		for j := range check.Servers[i].Addresses {
+			a := &check.Servers[i].Addresses[j]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				asns, err := tr.originASN(ctx, a.IP)
+				if err != nil {
+					a.ASNError = err.Error()
+					return
+				}
+				a.ASNs = asns
+			}()
+		}
+	}
+	wg.Wait()
+	var lastErr string
+	for _, s := range check.Servers {
+		for _, a := range s.Addresses {
+			if a.ASNError == "" {
+				return
+			}
+			lastErr = a.ASNError
+		}
+	}
+	check.ASNNote = "origin AS lookups failed, comparing prefixes only: " + lastErr
+}
+
+// originASN 通过 Team Cymru 的 DNS 接口（origin.asn.cymru.com 和 origin6.asn.cymru.com 的 TXT 记录）查询 ip 的起源 AS，
+// 应答形如 "16509 | 52.94.0.0/22 | US | arin | 2011-05-04"，第一段可能有多个以空格分隔的 AS
+func (tr *Tracer) originASN(ctx context.Context, ip string) ([]string, error) {
+	tr.asns.mu.Lock()
+	l, ok := tr.asns.entries[ip]
+	if !ok {
+		l = &asnLookup{done: make(chan struct{})}
+		tr.asns.entries[ip] = l
+		go func() {
+			defer close(l.done)
+			// 结果缓存给之后的追踪，不随这一次追踪取消
+			l.asns, l.err = tr.queryOriginASN(context.WithoutCancel(ctx), ip)
+			if l.err != nil {
+				// 正在等的调用方仍然拿到这个错误，之后的调用重新查询
+				tr.asns.mu.Lock()
+				delete(tr.asns.entries, ip)
+				tr.asns.mu.Unlock()
+			}
+		}()
+	}
+	tr.asns.mu.Unlock()
+	select {
+	case <-l.done:
+		return l.asns, l.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (tr *Tracer) queryOriginASN(ctx context.Context, ip string) ([]string, error) {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(arpa, "in-addr.arpa.") + "origin.asn.cymru.com."
+	if strings.HasSuffix(arpa, ".ip6.arpa.") {
+		name = strings.TrimSuffix(arpa, "ip6.arpa.") + "origin6.asn.cymru.com."
+	}
+	resp, b, err := tr.queryBootstrap(ctx, tr.newQuery(name, dns.TypeTXT, dns.ClassINET))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("resolver %s returned %s for %s", b.addr, dns.RcodeToString[resp.Rcode], name)
+	}
+	var asns []string
+	for _, rr := range resp.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		first, _, _ := strings.Cut(strings.Join(txt.Txt, ""), "|")
+		for _, asn := range strings.Fields(first) {
+			if !slices.Contains(asns, asn) {
+				asns = append(asns, asn)
+			}
+		}
+	}
+	if len(asns) == 0 {
+		return nil, fmt.Errorf("no origin AS announced for %s", ip)
+	}
+	return asns, nil
+}
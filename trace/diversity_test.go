@@ -0,0 +1,42 @@
+package trace
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// 起源 AS 查询失败的结果不缓存：第一次递归服务器返回 SERVFAIL，第二次查询重新发出并得到 AS
+func TestOriginASNRetriesFailure(t *testing.T) {
+	var queries atomic.Int32
+	n := &editNet{fakeNet: newFakeNet(t, 0), edit: func(host string, r *dns.Msg) {
+		if host != fakeResolver || r.Question[0].Name != "3.53.0.127.origin.asn.cymru.com." {
+			return
+		}
+		if queries.Add(1) == 1 {
+			r.Rcode = dns.RcodeServerFailure
+			return
+		}
+		txt, _ := dns.NewRR(`3.53.0.127.origin.asn.cymru.com. 300 IN TXT "64500 | 127.0.53.0/24 | ZZ | test | 2024-01-01"`)
+		r.Rcode, r.Answer = dns.RcodeSuccess, []dns.RR{txt}
+	}}
+	tr := newFakeTracer(t, n.fakeNet, func(o *Options) {
+		o.Exchanger = n
+		o.Retries = 0
+	})
+	if asns, err := tr.originASN(context.Background(), "127.0.53.3"); err == nil {
+		t.Fatalf("first lookup = %v, want the SERVFAIL error", asns)
+	}
+	for range 2 {
+		asns, err := tr.originASN(context.Background(), "127.0.53.3")
+		if err != nil || !slices.Equal(asns, []string{"64500"}) {
+			t.Fatalf("lookup after a failure = %v, %v, want [64500]", asns, err)
+		}
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("%d TXT queries sent, want 2: the failure is retried and the answer cached", got)
+	}
+}
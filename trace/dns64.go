@@ -0,0 +1,114 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// wellKnownDNS64 是 RFC 6052 的知名前缀 64:ff9b::/96
+var wellKnownDNS64 = netip.MustParsePrefix("64:ff9b::/96")
+
+// ipv4onlyAddrs 是 ipv4only.arpa 仅有的两个 A 记录（RFC 7050），DNS64 合成的 AAAA 里嵌着它们
+var ipv4onlyAddrs = []netip.Addr{netip.MustParseAddr("192.0.0.170"), netip.MustParseAddr("192.0.0.171")}
+
+// dns64Timeout 是发现 DNS64 前缀最多等待的时间
+const dns64Timeout = 2 * time.Second
+
+// dns64Prefixes 返回判断 AAAA 是否由 DNS64 合成时使用的前缀：知名前缀加上通过 ipv4only.arpa 发现的本地前缀。
+// 发现成功后不再查询；查询失败时这一次只用知名前缀，下次调用重新发现。看到合成的 AAAA 时只警告一次
+func (tr *Tracer) dns64Prefixes(ctx context.Context) []netip.Prefix {
+	tr.dns64Mu.Lock()
+	defer tr.dns64Mu.Unlock()
+	if tr.dns64 != nil {
+		return tr.dns64
+	}
+	// 结果留给之后的追踪使用，不随这一次追踪取消，dns64Timeout 限制了它的时间
+	qctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dns64Timeout)
+	defer cancel()
+	resp, b, err := tr.queryBootstrap(qctx, tr.newQuery("ipv4only.arpa.", dns.TypeAAAA, dns.ClassINET))
+	if err == nil && resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		err = fmt.Errorf("resolver %s returned %s", b.addr, dns.RcodeToString[resp.Rcode])
+	}
+	if err != nil {
+		tr.logger.Debug("cannot discover the DNS64 prefix", "error", err)
+		return []netip.Prefix{wellKnownDNS64}
+	}
+	prefixes := []netip.Prefix{wellKnownDNS64}
+	for _, rr := range resp.Answer {
+		if aaaa, ok := rr.(*dns.AAAA); ok {
+			if p, ok := nat64Prefix(aaaa.AAAA); ok && !slices.Contains(prefixes, p) {
+				prefixes = append(prefixes, p)
+			}
+		}
+	}
+	tr.dns64 = prefixes
+	if len(resp.Answer) > 0 {
+		tr.warnDNS64(prefixes)
+	}
+	return prefixes
+}
+
+func (tr *Tracer) warnDNS64(prefixes []netip.Prefix) {
+	tr.dns64Warn.Do(func() {
+		names := make([]string, len(prefixes))
+		for i, p := range prefixes {
+			names[i] = p.String()
+		}
+		tr.logger.Warn("the bootstrap resolver synthesizes AAAA records (DNS64), this vantage point is behind NAT64; synthesized nameserver addresses are ignored",
+			"prefixes", strings.Join(names, ", "))
+	})
+}
+
+// nat64Prefix 按 RFC 6052 的各种前缀长度查找 ip 里嵌入的 ipv4only.arpa 地址，找到时返回对应的前缀
+func nat64Prefix(ip net.IP) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ip.To16())
+	if !ok || addr.Is4In6() {
+		// IPv4 地址和 IPv4 映射地址（::ffff:0:0/96）不是 NAT64 合成的
+		return netip.Prefix{}, false
+	}
+	b := addr.As16()
+	for _, bits := range []int{96, 64, 56, 48, 40, 32} {
+		// 第 64 到 71 位（u 字节）必须为 0，嵌入的 IPv4 地址跳过这个字节
+		if bits < 96 && b[8] != 0 {
+			continue
+		}
+		var v4 [4]byte
+		pos := bits / 8
+		for i := range v4 {
+			if pos == 8 {
+				pos++
+			}
+			v4[i] = b[pos]
+			pos++
+		}
+		if slices.Contains(ipv4onlyAddrs, netip.AddrFrom4(v4)) {
+			p, _ := addr.Prefix(bits)
+			return p, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// splitDNS64 把 -dns 服务器给出的 AAAA 分成真实的和 DNS64 合成的。DNS64 只在名字没有 AAAA 时合成，
+// 所以全部地址都落在 DNS64 前缀里才算合成；Options.NoDNS64Check 时不做判断
+func (tr *Tracer) splitDNS64(ctx context.Context, ips []net.IP) (real, synthesized []net.IP) {
+	if tr.noDNS64Check || len(ips) == 0 {
+		return ips, nil
+	}
+	prefixes := tr.dns64Prefixes(ctx)
+	for _, ip := range ips {
+		addr, ok := netip.AddrFromSlice(ip.To16())
+		if !ok || !slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+			return ips, nil
+		}
+	}
+	tr.warnDNS64(prefixes)
+	return nil, ips
+}
@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RFC 6052 第 2.2 节的各种前缀长度，嵌入的都是 ipv4only.arpa 的 192.0.0.170；第 64 到 71 位的 u 字节为 0
+func TestNAT64Prefix(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"2001:db8:c000:aa::", "2001:db8::/32"},
+		{"2001:db8:1c0:0:aa::", "2001:db8:100::/40"},
+		{"2001:db8:122:c000:0:aa00::", "2001:db8:122::/48"},
+		{"2001:db8:122:3c0:0:aa::", "2001:db8:122:300::/56"},
+		{"2001:db8:122:344:c0:0:aa00:0", "2001:db8:122:344::/64"},
+		{"2001:db8:122:344::c000:aa", "2001:db8:122:344::/96"},
+		{"64:ff9b::c000:ab", "64:ff9b::/96"},
+		// 嵌入的不是 ipv4only.arpa 的地址
+		{"64:ff9b::c000:221", ""},
+		// u 字节不为 0，不是 /64 的嵌入方式
+		{"2001:db8:122:344:ffc0:0:aa00:0", ""},
+		{"192.0.0.170", ""},
+	}
+	for _, tt := range tests {
+		p, ok := nat64Prefix(net.ParseIP(tt.addr))
+		got := ""
+		if ok {
+			got = p.String()
+		}
+		if got != tt.want {
+			t.Errorf("nat64Prefix(%s) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+// dns64Net 让递归服务器对 ipv4only.arpa 的前 fail 次查询不应答，之后给出 2001:db8:64::/96 合成的 AAAA
+type dns64Net struct {
+	*fakeNet
+	fail    int32
+	queries atomic.Int32
+}
+
+func (n *dns64Net) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	if host, _, _ := net.SplitHostPort(addr); host != fakeResolver || m.Question[0].Name != "ipv4only.arpa." {
+		return n.fakeNet.Exchange(ctx, m, network, addr)
+	}
+	if n.queries.Add(1) <= n.fail {
+		return nil, 0, &net.OpError{Op: "read", Net: network, Err: os.ErrDeadlineExceeded}
+	}
+	r := new(dns.Msg)
+	r.SetReply(m)
+	for _, ip := range []string{"2001:db8:64::c000:aa", "2001:db8:64::c000:ab"} {
+		aaaa, _ := dns.NewRR("ipv4only.arpa. 3600 IN AAAA " + ip)
+		r.Answer = append(r.Answer, aaaa)
+	}
+	return r, time.Millisecond, nil
+}
+
+// DNS64 前缀发现失败时这一次只用知名前缀，下次调用重新发现；发现不随调用方的 ctx 取消，成功后不再查询
+func TestDNS64PrefixesRetry(t *testing.T) {
+	n := &dns64Net{fakeNet: newFakeNet(t, 0), fail: 1}
+	tr := newFakeTracer(t, n.fakeNet, func(o *Options) {
+		o.Exchanger = n
+		o.NoDNS64Check = false
+		o.Retries = 0
+	})
+	wellKnown := []netip.Prefix{wellKnownDNS64}
+	if got := tr.dns64Prefixes(context.Background()); !slices.Equal(got, wellKnown) {
+		t.Fatalf("prefixes after a failed discovery = %v, want %v", got, wellKnown)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	want := []netip.Prefix{wellKnownDNS64, netip.MustParsePrefix("2001:db8:64::/96")}
+	for range 2 {
+		if got := tr.dns64Prefixes(cancelled); !slices.Equal(got, want) {
+			t.Fatalf("prefixes = %v, want %v", got, want)
+		}
+	}
+	if got := n.queries.Load(); got != 2 {
+		t.Errorf("%d ipv4only.arpa queries, want 2: one failure and one discovery", got)
+	}
+}
@@ -0,0 +1,220 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type DelegationKeys struct {
+	Zone   string    `json:"zone"`
+	DS     []DSInfo  `json:"ds"`
+	DNSKEY []KeyInfo `json:"dnskey"`
+	Errors []string  `json:"errors,omitempty"`
+}
+
+type DSInfo struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digest_type"`
+	Digest     string `json:"digest"`
+	// Matched 表示子域有一个 DNSKEY 按 DigestType 算出的摘要与 Digest 相同，Status 给出不匹配的原因
+	Matched bool   `json:"matched"`
+	Status  string `json:"status"`
+}
+
+// DSInfo.Status 的取值
+const (
+	DSMatched           = "matched"
+	DSDigestMismatch    = "digest-mismatch"
+	DSNoKey             = "no-key"
+	DSUnsupportedDigest = "unsupported-digest"
+)
+
+// 一个委派的 DS 与 DNSKEY 比较后的结论
+const (
+	DelegationSecure   = "secure"
+	DelegationInsecure = "insecure"
+	DelegationBroken   = "broken"
+	DelegationUnknown  = "unknown"
+)
+
+// Verdict 汇总委派的安全状态：没有 DS 是 insecure，至少一个 DS 对上子域的 DNSKEY 是 secure，
+// 有 DS 却一个都对不上是 broken；DS 或 DNSKEY 没有取到时是 unknown
+func (k *DelegationKeys) Verdict() string {
+	switch {
+	case len(k.Errors) > 0:
+		return DelegationUnknown
+	case len(k.DS) == 0:
+		return DelegationInsecure
+	}
+	for _, ds := range k.DS {
+		if ds.Matched {
+			return DelegationSecure
+		}
+	}
+	return DelegationBroken
+}
+
+type KeyInfo struct {
+	KeyTag    uint16 `json:"key_tag"`
+	Algorithm uint8  `json:"algorithm"`
+	Flags     uint16 `json:"flags"`
+	Matched   bool   `json:"matched"`
+}
+
+// SigInfo 是一条 RRSIG；Section 是它所在的应答区（answer 或 authority），应答区的签名不混进 QueryResult.Answers，
+// 由输出画在所签名的 RRset 下面
+type SigInfo struct {
+	Owner       string    `json:"owner"`
+	Section     string    `json:"section"`
+	TypeCovered string    `json:"type_covered"`
+	Algorithm   uint8     `json:"algorithm"`
+	KeyTag      uint16    `json:"key_tag"`
+	SignerName  string    `json:"signer_name"`
+	Inception   time.Time `json:"inception"`
+	Expiration  time.Time `json:"expiration"`
+	// Labels 是签名时属主名的标签数，小于属主名的实际标签数说明应答由通配符合成
+	Labels uint8 `json:"labels"`
+}
+
+func newSigInfo(section string, sig *dns.RRSIG) SigInfo {
+	return SigInfo{
+		Owner:       strings.ToLower(sig.Hdr.Name),
+		Section:     section,
+		TypeCovered: dns.Type(sig.TypeCovered).String(),
+		Algorithm:   sig.Algorithm,
+		KeyTag:      sig.KeyTag,
+		SignerName:  sig.SignerName,
+		Labels:      sig.Labels,
+		Inception:   time.Unix(int64(sig.Inception), 0).UTC(),
+		Expiration:  time.Unix(int64(sig.Expiration), 0).UTC(),
+	}
+}
+
+// String 返回签名的说明，例如 "RRSIG A: algorithm 13, key tag 12345, signer example.com."
+func (s SigInfo) String() string {
+	return fmt.Sprintf("RRSIG %s: algorithm %d, key tag %d, signer %s", s.TypeCovered, s.Algorithm, s.KeyTag, s.SignerName)
+}
+
+// orderWithSignatures 把每条 RRSIG 放到它所签名的记录集后面
+func orderWithSignatures(rrs []dns.RR) []dns.RR {
+	rank := make(map[uint16]int)
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.RRSIG); ok {
+			continue
+		}
+		if _, ok := rank[rr.Header().Rrtype]; !ok {
+			rank[rr.Header().Rrtype] = len(rank)
+		}
+	}
+	key := func(rr dns.RR) (int, int) {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if r, ok := rank[sig.TypeCovered]; ok {
+				return r, 1
+			}
+			return len(rank), 1
+		}
+		return rank[rr.Header().Rrtype], 0
+	}
+	ordered := make([]dns.RR, len(rrs))
+	copy(ordered, rrs)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, si := key(ordered[i])
+		rj, sj := key(ordered[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return si < sj
+	})
+	return ordered
+}
+
+// fetchDelegationKeys 向父域服务器查询子域的 DS，向子域服务器查询 DNSKEY
+func (tr *Tracer) fetchDelegationKeys(ctx context.Context, zone string, parentServers []string, parentGlue glueAddrs, childServers []string, childGlue glueAddrs) *DelegationKeys {
+	keys := &DelegationKeys{Zone: zone}
+	dsRRs, err := tr.queryRRset(ctx, zone, parentServers, parentGlue, dns.TypeDS)
+	if err != nil {
+		keys.Errors = append(keys.Errors, "DS: "+err.Error())
+	}
+	keyRRs, err := tr.queryRRset(withDestination(ctx, zoneDestination(zone)), zone, childServers, childGlue, dns.TypeDNSKEY)
+	if err != nil {
+		keys.Errors = append(keys.Errors, "DNSKEY: "+err.Error())
+	}
+
+	var dnskeys []*dns.DNSKEY
+	for _, rr := range keyRRs {
+		if key, ok := rr.(*dns.DNSKEY); ok {
+			dnskeys = append(dnskeys, key)
+			keys.DNSKEY = append(keys.DNSKEY, KeyInfo{KeyTag: key.KeyTag(), Algorithm: key.Algorithm, Flags: key.Flags})
+		}
+	}
+	for _, rr := range dsRRs {
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			continue
+		}
+		info := DSInfo{KeyTag: ds.KeyTag, Algorithm: ds.Algorithm, DigestType: ds.DigestType, Digest: strings.ToLower(ds.Digest), Status: DSNoKey}
+		// 只按 key tag 和算法对上还不够，key tag 可能碰撞，要用 DS 的摘要算法重新计算摘要
+		for j, key := range dnskeys {
+			if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				continue
+			}
+			computed := key.ToDS(ds.DigestType)
+			switch {
+			case computed == nil:
+				info.Status = DSUnsupportedDigest
+			case strings.EqualFold(computed.Digest, ds.Digest):
+				info.Matched, info.Status = true, DSMatched
+				keys.DNSKEY[j].Matched = true
+			case info.Status != DSMatched:
+				info.Status = DSDigestMismatch
+			}
+		}
+		keys.DS = append(keys.DS, info)
+	}
+	return keys
+}
+
+// queryRRset 依次尝试各服务器，返回第一个成功应答的应答区记录
+func (tr *Tracer) queryRRset(ctx context.Context, name string, servers []string, glue glueAddrs, qtype uint16) ([]dns.RR, error) {
+	var lastErr error
+	for _, srv := range servers {
+		ips, _, err := tr.serverAddrs(ctx, srv, glue)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, ip := range tr.filterFamily(ips) {
+			r, _, err := tr.queryAuthorities(ctx, name, ip.String(), qtype)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if r.Rcode != dns.RcodeSuccess {
+				lastErr = fmt.Errorf("%s from %s (%s)", dns.RcodeToString[r.Rcode], srv, ip)
+				continue
+			}
+			return r.Answer, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no servers to query")
+	}
+	return nil, lastErr
+}
+
+// KeyRole 按 DNSKEY 的标志位返回 KSK、ZSK 或 non-zone key
+func KeyRole(flags uint16) string {
+	switch {
+	case flags&dns.SEP != 0:
+		return "KSK"
+	case flags&dns.ZONE != 0:
+		return "ZSK"
+	}
+	return "non-zone key"
+}
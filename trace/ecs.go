@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// ParseSubnet 解析 Options.Subnet 的前缀，0.0.0.0/0 表示要求服务器不要使用 ECS（RFC 7871 7.1.2）
+func ParseSubnet(s string) (*dns.EDNS0_SUBNET, error) {
+	_, prefix, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an address prefix, use a form like 203.0.113.0/24 or 2001:db8::/48", s)
+	}
+	ones, _ := prefix.Mask.Size()
+	e := &dns.EDNS0_SUBNET{Code: dns.EDNS0SUBNET, SourceNetmask: uint8(ones)}
+	if ip4 := prefix.IP.To4(); ip4 != nil {
+		e.Family = 1
+		e.Address = ip4
+	} else {
+		e.Family = 2
+		e.Address = prefix.IP
+	}
+	return e, nil
+}
+
+func addSubnet(m *dns.Msg, subnet *dns.EDNS0_SUBNET) {
+	if opt := m.IsEdns0(); opt != nil {
+		e := *subnet
+		opt.Option = append(opt.Option, &e)
+	}
+}
+
+// responseScope 返回服务器应答的 scope 前缀长度，没有回显 ECS 选项时返回 nil
+func responseScope(r *dns.Msg) *uint8 {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+			scope := e.SourceScope
+			return &scope
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// ECSProbe 是设置了 Options.ECSProbe 时的结果：最终一级的每个服务器 IP 对每个客户端子网给出的应答，
+// 应答相同的子网归为一组
+type ECSProbe struct {
+	Zone    string      `json:"zone,omitempty"`
+	Name    string      `json:"name"`
+	Qtype   string      `json:"qtype"`
+	Subnets []string    `json:"subnets"`
+	Servers []ECSServer `json:"servers"`
+}
+
+// ECSServer 是一个服务器 IP 的结果。IgnoresECS 表示所有收到的应答都相同，且 scope 都是 0 或没有回显 ECS 选项，
+// 即这个服务器不按客户端子网给出不同的应答
+type ECSServer struct {
+	Hostname   string     `json:"hostname"`
+	IP         string     `json:"ip"`
+	IgnoresECS bool       `json:"ignores_ecs"`
+	Groups     []ECSGroup `json:"groups"`
+}
+
+// ECSGroup 是得到相同应答（应答码和记录集合，不计顺序）的子网，按子网第一次出现的顺序排列；
+// 没有收到应答的子网按错误分组，Answer 为空
+type ECSGroup struct {
+	Answer  string      `json:"answer,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Subnets []ECSSubnet `json:"subnets"`
+}
+
+// ECSSubnet 是一个子网和服务器回显的 scope 前缀长度，没有回显 ECS 选项时 Scope 为 nil
+type ECSSubnet struct {
+	Subnet string `json:"subnet"`
+	Scope  *uint8 `json:"scope,omitempty"`
+}
+
+// probeSubnets 以 tr.ecsProbe 里的每个前缀向最终一级的每个服务器 IP 查询一次名字的第一个查询类型，
+// 查询附带的 ECS 选项替换 Options.Subnet。查询并发进行，经过和追踪相同的限速
+func (tr *Tracer) probeSubnets(ctx context.Context, domain string, results []Result) *ECSProbe {
+	check := &ECSProbe{Name: dns.Fqdn(domain)}
+	for _, e := range tr.ecsProbe {
+		check.Subnets = append(check.Subnets, subnetString(e))
+	}
+	level, ok := zoneLevel(domain, results)
+	if !ok {
+		return check
+	}
+	check.Zone, check.Name = level.Zone, level.Domain
+	for _, auth := range level.Authorities {
+		for _, qrs := range GroupByIP(auth.QueryResults) {
+			if check.Qtype == "" {
+				check.Qtype = qrs[0].Qtype
+			}
+			check.Servers = append(check.Servers, ECSServer{Hostname: normalizeName(auth.Hostname), IP: qrs[0].ServerIP})
+		}
+	}
+	qtype := dns.StringToType[check.Qtype]
+	type answer struct {
+		digest, err string
+		scope       *uint8
+	}
+	answers := make([][]answer, len(check.Servers))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Servers {
+		answers[i] = make([]answer, len(tr.ecsProbe))
+		for j, subnet := range tr.ecsProbe {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				if ctx.Err() != nil {
+					answers[i][j].err = ctx.Err().Error()
+					return
+				}
+				ip := check.Servers[i].IP
+				m, _ := tr.newAuthorityQuery(level.Domain, ip, qtype)
+				setSubnet(m, subnet)
+				r, _, err := tr.exchange(ctx, m, tr.authAddr(ip), tr.queryTimeout)
+				if err != nil {
+					answers[i][j].err = err.Error()
+					return
+				}
+				answers[i][j] = answer{digest: msgDigest(r, level.Zone, level.Domain), scope: responseScope(r)}
+			}()
+		}
+	}
+	wg.Wait()
+	for i := range check.Servers {
+		s := &check.Servers[i]
+		index := make(map[answer]int)
+		ignores, received, distinct := true, 0, make(map[string]bool)
+		for j, a := range answers[i] {
+			sub := ECSSubnet{Subnet: check.Subnets[j], Scope: a.scope}
+			key := answer{digest: a.digest, err: a.err}
+			g, ok := index[key]
+			if !ok {
+				g = len(s.Groups)
+				index[key] = g
+				s.Groups = append(s.Groups, ECSGroup{Answer: a.digest, Error: a.err})
+			}
+			s.Groups[g].Subnets = append(s.Groups[g].Subnets, sub)
+			if a.err == "" {
+				received++
+				distinct[a.digest] = true
+				ignores = ignores && (a.scope == nil || *a.scope == 0)
+			}
+		}
+		// 只有一个子网收到应答时看不出应答是否随子网变化
+		s.IgnoresECS = ignores && received > 1 && len(distinct) == 1
+	}
+	return check
+}
+
+// setSubnet 把查询里的 ECS 选项换成 subnet，查询没有 EDNS 时不做改动
+func setSubnet(m *dns.Msg, subnet *dns.EDNS0_SUBNET) {
+	if opt := m.IsEdns0(); opt != nil {
+		kept := opt.Option[:0]
+		for _, o := range opt.Option {
+			if _, ok := o.(*dns.EDNS0_SUBNET); !ok {
+				kept = append(kept, o)
+			}
+		}
+		opt.Option = kept
+		addSubnet(m, subnet)
+	}
+}
+
+func subnetString(e *dns.EDNS0_SUBNET) string {
+	return fmt.Sprintf("%s/%d", e.Address, e.SourceNetmask)
+}
@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ecsNet 让 example.test. 的 127.0.53.3 按 ECS 给出不同的应答：10.0.0.0/8 的客户端得到 192.0.2.10，
+// 其他客户端得到 192.0.2.20，并回显 scope /24；127.0.53.4 不理会 ECS，应答不变，回显 scope /0
+type ecsNet struct {
+	*fakeNet
+}
+
+func (n ecsNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	r, rtt, err := n.fakeNet.Exchange(ctx, m, network, addr)
+	if err != nil || m.IsEdns0() == nil {
+		return r, rtt, err
+	}
+	var subnet *dns.EDNS0_SUBNET
+	for _, o := range m.IsEdns0().Option {
+		if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+			subnet = e
+		}
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if subnet == nil || (host != "127.0.53.3" && host != "127.0.53.4") {
+		return r, rtt, err
+	}
+	echo := *subnet
+	if host == "127.0.53.3" {
+		echo.SourceScope = 24
+		ip := "192.0.2.20"
+		if subnet.Address.To4()[0] == 10 {
+			ip = "192.0.2.10"
+		}
+		a, _ := dns.NewRR(m.Question[0].Name + " 300 IN A " + ip)
+		r.Answer = []dns.RR{a}
+	}
+	r.SetEdns0(1232, false)
+	r.IsEdns0().Option = append(r.IsEdns0().Option, &echo)
+	return r, rtt, err
+}
+
+// -ecs-probe 按应答把子网分组：按 ECS 给出不同应答的服务器分成两组，不理会 ECS 的服务器只有一组并注明 IgnoresECS
+func TestProbeSubnets(t *testing.T) {
+	n := newFakeNet(t, 0)
+	subnets := []string{"10.1.0.0/24", "203.0.113.0/24", "10.2.0.0/24"}
+	tr := newFakeTracer(t, n, func(o *Options) {
+		o.Exchanger = ecsNet{n}
+		o.ECSProbe = subnets
+	})
+	results, status := tr.traceDNS(context.Background(), "www.example.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	check := tr.probeSubnets(context.Background(), "www.example.test", results)
+	if check.Zone != "example.test." || check.Qtype != "A" || !slices.Equal(check.Subnets, subnets) {
+		t.Errorf("probe = zone %s qtype %s subnets %v", check.Zone, check.Qtype, check.Subnets)
+	}
+	// groups 把每组写成 "应答: 子网 scope ..."，便于比较
+	groups := func(s ECSServer) []string {
+		var out []string
+		for _, g := range s.Groups {
+			line := g.Answer + g.Error + ":"
+			for _, sub := range g.Subnets {
+				line += " " + sub.Subnet
+				if sub.Scope != nil {
+					line += fmt.Sprintf(" scope /%d", *sub.Scope)
+				}
+			}
+			out = append(out, line)
+		}
+		return out
+	}
+	got := make(map[string]ECSServer)
+	for _, s := range check.Servers {
+		got[s.IP] = s
+	}
+	aware, ignoring := got["127.0.53.3"], got["127.0.53.4"]
+	if aware.IgnoresECS || len(aware.Groups) != 2 {
+		t.Errorf("127.0.53.3: ignores ECS %v, groups %q, want two groups", aware.IgnoresECS, groups(aware))
+	} else if a, b := aware.Groups[0], aware.Groups[1]; len(a.Subnets) != 2 || a.Subnets[0].Subnet != "10.1.0.0/24" || a.Subnets[1].Subnet != "10.2.0.0/24" ||
+		len(b.Subnets) != 1 || b.Subnets[0].Subnet != "203.0.113.0/24" || a.Subnets[0].Scope == nil || *a.Subnets[0].Scope != 24 {
+		t.Errorf("127.0.53.3 groups = %q, want the 10.x subnets together with scope /24 and 203.0.113.0/24 apart", groups(aware))
+	}
+	if !ignoring.IgnoresECS || len(ignoring.Groups) != 1 || len(ignoring.Groups[0].Subnets) != 3 {
+		t.Errorf("127.0.53.4: ignores ECS %v, groups %q, want one group of all subnets", ignoring.IgnoresECS, groups(ignoring))
+	}
+}
@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ExtendedError 是应答里的一个扩展错误（RFC 8914 EDE），说明 SERVFAIL 等应答的具体原因：验证失败、过期数据、被拦截等
+type ExtendedError struct {
+	InfoCode  uint16 `json:"info_code"`
+	Name      string `json:"name,omitempty"`
+	ExtraText string `json:"extra_text,omitempty"`
+}
+
+// String 写成 "EDE 9: DNSKEY Missing — 'extra text'"，未登记的代码只写数字
+func (e ExtendedError) String() string {
+	s := fmt.Sprintf("EDE %d", e.InfoCode)
+	if e.Name != "" {
+		s += ": " + e.Name
+	}
+	if e.ExtraText != "" {
+		s += " — '" + e.ExtraText + "'"
+	}
+	return s
+}
+
+// responseEDE 取出应答 OPT 里的全部 EDE 选项，一个应答可以带多个
+func responseEDE(r *dns.Msg) []ExtendedError {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	var errs []ExtendedError
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_EDE); ok {
+			errs = append(errs, ExtendedError{InfoCode: e.InfoCode, Name: dns.ExtendedErrorCodeToString[e.InfoCode], ExtraText: e.ExtraText})
+		}
+	}
+	return errs
+}
+
+// RcodeText 是应答码的名字，带 EDE 时在括号里附上，例如 "SERVFAIL (EDE 9: DNSKEY Missing — 'no SEP matching the DS found')"
+func RcodeText(rcode int, ede []ExtendedError) string {
+	s := dns.RcodeToString[rcode]
+	if len(ede) == 0 {
+		return s
+	}
+	parts := make([]string, len(ede))
+	for i, e := range ede {
+		parts[i] = e.String()
+	}
+	return s + " (" + strings.Join(parts, "; ") + ")"
+}
+
+// resolverError 是 -dns 服务器返回的失败应答，EDE 随错误一起带回，供 AuthorityServer.AddrEDE 使用
+type resolverError struct {
+	msg string
+	ede []ExtendedError
+}
+
+func (e *resolverError) Error() string { return e.msg }
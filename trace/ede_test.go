@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// -dns 服务器的地址应答带 EDE 时，不论应答成功还是 NXDOMAIN 都记在 AddrEDE 里
+func TestAddrEDE(t *testing.T) {
+	stale := ExtendedError{InfoCode: dns.ExtendedErrorCodeStaleAnswer, Name: "Stale Answer", ExtraText: "served stale"}
+	tests := []struct {
+		name    string
+		rcode   int
+		wantErr bool
+	}{
+		{"answer", dns.RcodeSuccess, false},
+		{"name does not exist", dns.RcodeNameError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &editNet{fakeNet: newFakeNet(t, 0), edit: func(host string, r *dns.Msg) {
+				if host != fakeResolver {
+					return
+				}
+				if tt.rcode != dns.RcodeSuccess {
+					r.Rcode, r.Answer = tt.rcode, nil
+				}
+				r.SetEdns0(1232, false)
+				opt := r.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: stale.InfoCode, ExtraText: stale.ExtraText})
+			}}
+			tr := newFakeTracer(t, n.fakeNet, func(o *Options) { o.Exchanger = n })
+			results, _ := tr.traceDNS(context.Background(), "www.other.test", "a", nil)
+			var auth *AuthorityServer
+			for i := range results {
+				for j := range results[i].Authorities {
+					if results[i].Authorities[j].Hostname == "ns.hosting.example.test." {
+						auth = &results[i].Authorities[j]
+					}
+				}
+			}
+			if auth == nil {
+				t.Fatalf("ns.hosting.example.test. not in the trace: %v", zonePath(results))
+			}
+			if !slices.Equal(auth.AddrEDE, []ExtendedError{stale}) {
+				t.Errorf("addr EDE = %v, want %v", auth.AddrEDE, stale)
+			}
+			if failed := auth.Error != ""; failed != tt.wantErr {
+				t.Errorf("error = %q, want failure %v", auth.Error, tt.wantErr)
+			}
+		})
+	}
+}
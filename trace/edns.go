@@ -0,0 +1,201 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// ednsUnknownOption 是测试用的未分配选项号，服务器应忽略它且不在应答里回显
+const ednsUnknownOption = 100
+
+// ednsProbes 按 ednscomp 的测试项命名，每一项都用 SOA 查询区名
+var ednsProbes = []struct {
+	name  string
+	build func(zone string) *dns.Msg
+	check func(r *dns.Msg) string
+}{
+	{"dns", func(zone string) *dns.Msg { return ednsQuery(zone, -1, false, false) }, checkPlain},
+	{"edns", func(zone string) *dns.Msg { return ednsQuery(zone, 0, false, false) }, checkEDNS0},
+	{"edns1", func(zone string) *dns.Msg { return ednsQuery(zone, 1, false, false) }, checkEDNS1},
+	{"ednsopt", func(zone string) *dns.Msg { return ednsQuery(zone, 0, false, true) }, checkUnknownOption},
+	{"do", func(zone string) *dns.Msg { return ednsQuery(zone, 0, true, false) }, checkDO},
+}
+
+// EDNSProbeNames 是 EDNSServer.Probes 的顺序
+func EDNSProbeNames() []string {
+	names := make([]string, len(ednsProbes))
+	for i, p := range ednsProbes {
+		names[i] = p.name
+	}
+	return names
+}
+
+// EDNSCheck 记录区的每台权威服务器对一组 EDNS 测试查询的处理，参照 ednscomp
+type EDNSCheck struct {
+	Zone    string       `json:"zone"`
+	Servers []EDNSServer `json:"servers"`
+	Error   string       `json:"error,omitempty"`
+}
+
+type EDNSServer struct {
+	Hostname string      `json:"hostname"`
+	IP       string      `json:"ip"`
+	Probes   []EDNSProbe `json:"probes"`
+}
+
+// EDNSProbe 是一项测试的结果，Problem 用一句话说明不符合的地方；NoResponse 表示查询被丢弃或超时
+type EDNSProbe struct {
+	Name       string `json:"name"`
+	Pass       bool   `json:"pass"`
+	Rcode      string `json:"rcode,omitempty"`
+	NoResponse bool   `json:"no_response,omitempty"`
+	Problem    string `json:"problem,omitempty"`
+}
+
+// Failed 判断是否有服务器没有通过某一项测试
+func (c *EDNSCheck) Failed() bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Servers {
+		for _, p := range s.Probes {
+			if !p.Pass {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ednsQuery 构造不要求递归的 SOA 查询；version 为负时不带 OPT
+func ednsQuery(zone string, version int, do, unknownOption bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeSOA)
+	m.RecursionDesired = false
+	if version < 0 {
+		return m
+	}
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.SetUDPSize(1232)
+	opt.SetVersion(uint8(version))
+	opt.SetDo(do)
+	if unknownOption {
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: ednsUnknownOption})
+	}
+	m.Extra = append(m.Extra, opt)
+	return m
+}
+
+func checkPlain(r *dns.Msg) string {
+	switch {
+	case r.Rcode != dns.RcodeSuccess:
+		return "a plain DNS query got " + dns.RcodeToString[r.Rcode] + " instead of NOERROR"
+	case r.IsEdns0() != nil:
+		return "the answer to a query without EDNS carries an OPT record"
+	}
+	return ""
+}
+
+func checkEDNS0(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	switch {
+	case r.Rcode != dns.RcodeSuccess:
+		return "an EDNS version 0 query got " + dns.RcodeToString[r.Rcode] + " instead of NOERROR"
+	case opt == nil:
+		return "the answer to an EDNS query has no OPT record, the server does not support EDNS"
+	case opt.Version() != 0:
+		return fmt.Sprintf("the answer uses EDNS version %d instead of 0", opt.Version())
+	}
+	return ""
+}
+
+func checkEDNS1(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	switch {
+	case r.Rcode != dns.RcodeBadVers:
+		return "an EDNS version 1 query got " + dns.RcodeToString[r.Rcode] + " instead of BADVERS (RFC 6891 section 6.1.3)"
+	case opt == nil:
+		return "the BADVERS answer has no OPT record"
+	case opt.Version() != 0:
+		return fmt.Sprintf("the BADVERS answer advertises EDNS version %d instead of the highest supported version 0", opt.Version())
+	case len(r.Answer) > 0:
+		return "the BADVERS answer still contains answer records"
+	}
+	return ""
+}
+
+func checkUnknownOption(r *dns.Msg) string {
+	if problem := checkEDNS0(r); problem != "" {
+		return problem + " when an unknown option is present"
+	}
+	for _, o := range r.IsEdns0().Option {
+		if o.Option() == ednsUnknownOption {
+			return fmt.Sprintf("the server echoes the unknown EDNS option %d instead of ignoring it", ednsUnknownOption)
+		}
+	}
+	return ""
+}
+
+func checkDO(r *dns.Msg) string {
+	if problem := checkEDNS0(r); problem != "" {
+		return problem + " when the DO bit is set"
+	}
+	if !r.IsEdns0().Do() {
+		return "the DO bit is not copied into the answer (RFC 3225)"
+	}
+	return ""
+}
+
+// checkEDNS 向 domain 所在区的每台权威服务器的每个 IP 发送 ednsProbes 里的每项测试
+func (tr *Tracer) checkEDNS(ctx context.Context, domain string, results []Result) *EDNSCheck {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &EDNSCheck{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	check := &EDNSCheck{Zone: level.Zone}
+	targets := tr.authTargets(level)
+	if len(targets) == 0 {
+		check.Error = "no addresses for the authoritative servers of " + level.Zone
+		return check
+	}
+	check.Servers = make([]EDNSServer, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i, t := range targets {
+		check.Servers[i] = EDNSServer{Hostname: t.host, IP: t.ip.String(), Probes: make([]EDNSProbe, len(ednsProbes))}
+		for j := range ednsProbes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				check.Servers[i].Probes[j] = tr.runEDNSProbe(ctx, check.Zone, check.Servers[i].IP, j)
+			}()
+		}
+	}
+	wg.Wait()
+	return check
+}
+
+func (tr *Tracer) runEDNSProbe(ctx context.Context, zone, ip string, i int) EDNSProbe {
+	probe := ednsProbes[i]
+	res := EDNSProbe{Name: probe.name}
+	m := probe.build(zone)
+	var r *dns.Msg
+	_, err := tr.retry(ctx, func() (err error) {
+		r, _, err = tr.exchange(ctx, m, tr.authAddr(ip), tr.queryTimeout)
+		return err
+	})
+	if err != nil {
+		res.NoResponse = true
+		res.Problem = "no response (" + err.Error() + "), the query appears to be dropped"
+		return res
+	}
+	res.Rcode = dns.RcodeToString[r.Rcode]
+	res.Problem = probe.check(r)
+	res.Pass = res.Problem == ""
+	return res
+}
@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// EDNSOption 是应答里 mdig 不专门解读的一个 EDNS 选项，Data 是十六进制的原始内容
+type EDNSOption struct {
+	Code uint16 `json:"code"`
+	Data string `json:"data"`
+}
+
+func (o EDNSOption) String() string {
+	if o.Data == "" {
+		return fmt.Sprintf("option %d (empty)", o.Code)
+	}
+	return fmt.Sprintf("option %d: %s", o.Code, o.Data)
+}
+
+// parseEDNSOption 解析 dig 风格的 code[:hexvalue]，例如 65001:c0ffee；0 和 65535 是保留的选项号
+func parseEDNSOption(s string) (*dns.EDNS0_LOCAL, error) {
+	codeStr, value, _ := strings.Cut(strings.TrimSpace(s), ":")
+	code, err := strconv.ParseUint(codeStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%q: option code must be a number between 1 and 65534", s)
+	}
+	if code == 0 || code == 65535 {
+		return nil, fmt.Errorf("%q: option code %d is reserved", s, code)
+	}
+	if len(value)%2 != 0 {
+		return nil, fmt.Errorf("%q: payload has an odd number of hex digits", s)
+	}
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%q: payload is not hex", s)
+	}
+	return &dns.EDNS0_LOCAL{Code: uint16(code), Data: data}, nil
+}
+
+// parseEDNSOptions 解析 Options.EDNSOptions。和已经由其他选项发送的 NSID、ECS（Subnet 或 ECSProbe）、Cookie 选项号相同时报错，
+// 否则同一个查询里会有两个同号的选项
+func (tr *Tracer) parseEDNSOptions(specs []string, nsid, subnet, ecsProbe, cookies bool) error {
+	builtin := map[uint16]string{}
+	if nsid {
+		builtin[dns.EDNS0NSID] = "NSID"
+	}
+	switch {
+	case subnet:
+		builtin[dns.EDNS0SUBNET] = "Subnet"
+	case ecsProbe:
+		builtin[dns.EDNS0SUBNET] = "ECSProbe"
+	}
+	if cookies {
+		builtin[dns.EDNS0COOKIE] = "Cookies"
+	}
+	for _, spec := range specs {
+		o, err := parseEDNSOption(spec)
+		if err != nil {
+			return err
+		}
+		if name, ok := builtin[o.Code]; ok {
+			return fmt.Errorf("%q: option %d is already sent by %s", spec, o.Code, name)
+		}
+		tr.ednsOptions = append(tr.ednsOptions, o)
+	}
+	return nil
+}
+
+// addEDNSOptions 把 Options.EDNSOptions 附加到查询的 OPT 记录，查询没有 EDNS 时不做改动
+func (tr *Tracer) addEDNSOptions(m *dns.Msg) {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return
+	}
+	for _, o := range tr.ednsOptions {
+		e := *o
+		opt.Option = append(opt.Option, &e)
+	}
+}
+
+// undecodedOptions 返回应答里没有被专门解读和显示的 EDNS 选项：EDE 总会解读，NSID、ECS 和 Cookie
+// 只在请求了它们时才解读，其余的都以选项号加十六进制内容给出，不会被丢掉
+func (tr *Tracer) undecodedOptions(r *dns.Msg) []EDNSOption {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	var out []EDNSOption
+	for _, o := range opt.Option {
+		switch o.Option() {
+		case dns.EDNS0EDE:
+			continue
+		case dns.EDNS0NSID:
+			if tr.nsid {
+				continue
+			}
+		case dns.EDNS0SUBNET:
+			if tr.ecsOption != nil {
+				continue
+			}
+		case dns.EDNS0COOKIE:
+			if tr.cookies != nil {
+				continue
+			}
+		}
+		out = append(out, EDNSOption{Code: o.Option(), Data: hex.EncodeToString(optionData(o))})
+	}
+	return out
+}
+
+// optionData 取出选项的原始内容：把它单独打包进一个 OPT 记录，跳过记录头和选项号、长度
+func optionData(o dns.EDNS0) []byte {
+	if l, ok := o.(*dns.EDNS0_LOCAL); ok {
+		return l.Data
+	}
+	rr := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}, Option: []dns.EDNS0{o}}
+	buf := make([]byte, dns.Len(rr))
+	n, err := dns.PackRR(rr, buf, 0, nil, false)
+	// 根名 1 字节，类型、类、TTL、长度共 10 字节，选项号和选项长度 4 字节
+	const skip = 1 + 10 + 4
+	if err != nil || n < skip {
+		return nil
+	}
+	return buf[skip:n]
+}
@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseEDNSOption(t *testing.T) {
+	tests := []struct {
+		spec     string
+		wantCode uint16
+		wantData []byte
+		wantErr  string
+	}{
+		{"65001", 65001, []byte{}, ""},
+		{"65001:", 65001, []byte{}, ""},
+		{" 12:00ff ", 12, []byte{0x00, 0xff}, ""},
+		{"65001:DEADbeef", 65001, []byte{0xde, 0xad, 0xbe, 0xef}, ""},
+		{"65001:abc", 0, nil, "odd number of hex digits"},
+		{"65001:zz", 0, nil, "not hex"},
+		{"0", 0, nil, "reserved"},
+		{"65535:00", 0, nil, "reserved"},
+		{"65536", 0, nil, "between 1 and 65534"},
+		{"-1", 0, nil, "between 1 and 65534"},
+		{"nsid", 0, nil, "between 1 and 65534"},
+		{"", 0, nil, "between 1 and 65534"},
+	}
+	for _, tt := range tests {
+		o, err := parseEDNSOption(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseEDNSOption(%q) error = %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || o.Code != tt.wantCode || !bytes.Equal(o.Data, tt.wantData) {
+			t.Errorf("parseEDNSOption(%q) = %v, %v, want code %d data %x", tt.spec, o, err, tt.wantCode, tt.wantData)
+		}
+	}
+}
+
+// EDNSOptions 不能和其他选项已经发送的 NSID、ECS、Cookie 同号，ECSProbe 也发送 ECS
+func TestEDNSOptionsDuplicateCode(t *testing.T) {
+	ecs := "8:0001180000"
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{"nsid", Options{NSID: true, EDNSOptions: []string{"3"}}, "already sent by NSID"},
+		{"subnet", Options{Subnet: "192.0.2.0/24", EDNSOptions: []string{ecs}}, "already sent by Subnet"},
+		{"ecs probe", Options{ECSProbe: []string{"192.0.2.0/24"}, EDNSOptions: []string{ecs}}, "already sent by ECSProbe"},
+		{"cookies", Options{Cookies: true, EDNSOptions: []string{"10:0102030405060708"}}, "already sent by Cookies"},
+		{"ecs without subnet", Options{EDNSOptions: []string{ecs}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := New(tt.opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(tr.ednsOptions) != 1 || tr.ednsOptions[0].Code != dns.EDNS0SUBNET {
+					t.Errorf("EDNS options = %v, want the ECS option", tr.ednsOptions)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
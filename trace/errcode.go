@@ -0,0 +1,101 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/miekg/dns"
+)
+
+// ErrorCode 是错误的机器可读分类，和 Error 里给人看的说明一起出现在 Result、AuthorityServer 和 QueryResult 上；
+// 取值保持稳定，监控和脚本可以直接按它判断，不必匹配说明文字
+type ErrorCode string
+
+const (
+	// 单次查询
+	ErrTimeout       ErrorCode = "timeout"
+	ErrConnRefused   ErrorCode = "conn_refused"
+	ErrNetwork       ErrorCode = "network"
+	ErrProxy         ErrorCode = "proxy"
+	ErrRcodeServfail ErrorCode = "rcode_servfail"
+	ErrRcodeRefused  ErrorCode = "rcode_refused"
+	ErrRcodeFailure  ErrorCode = "rcode_failure"
+	ErrLame          ErrorCode = "lame"
+	// 服务器
+	ErrNoIP    ErrorCode = "no_ip"
+	ErrNoGlue  ErrorCode = "no_glue"
+	ErrSkipped ErrorCode = "skipped"
+	ErrAborted ErrorCode = "aborted"
+	ErrLimited ErrorCode = "limited"
+	// 服务器、查询
+	ErrLevelBudget ErrorCode = "level_budget"
+	// 整级
+	ErrNoAuthority ErrorCode = "no_authority"
+	ErrAllFailed   ErrorCode = "all_failed"
+	ErrLoop        ErrorCode = "loop"
+	ErrMaxDepth    ErrorCode = "max_depth"
+	ErrInvalidName ErrorCode = "invalid_name"
+)
+
+// queryErrorCode 给发送查询时的错误分类
+func queryErrorCode(err error) ErrorCode {
+	var srcErr *sourceMismatchError
+	var connErr *connectError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &srcErr):
+		return ErrSkipped
+	case errors.As(err, new(*proxyError)):
+		return ErrProxy
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrAborted
+	case errors.As(err, &connErr) && connErr.reason == "refused", errors.Is(err, syscall.ECONNREFUSED):
+		return ErrConnRefused
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrTimeout
+	}
+	return ErrNetwork
+}
+
+// rcodeErrorCode 给失败的应答码分类，NOERROR 和 NXDOMAIN 不算错误
+func rcodeErrorCode(rcode int) ErrorCode {
+	switch {
+	case !RcodeFailure(rcode):
+		return ""
+	case rcode == dns.RcodeServerFailure:
+		return ErrRcodeServfail
+	case rcode == dns.RcodeRefused:
+		return ErrRcodeRefused
+	}
+	return ErrRcodeFailure
+}
+
+// levelErrorCode 是整级服务器都失败时的分类：各服务器失败的原因相同时就用它，否则是 all_failed
+func levelErrorCode(result Result) ErrorCode {
+	var code ErrorCode
+	for _, auth := range result.Authorities {
+		if auth.Code == ErrLimited {
+			continue
+		}
+		c := auth.Code
+		for _, qr := range auth.QueryResults {
+			if c == "" {
+				c = qr.Code
+			}
+		}
+		switch {
+		case c == "":
+			return ErrAllFailed
+		case code == "":
+			code = c
+		case code != c:
+			return ErrAllFailed
+		}
+	}
+	if code == "" {
+		return ErrAllFailed
+	}
+	return code
+}
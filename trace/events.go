@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type Event struct {
+	Event       string    `json:"event"`
+	Time        time.Time `json:"time"`
+	Domain      string    `json:"domain,omitempty"`
+	Level       int       `json:"level,omitempty"`
+	Zone        string    `json:"zone,omitempty"`
+	Server      string    `json:"server,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	Rcode       string    `json:"rcode,omitempty"`
+	RTTMs       float64   `json:"rtt_ms,omitempty"`
+	Authorities int       `json:"authorities,omitempty"`
+	Levels      int       `json:"levels,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Code        ErrorCode `json:"code,omitempty"`
+}
+
+// emitEvent 把事件交给 Options.OnEvent，没有设置时不产生任何事件
+func (tr *Tracer) emitEvent(ev Event) {
+	if tr.onEvent == nil {
+		return
+	}
+	ev.Time = time.Now()
+	tr.onEvent(ev)
+}
+
+// emitLevelStarted 在开始查询某一级之前发出，Authorities 是这一级要查询的服务器数
+func (tr *Tracer) emitLevelStarted(domain, zone string, level, servers int) {
+	tr.emitEvent(Event{Event: "level_started", Domain: domain, Level: level, Zone: zone, Authorities: servers})
+}
+
+func (tr *Tracer) emitQuerySent(domain, server string, qtype uint16) {
+	tr.emitEvent(Event{Event: "query_sent", Domain: domain, Server: server, Type: dns.TypeToString[qtype]})
+}
+
+func (tr *Tracer) emitResponse(domain string, qtype uint16, qr QueryResult) {
+	ev := Event{
+		Event:  "response_received",
+		Domain: domain,
+		Server: qr.ServerIP,
+		Type:   dns.TypeToString[qtype],
+		RTTMs:  millis(qr.RTT),
+		Error:  qr.Error,
+		Code:   qr.Code,
+	}
+	if qr.Error == "" {
+		ev.Rcode = dns.RcodeToString[qr.Rcode]
+	}
+	tr.emitEvent(ev)
+}
+
+// logResponse 在 Debug 级别记下一个服务器 IP 的应答摘要
+func (tr *Tracer) logResponse(domain, zone, server string, qr QueryResult) {
+	if qr.Error != "" {
+		tr.logger.Debug("query failed", "domain", domain, "zone", zone, "server", server, "ip", qr.ServerIP, "type", qr.Qtype, "code", qr.Code, "error", qr.Error)
+		return
+	}
+	attrs := []any{"domain", domain, "zone", zone, "server", server, "ip", qr.ServerIP, "type", qr.Qtype,
+		"rcode", dns.RcodeToString[qr.Rcode], "aa", qr.Flags.AA, "rtt", qr.RTT}
+	for _, e := range qr.EDE {
+		attrs = append(attrs, "ede", e.String())
+	}
+	if qr.Referral != "" {
+		attrs = append(attrs, "referral", qr.Referral, "ns", len(qr.NS))
+	} else {
+		attrs = append(attrs, "answers", len(qr.Answers))
+	}
+	tr.logger.Debug("response received", attrs...)
+}
@@ -0,0 +1,143 @@
+package trace
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Assertion.Kind 的取值
+const (
+	ExpectAddr  = "addr"
+	ExpectNS    = "ns"
+	ExpectRcode = "rcode"
+)
+
+// Expectations 是调用方对追踪最终结果的断言，用 Check 检查，供监控脚本判断结果是否符合预期而不必匹配输出文字
+type Expectations struct {
+	// Addrs 必须全部出现在最终一级（以及 CNAME 链末端）权威应答的 A/AAAA 记录里
+	Addrs []net.IP
+	// NS 必须全部出现在最终一级的委派里
+	NS []string
+	// Rcode 是最终一级每个应答的服务器都应当返回的应答码，例如 NOERROR、NXDOMAIN；为空时不检查
+	Rcode string
+}
+
+// Assertion 是一项断言的结果，Observed 是追踪实际看到的值，多个值以逗号分隔
+type Assertion struct {
+	Kind     string `json:"kind"`
+	Expected string `json:"expected"`
+	Observed string `json:"observed"`
+	Passed   bool   `json:"passed"`
+}
+
+// ExpectResult 是 Expectations.Check 的结果，断言按地址、NS、应答码的顺序排列
+type ExpectResult struct {
+	Name       string      `json:"name"`
+	Assertions []Assertion `json:"assertions"`
+}
+
+// Failed 返回没有通过的断言
+func (r *ExpectResult) Failed() []Assertion {
+	if r == nil {
+		return nil
+	}
+	var out []Assertion
+	for _, a := range r.Assertions {
+		if !a.Passed {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// Empty 表示没有任何断言
+func (e Expectations) Empty() bool {
+	return len(e.Addrs) == 0 && len(e.NS) == 0 && e.Rcode == ""
+}
+
+// Check 对 report 检查每一项断言。只看最终一级给出了应答的服务器：出错、lame 和仍在转介的应答不算在内；
+// 追踪没有到达最终一级时观察到的值为空，断言都不通过
+func (e Expectations) Check(report Report) *ExpectResult {
+	res := &ExpectResult{Name: dns.Fqdn(report.Domain)}
+	obs := observeFinal(report)
+	for _, ip := range e.Addrs {
+		res.Assertions = append(res.Assertions, Assertion{
+			Kind:     ExpectAddr,
+			Expected: ip.String(),
+			Observed: observedList(obs.addrs, "no addresses"),
+			Passed:   slices.ContainsFunc(obs.addrs, func(s string) bool { return net.ParseIP(s).Equal(ip) }),
+		})
+	}
+	for _, ns := range e.NS {
+		res.Assertions = append(res.Assertions, Assertion{
+			Kind:     ExpectNS,
+			Expected: dns.CanonicalName(ns),
+			Observed: observedList(obs.ns, "no delegation"),
+			Passed:   slices.Contains(obs.ns, dns.CanonicalName(ns)),
+		})
+	}
+	if e.Rcode != "" {
+		want := strings.ToUpper(e.Rcode)
+		res.Assertions = append(res.Assertions, Assertion{
+			Kind:     ExpectRcode,
+			Expected: want,
+			Observed: observedList(obs.rcodes, "no authoritative response"),
+			Passed:   len(obs.rcodes) == 1 && obs.rcodes[0] == want,
+		})
+	}
+	return res
+}
+
+// finalObservation 是最终一级看到的地址、NS 主机名和应答码，各自排好序并去重
+type finalObservation struct {
+	addrs, ns, rcodes []string
+}
+
+func observeFinal(report Report) finalObservation {
+	var obs finalObservation
+	if len(report.Results) == 0 {
+		return obs
+	}
+	final := report.Results[len(report.Results)-1]
+	for _, auth := range final.Authorities {
+		obs.ns = append(obs.ns, dns.CanonicalName(auth.Hostname))
+		for _, qr := range auth.QueryResults {
+			if qr.Error != "" || qr.LameReason != "" || qr.Referral != "" {
+				continue
+			}
+			obs.rcodes = append(obs.rcodes, dns.RcodeToString[qr.Rcode])
+			if qr.Qtype == "A" || qr.Qtype == "AAAA" {
+				obs.addrs = append(obs.addrs, answerAddrs(qr.Answers)...)
+			}
+		}
+	}
+	if n := len(report.CNAMEChain); n > 0 {
+		obs.addrs = append(obs.addrs, answerAddrs(report.CNAMEChain[n-1].Answers)...)
+	}
+	for _, s := range []*[]string{&obs.addrs, &obs.ns, &obs.rcodes} {
+		slices.Sort(*s)
+		*s = slices.Compact(*s)
+	}
+	return obs
+}
+
+// answerAddrs 取出应答里的地址，CNAME 目标等其他记录被忽略
+func answerAddrs(answers []string) []string {
+	var out []string
+	for _, v := range answers {
+		if ip := net.ParseIP(v); ip != nil {
+			out = append(out, ip.String())
+		}
+	}
+	return out
+}
+
+func observedList(values []string, none string) string {
+	if len(values) == 0 {
+		return none
+	}
+	return strings.Join(values, ", ")
+}
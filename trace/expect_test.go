@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// expectReport 的最终一级有一台正常应答、一台超时和一台 lame 的服务器，后两台不算在观察值里
+func expectReport() Report {
+	return Report{
+		Domain: "www.example.test",
+		Results: []Result{
+			{Zone: "test.", Child: "example.test.", Authorities: []AuthorityServer{{Hostname: "ns.test.", QueryResults: []QueryResult{{Referral: "example.test.", NS: []string{"ns1.example.test."}}}}}},
+			{Zone: "example.test.", Authorities: []AuthorityServer{
+				{Hostname: "NS1.Example.Test.", QueryResults: []QueryResult{
+					{Qtype: "A", Answers: []string{"192.0.2.10", "192.0.2.11"}},
+					{Qtype: "AAAA", Answers: []string{"2001:db8::10"}},
+					{Qtype: "TXT", Answers: []string{`"192.0.2.99"`}},
+				}},
+				{Hostname: "ns2.example.test.", QueryResults: []QueryResult{{Qtype: "A", Error: "timeout after 3s", TimedOut: true}}},
+				{Hostname: "ns3.example.test.", QueryResults: []QueryResult{{Qtype: "A", Rcode: dns.RcodeRefused, LameReason: "REFUSED", Answers: []string{"192.0.2.66"}}}},
+			}},
+		},
+	}
+}
+
+func TestExpectationsCheck(t *testing.T) {
+	ips := func(s ...string) (out []net.IP) {
+		for _, v := range s {
+			out = append(out, net.ParseIP(v))
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		expect Expectations
+		report func() Report
+		want   []Assertion
+	}{
+		{
+			name:   "address present",
+			expect: Expectations{Addrs: ips("192.0.2.11")},
+			want:   []Assertion{{Kind: ExpectAddr, Expected: "192.0.2.11", Observed: "192.0.2.10, 192.0.2.11, 2001:db8::10", Passed: true}},
+		},
+		{
+			name:   "several addresses, one missing",
+			expect: Expectations{Addrs: ips("192.0.2.10", "2001:0db8:0::10", "192.0.2.12")},
+			want: []Assertion{
+				{Kind: ExpectAddr, Expected: "192.0.2.10", Observed: "192.0.2.10, 192.0.2.11, 2001:db8::10", Passed: true},
+				{Kind: ExpectAddr, Expected: "2001:db8::10", Observed: "192.0.2.10, 192.0.2.11, 2001:db8::10", Passed: true},
+				{Kind: ExpectAddr, Expected: "192.0.2.12", Observed: "192.0.2.10, 192.0.2.11, 2001:db8::10"},
+			},
+		},
+		{
+			name:   "addresses from lame servers and other types do not count",
+			expect: Expectations{Addrs: ips("192.0.2.66", "192.0.2.99")},
+			want: []Assertion{
+				{Kind: ExpectAddr, Expected: "192.0.2.66", Observed: "192.0.2.10, 192.0.2.11, 2001:db8::10"},
+				{Kind: ExpectAddr, Expected: "192.0.2.99", Observed: "192.0.2.10, 192.0.2.11, 2001:db8::10"},
+			},
+		},
+		{
+			name:   "address at the end of the CNAME chain",
+			expect: Expectations{Addrs: ips("198.51.100.7")},
+			report: func() Report {
+				r := expectReport()
+				r.CNAMEChain = []CNAMEHop{{Name: "www.example.test."}, {Name: "cdn.example.net.", Answers: []string{"198.51.100.7"}}}
+				return r
+			},
+			want: []Assertion{{Kind: ExpectAddr, Expected: "198.51.100.7", Observed: "192.0.2.10, 192.0.2.11, 198.51.100.7, 2001:db8::10", Passed: true}},
+		},
+		{
+			name:   "NS in another case and without the trailing dot",
+			expect: Expectations{NS: []string{"ns1.EXAMPLE.test", "ns3.example.test.", "ns4.example.test"}},
+			want: []Assertion{
+				{Kind: ExpectNS, Expected: "ns1.example.test.", Observed: "ns1.example.test., ns2.example.test., ns3.example.test.", Passed: true},
+				{Kind: ExpectNS, Expected: "ns3.example.test.", Observed: "ns1.example.test., ns2.example.test., ns3.example.test.", Passed: true},
+				{Kind: ExpectNS, Expected: "ns4.example.test.", Observed: "ns1.example.test., ns2.example.test., ns3.example.test."},
+			},
+		},
+		{
+			name:   "rcode",
+			expect: Expectations{Rcode: "noerror"},
+			want:   []Assertion{{Kind: ExpectRcode, Expected: "NOERROR", Observed: "NOERROR", Passed: true}},
+		},
+		{
+			name:   "rcode differs",
+			expect: Expectations{Rcode: "NXDOMAIN"},
+			want:   []Assertion{{Kind: ExpectRcode, Expected: "NXDOMAIN", Observed: "NOERROR"}},
+		},
+		{
+			name:   "servers disagree on the rcode",
+			expect: Expectations{Rcode: "NOERROR"},
+			report: func() Report {
+				r := expectReport()
+				final := &r.Results[len(r.Results)-1]
+				final.Authorities[1].QueryResults[0] = QueryResult{Qtype: "A", Rcode: dns.RcodeNameError}
+				return r
+			},
+			want: []Assertion{{Kind: ExpectRcode, Expected: "NOERROR", Observed: "NOERROR, NXDOMAIN"}},
+		},
+		{
+			name:   "trace did not reach the final level",
+			expect: Expectations{Addrs: ips("192.0.2.10"), Rcode: "NOERROR"},
+			report: func() Report { return Report{Domain: "www.example.test."} },
+			want: []Assertion{
+				{Kind: ExpectAddr, Expected: "192.0.2.10", Observed: "no addresses"},
+				{Kind: ExpectRcode, Expected: "NOERROR", Observed: "no authoritative response"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := expectReport()
+			if tt.report != nil {
+				report = tt.report()
+			}
+			res := tt.expect.Check(report)
+			if res.Name != "www.example.test." {
+				t.Errorf("name = %q", res.Name)
+			}
+			if !slices.Equal(res.Assertions, tt.want) {
+				t.Errorf("assertions = %+v\nwant         %+v", res.Assertions, tt.want)
+			}
+			var failed []Assertion
+			for _, a := range tt.want {
+				if !a.Passed {
+					failed = append(failed, a)
+				}
+			}
+			if got := res.Failed(); !slices.Equal(got, failed) {
+				t.Errorf("Failed() = %+v, want %+v", got, failed)
+			}
+		})
+	}
+}
+
+// 在假层级上追踪后检查：NXDOMAIN 的名字断言 NXDOMAIN 通过，断言地址不通过
+func TestExpectationsCheckTrace(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tests := []struct {
+		name   string
+		domain string
+		expect Expectations
+		passed []bool
+	}{
+		{"answer", "www.example.test", Expectations{Addrs: []net.IP{net.ParseIP("192.0.2.10")}, NS: []string{"NS2.example.test"}, Rcode: "noerror"}, []bool{true, true, true}},
+		{"name does not exist", "missing.example.test", Expectations{Addrs: []net.IP{net.ParseIP("192.0.2.10")}, Rcode: "nxdomain"}, []bool{false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newFakeTracer(t, n, nil)
+			results, _ := tr.traceDNS(context.Background(), tt.domain, "a", nil)
+			res := tt.expect.Check(Report{Domain: tt.domain, Results: results})
+			var passed []bool
+			for _, a := range res.Assertions {
+				passed = append(passed, a.Passed)
+			}
+			if !slices.Equal(passed, tt.passed) {
+				t.Errorf("passed = %v, want %v: %+v", passed, tt.passed, res.Assertions)
+			}
+		})
+	}
+}
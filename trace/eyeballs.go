@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// heDelay 是 RFC 8305 建议的地址族间隔：首选的地址族这么久还没有应答，就同时开始查询另一个地址族；
+// 一个地址族应答之后，另一个地址族的每个查询也最多再等这么久
+const heDelay = 250 * time.Millisecond
+
+// raceLost 是双栈服务器的一个地址族已经应答、另一个地址族的查询被放弃时的取消原因
+type raceLost struct {
+	winner string
+}
+
+func (e *raceLost) Error() string {
+	return fmt.Sprintf("skipped: no answer within %s after %s answered (happy eyeballs)", heDelay, e.winner)
+}
+
+// familyName 是地址族的名字，用在 raceLost 的说明里
+func familyName(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// raceFamilies 按 happy eyeballs 查询一台服务器的全部地址：同一地址族的地址逐个查询，先查 IPv6，
+// 250ms 内没有应答或者查询失败就同时开始查 IPv4。一个地址族查完并且有地址应答之后，另一个地址族的每个查询
+// 从发出（或者那时起）最多再等 250ms，还没应答就取消并记为跳过（skipped），于是不通的地址族仍然出现在结果里，
+// 却不算作失败，这一级也不必等它的超时和重试。query 占用 -concurrency 的名额、按 -retries 重试，返回地址是否应答、是否不再查询其余地址
+func raceFamilies(ctx context.Context, ips []net.IP, query func(context.Context, net.IP) (answered, stop bool)) {
+	var families [2][]net.IP
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			families[0] = append(families[0], ip)
+		} else {
+			families[1] = append(families[1], ip)
+		}
+	}
+	if len(families[0]) == 0 || len(families[1]) == 0 {
+		// 只有一个地址族，和原来一样逐个查询
+		for _, ip := range ips {
+			if _, stop := query(ctx, ip); stop {
+				return
+			}
+		}
+		return
+	}
+	// started 关闭后开始查询第二个地址族，answered[i] 在地址族 i 查完且有应答时关闭
+	started := make(chan struct{})
+	var startOnce sync.Once
+	startLater := func() { startOnce.Do(func() { close(started) }) }
+	timer := time.AfterFunc(heDelay, startLater)
+	defer timer.Stop()
+	answered := [2]chan struct{}{make(chan struct{}), make(chan struct{})}
+	var wg sync.WaitGroup
+	run := func(i int) {
+		defer wg.Done()
+		if i == 1 {
+			select {
+			case <-started:
+			case <-ctx.Done():
+				return
+			}
+		}
+		other := 1 - i
+		lost := &raceLost{familyName(families[other][0])}
+		got := false
+		for _, ip := range families[i] {
+			qctx, qcancel := context.WithCancelCause(ctx)
+			stopWatch := watchRace(answered[other], func() { qcancel(lost) })
+			ok, stop := query(qctx, ip)
+			stopWatch()
+			qcancel(nil)
+			got = got || ok
+			if i == 0 && !ok {
+				// 首选地址族的查询失败了，不必等满 250ms
+				startLater()
+			}
+			if stop {
+				break
+			}
+		}
+		if i == 0 {
+			startLater()
+		}
+		if got {
+			close(answered[i])
+		}
+	}
+	wg.Add(2)
+	go run(0)
+	go run(1)
+	wg.Wait()
+}
+
+// watchRace 在 done 关闭（另一个地址族已经应答）250ms 后调用 abandon；返回的函数在查询结束时停止等待
+func watchRace(done <-chan struct{}, abandon func()) func() {
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+		case <-finished:
+			return
+		}
+		t := time.NewTimer(heDelay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			abandon()
+		case <-finished:
+		}
+	}()
+	return func() { close(finished) }
+}
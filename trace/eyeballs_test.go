@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// IPv6 地址没有应答、IPv4 地址应答时，250ms 后开始查 IPv4，IPv4 应答 250ms 后放弃 IPv6，取消原因是 raceLost
+func TestRaceFamiliesAbandonsSlowFamily(t *testing.T) {
+	v6, v4 := net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")
+	var mu sync.Mutex
+	causes := make(map[string]error)
+	start := time.Now()
+	raceFamilies(context.Background(), []net.IP{v6, v4}, func(ctx context.Context, ip net.IP) (bool, bool) {
+		if ip.To4() != nil {
+			return true, false
+		}
+		<-ctx.Done()
+		mu.Lock()
+		causes[ip.String()] = context.Cause(ctx)
+		mu.Unlock()
+		return false, false
+	})
+	elapsed := time.Since(start)
+	var lost *raceLost
+	if !errors.As(causes[v6.String()], &lost) || lost.winner != "IPv4" {
+		t.Errorf("IPv6 query cancelled with %v, want IPv4 to win the race", causes[v6.String()])
+	}
+	if elapsed < 2*heDelay || elapsed > 4*heDelay {
+		t.Errorf("race took %s, want about %s", elapsed, 2*heDelay)
+	}
+}
+
+// 整个追踪被取消时等待中的查询不是被 happy eyeballs 放弃的，还没开始的地址族也不再查询
+func TestRaceFamiliesCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	var mu sync.Mutex
+	var queried []string
+	var cause error
+	raceFamilies(ctx, []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}, func(qctx context.Context, ip net.IP) (bool, bool) {
+		mu.Lock()
+		queried = append(queried, ip.String())
+		mu.Unlock()
+		<-qctx.Done()
+		cause = context.Cause(qctx)
+		return false, true
+	})
+	var lost *raceLost
+	if errors.As(cause, &lost) || !errors.Is(cause, context.Canceled) {
+		t.Errorf("cancelled query cause = %v, want context.Canceled", cause)
+	}
+	if len(queried) != 1 {
+		t.Errorf("queried %v after the trace was cancelled, want only the IPv6 address", queried)
+	}
+}
+
+// dualNet 把 ns.dual.test. 的 IPv6 地址接到不应答的服务器上，模拟本机 IPv6 不通
+func dualNet(t *testing.T) *fakeNet {
+	n := newFakeNet(t, 0)
+	n.udp["fd00:53::14"], n.tcp["fd00:53::14"] = n.udp["127.0.53.5"], n.tcp["127.0.53.5"]
+	return n
+}
+
+// 被 happy eyeballs 放弃的 IPv6 查询记为跳过：照样出现在结果里，但服务器不算失败，也不计入查询统计
+func TestHappyEyeballsSkipped(t *testing.T) {
+	n := dualNet(t)
+	tr := newFakeTracer(t, n, func(o *Options) {
+		o.AddressFamily = "all"
+		o.Timeout = 2 * time.Second
+	})
+	report, status := tr.Run(context.Background(), "www.dual.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	level := report.Results[len(report.Results)-1]
+	if len(level.Authorities) != 1 {
+		t.Fatalf("authorities = %+v", level.Authorities)
+	}
+	var v6 *QueryResult
+	for i, qr := range level.Authorities[0].QueryResults {
+		if qr.ServerIP == "fd00:53::14" {
+			v6 = &level.Authorities[0].QueryResults[i]
+		}
+	}
+	if v6 == nil {
+		t.Fatalf("IPv6 address not in the results: %+v", level.Authorities[0].QueryResults)
+	}
+	if v6.Code != ErrSkipped || v6.Class != ClassSkipped || v6.TimedOut {
+		t.Errorf("abandoned IPv6 query: code %q, class %q, timed out %v; want skipped", v6.Code, v6.Class, v6.TimedOut)
+	}
+	if len(level.Unreachable) > 0 || slices.ContainsFunc(level.Notes, func(n string) bool { return strings.Contains(n, "answered") }) {
+		t.Errorf("unreachable %v, notes %q; an abandoned query is not a failure", level.Unreachable, level.Notes)
+	}
+	for _, s := range report.Summary {
+		if s.IP == "fd00:53::14" {
+			t.Errorf("summary counts the abandoned IPv6 query: %+v", s)
+		}
+	}
+}
+
+// -no-happy-eyeballs 时逐个地址查询：IPv6 地址一直等到超时和重试用完，记为超时而不是跳过
+func TestNoHappyEyeballs(t *testing.T) {
+	n := dualNet(t)
+	tr := newFakeTracer(t, n, func(o *Options) {
+		o.AddressFamily = "all"
+		o.NoHappyEyeballs = true
+		o.Timeout = 200 * time.Millisecond
+		o.Retries = 1
+	})
+	start := time.Now()
+	report, status := tr.Run(context.Background(), "www.dual.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	qrs := report.Results[len(report.Results)-1].Authorities[0].QueryResults
+	if len(qrs) != 2 {
+		t.Fatalf("queried %d addresses, want both", len(qrs))
+	}
+	for _, qr := range qrs {
+		switch qr.ServerIP {
+		case "fd00:53::14":
+			if !qr.TimedOut || qr.Code == ErrSkipped || qr.Attempts != 2 {
+				t.Errorf("IPv6 query: code %q, timed out %v, %d attempts; want a timeout after the retry", qr.Code, qr.TimedOut, qr.Attempts)
+			}
+		case "127.0.53.14":
+			if qr.Error != "" {
+				t.Errorf("IPv4 query failed: %s", qr.Error)
+			}
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("trace took %s, want it to wait for both IPv6 attempts", elapsed)
+	}
+}
@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// serverFailure 判断一台服务器在本级是否整体失败：只要有一个 IP 给出了可用的委派或应答就不算失败。
+// 失败时返回用于汇总的分类（timed out、SERVFAIL 等）和带 IP 的具体原因
+func serverFailure(auth AuthorityServer) (string, string) {
+	if auth.Error != "" {
+		kind := "failed"
+		switch auth.Code {
+		case ErrNoIP, ErrNoGlue:
+			switch auth.AddrStatus {
+			case AddrNXDomain:
+				kind = "NS name does not exist"
+			case AddrNoData:
+				kind = "NS name has no addresses"
+			default:
+				kind = "address lookup failed"
+			}
+		case ErrAborted:
+			kind = "not queried"
+		case ErrSkipped:
+			kind = "skipped"
+		case ErrLevelBudget:
+			kind = "over level budget"
+		case ErrLimited:
+			// 按 MaxNS 没有查询，不是服务器的问题
+			return "", ""
+		}
+		return kind, auth.Error
+	}
+	kind, detail := "", ""
+	for _, qr := range auth.QueryResults {
+		var k, d string
+		switch {
+		case qr.Class == ClassAnswer, qr.Class == ClassReferral:
+			return "", ""
+		case qr.Class == ClassSkipped:
+			// 没有发出或者被 happy eyeballs 放弃的查询不说明服务器有问题
+			continue
+		case qr.Error != "":
+			k, d = "unreachable", qr.Error
+			switch {
+			case qr.Code == ErrLevelBudget:
+				k = "over level budget"
+			case qr.TimedOut:
+				k = "timed out"
+			}
+		case RcodeFailure(qr.Rcode):
+			k, d = dns.RcodeToString[qr.Rcode], RcodeText(qr.Rcode, qr.EDE)
+		default:
+			k, d = "lame", "lame: "+qr.LameReason
+		}
+		if kind == "" {
+			kind, detail = k, qr.ServerIP+": "+d
+		}
+	}
+	if kind == "" {
+		return "not queried", "no address was queried"
+	}
+	return kind, detail
+}
+
+// levelFailures 汇总本级失败的服务器：部分失败时返回形如 "9/13 root servers answered, 4 timed out" 的提示，
+// 全部失败时返回逐台列出原因的错误
+func levelFailures(result Result) (string, string) {
+	counts := make(map[string]int)
+	var details []string
+	total := 0
+	for _, auth := range result.Authorities {
+		if auth.Code != ErrLimited {
+			total++
+		}
+		if kind, detail := serverFailure(auth); kind != "" {
+			counts[kind]++
+			details = append(details, fmt.Sprintf("%s (%s)", auth.Hostname, detail))
+		}
+	}
+	if len(details) == 0 {
+		return "", ""
+	}
+	label := result.Zone + " servers"
+	switch result.Zone {
+	case ".":
+		label = "root servers"
+	case "":
+		label = "listed servers"
+	}
+	if len(details) == total {
+		return "", fmt.Sprintf("all %d %s failed: %s", total, label, strings.Join(details, "; "))
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if counts[kinds[i]] != counts[kinds[j]] {
+			return counts[kinds[i]] > counts[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", counts[kind], kind)
+	}
+	return fmt.Sprintf("%d/%d %s answered, %s", total-len(details), total, label, strings.Join(parts, ", ")), ""
+}
+
+// failedLevelStatus 给全部服务器都失败的一级选择退出状态：有 lame 应答说明委派坏了，
+// 都是 SERVFAIL/REFUSED 算服务器故障，否则是网络问题
+func failedLevelStatus(result Result) Status {
+	status := StatusNetworkError
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			switch {
+			case qr.Error != "":
+			case RcodeFailure(qr.Rcode):
+				if status == StatusNetworkError {
+					status = StatusServerFailure
+				}
+			default:
+				return StatusBrokenDelegation
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,142 @@
+package trace
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestLevelFailures(t *testing.T) {
+	answer := AuthorityServer{Hostname: "ok.example.", QueryResults: []QueryResult{{ServerIP: "192.0.2.1", Class: ClassAnswer}}}
+	referral := AuthorityServer{Hostname: "ref.example.", QueryResults: []QueryResult{{ServerIP: "192.0.2.2", Class: ClassReferral}}}
+	timeout := AuthorityServer{Hostname: "slow.example.", QueryResults: []QueryResult{{ServerIP: "192.0.2.3", Error: "timeout after 3s", TimedOut: true}}}
+	servfail := AuthorityServer{Hostname: "broken.example.", QueryResults: []QueryResult{{ServerIP: "192.0.2.4", Rcode: dns.RcodeServerFailure, Class: ClassLame}}}
+	lame := AuthorityServer{Hostname: "lame.example.", QueryResults: []QueryResult{{ServerIP: "192.0.2.5", Class: ClassLame, LameReason: "non-authoritative answer"}}}
+	noIP := AuthorityServer{Hostname: "gone.example.", Error: "no IP found for gone.example.", Code: ErrNoIP, AddrStatus: AddrNXDomain}
+	limited := AuthorityServer{Hostname: "extra.example.", Error: "not queried (-max-ns)", Code: ErrLimited}
+	// 只要有一个 IP 给出了应答，这台服务器就不算失败
+	dualStack := AuthorityServer{Hostname: "dual.example.", QueryResults: []QueryResult{
+		{ServerIP: "2001:db8::1", Error: "timeout after 3s", TimedOut: true},
+		{ServerIP: "192.0.2.6", Class: ClassReferral},
+	}}
+
+	tests := []struct {
+		name        string
+		zone        string
+		authorities []AuthorityServer
+		wantNote    string
+		wantError   string
+		wantStatus  Status
+	}{
+		{name: "every server answered", zone: "example.", authorities: []AuthorityServer{answer, referral, dualStack}},
+		{name: "servers over -max-ns are not failures", zone: "example.", authorities: []AuthorityServer{answer, limited}},
+		{
+			name:        "partial failure",
+			zone:        ".",
+			authorities: []AuthorityServer{answer, referral, timeout, servfail, noIP},
+			wantNote:    "2/5 root servers answered, 1 NS name does not exist, 1 SERVFAIL, 1 timed out",
+		},
+		{
+			name:        "most common failure first",
+			zone:        "example.",
+			authorities: []AuthorityServer{answer, timeout, timeout, lame},
+			wantNote:    "1/4 example. servers answered, 2 timed out, 1 lame",
+		},
+		{
+			name:        "all timed out",
+			zone:        "example.",
+			authorities: []AuthorityServer{timeout, limited},
+			wantError:   "all 1 example. servers failed: slow.example. (192.0.2.3: timeout after 3s)",
+			wantStatus:  StatusNetworkError,
+		},
+		{
+			name:        "all SERVFAIL",
+			zone:        "example.",
+			authorities: []AuthorityServer{servfail},
+			wantError:   "all 1 example. servers failed: broken.example. (192.0.2.4: SERVFAIL)",
+			wantStatus:  StatusServerFailure,
+		},
+		{
+			name:        "lame answers mean a broken delegation",
+			zone:        "example.",
+			authorities: []AuthorityServer{timeout, lame},
+			wantError:   "all 2 example. servers failed: slow.example. (192.0.2.3: timeout after 3s); lame.example. (192.0.2.5: lame: non-authoritative answer)",
+			wantStatus:  StatusBrokenDelegation,
+		},
+		{
+			name:        "listed servers",
+			authorities: []AuthorityServer{noIP},
+			wantError:   "all 1 listed servers failed: gone.example. (no IP found for gone.example.)",
+			wantStatus:  StatusNetworkError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Result{Zone: tt.zone, Authorities: tt.authorities}
+			note, failure := levelFailures(result)
+			if note != tt.wantNote {
+				t.Errorf("note = %q, want %q", note, tt.wantNote)
+			}
+			if failure != tt.wantError {
+				t.Errorf("error = %q, want %q", failure, tt.wantError)
+			}
+			if failure != "" {
+				if got := failedLevelStatus(result); got != tt.wantStatus {
+					t.Errorf("status = %v, want %v", got, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+// 同一级里有超时、SERVFAIL 和正常的服务器时追踪继续，失败只记在各自的条目上并汇总在提示里；
+// 全部服务器都超时时追踪停止，错误逐台列出原因
+func TestTraceLevelFailures(t *testing.T) {
+	n := newFakeNet(t, 0)
+	t.Run("mixed servers", func(t *testing.T) {
+		tr := newFakeTracer(t, n, nil)
+		results, status := tr.traceDNS(context.Background(), "www.mixed.test", "a", nil)
+		if status != StatusAnswer {
+			t.Fatalf("status = %v, want %v", status, StatusAnswer)
+		}
+		final := results[len(results)-1]
+		if final.Error != "" {
+			t.Fatalf("level failed: %s", final.Error)
+		}
+		const want = "1/3 mixed.test. servers answered, 1 SERVFAIL, 1 timed out"
+		if !slices.Contains(final.Notes, want) {
+			t.Errorf("notes = %q, want %q", final.Notes, want)
+		}
+		if got := finalAnswers(results); !slices.Equal(got, []string{"192.0.2.60"}) {
+			t.Errorf("answers = %v, want [192.0.2.60]", got)
+		}
+		for _, auth := range final.Authorities {
+			kind, _ := serverFailure(auth)
+			want := map[string]string{"ns1.mixed.test.": "timed out", "ns2.mixed.test.": "SERVFAIL", "ns3.mixed.test.": ""}[auth.Hostname]
+			if kind != want {
+				t.Errorf("%s failure = %q, want %q", auth.Hostname, kind, want)
+			}
+		}
+	})
+	t.Run("every server fails", func(t *testing.T) {
+		tr := newFakeTracer(t, n, nil)
+		results, status := tr.traceDNS(context.Background(), "www.dead.test", "a", nil)
+		if status != StatusNetworkError {
+			t.Errorf("status = %v, want %v", status, StatusNetworkError)
+		}
+		final := results[len(results)-1]
+		const want = "all 2 dead.test. servers failed: ns1.dead.test. (127.0.53.7: query failed: timeout after 300ms); ns2.dead.test. (127.0.53.8: query failed: timeout after 300ms)"
+		if final.Error != want {
+			t.Errorf("error = %q\nwant  %q", final.Error, want)
+		}
+		if final.Code != ErrTimeout {
+			t.Errorf("code = %q, want %q", final.Code, ErrTimeout)
+		}
+		if !strings.Contains(final.Zone, "dead.test") || final.Child != "" {
+			t.Errorf("stopped at zone %q child %q, want dead.test. with no child", final.Zone, final.Child)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// parseFrom 解析 -from 的值：zone 或 zone=ns1,ns2；列表里也可以直接写服务器 IP
+func (tr *Tracer) parseFrom(spec string) error {
+	zone, list, explicit := strings.Cut(spec, "=")
+	if _, ok := dns.IsDomainName(zone); !ok || zone == "" {
+		return fmt.Errorf("invalid -from zone %q", zone)
+	}
+	tr.fromZone = normalizeName(zone)
+	tr.fromGlue = make(glueAddrs)
+	if !explicit {
+		return nil
+	}
+	servers, glue, err := parseServerList(strings.Split(list, ","))
+	if err != nil {
+		return fmt.Errorf("%v in -from", err)
+	}
+	tr.fromServers, tr.fromGlue = servers, glue
+	if len(tr.fromServers) == 0 {
+		return fmt.Errorf("-from %s= needs at least one nameserver", zone)
+	}
+	return nil
+}
+
+// lookupFromServers 没有显式给出 NS 时通过引导解析服务器查询起始区的 NS 集合
+func (tr *Tracer) lookupFromServers(ctx context.Context) error {
+	if len(tr.fromServers) > 0 {
+		return nil
+	}
+	m := tr.newQuery(tr.fromZone, dns.TypeNS, dns.ClassINET)
+	resp, b, err := tr.queryBootstrap(ctx, m)
+	if err != nil {
+		return fmt.Errorf("NS lookup for %s via %s failed: %v", tr.fromZone, b.addr, err)
+	}
+	for _, rr := range resp.Answer {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, tr.fromZone) {
+			tr.fromServers = append(tr.fromServers, normalizeName(ns.Ns))
+		}
+	}
+	if len(tr.fromServers) == 0 {
+		return fmt.Errorf("%s has no NS records according to %s (%s)", tr.fromZone, b.addr, dns.RcodeToString[resp.Rcode])
+	}
+	tr.fromServers = uniqueStrings(tr.fromServers)
+	return nil
+}
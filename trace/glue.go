@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// glueAddrs 记录委派应答附加区里 NS 主机名对应的地址（胶水记录），键为小写的完整域名
+type glueAddrs map[string][]net.IP
+
+// GlueRecord 是委派应答里带的一条胶水地址
+type GlueRecord struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	TTL     uint32 `json:"ttl"`
+}
+
+// collectGlue 从负责 zone 的服务器给出的委派应答附加区取出属于 nsNames 且在 zone 之内的 A/AAAA 记录，
+// 返回带 TTL 的胶水记录和被忽略的地址记录；不是委派时没有胶水
+func collectGlue(extra []dns.RR, nsNames []string, zone string, glue glueAddrs) ([]GlueRecord, []IgnoredRecord) {
+	if len(nsNames) == 0 {
+		return nil, nil
+	}
+	var records []GlueRecord
+	var ignored []IgnoredRecord
+	wanted := make(map[string]bool)
+	for _, name := range nsNames {
+		wanted[strings.ToLower(dns.Fqdn(name))] = true
+	}
+	for _, rr := range extra {
+		name := strings.ToLower(rr.Header().Name)
+		if t := rr.Header().Rrtype; t != dns.TypeA && t != dns.TypeAAAA {
+			continue
+		}
+		if reason := glueOutOfBailiwick(name, zone, wanted); reason != "" {
+			ignored = append(ignored, newIgnoredRecord(rr, reason))
+			continue
+		}
+		var ip net.IP
+		switch rec := rr.(type) {
+		case *dns.A:
+			ip = rec.A
+		case *dns.AAAA:
+			ip = rec.AAAA
+		default:
+			continue
+		}
+		records = append(records, GlueRecord{Name: name, Address: ip.String(), TTL: rr.Header().Ttl})
+		if !containsIP(glue[name], ip) {
+			glue[name] = append(glue[name], ip)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].Address < records[j].Address
+	})
+	return records, ignored
+}
+
+func (g glueAddrs) merge(other glueAddrs) {
+	for name, addrs := range other {
+		for _, ip := range addrs {
+			if !containsIP(g[name], ip) {
+				g[name] = append(g[name], ip)
+			}
+		}
+	}
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, existing := range ips {
+		if existing.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// addrLookup 说明 NS 的地址从哪里来：source 是 glue、recursor 或 iterative，cached 表示全部来自缓存，
+// ad 表示递归服务器给出地址的应答都设置了 AD 位，resolver 是实际给出地址（或 NXDOMAIN）的 -dns 服务器，
+// status 是查询的结果（AddrResolved 等），使用胶水时为空；queries 是解析地址花费的查询数，来自缓存的地址按当初查询时的花费计算
+type addrLookup struct {
+	source   string
+	cached   bool
+	ad       bool
+	resolver string
+	status   string
+	dns64    []net.IP
+	ede      []ExtendedError
+	queries  int64
+}
+
+// serverAddrs 优先使用胶水记录，没有胶水时通过 -dns 指定的服务器（-no-recursor 时从根迭代）查询 NS 的地址
+func (tr *Tracer) serverAddrs(ctx context.Context, host string, glue glueAddrs) ([]net.IP, addrLookup, error) {
+	var ips []net.IP
+	for _, ip := range glue[strings.ToLower(dns.Fqdn(host))] {
+		if tr.wantAddress(ip) {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) > 0 {
+		return ips, addrLookup{source: "glue"}, nil
+	}
+	ips, info, err := tr.lookupSpecificIP(ctx, host)
+	info.source = "recursor"
+	if tr.noRecursor {
+		info.source = "iterative"
+	}
+	return ips, info, err
+}
+
+// wantAddress 判断地址是否属于 -iptype 要求查询的地址族
+func (tr *Tracer) wantAddress(ip net.IP) bool {
+	for _, t := range tr.addressTypes() {
+		if t == dns.TypeA && ip.To4() != nil || t == dns.TypeAAAA && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
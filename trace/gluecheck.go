@@ -0,0 +1,138 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// GlueCheck 比较父域给出的胶水地址和子域为区内 NS 主机名发布的 A/AAAA 记录
+type GlueCheck struct {
+	Zone    string           `json:"zone"`
+	Servers []GlueComparison `json:"servers"`
+}
+
+type GlueComparison struct {
+	Name      string        `json:"name"`
+	Addresses []GlueAddress `json:"addresses,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// GlueAddress 是一个地址在父域胶水和子域权威记录两边的出现情况，TTL 只在该侧存在时有意义
+type GlueAddress struct {
+	Address  string `json:"address"`
+	InGlue   bool   `json:"in_glue"`
+	InChild  bool   `json:"in_child"`
+	GlueTTL  uint32 `json:"glue_ttl,omitempty"`
+	ChildTTL uint32 `json:"child_ttl,omitempty"`
+}
+
+func (c *GlueCheck) Mismatch() bool {
+	if c == nil {
+		return false
+	}
+	for _, srv := range c.Servers {
+		if len(GlueMismatchesFor(srv)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGlue 对 zone 里的每个区内 NS 名字，向子域服务器查询 A 和 AAAA，与委派应答 level 里的胶水逐个地址对比
+func (tr *Tracer) checkGlue(ctx context.Context, zone string, level Result, childServers []string, childGlue glueAddrs) *GlueCheck {
+	glue := make(map[string]map[string]uint32)
+	for _, auth := range level.Authorities {
+		for _, qr := range auth.QueryResults {
+			for _, g := range qr.Glue {
+				if glue[g.Name] == nil {
+					glue[g.Name] = make(map[string]uint32)
+				}
+				glue[g.Name][g.Address] = g.TTL
+			}
+		}
+	}
+
+	check := &GlueCheck{Zone: zone}
+	ctx = withDestination(ctx, zoneDestination(zone))
+	for _, name := range childServers {
+		name = normalizeName(name)
+		// 区外的 NS 不需要也不应该有胶水
+		if !dns.IsSubDomain(zone, name) {
+			continue
+		}
+		cmp := GlueComparison{Name: name}
+		child := make(map[string]uint32)
+		var errs []string
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			rrs, err := tr.queryRRset(ctx, name, childServers, childGlue, qtype)
+			if err != nil {
+				errs = append(errs, dns.TypeToString[qtype]+": "+err.Error())
+				continue
+			}
+			for _, rr := range rrs {
+				if !strings.EqualFold(rr.Header().Name, name) {
+					continue
+				}
+				switch rec := rr.(type) {
+				case *dns.A:
+					child[rec.A.String()] = rec.Hdr.Ttl
+				case *dns.AAAA:
+					child[rec.AAAA.String()] = rec.Hdr.Ttl
+				}
+			}
+		}
+		cmp.Error = strings.Join(errs, "; ")
+		for addr, ttl := range glue[name] {
+			a := GlueAddress{Address: addr, InGlue: true, GlueTTL: ttl}
+			if childTTL, ok := child[addr]; ok {
+				a.InChild, a.ChildTTL = true, childTTL
+			}
+			cmp.Addresses = append(cmp.Addresses, a)
+		}
+		for addr, ttl := range child {
+			if _, ok := glue[name][addr]; !ok {
+				cmp.Addresses = append(cmp.Addresses, GlueAddress{Address: addr, InChild: true, ChildTTL: ttl})
+			}
+		}
+		sort.Slice(cmp.Addresses, func(i, j int) bool {
+			return cmp.Addresses[i].Address < cmp.Addresses[j].Address
+		})
+		check.Servers = append(check.Servers, cmp)
+	}
+	if len(check.Servers) == 0 {
+		return nil
+	}
+	sort.Slice(check.Servers, func(i, j int) bool {
+		return check.Servers[i].Name < check.Servers[j].Name
+	})
+	return check
+}
+
+// FormatGlueAddress 描述一个地址在胶水和子域里的 TTL，只在一边出现时以 ! 开头
+func FormatGlueAddress(a GlueAddress) string {
+	switch {
+	case a.InGlue && a.InChild:
+		return fmt.Sprintf("%s glue ttl %d, child ttl %d", a.Address, a.GlueTTL, a.ChildTTL)
+	case a.InGlue:
+		return fmt.Sprintf("! %s only in glue (ttl %d)", a.Address, a.GlueTTL)
+	}
+	return fmt.Sprintf("! %s only at child (ttl %d)", a.Address, a.ChildTTL)
+}
+
+// GlueMismatchesFor 返回一个 NS 名字下两边不一致的地址；子域查询出错时无法判断缺失，不算不一致
+func GlueMismatchesFor(srv GlueComparison) []string {
+	if srv.Error != "" {
+		return nil
+	}
+	var out []string
+	for _, a := range srv.Addresses {
+		if !a.InGlue || !a.InChild {
+			out = append(out, srv.Name+" "+strings.TrimPrefix(FormatGlueAddress(a), "! "))
+		}
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package trace
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// DelegationGlue.Verdict 的取值
+const (
+	// GlueFull 是区内的每个 NS 都有胶水
+	GlueFull = "glued"
+	// GluePartial 是有胶水，但有区内的 NS 没有胶水
+	GluePartial = "partial"
+	// GlueNone 是委派里一条胶水也没有，递归服务器必须先另外解析 NS 的地址
+	GlueNone = "glueless"
+)
+
+// DelegationGlue 是追踪经过的一个委派的胶水情况，只根据父域的转介判断（兄弟胶水也算胶水）；
+// Unglued 列出没有胶水、需要另外查询地址的 NS
+type DelegationGlue struct {
+	Zone    string      `json:"zone"`
+	Verdict string      `json:"verdict"`
+	NS      int         `json:"ns"`
+	Glued   int         `json:"glued"`
+	Unglued []UngluedNS `json:"unglued,omitempty"`
+	// ColdCacheQueries 是 glueless 委派下，只有根提示的递归服务器解析区外 NS 地址至少要多发的查询数：
+	// 每个不同的 TLD 一次根转介、每个不同的可注册域一次 TLD 转介、每个 NS 一次地址查询
+	ColdCacheQueries int `json:"cold_cache_queries,omitempty"`
+}
+
+// UngluedNS 是一个没有胶水的 NS。InZone 表示它在被委派的区之内，没有胶水就无法解析（循环依赖）；
+// Queries 是 mdig 解析它的地址花费的查询数，地址来自本次追踪的缓存时按当初查询的花费计算
+type UngluedNS struct {
+	Hostname string `json:"hostname"`
+	InZone   bool   `json:"in_zone,omitempty"`
+	Source   string `json:"source"`
+	Cached   bool   `json:"cached,omitempty"`
+	Queries  int64  `json:"queries"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Failed 表示有没有胶水的 NS 地址查询失败
+func (g DelegationGlue) Failed() bool {
+	for _, ns := range g.Unglued {
+		if ns.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// inZone 返回没有胶水的区内 NS 数
+func (g DelegationGlue) inZone() int {
+	n := 0
+	for _, ns := range g.Unglued {
+		if ns.InZone {
+			n++
+		}
+	}
+	return n
+}
+
+// String 返回一行结论，例如 "delegation for example.com. is glueless via 3 external nameservers;
+// cold-cache resolution needs at least 5 additional queries"
+func (g DelegationGlue) String() string {
+	inZone := g.inZone()
+	external := len(g.Unglued) - inZone
+	var s string
+	switch g.Verdict {
+	case GlueFull:
+		return fmt.Sprintf("delegation for %s is fully glued", g.Zone)
+	case GluePartial:
+		s = fmt.Sprintf("delegation for %s is partially glued: %d in-zone nameserver%s without glue", g.Zone, inZone, plural(inZone))
+	default:
+		s = fmt.Sprintf("delegation for %s is glueless via %d external nameserver%s", g.Zone, external, plural(external))
+		if g.ColdCacheQueries > 0 {
+			s += fmt.Sprintf("; cold-cache resolution needs at least %d additional queries", g.ColdCacheQueries)
+		}
+		if inZone > 0 {
+			s += fmt.Sprintf("; %d in-zone nameserver%s without glue cannot be resolved", inZone, plural(inZone))
+		}
+	}
+	return s
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// classifyGlue 按父域转介附加区里的胶水给追踪经过的委派分类。胶水取自转介本身（QueryResult.Glue），
+// 不受 -iptype、-net 对服务器地址的筛选影响；父域之内、被委派的区之外的兄弟胶水同样算作胶水。
+// 起始区（根或 From）的服务器不来自转介，-servers 指定的服务器、磁盘缓存的转介和没有胶水也没有查询地址的服务器
+// （-max-ns 之外、被取消）都无从判断，不计入
+func classifyGlue(results []Result, start string) []DelegationGlue {
+	referralGlue := make(map[string]map[string]bool)
+	for _, res := range results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				if qr.Referral == "" {
+					continue
+				}
+				child := normalizeName(qr.Referral)
+				if referralGlue[child] == nil {
+					referralGlue[child] = make(map[string]bool)
+				}
+				for _, g := range qr.Glue {
+					referralGlue[child][normalizeName(g.Name)] = true
+				}
+			}
+		}
+	}
+	var out []DelegationGlue
+	seen := make(map[string]bool)
+	for _, res := range results {
+		if res.Zone == "" || res.FromCache {
+			continue
+		}
+		// -qmin 时同一个区可能出现在好几级，只看第一次
+		zone := normalizeName(res.Zone)
+		if seen[zone] || zone == normalizeName(start) {
+			continue
+		}
+		seen[zone] = true
+		g := DelegationGlue{Zone: zone}
+		var inZoneUnglued bool
+		for _, auth := range res.Authorities {
+			host := normalizeName(auth.Hostname)
+			switch {
+			case referralGlue[zone][host], auth.AddrSource == "glue":
+				g.NS++
+				g.Glued++
+				continue
+			case auth.AddrSource == "recursor", auth.AddrSource == "iterative":
+			default:
+				continue
+			}
+			g.NS++
+			ns := UngluedNS{
+				Hostname: host,
+				InZone:   dns.IsSubDomain(zone, host),
+				Source:   auth.AddrSource,
+				Cached:   auth.AddrCached,
+				Queries:  auth.AddrQueries,
+			}
+			if len(auth.IPs) == 0 {
+				ns.Error = auth.Error
+			}
+			inZoneUnglued = inZoneUnglued || ns.InZone
+			g.Unglued = append(g.Unglued, ns)
+		}
+		if g.NS == 0 {
+			continue
+		}
+		switch {
+		case g.Glued == 0:
+			g.Verdict = GlueNone
+			g.ColdCacheQueries = coldCacheQueries(g.Unglued)
+		case inZoneUnglued:
+			g.Verdict = GluePartial
+		default:
+			g.Verdict = GlueFull
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// coldCacheQueries 估算只有根提示的递归服务器解析这些区外 NS 的地址至少要发的查询数。
+// NS 所在的区可能本身也是 glueless 的，实际只会更多
+func coldCacheQueries(unglued []UngluedNS) int {
+	tlds, domains := make(map[string]bool), make(map[string]bool)
+	n := 0
+	for _, ns := range unglued {
+		if ns.InZone {
+			continue
+		}
+		labels := dns.SplitDomainName(ns.Hostname)
+		if len(labels) == 0 {
+			continue
+		}
+		tlds[labels[len(labels)-1]] = true
+		if reg := registrableDomain(ns.Hostname); reg != "" {
+			domains[reg] = true
+		}
+		n++
+	}
+	return len(tlds) + len(domains) + n
+}
@@ -0,0 +1,135 @@
+package trace
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestClassifyGlue(t *testing.T) {
+	// referral 是父域 parent 的一台服务器给出的 child 的转介，glue 是附加区里的胶水名字；
+	// 这台服务器没有地址来源，父域这一级本身不计入
+	referral := func(parent, child string, glue ...string) Result {
+		qr := QueryResult{Referral: child}
+		for _, name := range glue {
+			qr.Glue = append(qr.Glue, GlueRecord{Name: name, Address: "2001:db8::53"})
+		}
+		return Result{Zone: parent, Authorities: []AuthorityServer{{Hostname: "ns." + parent, QueryResults: []QueryResult{qr}}}}
+	}
+	// level 是 zone 这一级，servers 是 "主机名=地址来源"
+	level := func(zone string, servers ...string) Result {
+		res := Result{Zone: zone}
+		for _, s := range servers {
+			host, source, _ := strings.Cut(s, "=")
+			res.Authorities = append(res.Authorities, AuthorityServer{Hostname: host, AddrSource: source, AddrQueries: 1})
+		}
+		return res
+	}
+	type verdict struct {
+		zone    string
+		verdict string
+		ns      int
+		glued   int
+		unglued []string
+	}
+	tests := []struct {
+		name    string
+		results []Result
+		want    []verdict
+	}{
+		{
+			// -iptype 4 筛掉了只有 AAAA 的胶水，地址改从递归服务器查询，但委派本身是有胶水的
+			name: "glue filtered by address family",
+			results: []Result{
+				referral("test.", "example.test.", "ns1.example.test.", "ns2.example.test."),
+				level("example.test.", "ns1.example.test.=recursor", "ns2.example.test.=recursor"),
+			},
+			want: []verdict{{"example.test.", GlueFull, 2, 2, nil}},
+		},
+		{
+			// ns.other.test. 在父域 test. 之内、example.test. 之外，父域给出的胶水同样算数
+			name: "sibling glue",
+			results: []Result{
+				referral("test.", "example.test.", "ns.other.test."),
+				level("example.test.", "ns.other.test.=recursor", "ns.hosting.example=recursor"),
+			},
+			want: []verdict{{"example.test.", GlueFull, 2, 1, []string{"ns.hosting.example."}}},
+		},
+		{
+			name: "partial",
+			results: []Result{
+				referral("test.", "example.test.", "ns1.example.test."),
+				level("example.test.", "ns1.example.test.=glue", "ns2.example.test.=recursor"),
+			},
+			want: []verdict{{"example.test.", GluePartial, 2, 1, []string{"ns2.example.test."}}},
+		},
+		{
+			name: "glueless",
+			results: []Result{
+				referral("test.", "example.test."),
+				level("example.test.", "ns1.dns.example=recursor", "ns2.dns.example=iterative", "ns.example.test.=recursor"),
+			},
+			want: []verdict{{"example.test.", GlueNone, 3, 0, []string{"ns1.dns.example.", "ns2.dns.example.", "ns.example.test."}}},
+		},
+		{
+			// 起始区、磁盘缓存的转介、-servers 指定的服务器和没有查询地址的服务器都不计入
+			name: "not judged",
+			results: []Result{
+				level(".", "a.root.test.=glue"),
+				{Zone: "test.", FromCache: true, Authorities: []AuthorityServer{{Hostname: "ns.nic.test.", AddrSource: "recursor"}}},
+				level("example.test.", "ns1.example.test.=listed"),
+				level("other.test.", "ns1.other.test."),
+			},
+		},
+		{
+			// -qmin 时同一个区出现在好几级，只看第一次
+			name: "qmin",
+			results: []Result{
+				referral("test.", "example.test.", "ns1.example.test."),
+				level("example.test.", "ns1.example.test.=glue"),
+				level("example.test.", "ns1.example.test.=recursor", "ns2.example.test.=recursor"),
+			},
+			want: []verdict{{"example.test.", GlueFull, 1, 1, nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []verdict
+			for _, g := range classifyGlue(tt.results, ".") {
+				v := verdict{g.Zone, g.Verdict, g.NS, g.Glued, nil}
+				for _, ns := range g.Unglued {
+					v.unglued = append(v.unglued, ns.Hostname)
+				}
+				got = append(got, v)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b verdict) bool {
+				return a.zone == b.zone && a.verdict == b.verdict && a.ns == b.ns && a.glued == b.glued && slices.Equal(a.unglued, b.unglued)
+			}) {
+				t.Errorf("classifyGlue = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColdCacheQueries(t *testing.T) {
+	tests := []struct {
+		name    string
+		unglued []UngluedNS
+		want    int
+	}{
+		{"none", nil, 0},
+		// 一次 com 的根转介、一次 dns.com 的 TLD 转介、两次地址查询
+		{"same domain", []UngluedNS{{Hostname: "ns1.dns.com."}, {Hostname: "ns2.dns.com."}}, 4},
+		{"two tlds", []UngluedNS{{Hostname: "ns.dns.com."}, {Hostname: "ns.dns.net."}}, 6},
+		{"same tld", []UngluedNS{{Hostname: "ns.a.com."}, {Hostname: "ns.b.com."}}, 5},
+		// 可注册域按公共后缀列表取，co.uk 下面的 example.co.uk 是一个域
+		{"public suffix", []UngluedNS{{Hostname: "ns1.dns.example.co.uk."}, {Hostname: "ns2.example.co.uk."}}, 4},
+		// 区内的 NS 没有胶水就解析不了，不计入
+		{"in zone", []UngluedNS{{Hostname: "ns.example.test.", InZone: true}, {Hostname: "ns.dns.com."}}, 3},
+	}
+	for _, tt := range tests {
+		if got := coldCacheQueries(tt.unglued); got != tt.want {
+			t.Errorf("%s: coldCacheQueries = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
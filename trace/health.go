@@ -0,0 +1,250 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 委派整体状况
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthBroken   = "broken"
+)
+
+// 发现的问题的严重程度：critical 表示名字解析不了或结果不可信，warning 表示还能解析但有隐患
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// 每个问题扣除的分数，扣到 0 为止
+var healthPenalty = map[string]int{
+	SeverityCritical: 50,
+	SeverityWarning:  10,
+	SeverityInfo:     0,
+}
+
+// Health 是设置了 Options.Health 时对整个追踪的总体判断：Score 从 100 开始按问题的严重程度扣分，便于看趋势
+type Health struct {
+	Status   string    `json:"status"`
+	Score    int       `json:"score"`
+	Findings []Finding `json:"findings"`
+}
+
+// Finding 是一个问题，Check 是它来自哪项检查（trace、lame、ns_consistency 等），Zone 是涉及的区
+type Finding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Zone     string `json:"zone,omitempty"`
+	Message  string `json:"message"`
+}
+
+// assessHealth 只根据报告里各项检查的结构化结果给出问题，没有运行的检查不计入
+func assessHealth(report Report, status Status) *Health {
+	h := &Health{Findings: []Finding{}}
+	add := func(severity, check, zone, format string, args ...any) {
+		h.Findings = append(h.Findings, Finding{Severity: severity, Check: check, Zone: zone, Message: fmt.Sprintf(format, args...)})
+	}
+	switch status {
+	case StatusNXDomain:
+		add(SeverityInfo, "trace", "", "%s does not exist (NXDOMAIN)", report.Domain)
+	case StatusNoData:
+		add(SeverityInfo, "trace", "", "%s exists but has no records of the queried type", report.Domain)
+	case StatusAnswer:
+	default:
+		msg := status.String()
+		if n := len(report.Results); n > 0 && report.Results[n-1].Error != "" {
+			msg = report.Results[n-1].Error
+		}
+		add(SeverityCritical, "trace", "", "the trace did not reach an answer: %s", msg)
+	}
+	for _, res := range report.Results {
+		zone := res.Zone
+		if res.Error == "" {
+			// 整级失败已经作为追踪失败报告，这里只看部分服务器出问题的级别
+			var lame, failed []string
+			queried := 0
+			for _, auth := range res.Authorities {
+				if auth.Code == ErrLimited {
+					continue
+				}
+				queried++
+				switch kind, detail := serverFailure(auth); kind {
+				case "":
+				case "lame":
+					lame = append(lame, auth.Hostname)
+				default:
+					failed = append(failed, fmt.Sprintf("%s (%s)", auth.Hostname, detail))
+				}
+			}
+			if len(lame) > 0 {
+				add(SeverityWarning, "lame", zone, "%d of %d servers are lame: %s", len(lame), queried, strings.Join(lame, ", "))
+			}
+			if len(failed) > 0 {
+				add(SeverityWarning, "servers", zone, "%d of %d servers failed: %s", len(failed), queried, strings.Join(failed, "; "))
+			}
+		}
+		if c := res.NSCheck; c.Mismatch() {
+			var parts []string
+			if len(c.ParentOnly) > 0 {
+				parts = append(parts, "only at the parent: "+strings.Join(c.ParentOnly, ", "))
+			}
+			if len(c.ChildOnly) > 0 {
+				parts = append(parts, "only at the child: "+strings.Join(c.ChildOnly, ", "))
+			}
+			add(SeverityWarning, "ns_consistency", c.Zone, "parent and child NS sets differ (%s)", strings.Join(parts, "; "))
+		}
+		if c := res.GlueCheck; c.Mismatch() {
+			var names []string
+			for _, srv := range c.Servers {
+				if len(GlueMismatchesFor(srv)) > 0 {
+					names = append(names, srv.Name)
+				}
+			}
+			add(SeverityWarning, "glue", c.Zone, "glue at the parent does not match the child's address records for %s", strings.Join(names, ", "))
+		}
+		if a := res.ApexCNAME; a != nil {
+			add(SeverityWarning, "apex_cname", a.Zone, "%s", a.String())
+		}
+		if v := res.Validation; v != nil && v.Status == ValidationBogus {
+			add(SeverityCritical, "dnssec", v.Zone, "DNSSEC validation failed: %s", v.Reason)
+		}
+		if d := res.Delegation; d != nil && d.Verdict() == DelegationBroken {
+			add(SeverityCritical, "dnssec", res.Child, "no DNSKEY matches the DS records at the parent")
+		}
+	}
+	if exp := report.RRSIGExpiry; exp != nil {
+		for _, w := range exp.Warnings {
+			severity, state := SeverityWarning, "expires soon"
+			if w.Expired {
+				severity, state = SeverityCritical, "has expired"
+			}
+			add(severity, "rrsig", w.SignerName, "signature over %s %s %s (%s)", w.Owner, w.TypeCovered, state, w.Expiration.UTC().Format("2006-01-02 15:04 UTC"))
+		}
+	}
+	if c := report.Serial; c.Mismatch() {
+		var lagging []string
+		for _, s := range c.Servers {
+			if s.Lagging {
+				lagging = append(lagging, fmt.Sprintf("%s (%d)", s.Hostname, s.Serial))
+			}
+		}
+		add(SeverityWarning, "serial", c.Zone, "SOA serials differ, %d to %d; behind the primary: %s", c.MinSerial, c.MaxSerial, strings.Join(lagging, ", "))
+	}
+	if c := report.IPv6; c != nil && c.Error == "" {
+		if !c.Resolvable {
+			add(SeverityWarning, "ipv6", c.Zone, "no nameserver answers over IPv6")
+		} else {
+			var broken []string
+			for _, s := range c.Servers {
+				if s.Verdict == V6Unreachable {
+					broken = append(broken, s.Hostname)
+				}
+			}
+			if len(broken) > 0 {
+				add(SeverityWarning, "ipv6", c.Zone, "IPv6 addresses do not answer: %s", strings.Join(broken, ", "))
+			}
+		}
+	}
+	for _, r := range report.Hijack.Tampered() {
+		add(SeverityCritical, "hijack", "", "resolver %s %s", r.Resolver, report.Hijack.Describe(r))
+	}
+	if c := report.Probe; c != nil {
+		for _, p := range c.Servers {
+			if p.Received < p.Sent {
+				add(SeverityWarning, "loss", c.Zone, "%.0f%% packet loss to %s (%s): %d of %d queries unanswered", p.LossPct, p.Hostname, p.IP, p.Sent-p.Received, p.Sent)
+			}
+		}
+	}
+	for _, d := range report.Dangling {
+		add(SeverityCritical, "dangling_ns", d.Zone, "dangling NS: %s", d)
+	}
+	for _, g := range report.DelegationGlue {
+		// 区外 NS 的 glueless 委派本身是常见的做法，只有区内 NS 缺胶水或者 NS 地址查不到时才算问题
+		if g.Verdict != GlueFull && (g.inZone() > 0 || g.Failed()) {
+			add(SeverityWarning, "glue", g.Zone, "%s", g)
+		}
+	}
+	if c := report.Diversity; c != nil {
+		for _, w := range c.Warnings {
+			add(SeverityWarning, "diversity", c.Zone, "%s", w)
+		}
+	}
+	if c := report.RFC2182; c != nil {
+		for _, cr := range c.Failed() {
+			severity := SeverityWarning
+			if cr.Name == RFC2182NoCNAME {
+				// NS 指向别名是 RFC 2181 明确禁止的，不少解析器会因此解析失败
+				severity = SeverityCritical
+			}
+			add(severity, "rfc2182", c.Zone, "%s: %s", cr.Title, cr.Evidence)
+		}
+	}
+	if c := report.Recursion; c.Open() {
+		var open []string
+		for _, s := range c.Servers {
+			if s.Status == RecursionOpen {
+				open = append(open, fmt.Sprintf("%s (%s)", s.Hostname, s.IP))
+			}
+		}
+		add(SeverityWarning, "recursion", "", "authoritative servers resolve recursively for anyone: %s", strings.Join(open, ", "))
+	}
+	if c := report.AXFR; c.Open() {
+		var open []string
+		for _, s := range c.Servers {
+			if s.Status == AXFRAllowed {
+				open = append(open, fmt.Sprintf("%s (%s)", s.Hostname, s.IP))
+			}
+		}
+		add(SeverityWarning, "axfr", c.Zone, "zone transfers are allowed to anyone: %s", strings.Join(open, ", "))
+	}
+	if c := report.EDNS; c.Failed() {
+		var failed []string
+		for _, s := range c.Servers {
+			for _, p := range s.Probes {
+				if !p.Pass {
+					failed = append(failed, fmt.Sprintf("%s (%s)", s.Hostname, s.IP))
+					break
+				}
+			}
+		}
+		add(SeverityWarning, "edns", c.Zone, "servers fail EDNS compliance tests: %s", strings.Join(failed, ", "))
+	}
+	if udpOnly := report.TCP.UDPOnly(); len(udpOnly) > 0 {
+		var servers []string
+		for _, q := range udpOnly {
+			servers = append(servers, fmt.Sprintf("%s (%s)", q.Hostname, q.IP))
+		}
+		add(SeverityWarning, "tcp", "", "servers answer over UDP but not over TCP: %s", strings.Join(servers, ", "))
+	}
+	if report.TCP.Mismatch() {
+		add(SeverityWarning, "tcp", "", "TCP and UDP answers differ")
+	}
+	if report.Verify.Disagrees() {
+		add(SeverityWarning, "verify", "", "repeated queries returned different answers")
+	}
+	if c := report.Slow; c != nil && len(c.Queries) > 0 {
+		add(SeverityWarning, "rtt", "", "%d queries took longer than %gms or timed out", len(c.Queries), c.ThresholdMs)
+	}
+	if report.TTL.Problems() {
+		add(SeverityInfo, "ttl", "", "some TTLs differ between servers or are outside the expected range")
+	}
+	if report.Wildcard.Matches() {
+		add(SeverityInfo, "wildcard", "", "the answer may come from a wildcard record")
+	}
+	h.Score = 100
+	h.Status = HealthHealthy
+	for _, f := range h.Findings {
+		h.Score -= healthPenalty[f.Severity]
+		switch {
+		case f.Severity == SeverityCritical:
+			h.Status = HealthBroken
+		case f.Severity == SeverityWarning && h.Status == HealthHealthy:
+			h.Status = HealthDegraded
+		}
+	}
+	h.Score = max(h.Score, 0)
+	return h
+}
@@ -0,0 +1,31 @@
+package trace
+
+import "testing"
+
+// -check-rfc2182 不满足的项计入 -health：NS 指向 CNAME 是 critical，其他项是 warning
+func TestHealthRFC2182Severity(t *testing.T) {
+	tests := []struct {
+		criterion string
+		want      string
+	}{
+		{RFC2182Count, SeverityWarning},
+		{RFC2182Hosts, SeverityWarning},
+		{RFC2182OffZone, SeverityWarning},
+		{RFC2182NoCNAME, SeverityCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.criterion, func(t *testing.T) {
+			report := Report{Domain: "www.example.test.", RFC2182: &RFC2182Check{
+				Zone:     "example.test.",
+				Criteria: []RFC2182Criterion{{Name: tt.criterion, Title: tt.criterion, Evidence: "evidence"}},
+			}}
+			h := assessHealth(report, StatusAnswer)
+			if len(h.Findings) != 1 || h.Findings[0].Check != "rfc2182" {
+				t.Fatalf("findings = %+v, want one rfc2182 finding", h.Findings)
+			}
+			if got := h.Findings[0].Severity; got != tt.want {
+				t.Errorf("severity = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// HijackResult.Verdict 的取值
+const (
+	HijackMatch = "match"
+	// HijackDifferent 是递归服务器给出了权威服务器没有的记录，包括对不存在的名字给出地址（NXDOMAIN 重定向）
+	HijackDifferent = "different"
+	// HijackNXDomain 是名字在权威服务器上有记录，递归服务器却说它不存在
+	HijackNXDomain = "nxdomain"
+	// HijackFiltered 是递归服务器拒绝查询、返回空应答，或者只给出 0.0.0.0、127.0.0.1 之类的黑洞地址
+	HijackFiltered = "filtered"
+	// HijackError 是递归服务器没有应答或返回 SERVFAIL 等错误，无法判断
+	HijackError = "error"
+)
+
+// HijackCheck 把追踪得到的权威应答和每个 -dns 递归服务器对同一名字、同一类型的应答逐项比较。
+// 只比较记录本身，顺序和 TTL 不同不算不一致
+type HijackCheck struct {
+	Name string `json:"name"`
+	// Authoritative 按类型记录权威应答，和 ResolverComparison 相同
+	Authoritative map[string]*ResolverAnswer `json:"authoritative,omitempty"`
+	Results       []HijackResult             `json:"results"`
+	Error         string                     `json:"error,omitempty"`
+}
+
+// HijackResult 是一个递归服务器对一种类型的应答；Extra 是权威应答里没有的记录，Missing 是递归服务器没有给出的权威记录
+type HijackResult struct {
+	ResolverAnswer
+	Verdict string   `json:"verdict"`
+	Extra   []string `json:"extra,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Tampered 返回和权威应答不一致的结果（different、nxdomain 和 filtered），查询出错的不算在内
+func (c *HijackCheck) Tampered() []HijackResult {
+	if c == nil {
+		return nil
+	}
+	var out []HijackResult
+	for _, r := range c.Results {
+		switch r.Verdict {
+		case HijackDifferent, HijackNXDomain, HijackFiltered:
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// checkHijack 向每个 -dns 服务器（包括 FallbackResolvers）查询追踪的名字，查询并发进行；
+// 追踪没有得到权威应答时不查询
+func (tr *Tracer) checkHijack(ctx context.Context, name, types string, report Report, status Status) *HijackCheck {
+	check := &HijackCheck{Name: dns.Fqdn(name), Authoritative: authoritativeAnswers(report, status)}
+	if check.Authoritative == nil {
+		check.Error = "the trace did not reach an authoritative answer, nothing to compare"
+		return check
+	}
+	var qtypes []uint16
+	for _, qtype := range parseQueryTypes(types) {
+		if check.Authoritative[dns.TypeToString[qtype]] != nil {
+			qtypes = append(qtypes, qtype)
+		}
+	}
+	check.Results = make([]HijackResult, len(tr.bootstraps)*len(qtypes))
+	var wg sync.WaitGroup
+	for i, r := range tr.bootstraps {
+		for j, qtype := range qtypes {
+			wg.Add(1)
+			go func(slot int) {
+				defer wg.Done()
+				ans := tr.queryResolver(ctx, r, check.Name, qtype)
+				check.Results[slot] = classifyHijack(ans, check.Authoritative[ans.Qtype])
+			}(i*len(qtypes) + j)
+		}
+	}
+	wg.Wait()
+	return check
+}
+
+// classifyHijack 判断递归服务器的应答和权威应答的关系，两者的 Answers 都已排序去重
+func classifyHijack(ans ResolverAnswer, auth *ResolverAnswer) HijackResult {
+	res := HijackResult{ResolverAnswer: ans}
+	switch {
+	case ans.Error != "":
+		res.Verdict = HijackError
+		return res
+	case ans.Rcode == dns.RcodeToString[dns.RcodeRefused]:
+		res.Verdict = HijackFiltered
+		return res
+	case ans.Rcode != dns.RcodeToString[dns.RcodeSuccess] && ans.Rcode != dns.RcodeToString[dns.RcodeNameError]:
+		res.Verdict = HijackError
+		return res
+	}
+	res.Extra, res.Missing = diffSets(auth.Answers, ans.Answers)
+	switch {
+	case ans.Rcode == auth.Rcode && len(res.Extra) == 0 && len(res.Missing) == 0:
+		res.Verdict = HijackMatch
+	case ans.Rcode == dns.RcodeToString[dns.RcodeNameError]:
+		res.Verdict = HijackNXDomain
+	case len(ans.Answers) == 0, sinkholed(ans.Answers):
+		res.Verdict = HijackFiltered
+	default:
+		res.Verdict = HijackDifferent
+	}
+	return res
+}
+
+// sinkholed 判断应答是否只有过滤型递归服务器常用的黑洞地址
+func sinkholed(answers []string) bool {
+	return !slices.ContainsFunc(answers, func(a string) bool {
+		ip := net.ParseIP(a)
+		return ip == nil || !(ip.IsUnspecified() || ip.IsLoopback())
+	})
+}
+
+// Describe 用一句话说明 r 和权威应答的差别，两边的记录都列出来
+func (c *HijackCheck) Describe(r HijackResult) string {
+	auth := "no records"
+	switch a := c.Authoritative[r.Qtype]; {
+	case a == nil:
+	case len(a.Answers) > 0:
+		auth = strings.Join(a.Answers, ", ")
+	case a.Rcode != dns.RcodeToString[dns.RcodeSuccess]:
+		auth = a.Rcode
+	}
+	what := c.Name + " " + r.Qtype
+	switch r.Verdict {
+	case HijackMatch:
+		return "agrees with the authoritative answer for " + what
+	case HijackError:
+		if r.Error != "" {
+			return "could not be checked for " + what + ": " + r.Error
+		}
+		return "returned " + r.Rcode + " for " + what + ", cannot compare"
+	case HijackNXDomain:
+		return fmt.Sprintf("says %s does not exist (NXDOMAIN), authoritative: %s", what, auth)
+	case HijackFiltered:
+		switch {
+		case r.Rcode != dns.RcodeToString[dns.RcodeSuccess]:
+			return fmt.Sprintf("refuses %s (%s), authoritative: %s", what, r.Rcode, auth)
+		case len(r.Answers) == 0:
+			return fmt.Sprintf("returns no records for %s, authoritative: %s", what, auth)
+		}
+		return fmt.Sprintf("returns sinkhole %s for %s, authoritative: %s", strings.Join(r.Answers, ", "), what, auth)
+	}
+	return fmt.Sprintf("returns %s for %s, authoritative: %s", strings.Join(r.Answers, ", "), what, auth)
+}
@@ -0,0 +1,71 @@
+package trace
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ParseRootHints 解析 named.root 格式的根提示：根的 NS 记录给出服务器名字，A/AAAA 记录给出它们的地址
+func ParseRootHints(data string) ([]string, map[string][]string, error) {
+	var servers []string
+	addrs := make(map[string][]string)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hints line %d: %v", i+1, err)
+		}
+		if rr == nil {
+			continue
+		}
+		switch rec := rr.(type) {
+		case *dns.NS:
+			if rec.Hdr.Name != "." {
+				return nil, nil, fmt.Errorf("hints line %d: NS record for %s, expected the root (.)", i+1, rec.Hdr.Name)
+			}
+			servers = append(servers, normalizeName(rec.Ns))
+		case *dns.A:
+			name := normalizeName(rec.Hdr.Name)
+			addrs[name] = append(addrs[name], rec.A.String())
+		case *dns.AAAA:
+			name := normalizeName(rec.Hdr.Name)
+			addrs[name] = append(addrs[name], rec.AAAA.String())
+		default:
+			return nil, nil, fmt.Errorf("hints line %d: unexpected %s record", i+1, dns.Type(rr.Header().Rrtype))
+		}
+	}
+	if len(servers) == 0 {
+		return nil, nil, fmt.Errorf("no root NS records found")
+	}
+	servers = uniqueStrings(servers)
+	sort.Strings(servers)
+	// 只留下根 NS 的地址，其他名字的地址记录用不上
+	hinted := make(map[string][]string)
+	for _, name := range servers {
+		if a := addrs[name]; len(a) > 0 {
+			hinted[name] = a
+		}
+	}
+	return servers, hinted, nil
+}
+
+// loadRootHints 读取 -hints 文件，用其中的名字和地址替换内置的根服务器列表
+func (tr *Tracer) loadRootHints(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	servers, addrs, err := ParseRootHints(string(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	tr.rootHints, tr.rootHintAddrs = servers, addrs
+	return nil
+}
@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+)
+
+const acePrefix = "xn--"
+
+// idnaSeparators 是 UTS #46 里等同于 "." 的全角和表意句点；按标签转换前先换成 "."
+var idnaSeparators = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+// ToASCII 把国际化域名逐个标签用 idna.Lookup（UTS #46 映射和校验）转换成 A-label（xn--…），
+// 纯 ASCII 的标签除了校验 A-label 外原样保留，这样 _443._tcp 这类服务标签不受 IDNA 规则限制
+func ToASCII(domain string) (string, error) {
+	domain = idnaSeparators.Replace(domain)
+	fqdn := strings.HasSuffix(domain, ".")
+	name := strings.TrimSuffix(domain, ".")
+	if name == "" {
+		return domain, nil
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "" {
+			return "", fmt.Errorf("invalid domain %q: empty label", domain)
+		}
+		if isASCII(label) {
+			if hasACEPrefix(label) {
+				if _, err := idna.Lookup.ToUnicode(label); err != nil {
+					return "", fmt.Errorf("invalid A-label %q: %v", label, err)
+				}
+			}
+			continue
+		}
+		alabel, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid IDN label %q: %v", label, err)
+		}
+		labels[i] = alabel
+	}
+	ascii := strings.Join(labels, ".")
+	for _, label := range labels {
+		if len(label) > 63 {
+			return "", fmt.Errorf("invalid domain %q: label %s is longer than 63 octets", domain, label)
+		}
+	}
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("invalid domain %q: longer than 253 octets", domain)
+	}
+	if fqdn {
+		ascii += "."
+	}
+	return ascii, nil
+}
+
+// ToUnicode 把名字里的 A-label 还原成 U-label 用于显示，无法解码的标签保持原样
+func ToUnicode(domain string) string {
+	labels := dns.SplitDomainName(domain)
+	changed := false
+	for i, label := range labels {
+		if !hasACEPrefix(label) {
+			continue
+		}
+		if u, err := idna.Lookup.ToUnicode(label); err == nil {
+			labels[i] = u
+			changed = true
+		}
+	}
+	if !changed {
+		return domain
+	}
+	u := strings.Join(labels, ".")
+	if strings.HasSuffix(domain, ".") {
+		u += "."
+	}
+	return u
+}
+
+func hasACEPrefix(label string) bool {
+	return len(label) >= len(acePrefix) && strings.EqualFold(label[:len(acePrefix)], acePrefix)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		in, want, err string
+	}{
+		{in: "例え.テスト", want: "xn--r8jz45g.xn--zckzah"},
+		{in: "Bücher.example.", want: "xn--bcher-kva.example."},
+		// UTS #46 映射：全角字母、句点和大写都先映射再编码
+		{in: "ＢＵＣＨＥＲ。example", want: "bucher.example"},
+		{in: "faß.de", want: "xn--fa-hia.de"},
+		{in: "_443._tcp.bücher.example", want: "_443._tcp.xn--bcher-kva.example"},
+		{in: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{in: "example.com", want: "example.com"},
+		{in: "xn--bcher-kv1.example", err: "invalid A-label"},
+		{in: "-bücher.example", err: "invalid IDN label"},
+		{in: "a..b", err: "empty label"},
+		{in: strings.Repeat("ü", 60) + ".example", err: "longer than 63 octets"},
+	}
+	for _, tt := range tests {
+		got, err := ToASCII(tt.in)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("ToASCII(%q) error = %v, want %q", tt.in, err, tt.err)
+		case tt.err == "" && (err != nil || got != tt.want):
+			t.Errorf("ToASCII(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"xn--r8jz45g.xn--zckzah.", "例え.テスト."},
+		{"_443._tcp.xn--bcher-kva.example", "_443._tcp.bücher.example"},
+		{"xn--bcher-kv1.example", "xn--bcher-kv1.example"},
+		{"example.com.", "example.com."},
+	}
+	for _, tt := range tests {
+		if got := ToUnicode(tt.in); got != tt.want {
+			t.Errorf("ToUnicode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"context"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// 每台权威服务器的 IPv6 结论
+const (
+	V6Reachable   = "reachable"
+	V6Unreachable = "unreachable"
+	V6Only4       = "v4-only"
+	V6Unknown     = "unknown"
+)
+
+// V6Check 记录区的每台权威服务器是否有 AAAA 记录，以及通过 IPv6 地址查询是否成功
+type V6Check struct {
+	Zone    string     `json:"zone"`
+	Servers []V6Server `json:"servers"`
+	// Resolvable 表示至少有一台服务器能通过 IPv6 给出权威应答，只考虑区自己这一级
+	Resolvable bool   `json:"resolvable"`
+	Error      string `json:"error,omitempty"`
+}
+
+type V6Server struct {
+	Hostname  string      `json:"hostname"`
+	Verdict   string      `json:"verdict"`
+	Addresses []V6Address `json:"addresses,omitempty"`
+	// DNS64 是 -dns 服务器合成的 AAAA，服务器实际上没有 IPv6 地址，结论是 v4-only
+	DNS64 []string `json:"dns64_synthesized,omitempty"`
+	// Error 是查询 AAAA 记录失败的原因，这时 Verdict 为 unknown
+	Error string `json:"error,omitempty"`
+}
+
+type V6Address struct {
+	IP        string  `json:"ip"`
+	Reachable bool    `json:"reachable"`
+	RTTMs     float64 `json:"rtt_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// checkV6 不受 -iptype 和 -net 限制：每台服务器都单独查询 AAAA，并通过每个 IPv6 地址查询区的 SOA
+func (tr *Tracer) checkV6(ctx context.Context, domain string, results []Result) *V6Check {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &V6Check{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	check := &V6Check{Zone: level.Zone}
+	for _, auth := range level.Authorities {
+		check.Servers = append(check.Servers, V6Server{Hostname: normalizeName(auth.Hostname)})
+	}
+	if len(check.Servers) == 0 {
+		check.Error = "no authoritative servers for " + level.Zone
+		return check
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tr.probeV6(ctx, check.Zone, &check.Servers[i])
+		}()
+	}
+	wg.Wait()
+	for _, s := range check.Servers {
+		check.Resolvable = check.Resolvable || s.Verdict == V6Reachable
+	}
+	return check
+}
+
+func (tr *Tracer) probeV6(ctx context.Context, zone string, s *V6Server) {
+	answer, _, err := tr.lookupAddresses(ctx, s.Hostname, dns.TypeAAAA)
+	switch {
+	case err != nil:
+		s.Verdict, s.Error = V6Unknown, err.Error()
+		return
+	case len(answer.ips) == 0:
+		s.Verdict = V6Only4
+		for _, ip := range answer.dns64 {
+			s.DNS64 = append(s.DNS64, ip.String())
+		}
+		return
+	}
+	s.Verdict = V6Unreachable
+	for _, ip := range answer.ips {
+		addr := V6Address{IP: ip.String()}
+		r, qr, err := tr.queryAuthorities(ctx, zone, addr.IP, dns.TypeSOA)
+		addr.RTTMs = qr.RTTMs
+		switch {
+		case err != nil:
+			addr.Error = err.Error()
+		case r.Rcode != dns.RcodeSuccess:
+			addr.Error = dns.RcodeToString[r.Rcode]
+		case !r.Authoritative:
+			addr.Error = "answer without AA"
+		default:
+			addr.Reachable = true
+			s.Verdict = V6Reachable
+		}
+		s.Addresses = append(s.Addresses, addr)
+	}
+}
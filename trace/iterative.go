@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// iterativeCacheTTL 是迭代解析得到的 NS 地址在缓存里保留的秒数，getAuthorities 的结果不带 TTL
+const iterativeCacheTTL = 300
+
+// maxGluelessDepth 限制“解析 NS 地址又需要解析另一个无胶水 NS”的嵌套层数
+const maxGluelessDepth = 4
+
+// defaultRootHints 是内置的根服务器列表，HintsFile 可以换成文件里的服务器
+var defaultRootHints = []string{
+	"a.root-servers.net.",
+	"b.root-servers.net.", "c.root-servers.net.",
+	"d.root-servers.net.", "e.root-servers.net.", "f.root-servers.net.",
+	"g.root-servers.net.", "h.root-servers.net.", "i.root-servers.net.",
+	"j.root-servers.net.", "k.root-servers.net.", "l.root-servers.net.",
+	"m.root-servers.net.",
+}
+
+// defaultRootHintAddrs 是根服务器的内置地址（HintsFile 时换成文件里的地址），NoRecursor 时不经过递归服务器就能开始追踪
+var defaultRootHintAddrs = map[string][]string{
+	"a.root-servers.net.": {"198.41.0.4", "2001:503:ba3e::2:30"},
+	"b.root-servers.net.": {"170.247.170.2", "2801:1b8:10::b"},
+	"c.root-servers.net.": {"192.33.4.12", "2001:500:2::c"},
+	"d.root-servers.net.": {"199.7.91.13", "2001:500:2d::d"},
+	"e.root-servers.net.": {"192.203.230.10", "2001:500:a8::e"},
+	"f.root-servers.net.": {"192.5.5.241", "2001:500:2f::f"},
+	"g.root-servers.net.": {"192.112.36.4", "2001:500:12::d0d"},
+	"h.root-servers.net.": {"198.97.190.53", "2001:500:1::53"},
+	"i.root-servers.net.": {"192.36.148.17", "2001:7fe::53"},
+	"j.root-servers.net.": {"192.58.128.30", "2001:503:c27::2:30"},
+	"k.root-servers.net.": {"193.0.14.129", "2001:7fd::1"},
+	"l.root-servers.net.": {"199.7.83.42", "2001:500:9f::42"},
+	"m.root-servers.net.": {"202.12.27.33", "2001:dc3::35"},
+}
+
+func (tr *Tracer) rootGlue() glueAddrs {
+	glue := make(glueAddrs)
+	for name, addrs := range tr.rootHintAddrs {
+		for _, a := range addrs {
+			glue[name] = append(glue[name], net.ParseIP(a))
+		}
+	}
+	return glue
+}
+
+type zoneServers struct {
+	servers []string
+	glue    glueAddrs
+}
+
+// zoneCutCache 记录追踪过程中发现的每个区的 NS 和胶水，嵌套解析可以从最近的已知区开始，不必每次都从根走
+type zoneCutCache struct {
+	mu   sync.Mutex
+	cuts map[string]zoneServers
+}
+
+func (z *zoneCutCache) add(zone string, servers []string, glue glueAddrs) {
+	if zone == "" || len(servers) == 0 {
+		return
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.cuts[normalizeName(zone)] = zoneServers{servers, glue}
+}
+
+// closest 返回 name 最近的已知祖先区的服务器，一个都没有时 ok 为 false
+func (z *zoneCutCache) closest(name string) (zone string, servers []string, glue glueAddrs, ok bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	labels := dns.SplitDomainName(name)
+	for i := range labels {
+		zone := normalizeName(strings.Join(labels[i:], "."))
+		if cut, ok := z.cuts[zone]; ok {
+			return zone, cut.servers, cut.glue, true
+		}
+	}
+	return "", nil, nil, false
+}
+
+type resolvingKey struct{}
+
+// resolveIterative 不经过递归服务器，从最近的已知区开始逐级查询 host 的 qtype 地址
+func (tr *Tracer) resolveIterative(ctx context.Context, host string, qtype uint16) ([]net.IP, error) {
+	host = normalizeName(host)
+	resolving, _ := ctx.Value(resolvingKey{}).([]string)
+	for _, name := range resolving {
+		if name == host {
+			return nil, fmt.Errorf("circular glueless dependency resolving %s", host)
+		}
+	}
+	if len(resolving) >= maxGluelessDepth {
+		return nil, fmt.Errorf("glueless nameserver chain deeper than %d resolving %s", maxGluelessDepth, host)
+	}
+	ctx = context.WithValue(ctx, resolvingKey{}, append(resolving[:len(resolving):len(resolving)], host))
+
+	zone, servers, glue, ok := tr.zoneCuts.closest(host)
+	if !ok {
+		zone, servers, glue = ".", tr.rootHints, tr.rootGlue()
+	}
+	for depth := 0; depth < tr.maxDepth; depth++ {
+		auths, next, nextGlue, err := tr.getAuthorities(ctx, host, zone, servers, glue, qtype)
+		if err != nil {
+			return nil, err
+		}
+		var ips []net.IP
+		for _, auth := range auths {
+			for _, qr := range auth.QueryResults {
+				for _, ans := range qr.Answers {
+					if ip := net.ParseIP(ans); ip != nil && !containsIP(ips, ip) {
+						ips = append(ips, ip)
+					}
+				}
+			}
+		}
+		if len(ips) > 0 {
+			return ips, nil
+		}
+		level := Result{Zone: zone, Authorities: auths}
+		classifyLevel(&level)
+		if _, failure := levelFailures(level); failure != "" {
+			return nil, fmt.Errorf("resolving %s: %s", host, failure)
+		}
+		if len(next) == 0 {
+			return nil, nil
+		}
+		zone = delegatedZone(Result{Authorities: auths})
+		tr.zoneCuts.add(zone, next, nextGlue)
+		servers, glue = next, nextGlue
+	}
+	return nil, fmt.Errorf("maximum delegation depth %d reached resolving %s", tr.maxDepth, host)
+}
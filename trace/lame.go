@@ -0,0 +1,75 @@
+package trace
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// 每个服务器 IP 应答的分类
+const (
+	ClassAnswer      = "authoritative"
+	ClassReferral    = "referral"
+	ClassLame        = "lame"
+	ClassUnreachable = "unreachable"
+	ClassSkipped     = "skipped"
+)
+
+// classifyResponse 判断服务器对本级区 zone 的应答是权威应答、向下委派、lame、不可达还是没有查询（跳过），lame 时返回原因
+func classifyResponse(qr QueryResult, zone string) (string, string) {
+	switch {
+	case qr.Code == ErrSkipped:
+		return ClassSkipped, ""
+	case qr.Error != "":
+		return ClassUnreachable, ""
+	case qr.Rcode == dns.RcodeRefused, qr.Rcode == dns.RcodeServerFailure:
+		return ClassLame, RcodeText(qr.Rcode, qr.EDE)
+	case qr.Referral != "":
+		switch {
+		case strings.EqualFold(qr.Referral, zone):
+			return ClassLame, "referral back to " + qr.Referral + " itself"
+		case zone == "" || dns.IsSubDomain(zone, qr.Referral):
+			// zone 为空（Options.Servers）时不知道服务器负责哪个区，任何转介都算向下委派
+			return ClassReferral, ""
+		}
+		return ClassLame, "upward referral to " + qr.Referral
+	case !qr.Flags.AA && ignoredReferral(qr) != "":
+		return ClassLame, "out-of-bailiwick referral to " + ignoredReferral(qr)
+	case qr.Flags.AA:
+		return ClassAnswer, ""
+	}
+	return ClassLame, "non-authoritative answer"
+}
+
+// classifyLevel 给本级每个查询结果打上分类，并记录 lame 和完全不可达的服务器
+func classifyLevel(result *Result) {
+	result.Lame, result.Unreachable = nil, nil
+	for i := range result.Authorities {
+		auth := &result.Authorities[i]
+		lame, reachable, attempted := false, false, false
+		for j := range auth.QueryResults {
+			qr := &auth.QueryResults[j]
+			qr.Class, qr.LameReason = classifyResponse(*qr, result.Zone)
+			if qr.Class == ClassLame && qr.Code == "" {
+				qr.Code = ErrLame
+			}
+			attempted = attempted || qr.Class != ClassSkipped
+			switch qr.Class {
+			case ClassLame:
+				lame = true
+				reachable = true
+			case ClassAnswer, ClassReferral:
+				reachable = true
+			}
+		}
+		if lame {
+			result.Lame = append(result.Lame, auth.Hostname)
+		}
+		if attempted && !reachable {
+			result.Unreachable = append(result.Unreachable, auth.Hostname)
+		}
+	}
+	sort.Strings(result.Lame)
+	sort.Strings(result.Unreachable)
+}
@@ -0,0 +1,41 @@
+package trace
+
+import "math/rand/v2"
+
+// limitedMessage 是因为 MaxNS 没有查询的服务器上的说明
+const limitedMessage = "not queried (limit)"
+
+// limitServers 按 MaxNS 把一级的服务器分成要查询的和不查询的；random 时随机选取，但保持它们原来的顺序。
+// 其余类型和 -fast 都只用选中的服务器，同一级每次查询的是同一组
+func (tr *Tracer) limitServers(servers []string) (queried, limited []string) {
+	if tr.maxNS == 0 || len(servers) <= tr.maxNS {
+		return servers, nil
+	}
+	picked := make([]bool, len(servers))
+	if tr.nsSample == "random" {
+		for _, i := range rand.Perm(len(servers))[:tr.maxNS] {
+			picked[i] = true
+		}
+	} else {
+		for i := range tr.maxNS {
+			picked[i] = true
+		}
+	}
+	for i, srv := range servers {
+		if picked[i] {
+			queried = append(queried, srv)
+		} else {
+			limited = append(limited, srv)
+		}
+	}
+	return queried, limited
+}
+
+// limitedAuthorities 给没有查询的服务器各建一个条目，只写明原因；它们不提供转介，也不算作失败
+func limitedAuthorities(zone string, limited []string) []AuthorityServer {
+	auths := make([]AuthorityServer, len(limited))
+	for i, srv := range limited {
+		auths[i] = AuthorityServer{Hostname: srv, Bailiwick: zone, Error: limitedMessage, Code: ErrLimited}
+	}
+	return auths
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// NSConsistency 比较父域委派里的 NS 和子域自己在顶点发布的 NS
+type NSConsistency struct {
+	Zone       string   `json:"zone"`
+	Both       []string `json:"both,omitempty"`
+	ParentOnly []string `json:"parent_only,omitempty"`
+	ChildOnly  []string `json:"child_only,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+func (c *NSConsistency) Mismatch() bool {
+	return c != nil && (len(c.ParentOnly) > 0 || len(c.ChildOnly) > 0)
+}
+
+// checkNSConsistency 向子域服务器查询 zone 的 NS，与父域给出的 parentNS 对比（忽略大小写和末尾的点）
+func (tr *Tracer) checkNSConsistency(ctx context.Context, zone string, parentNS []string, childGlue glueAddrs) *NSConsistency {
+	check := &NSConsistency{Zone: zone}
+	// 子域服务器在追踪到下一级之前就被问到，queryServer 还没记下它们的角色
+	rrs, err := tr.queryRRset(withDestination(ctx, zoneDestination(zone)), zone, parentNS, childGlue, dns.TypeNS)
+	if err != nil {
+		check.Error = "child NS query failed: " + err.Error()
+		return check
+	}
+	parent := make(map[string]bool)
+	for _, name := range parentNS {
+		parent[normalizeName(name)] = true
+	}
+	child := make(map[string]bool)
+	for _, rr := range rrs {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, zone) {
+			child[normalizeName(ns.Ns)] = true
+		}
+	}
+	if len(child) == 0 {
+		check.Error = "child servers returned no NS records for " + zone
+		return check
+	}
+	for name := range parent {
+		if child[name] {
+			check.Both = append(check.Both, name)
+		} else {
+			check.ParentOnly = append(check.ParentOnly, name)
+		}
+	}
+	for name := range child {
+		if !parent[name] {
+			check.ChildOnly = append(check.ChildOnly, name)
+		}
+	}
+	sort.Strings(check.Both)
+	sort.Strings(check.ParentOnly)
+	sort.Strings(check.ChildOnly)
+	return check
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
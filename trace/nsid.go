@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"encoding/hex"
+
+	"github.com/miekg/dns"
+)
+
+// addNSID 请求服务器在应答中带回 NSID（RFC 5001），用于区分应答的任播节点
+func addNSID(m *dns.Msg) {
+	if opt := m.IsEdns0(); opt != nil {
+		opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	}
+}
+
+// responseNSID 取出应答里的 NSID，可打印的 ASCII 原样显示，否则显示十六进制
+func responseNSID(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		n, ok := o.(*dns.EDNS0_NSID)
+		if !ok || n.Nsid == "" {
+			continue
+		}
+		raw, err := hex.DecodeString(n.Nsid)
+		if err != nil {
+			return n.Nsid
+		}
+		for _, b := range raw {
+			if b < 0x20 || b > 0x7e {
+				return n.Nsid
+			}
+		}
+		return string(raw)
+	}
+	return ""
+}
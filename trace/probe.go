@@ -0,0 +1,128 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ProbeCheck 是设置了 Options.Count 时对最终一级每个服务器 IP 的丢包和 RTT 统计，相当于一个只发 DNS 查询的 mtr
+type ProbeCheck struct {
+	Zone       string        `json:"zone,omitempty"`
+	Count      int           `json:"count"`
+	IntervalMs float64       `json:"interval_ms"`
+	Qtype      string        `json:"qtype"`
+	Protocol   string        `json:"protocol"`
+	Servers    []ProbeResult `json:"servers"`
+}
+
+// ProbeResult 是一个服务器 IP 的统计，RTT 只统计收到的应答；一个应答也没有收到时 RTT 各项为 0
+type ProbeResult struct {
+	Hostname  string  `json:"hostname"`
+	IP        string  `json:"ip"`
+	Sent      int     `json:"sent"`
+	Received  int     `json:"received"`
+	LossPct   float64 `json:"loss_pct"`
+	MinMs     float64 `json:"min_ms,omitempty"`
+	AvgMs     float64 `json:"avg_ms,omitempty"`
+	MaxMs     float64 `json:"max_ms,omitempty"`
+	StddevMs  float64 `json:"stddev_ms,omitempty"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// probeServers 向最终一级的每个服务器 IP 发送 tr.count 个相同的查询，相邻两次之间至少间隔 tr.countInterval。
+// 每个查询只发一次，不重试，也不因截断改用 TCP，这样各服务器的数字可以直接比较；Options.TCP 时全部用 TCP。
+// 查询经过和追踪相同的限速（Options.QPS），各服务器并发探测
+func (tr *Tracer) probeServers(ctx context.Context, domain string, results []Result) *ProbeCheck {
+	network := "udp"
+	if tr.forceTCP {
+		network = "tcp"
+	}
+	check := &ProbeCheck{Count: tr.count, IntervalMs: millis(tr.countInterval), Protocol: tr.protocolLabel(network)}
+	level, ok := zoneLevel(domain, results)
+	if !ok {
+		return check
+	}
+	check.Zone = level.Zone
+	for _, auth := range level.Authorities {
+		for _, qrs := range GroupByIP(auth.QueryResults) {
+			if check.Qtype == "" {
+				check.Qtype = qrs[0].Qtype
+			}
+			check.Servers = append(check.Servers, ProbeResult{Hostname: normalizeName(auth.Hostname), IP: qrs[0].ServerIP})
+		}
+	}
+	qtype := dns.StringToType[check.Qtype]
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tr.probeServer(ctx, level.Domain, qtype, network, &check.Servers[i])
+		}()
+	}
+	wg.Wait()
+	return check
+}
+
+func (tr *Tracer) probeServer(ctx context.Context, domain string, qtype uint16, network string, p *ProbeResult) {
+	var rtts []float64
+	for n := range tr.count {
+		if n > 0 {
+			t := time.NewTimer(tr.countInterval)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		m, _ := tr.newAuthorityQuery(domain, p.IP, qtype)
+		qctx, cancel := context.WithTimeout(ctx, tr.queryTimeout)
+		_, rtt, err := tr.exchangeOnce(qctx, network, m, tr.authAddr(p.IP))
+		cancel()
+		if ctx.Err() != nil {
+			// 被取消的查询不算丢包
+			break
+		}
+		p.Sent++
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !errors.As(err, new(*proxyError)) {
+				err = &timeoutError{tr.queryTimeout}
+			}
+			p.LastError = err.Error()
+			continue
+		}
+		p.Received++
+		rtts = append(rtts, millis(rtt))
+	}
+	if p.Sent > 0 {
+		p.LossPct = float64(p.Sent-p.Received) / float64(p.Sent) * 100
+	}
+	if len(rtts) == 0 {
+		return
+	}
+	p.MinMs, p.MaxMs = rtts[0], rtts[0]
+	var sum float64
+	for _, v := range rtts {
+		p.MinMs, p.MaxMs = min(p.MinMs, v), max(p.MaxMs, v)
+		sum += v
+	}
+	p.AvgMs = sum / float64(len(rtts))
+	var sq float64
+	for _, v := range rtts {
+		sq += (v - p.AvgMs) * (v - p.AvgMs)
+	}
+	p.StddevMs = math.Sqrt(sq / float64(len(rtts)))
+}
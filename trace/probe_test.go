@@ -0,0 +1,81 @@
+package trace
+
+import (
+	"context"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// lossyNet 在 probing 之后接管 example.test. 两个服务器的应答：每个 IP 按 rtts 的顺序给出 RTT，
+// 0 表示这个查询的应答丢失
+type lossyNet struct {
+	*fakeNet
+	mu      sync.Mutex
+	probing bool
+	rtts    map[string][]time.Duration
+	sent    map[string]int
+}
+
+func (n *lossyNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	n.mu.Lock()
+	rtts, ok := n.rtts[host]
+	if !n.probing || !ok {
+		n.mu.Unlock()
+		return n.fakeNet.Exchange(ctx, m, network, addr)
+	}
+	i := n.sent[host]
+	n.sent[host]++
+	n.mu.Unlock()
+	if i >= len(rtts) || rtts[i] == 0 {
+		return nil, 0, &net.OpError{Op: "read", Net: network, Err: os.ErrDeadlineExceeded}
+	}
+	r, _, err := n.fakeNet.Exchange(ctx, m, network, addr)
+	return r, rtts[i], err
+}
+
+// -count 按收到的应答统计丢包率和 RTT 的最小、平均、最大值和标准差，丢失的应答不计入 RTT
+func TestProbeLossAndJitter(t *testing.T) {
+	ms := time.Millisecond
+	n := &lossyNet{fakeNet: newFakeNet(t, 0), sent: make(map[string]int), rtts: map[string][]time.Duration{
+		"127.0.53.3": {10 * ms, 0, 20 * ms, 30 * ms},
+		"127.0.53.4": {0, 0, 0, 0},
+	}}
+	tr := newFakeTracer(t, n.fakeNet, func(o *Options) {
+		o.Exchanger = n
+		o.Count = 4
+		o.CountInterval = ms
+	})
+	results, status := tr.traceDNS(context.Background(), "www.example.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	n.mu.Lock()
+	n.probing = true
+	n.mu.Unlock()
+	check := tr.probeServers(context.Background(), "www.example.test", results)
+	if check.Zone != "example.test." || check.Qtype != "A" || check.Protocol != "udp" {
+		t.Errorf("probe = zone %s qtype %s protocol %s, want example.test. A udp", check.Zone, check.Qtype, check.Protocol)
+	}
+	got := make(map[string]ProbeResult)
+	for _, p := range check.Servers {
+		got[p.IP] = p
+	}
+	if len(got) != 2 {
+		t.Fatalf("probed servers = %+v, want 127.0.53.3 and 127.0.53.4", check.Servers)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if p := got["127.0.53.3"]; p.Sent != 4 || p.Received != 3 || !near(p.LossPct, 25) ||
+		!near(p.MinMs, 10) || !near(p.AvgMs, 20) || !near(p.MaxMs, 30) || !near(p.StddevMs, math.Sqrt(200.0/3)) {
+		t.Errorf("127.0.53.3 = %+v, want 4 sent, 3 received, 25%% loss, rtt 10/20/30 ms, stddev 8.16 ms", p)
+	}
+	if p := got["127.0.53.4"]; p.Sent != 4 || p.Received != 0 || !near(p.LossPct, 100) || p.AvgMs != 0 || p.LastError != "timeout after 300ms" {
+		t.Errorf("127.0.53.4 = %+v, want 4 sent, none received, 100%% loss, no rtt and a timeout error", p)
+	}
+}
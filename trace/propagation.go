@@ -0,0 +1,143 @@
+package trace
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// 传播报告里 TTL 的来源
+const (
+	PropagationParentNS = "parent_ns"
+	PropagationChildNS  = "child_ns"
+	PropagationGlue     = "glue"
+)
+
+// Propagation 是设置了 Options.Propagation 时名字所在区的委派 TTL：父域转介里的 NS、子域自己的 NS 和父域的胶水。
+// 更换 NS 之后，递归服务器最多还会按 WorstSec 秒使用旧的数据，这就是切换完全生效的最坏时间
+type Propagation struct {
+	Zone     string           `json:"zone"`
+	Parent   string           `json:"parent,omitempty"`
+	TTLs     []PropagationTTL `json:"ttls,omitempty"`
+	WorstSec uint32           `json:"worst_case_sec"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// PropagationTTL 是一个 RRset 的一个 TTL 取值，Servers 是给出这个取值的服务器
+type PropagationTTL struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     uint32   `json:"ttl"`
+	Servers []string `json:"servers"`
+}
+
+// Worst 是决定 WorstSec 的那一项
+func (p *Propagation) Worst() (PropagationTTL, bool) {
+	if p == nil || len(p.TTLs) == 0 {
+		return PropagationTTL{}, false
+	}
+	return slices.MaxFunc(p.TTLs, func(a, b PropagationTTL) int { return cmp.Compare(a.TTL, b.TTL) }), true
+}
+
+func (p *Propagation) add(kind, name, rrtype string, ttl uint32, server string) {
+	for i, t := range p.TTLs {
+		if t.Kind == kind && t.Name == name && t.Type == rrtype && t.TTL == ttl {
+			if !slices.Contains(t.Servers, server) {
+				p.TTLs[i].Servers = append(p.TTLs[i].Servers, server)
+			}
+			return
+		}
+	}
+	p.TTLs = append(p.TTLs, PropagationTTL{Kind: kind, Name: name, Type: rrtype, TTL: ttl, Servers: []string{server}})
+	p.WorstSec = max(p.WorstSec, ttl)
+}
+
+// checkPropagation 从追踪结果里取出父域转介的 NS 和胶水 TTL，再向子域的每台服务器查询区顶点的 NS
+func (tr *Tracer) checkPropagation(ctx context.Context, domain string, results []Result) *Propagation {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &Propagation{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	p := &Propagation{Zone: level.Zone}
+	for _, res := range results {
+		if !strings.EqualFold(res.Child, level.Zone) {
+			continue
+		}
+		p.Parent = res.Zone
+		for _, auth := range res.Authorities {
+			host := auth.Hostname
+			for _, qr := range auth.QueryResults {
+				if !strings.EqualFold(qr.Referral, level.Zone) {
+					continue
+				}
+				for _, t := range qr.TTLs {
+					if t.Section == "authority" && t.Type == "NS" && strings.EqualFold(t.Name, level.Zone) {
+						p.add(PropagationParentNS, t.Name, t.Type, t.TTL, host)
+					}
+				}
+				for _, g := range qr.Glue {
+					rrtype := "A"
+					if !strings.Contains(g.Address, ".") {
+						rrtype = "AAAA"
+					}
+					p.add(PropagationGlue, normalizeName(g.Name), rrtype, g.TTL, host)
+				}
+			}
+		}
+	}
+	if p.Parent == "" {
+		p.Error = "the trace did not include the delegation of " + level.Zone + " from its parent"
+	}
+
+	// 每台子域服务器问一次，各自给出的 NS TTL 分别记录
+	type childNS struct {
+		host string
+		ttl  uint32
+	}
+	var answers []childNS
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for _, auth := range level.Authorities {
+		ips := tr.filterFamily(auth.IPs)
+		if len(ips) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for _, ip := range ips {
+				r, _, err := tr.queryAuthorities(ctx, level.Zone, ip.String(), dns.TypeNS)
+				if err != nil || r.Rcode != dns.RcodeSuccess || !r.Authoritative {
+					continue
+				}
+				for _, t := range rrsetTTLs("answer", r.Answer) {
+					if t.Type == "NS" && strings.EqualFold(t.Name, level.Zone) {
+						mu.Lock()
+						answers = append(answers, childNS{auth.Hostname, t.TTL})
+						mu.Unlock()
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if !tr.noSort {
+		slices.SortFunc(answers, func(a, b childNS) int { return strings.Compare(a.host, b.host) })
+	}
+	for _, a := range answers {
+		p.add(PropagationChildNS, level.Zone, "NS", a.ttl, a.host)
+	}
+	if len(answers) == 0 && p.Error == "" {
+		p.Error = "no child server gave an authoritative NS answer for " + level.Zone
+	}
+	return p
+}
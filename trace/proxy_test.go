@@ -0,0 +1,186 @@
+package trace
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// socks5Proxy 是一个只支持无认证 CONNECT 的 SOCKS5 代理（RFC 1928），refuse 为真的目标回答 connection refused。
+// 返回代理地址和连接过的目标
+func socks5Proxy(t *testing.T, refuse func(target string) bool) (string, func() []string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.1: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var mu sync.Mutex
+	var targets []string
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				target, err := socks5Handshake(c)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				targets = append(targets, target)
+				mu.Unlock()
+				var up net.Conn
+				if !refuse(target) {
+					up, err = net.Dial("tcp", target)
+				}
+				if up == nil || err != nil {
+					// 0x05：connection refused
+					c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer up.Close()
+				c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(up, c)
+				io.Copy(c, up)
+			}()
+		}
+	}()
+	return "socks5://" + l.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), targets...)
+	}
+}
+
+// socks5Handshake 读完问候和 CONNECT 请求，返回目标地址
+func socks5Handshake(c net.Conn) (string, error) {
+	buf := make([]byte, 262)
+	if _, err := io.ReadFull(c, buf[:2]); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(c, buf[:buf[1]]); err != nil {
+		return "", err
+	}
+	if _, err := c.Write([]byte{5, 0}); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(c, buf[:4]); err != nil {
+		return "", err
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		if _, err := io.ReadFull(c, buf[:4]); err != nil {
+			return "", err
+		}
+		host = net.IP(buf[:4]).String()
+	case 4:
+		if _, err := io.ReadFull(c, buf[:16]); err != nil {
+			return "", err
+		}
+		host = net.IP(buf[:16]).String()
+	default:
+		if _, err := io.ReadFull(c, buf[:1]); err != nil {
+			return "", err
+		}
+		n := int(buf[0])
+		if _, err := io.ReadFull(c, buf[:n]); err != nil {
+			return "", err
+		}
+		host = string(buf[:n])
+	}
+	if _, err := io.ReadFull(c, buf[:2]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2])))), nil
+}
+
+// 设置了代理时所有查询都经过它用 TCP 发出，追踪和 -count 都把协议记为 tcp via proxy；
+// 代理连不上的服务器记为 proxy 错误，不影响其他服务器
+func TestProxy(t *testing.T) {
+	n := newFakeNet(t, freePort(t))
+	refused := "127.0.53.4"
+	proxyURL, targets := socks5Proxy(t, func(target string) bool { return strings.HasPrefix(target, refused+":") })
+	tr := newFakeTracer(t, n, func(o *Options) {
+		o.Proxy = proxyURL
+		o.Count = 2
+		o.CountInterval = 1
+	})
+	report, status := tr.Run(context.Background(), "www.example.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	var sawRefused bool
+	for _, res := range report.Results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				if qr.Protocol != "tcp via proxy" {
+					t.Errorf("%s %s: protocol %q, want tcp via proxy", qr.ServerIP, qr.Qtype, qr.Protocol)
+				}
+				if qr.ServerIP != refused {
+					continue
+				}
+				sawRefused = true
+				if qr.Code != ErrProxy || !strings.Contains(qr.Error, "proxy socks5://") {
+					t.Errorf("%s through a refusing proxy: code %q error %q, want %q", qr.ServerIP, qr.Code, qr.Error, ErrProxy)
+				}
+			}
+		}
+	}
+	if !sawRefused {
+		t.Errorf("%s was not queried: %v", refused, zonePath(report.Results))
+	}
+	if p := report.Probe; p == nil || p.Protocol != "tcp via proxy" {
+		t.Errorf("-count = %+v, want protocol tcp via proxy", p)
+	}
+	if len(targets()) == 0 {
+		t.Error("no connection went through the proxy")
+	}
+	if tr.Usage().Exchanges["udp"] != 0 {
+		t.Errorf("usage %v: queries sent over UDP bypassed the proxy", tr.Usage().Exchanges)
+	}
+}
+
+// 经过代理的 DNS-over-TLS 握手失败时，错误注明经过了代理，但不算作代理的问题
+func TestProxyTLSHandshake(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on 127.0.0.1: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// 不是 TLS 服务器：收到 ClientHello 就断开
+			c.Read(make([]byte, 512))
+			c.Close()
+		}
+	}()
+	proxyURL, _ := socks5Proxy(t, func(string) bool { return false })
+	tr := newFakeTracer(t, newFakeNet(t, 0), func(o *Options) { o.Proxy = proxyURL })
+	c := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{ServerName: "dot.test"}}
+	_, err = tr.dialConn(context.Background(), c, l.Addr().String())
+	if err == nil {
+		t.Fatal("handshake with a plain TCP server succeeded")
+	}
+	if !strings.Contains(err.Error(), "tls handshake with "+l.Addr().String()+" via proxy") {
+		t.Errorf("error = %q, want it to name the server and the proxy", err)
+	}
+	if code := queryErrorCode(err); code == ErrProxy {
+		t.Errorf("code = %q, the proxy itself worked", code)
+	}
+}
@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ptrTimeout 是单个服务器 IP 的 PTR 查询最多等待的时间，查不到时只显示 IP
+const ptrTimeout = 2 * time.Second
+
+// ptrCache 保存 Options.PTRNames 时每个服务器 IP 的反向解析，同一个 IP 在这个 Tracer 里只查一次
+type ptrCache struct {
+	mu      sync.Mutex
+	entries map[string]*ptrLookup
+}
+
+// ptrLookup 是一个 IP 的 PTR 查询，done 关闭之后 name 才可以读取；没有 PTR 或查询失败时 name 为空
+type ptrLookup struct {
+	done chan struct{}
+	name string
+}
+
+func newPTRCache() *ptrCache {
+	return &ptrCache{entries: make(map[string]*ptrLookup)}
+}
+
+// startReverseLookups 在后台为 res 里联系过的每个服务器 IP 查询 PTR，不等待结果；已经开始的查询不重复发出
+func (tr *Tracer) startReverseLookups(ctx context.Context, res Result) {
+	for _, auth := range res.Authorities {
+		for _, qr := range auth.QueryResults {
+			tr.reverseLookup(ctx, qr.ServerIP)
+		}
+	}
+}
+
+// reverseLookup 返回 ip 的 PTR 查询，第一次见到 ip 时在后台发出查询
+func (tr *Tracer) reverseLookup(ctx context.Context, ip string) *ptrLookup {
+	c := tr.ptrNames
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.entries[ip]; ok {
+		return l
+	}
+	l := &ptrLookup{done: make(chan struct{})}
+	c.entries[ip] = l
+	go func() {
+		defer close(l.done)
+		arpa, err := dns.ReverseAddr(ip)
+		if err != nil {
+			return
+		}
+		// 结果要留给之后的追踪使用，不随这一次追踪取消，ptrTimeout 限制了它的时间
+		qctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ptrTimeout)
+		defer cancel()
+		resp, _, err := tr.queryBootstrap(qctx, tr.newQuery(arpa, dns.TypePTR, dns.ClassINET))
+		if err != nil {
+			tr.logger.Debug("PTR lookup failed", "ip", ip, "error", err)
+			return
+		}
+		for _, rr := range resp.Answer {
+			if ptr, ok := rr.(*dns.PTR); ok && strings.EqualFold(ptr.Hdr.Name, arpa) {
+				l.name = normalizeName(ptr.Ptr)
+				return
+			}
+		}
+	}()
+	return l
+}
+
+// ReverseNames 等待 res 里各服务器 IP 的 PTR 查询，把查到的名字填进 AuthorityServer.PTRNames；没有设置 Options.PTRNames 时什么也不做。
+// 查询在联系服务器时就已经开始，这里先补上还没开始的再逐个等待，全部查询同时进行，总共最多等 ptrTimeout
+func (tr *Tracer) ReverseNames(ctx context.Context, res *Result) {
+	if tr.ptrNames == nil {
+		return
+	}
+	tr.startReverseLookups(ctx, *res)
+	for i := range res.Authorities {
+		auth := &res.Authorities[i]
+		for _, qr := range auth.QueryResults {
+			l := tr.reverseLookup(ctx, qr.ServerIP)
+			select {
+			case <-l.done:
+			case <-ctx.Done():
+				return
+			}
+			if l.name == "" {
+				continue
+			}
+			if auth.PTRNames == nil {
+				auth.PTRNames = make(map[string]string)
+			}
+			auth.PTRNames[qr.ServerIP] = l.name
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ptrDelay 是 slowPTRNet 让每个 PTR 查询多等的时间，serverDelay 是 example.test. 的服务器晚应答的时间
+const (
+	ptrDelay    = 100 * time.Millisecond
+	serverDelay = 150 * time.Millisecond
+)
+
+// slowPTRNet 让递归服务器的每个 PTR 应答晚 ptrDelay 才到，example.test. 的两个服务器晚 serverDelay 才应答
+type slowPTRNet struct {
+	*fakeNet
+}
+
+func (n slowPTRNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	delay := time.Duration(0)
+	if host, _, _ := net.SplitHostPort(addr); host == "127.0.53.3" || host == "127.0.53.4" {
+		delay = serverDelay
+	}
+	if len(m.Question) == 1 && m.Question[0].Qtype == dns.TypePTR {
+		delay = ptrDelay
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	}
+	return n.fakeNet.Exchange(ctx, m, network, addr)
+}
+
+// PTR 查询在联系服务器时就开始，和各级的查询同时进行：example.test. 的服务器应答得慢，
+// 它们的反向解析在等应答时已经完成，追踪结束时不必再等，名字都填进 PTRNames
+func TestReverseNamesConcurrent(t *testing.T) {
+	n := newFakeNet(t, 0)
+	run := func(ptr bool) (Report, time.Duration) {
+		tr := newFakeTracer(t, n, func(o *Options) {
+			o.Exchanger = slowPTRNet{n}
+			o.PTRNames = ptr
+		})
+		start := time.Now()
+		report, status := tr.Run(context.Background(), "www.example.test", "a", nil)
+		if status != StatusAnswer {
+			t.Fatalf("status = %v", status)
+		}
+		return report, time.Since(start)
+	}
+	_, baseline := run(false)
+	report, elapsed := run(true)
+	want := map[string]string{
+		"127.0.53.1": "a.root.test.",
+		"127.0.53.2": "ns.nic.test.",
+		"127.0.53.3": "host-3.hosting.test.",
+		"127.0.53.4": "host-4.hosting.test.",
+	}
+	got := make(map[string]string)
+	for _, res := range report.Results {
+		for _, auth := range res.Authorities {
+			for ip, name := range auth.PTRNames {
+				got[ip] = name
+			}
+		}
+	}
+	for ip, name := range want {
+		if got[ip] != name {
+			t.Errorf("PTR name of %s = %q, want %q", ip, got[ip], name)
+		}
+	}
+	if elapsed > baseline+ptrDelay/2 {
+		t.Errorf("trace took %s with -ptr-names and %s without, want the %s PTR lookups hidden behind the queries", elapsed, baseline, ptrDelay)
+	}
+}
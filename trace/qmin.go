@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// minimizedName 返回 domain 在 zone 之下再多 labels 个标签的祖先名字，已经够长时就是 domain 本身
+func minimizedName(domain, zone string, labels int) string {
+	all := dns.SplitDomainName(domain)
+	n := dns.CountLabel(zone) + labels
+	if n >= len(all) {
+		return domain
+	}
+	return dns.Fqdn(strings.Join(all[len(all)-n:], "."))
+}
+
+// qminExtend 判断最小化查询没有得到转介时是否该加一个标签再问：有服务器给出 NOERROR
+// （空非终端的 NODATA，或者同一批服务器也负责子区时直接给出的 NS 应答）就说明还没到区切分；
+// 出现 NXDOMAIN 时名字不存在，它下面的名字也不存在，不再继续
+func qminExtend(authorities []AuthorityServer) bool {
+	extend := false
+	for _, auth := range authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Error != "" {
+				continue
+			}
+			switch qr.Rcode {
+			case dns.RcodeNameError:
+				return false
+			case dns.RcodeSuccess:
+				extend = true
+			}
+		}
+	}
+	return extend
+}
@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMinimizedName(t *testing.T) {
+	tests := []struct {
+		domain, zone string
+		labels       int
+		want         string
+	}{
+		{"www.example.test.", ".", 1, "test."},
+		{"www.example.test.", "test.", 1, "example.test."},
+		{"www.example.test.", "test.", 2, "www.example.test."},
+		{"www.example.test.", "example.test.", 1, "www.example.test."},
+		{"www.example.test.", "example.test.", 5, "www.example.test."},
+		{"a.b.c.example.test.", "example.test.", 1, "c.example.test."},
+		{"a.b.c.example.test.", "example.test.", 2, "b.c.example.test."},
+	}
+	for _, tt := range tests {
+		if got := minimizedName(tt.domain, tt.zone, tt.labels); got != tt.want {
+			t.Errorf("minimizedName(%q, %q, %d) = %q, want %q", tt.domain, tt.zone, tt.labels, got, tt.want)
+		}
+	}
+}
+
+// c.example.test. 是空非终端：服务器对它的 NS 查询返回 NOERROR/NODATA，最小化应当加一个标签继续，
+// 而不是当作追踪失败
+func TestQMinEmptyNonTerminal(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, func(o *Options) { o.QMin = true })
+	results, status := tr.traceDNS(context.Background(), "b.c.example.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	if got := zonePath(results); !slices.Equal(got, []string{".", "test.", "example.test."}) {
+		t.Fatalf("zones = %v", got)
+	}
+	var qnames []string
+	for _, res := range results {
+		qnames = append(qnames, res.QName)
+	}
+	if want := []string{"test.", "example.test.", "b.c.example.test."}; !slices.Equal(qnames, want) {
+		t.Errorf("minimized names = %v, want %v", qnames, want)
+	}
+	final := results[len(results)-1]
+	const note = "qname minimization: c.example.test. is not a zone cut, adding a label"
+	if !slices.Contains(final.Notes, note) {
+		t.Errorf("notes = %q, want %q", final.Notes, note)
+	}
+	if final.Error != "" {
+		t.Errorf("level failed: %s", final.Error)
+	}
+	if got := finalAnswers(results); !slices.Equal(got, []string{"192.0.2.11"}) {
+		t.Errorf("answers = %v, want [192.0.2.11]", got)
+	}
+}
+
+// 最小化的名字不存在时它下面的名字也不存在（RFC 8020），不再加标签
+func TestQMinNXDomain(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, func(o *Options) { o.QMin = true })
+	results, status := tr.traceDNS(context.Background(), "x.missing.example.test", "a", nil)
+	if status != StatusNXDomain {
+		t.Fatalf("status = %v, want %v", status, StatusNXDomain)
+	}
+	final := results[len(results)-1]
+	if final.QName != "missing.example.test." {
+		t.Errorf("stopped at %q, want missing.example.test.", final.QName)
+	}
+	if !slices.ContainsFunc(final.Notes, func(s string) bool { return strings.HasPrefix(s, "x.missing.example.test. does not exist either") }) {
+		t.Errorf("notes = %q, want the RFC 8020 note", final.Notes)
+	}
+}
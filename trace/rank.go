@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"sort"
+	"time"
+)
+
+// rankOutlierFactor 是判定慢服务器的倍数：平均 RTT 超过本级中位数的这么多倍就标为离群
+const rankOutlierFactor = 3
+
+// LatencyRank 按每一级各服务器 IP 的平均 RTT 从快到慢排列，并估算每级都选最快服务器时的总耗时
+type LatencyRank struct {
+	Levels []LevelRank `json:"levels"`
+	// BestPathMs 是每一级最快服务器的平均 RTT 之和；Complete 为 false 时有的级别没有服务器应答，不计在内
+	BestPathMs float64 `json:"best_path_ms"`
+	Complete   bool    `json:"complete"`
+}
+
+type LevelRank struct {
+	Level    int     `json:"level"`
+	Zone     string  `json:"zone"`
+	MedianMs float64 `json:"median_ms,omitempty"`
+	// Servers 里有应答的在前按平均 RTT 排列，没有任何成功应答的排在最后
+	Servers []RankedServer `json:"servers"`
+}
+
+type RankedServer struct {
+	Hostname  string  `json:"hostname"`
+	IP        string  `json:"ip"`
+	Queries   int     `json:"queries"`
+	Successes int     `json:"successes"`
+	AvgRTTMs  float64 `json:"avg_rtt_ms,omitempty"`
+	MinRTTMs  float64 `json:"min_rtt_ms,omitempty"`
+	Outlier   bool    `json:"outlier,omitempty"`
+}
+
+// Fastest 返回本级最快的服务器，没有服务器应答时为 nil
+func (l LevelRank) Fastest() *RankedServer {
+	if len(l.Servers) == 0 || l.Servers[0].Successes == 0 {
+		return nil
+	}
+	return &l.Servers[0]
+}
+
+// rankLatency 和 summarize 一样只用没有出错、应答码不是失败的查询计算 RTT，但按级别分开汇总
+func rankLatency(results []Result) *LatencyRank {
+	rank := &LatencyRank{Complete: len(results) > 0}
+	for _, res := range results {
+		level := LevelRank{Level: res.Level, Zone: res.Zone}
+		type agg struct {
+			min, sum time.Duration
+		}
+		index := make(map[[2]string]int)
+		var sums []agg
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				if qr.Code == ErrSkipped {
+					continue
+				}
+				k := [2]string{auth.Hostname, qr.ServerIP}
+				i, ok := index[k]
+				if !ok {
+					i = len(level.Servers)
+					index[k] = i
+					level.Servers = append(level.Servers, RankedServer{Hostname: auth.Hostname, IP: qr.ServerIP})
+					sums = append(sums, agg{})
+				}
+				s := &level.Servers[i]
+				s.Queries++
+				if qr.Error != "" || RcodeFailure(qr.Rcode) {
+					continue
+				}
+				if s.Successes == 0 || qr.RTT < sums[i].min {
+					sums[i].min = qr.RTT
+				}
+				sums[i].sum += qr.RTT
+				s.Successes++
+			}
+		}
+		var rtts []float64
+		for i := range level.Servers {
+			s := &level.Servers[i]
+			if s.Successes > 0 {
+				s.AvgRTTMs = millis(sums[i].sum / time.Duration(s.Successes))
+				s.MinRTTMs = millis(sums[i].min)
+				rtts = append(rtts, s.AvgRTTMs)
+			}
+		}
+		sort.SliceStable(level.Servers, func(i, j int) bool {
+			a, b := level.Servers[i], level.Servers[j]
+			if (a.Successes > 0) != (b.Successes > 0) {
+				return a.Successes > 0
+			}
+			return a.AvgRTTMs < b.AvgRTTMs
+		})
+		if len(rtts) > 0 {
+			level.MedianMs = median(rtts)
+			for i := range level.Servers {
+				s := &level.Servers[i]
+				s.Outlier = s.Successes > 0 && len(rtts) > 2 && s.AvgRTTMs > rankOutlierFactor*level.MedianMs
+			}
+		}
+		if fastest := level.Fastest(); fastest != nil {
+			rank.BestPathMs += fastest.AvgRTTMs
+		} else {
+			rank.Complete = false
+		}
+		rank.Levels = append(rank.Levels, level)
+	}
+	return rank
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter 是所有出站查询共用的令牌桶，按 -qps 的速率补充；桶容量为 1，不允许突发
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(qps float64) *rateLimiter {
+	return &rateLimiter{rate: qps, tokens: 1, last: time.Now()}
+}
+
+// wait 取一个令牌，令牌不足时等待；ctx 取消时立即返回错误
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > 1 {
+			l.tokens = 1
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// beforeSend 在每次发出查询前调用，负责限速；计数在 meterExchange
+func (tr *Tracer) beforeSend(ctx context.Context) error {
+	if tr.limiter != nil {
+		return tr.limiter.wait(ctx)
+	}
+	return nil
+}
+
+// QueryRate 是一次 Run 的查询速率，由同一次 Run 的 Usage 算出，包括追踪之后的各项检查
+type QueryRate struct {
+	Sent      int64   `json:"sent"`
+	ElapsedMs float64 `json:"elapsed_ms"`
+	QPS       float64 `json:"qps"`
+	Limit     float64 `json:"limit,omitempty"`
+	// CacheHits 是 NS 地址缓存和磁盘缓存省掉的查询数，和 Usage.CacheHits 相同
+	CacheHits int64 `json:"address_cache_hits,omitempty"`
+	// Connections 是默认 Exchanger 打开过的 UDP 套接字和 TCP 连接数，同一服务器的查询共用连接
+	Connections int64 `json:"connections,omitempty"`
+	// DiskHits 是 Options.CacheDir 的磁盘缓存代替查询的次数（顶级域转介和根服务器地址），DiskMisses 是要查询根服务器时缓存里没有可用转介的次数
+	DiskHits   int64 `json:"disk_cache_hits,omitempty"`
+	DiskMisses int64 `json:"disk_cache_misses,omitempty"`
+	// BudgetHits 是 Options.LevelTimeout 用完时还有服务器没有应答的级数
+	BudgetHits int `json:"level_budget_hits,omitempty"`
+}
+
+func (tr *Tracer) newQueryRate(u *Usage) *QueryRate {
+	r := &QueryRate{Sent: u.Total, ElapsedMs: u.ElapsedMs, Limit: tr.qps, CacheHits: u.CacheHits, Connections: u.Connections, DiskHits: u.DiskHits, DiskMisses: u.DiskMisses}
+	if u.ElapsedMs > 0 {
+		r.QPS = float64(r.Sent) / (u.ElapsedMs / 1000)
+	}
+	return r
+}
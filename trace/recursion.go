@@ -0,0 +1,126 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// recursionProbeZone 是探测递归用的外部域，随机标签保证服务器的缓存里没有现成的应答
+const recursionProbeZone = "example.net."
+
+// 每个服务器 IP 对递归查询的处理方式
+const (
+	RecursionRefused  = "refused"
+	RecursionOpen     = "open"
+	RecursionNoAnswer = "ra-no-answer"
+	RecursionFailed   = "failed"
+)
+
+// RecursionCheck 记录向追踪经过的每台权威服务器发送 RD=1 的区外查询的结果
+type RecursionCheck struct {
+	Probe   string            `json:"probe"`
+	Servers []RecursionResult `json:"servers"`
+}
+
+type RecursionResult struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Zone     string `json:"zone"`
+	Status   string `json:"status"`
+	RA       bool   `json:"ra"`
+	Rcode    string `json:"rcode,omitempty"`
+	// Answers 是应答区的记录数，负面应答时为 0
+	Answers int     `json:"answers"`
+	RTTMs   float64 `json:"rtt_ms,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// Open 判断是否有权威服务器替任何人做递归解析
+func (c *RecursionCheck) Open() bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Servers {
+		if s.Status == RecursionOpen {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRecursion 对每一级的每台权威服务器的每个 IP 只探测一次，同一个 IP 出现在多级时按第一次出现的区记录
+func (tr *Tracer) checkRecursion(ctx context.Context, results []Result) *RecursionCheck {
+	check := &RecursionCheck{Probe: fmt.Sprintf("mdig-%08x.%s", rand.Uint32(), recursionProbeZone)}
+	seen := make(map[string]bool)
+	for _, res := range results {
+		for _, t := range tr.authTargets(res) {
+			ip := t.ip.String()
+			if seen[ip] {
+				continue
+			}
+			seen[ip] = true
+			check.Servers = append(check.Servers, RecursionResult{Hostname: t.host, IP: ip, Zone: res.Zone})
+		}
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tr.probeRecursion(ctx, check.Probe, &check.Servers[i])
+		}()
+	}
+	wg.Wait()
+	return check
+}
+
+func (tr *Tracer) probeRecursion(ctx context.Context, probe string, s *RecursionResult) {
+	s.Status = RecursionFailed
+	m := tr.newQuery(probe, dns.TypeA, dns.ClassINET)
+	m.RecursionDesired = true
+	var r *dns.Msg
+	var info exchangeInfo
+	_, err := tr.retry(ctx, func() (err error) {
+		r, info, err = tr.exchange(ctx, m, tr.authAddr(s.IP), tr.queryTimeout)
+		return err
+	})
+	s.RTTMs = millis(info.RTT)
+	if err != nil {
+		s.Error = err.Error()
+		return
+	}
+	s.RA, s.Rcode, s.Answers = r.RecursionAvailable, dns.RcodeToString[r.Rcode], len(r.Answer)
+	switch {
+	case recursiveAnswer(r, probe):
+		s.Status = RecursionOpen
+	case r.RecursionAvailable:
+		s.Status = RecursionNoAnswer
+	default:
+		s.Status = RecursionRefused
+	}
+}
+
+// recursiveAnswer 判断应答是否来自递归解析：有应答记录，或带着外部域 SOA 的 NXDOMAIN/NODATA。
+// 带 AA 的应答来自服务器自己的区数据（例如它恰好也是 example.net 的权威），转介只带 NS，都不算递归
+func recursiveAnswer(r *dns.Msg, probe string) bool {
+	if r.Authoritative || r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+		return false
+	}
+	if len(r.Answer) > 0 {
+		return true
+	}
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok && dns.IsSubDomain(soa.Hdr.Name, strings.ToLower(probe)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// RFC 2182 检查的各项
+const (
+	RFC2182Count   = "ns_count"
+	RFC2182Hosts   = "distinct_hosts"
+	RFC2182OffZone = "out_of_zone"
+	RFC2182NoCNAME = "no_cname"
+)
+
+// rfc2182MinServers 是 RFC 2182 第 5 节建议的最少 NS 数
+const rfc2182MinServers = 2
+
+// RFC2182Check 按 RFC 2182（以及 RFC 2181 第 10.3 节关于 NS 不能指向别名的规定）检查区的委派：
+// 至少两个 NS、不全在同一台主机上、至少一个 NS 在区外、没有 NS 指向 CNAME。Pass 表示所有项都满足
+type RFC2182Check struct {
+	Zone     string             `json:"zone"`
+	Criteria []RFC2182Criterion `json:"criteria"`
+	Pass     bool               `json:"pass"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// RFC2182Criterion 是一项检查，Evidence 给出判断依据
+type RFC2182Criterion struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	Pass     bool   `json:"pass"`
+	Evidence string `json:"evidence"`
+}
+
+// Failed 返回没有满足的项
+func (c *RFC2182Check) Failed() []RFC2182Criterion {
+	if c == nil {
+		return nil
+	}
+	var failed []RFC2182Criterion
+	for _, cr := range c.Criteria {
+		if !cr.Pass {
+			failed = append(failed, cr)
+		}
+	}
+	return failed
+}
+
+// checkRFC2182 检查最终一级的 NS 集合；NS 主机名是否是 CNAME 通过 -dns 服务器查询
+func (tr *Tracer) checkRFC2182(ctx context.Context, domain string, results []Result) *RFC2182Check {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &RFC2182Check{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	check := &RFC2182Check{Zone: level.Zone}
+	var hosts []string
+	for _, auth := range level.Authorities {
+		hosts = append(hosts, normalizeName(auth.Hostname))
+	}
+	hosts = uniqueStrings(hosts)
+	if len(hosts) == 0 {
+		check.Error = "no NS records for " + level.Zone
+		return check
+	}
+	count := RFC2182Criterion{Name: RFC2182Count, Title: fmt.Sprintf("at least %d NS records", rfc2182MinServers), Pass: len(hosts) >= rfc2182MinServers}
+	count.Evidence = fmt.Sprintf("%d NS: %s", len(hosts), strings.Join(hosts, ", "))
+	check.Criteria = append(check.Criteria, count, sharedHost(level), offZone(level.Zone, hosts), tr.cnameTargets(ctx, hosts))
+	check.Pass = len(check.Failed()) == 0
+	return check
+}
+
+// sharedHost 判断是否所有 NS 都落在同一台主机上：有一个地址是每台服务器都有的，或者只有一台服务器
+func sharedHost(level Result) RFC2182Criterion {
+	cr := RFC2182Criterion{Name: RFC2182Hosts, Title: "NS not all on the same host"}
+	owners := make(map[string][]string)
+	var order []string
+	known := 0
+	for _, auth := range level.Authorities {
+		if len(auth.IPs) == 0 {
+			continue
+		}
+		known++
+		for _, ip := range uniqueIPs(auth.IPs) {
+			s := ip.String()
+			if _, ok := owners[s]; !ok {
+				order = append(order, s)
+			}
+			owners[s] = append(owners[s], normalizeName(auth.Hostname))
+		}
+	}
+	switch {
+	case known == 0:
+		cr.Evidence = "no addresses known for the nameservers"
+		return cr
+	case known == 1:
+		cr.Evidence = fmt.Sprintf("only one nameserver has addresses (%s)", strings.Join(order, ", "))
+		return cr
+	}
+	for _, ip := range order {
+		if len(owners[ip]) == known {
+			cr.Evidence = fmt.Sprintf("every nameserver resolves to %s", ip)
+			return cr
+		}
+	}
+	cr.Pass = true
+	cr.Evidence = fmt.Sprintf("%d distinct addresses across %d nameservers", len(order), known)
+	return cr
+}
+
+func uniqueIPs(ips []net.IP) []net.IP {
+	var out []net.IP
+	for _, ip := range ips {
+		if !slices.ContainsFunc(out, ip.Equal) {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+// offZone 要求至少有一个 NS 不在区之内，区自己出问题时还能通过它找到区外的服务器
+func offZone(zone string, hosts []string) RFC2182Criterion {
+	cr := RFC2182Criterion{Name: RFC2182OffZone, Title: "at least one NS outside the zone"}
+	var outside []string
+	for _, h := range hosts {
+		if !dns.IsSubDomain(zone, h) {
+			outside = append(outside, h)
+		}
+	}
+	cr.Pass = len(outside) > 0
+	if cr.Pass {
+		cr.Evidence = "outside " + zone + ": " + strings.Join(outside, ", ")
+	} else {
+		cr.Evidence = "all NS are inside " + zone
+	}
+	return cr
+}
+
+// cnameTargets 对每个 NS 主机名查询 CNAME 记录，NS 指向别名违反 RFC 2181 第 10.3 节
+func (tr *Tracer) cnameTargets(ctx context.Context, hosts []string) RFC2182Criterion {
+	cr := RFC2182Criterion{Name: RFC2182NoCNAME, Title: "no NS pointing to a CNAME"}
+	aliases := make([]string, len(hosts))
+	errs := make([]string, len(hosts))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i, host := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			aliases[i], errs[i] = tr.lookupCNAME(ctx, host)
+		}()
+	}
+	wg.Wait()
+	var found, failed []string
+	for i, host := range hosts {
+		switch {
+		case aliases[i] != "":
+			found = append(found, host+" is a CNAME for "+aliases[i])
+		case errs[i] != "":
+			failed = append(failed, host+" ("+errs[i]+")")
+		}
+	}
+	switch {
+	case len(found) > 0:
+		cr.Evidence = strings.Join(found, "; ")
+	case len(failed) > 0:
+		// 查询失败的名字无法判断，不算作违规
+		cr.Pass = true
+		cr.Evidence = "no CNAME found; could not check " + strings.Join(failed, ", ")
+	default:
+		cr.Pass = true
+		cr.Evidence = fmt.Sprintf("none of the %d NS names is a CNAME", len(hosts))
+	}
+	return cr
+}
+
+// lookupCNAME 返回 host 的 CNAME 目标，不是别名时返回空字符串
+func (tr *Tracer) lookupCNAME(ctx context.Context, host string) (string, string) {
+	if tr.noRecursor {
+		return "", "not checked with -no-recursor"
+	}
+	resp, b, err := tr.queryBootstrap(ctx, tr.newQuery(dns.Fqdn(host), dns.TypeCNAME, dns.ClassINET))
+	if err != nil {
+		return "", err.Error()
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return "", fmt.Sprintf("resolver %s returned %s", b.addr, dns.RcodeToString[resp.Rcode])
+	}
+	for _, rr := range resp.Answer {
+		if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, dns.Fqdn(host)) {
+			return normalizeName(c.Target), ""
+		}
+	}
+	return "", ""
+}
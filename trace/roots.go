@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// selectRoots 按 Roots 从根提示里选出第一级使用的服务器：数字表示随机选这么多台，
+// 否则是逗号分隔的字母（a、k 等，对应主机名的第一个标签）或完整的主机名。
+// 根提示来自 HintsFile 时同样适用，字母按文件里的名字匹配；选中的服务器保持根提示里的顺序
+func selectRoots(spec string, hints []string) ([]string, error) {
+	chosen := make([]bool, len(hints))
+	if n, err := strconv.Atoi(spec); err == nil {
+		switch {
+		case n < 1:
+			return nil, errors.New("need at least one root server")
+		case n > len(hints):
+			return nil, fmt.Errorf("%d root servers requested, the hints only have %d", n, len(hints))
+		}
+		for _, i := range rand.Perm(len(hints))[:n] {
+			chosen[i] = true
+		}
+	} else {
+		for _, item := range strings.Split(spec, ",") {
+			item = strings.ToLower(strings.TrimSpace(item))
+			if item == "" {
+				continue
+			}
+			i := slices.IndexFunc(hints, func(h string) bool {
+				return h == normalizeName(item) || rootLetter(h) == item
+			})
+			if i < 0 {
+				letters := make([]string, len(hints))
+				for j, h := range hints {
+					letters[j] = rootLetter(h)
+				}
+				return nil, fmt.Errorf("%q is not one of the root servers (%s)", item, strings.Join(letters, ", "))
+			}
+			chosen[i] = true
+		}
+	}
+	var roots []string
+	for i, h := range hints {
+		if chosen[i] {
+			roots = append(roots, h)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("no root servers selected")
+	}
+	return roots, nil
+}
+
+// rootLetter 是根服务器主机名的第一个标签，a.root-servers.net. 是 a
+func rootLetter(host string) string {
+	letter, _, _ := strings.Cut(host, ".")
+	return letter
+}
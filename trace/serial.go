@@ -0,0 +1,216 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// SerialCheck 比较一个区的每台权威服务器（每个 IP）返回的 SOA serial，用来发现没有同步的辅服务器
+type SerialCheck struct {
+	Zone string `json:"zone"`
+	// Primary 是 SOA 里的 mname，PrimarySerial 是它给出的 serial；mname 不可达时以最大的 serial 作为参照
+	Primary       string         `json:"primary,omitempty"`
+	PrimarySerial uint32         `json:"primary_serial"`
+	PrimaryError  string         `json:"primary_error,omitempty"`
+	Servers       []ServerSerial `json:"servers"`
+	// MinSerial 和 MaxSerial 只统计给出权威应答的服务器
+	MinSerial uint32 `json:"min_serial"`
+	MaxSerial uint32 `json:"max_serial"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ServerSerial struct {
+	Hostname string  `json:"hostname"`
+	IP       string  `json:"ip"`
+	Serial   uint32  `json:"serial,omitempty"`
+	RTTMs    float64 `json:"rtt_ms,omitempty"`
+	// Error 表示没有拿到 SOA，Unreachable 时是没有收到应答，否则是错误的应答码或应答里没有 SOA；
+	// NotAuthoritative 表示应答没有 AA 位，serial 不可信
+	Error            string `json:"error,omitempty"`
+	Unreachable      bool   `json:"unreachable,omitempty"`
+	NotAuthoritative bool   `json:"not_authoritative,omitempty"`
+	Lagging          bool   `json:"lagging,omitempty"`
+}
+
+// Mismatch 判断是否有权威服务器的 serial 和主服务器不同；不可达和非权威的服务器单独列出，不算不一致
+func (c *SerialCheck) Mismatch() bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Servers {
+		if s.Lagging {
+			return true
+		}
+	}
+	return false
+}
+
+// Spread 是最大和最小 serial 的差，按 RFC 1982 的序号算术计算
+func (c *SerialCheck) Spread() uint32 {
+	return c.MaxSerial - c.MinSerial
+}
+
+// serialBefore 按 RFC 1982 判断 a 是否早于 b
+func serialBefore(a, b uint32) bool {
+	return a != b && int32(b-a) > 0
+}
+
+// zoneLevel 选出 domain 自己的最后一级：经过 CNAME 链时 results 里还有目标名的各级结果
+func zoneLevel(domain string, results []Result) (Result, bool) {
+	for i := len(results) - 1; i >= 0; i-- {
+		if strings.EqualFold(dns.Fqdn(results[i].Domain), dns.Fqdn(domain)) {
+			return results[i], true
+		}
+	}
+	if len(results) == 0 {
+		return Result{}, false
+	}
+	return results[len(results)-1], true
+}
+
+type authTarget struct {
+	host string
+	ip   net.IP
+}
+
+// authTargets 列出一级里每台权威服务器可以按 Network 发送查询的每个 IP
+func (tr *Tracer) authTargets(level Result) []authTarget {
+	var targets []authTarget
+	for _, auth := range level.Authorities {
+		for _, ip := range tr.filterFamily(auth.IPs) {
+			targets = append(targets, authTarget{normalizeName(auth.Hostname), ip})
+		}
+	}
+	return targets
+}
+
+// checkSerial 向 domain 所在区的每台权威服务器的每个 IP 查询 SOA，并和 mname 给出的 serial 比较
+func (tr *Tracer) checkSerial(ctx context.Context, domain string, results []Result) *SerialCheck {
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		return &SerialCheck{Zone: dns.Fqdn(domain), Error: "the trace did not reach the zone's authoritative servers"}
+	}
+	check := &SerialCheck{Zone: level.Zone}
+	targets := tr.authTargets(level)
+	if len(targets) == 0 {
+		check.Error = "no addresses for the authoritative servers of " + level.Zone
+		return check
+	}
+	check.Servers = make([]ServerSerial, len(targets))
+	mnames := make([]string, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			check.Servers[i], mnames[i] = tr.querySerial(ctx, check.Zone, t.host, t.ip.String())
+		}()
+	}
+	wg.Wait()
+
+	counts := make(map[string]int)
+	for i, name := range mnames {
+		if name != "" && check.Servers[i].Error == "" && !check.Servers[i].NotAuthoritative {
+			counts[name]++
+		}
+	}
+	for name, n := range counts {
+		if check.Primary == "" || n > counts[check.Primary] || n == counts[check.Primary] && name < check.Primary {
+			check.Primary = name
+		}
+	}
+	first := true
+	for _, s := range check.Servers {
+		if s.Error != "" || s.NotAuthoritative {
+			continue
+		}
+		if first || serialBefore(s.Serial, check.MinSerial) {
+			check.MinSerial = s.Serial
+		}
+		if first || serialBefore(check.MaxSerial, s.Serial) {
+			check.MaxSerial = s.Serial
+		}
+		first = false
+	}
+	if first {
+		check.Error = "no server returned an authoritative SOA for " + check.Zone
+		return check
+	}
+
+	// mname 是 NS 之一时直接用它的应答，否则（隐藏主服务器）单独查询一次
+	check.PrimarySerial = check.MaxSerial
+	found := false
+	for _, s := range check.Servers {
+		if s.Hostname == check.Primary && s.Error == "" && !s.NotAuthoritative {
+			check.PrimarySerial, found = s.Serial, true
+			break
+		}
+	}
+	if !found && check.Primary != "" {
+		if serial, err := tr.primarySerial(ctx, check.Zone, check.Primary); err != nil {
+			check.PrimaryError = err.Error()
+		} else {
+			check.PrimarySerial = serial
+		}
+	}
+	for i := range check.Servers {
+		s := &check.Servers[i]
+		s.Lagging = s.Error == "" && !s.NotAuthoritative && s.Serial != check.PrimarySerial
+	}
+	return check
+}
+
+func (tr *Tracer) querySerial(ctx context.Context, zone, host, ip string) (ServerSerial, string) {
+	s := ServerSerial{Hostname: host, IP: ip}
+	r, qr, err := tr.queryAuthorities(ctx, zone, ip, dns.TypeSOA)
+	s.RTTMs = qr.RTTMs
+	if err != nil {
+		s.Error, s.Unreachable = err.Error(), true
+		return s, ""
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		s.Error = dns.RcodeToString[r.Rcode]
+		return s, ""
+	}
+	for _, rr := range r.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, zone) {
+			s.Serial = soa.Serial
+			s.NotAuthoritative = !r.Authoritative
+			return s, normalizeName(soa.Ns)
+		}
+	}
+	s.Error = "no SOA in the answer"
+	return s, ""
+}
+
+// primarySerial 查询不在 NS 集合里的 mname，只要有一个地址给出权威应答就返回它的 serial
+func (tr *Tracer) primarySerial(ctx context.Context, zone, mname string) (uint32, error) {
+	ips, _, err := tr.lookupSpecificIP(ctx, mname)
+	if err != nil {
+		return 0, err
+	}
+	var lastErr string
+	for _, ip := range tr.filterFamily(ips) {
+		s, _ := tr.querySerial(ctx, zone, mname, ip.String())
+		switch {
+		case s.Error != "":
+			lastErr = s.Error
+		case s.NotAuthoritative:
+			lastErr = "answer without AA"
+		default:
+			return s.Serial, nil
+		}
+	}
+	if lastErr == "" {
+		lastErr = "no usable address"
+	}
+	return 0, fmt.Errorf("%s: %s", mname, lastErr)
+}
@@ -0,0 +1,60 @@
+package trace
+
+import (
+	"time"
+)
+
+// SigExpiry 汇总追踪中见到的所有 RRSIG 的过期时间，只有查询带 DO 位时才有签名
+type SigExpiry struct {
+	// WindowSec 是 Options.RRSIGWarn，在这个时间内过期的签名进入 Warnings
+	WindowSec float64      `json:"window_sec"`
+	Soonest   *SigWarning  `json:"soonest,omitempty"`
+	Warnings  []SigWarning `json:"warnings,omitempty"`
+}
+
+type SigWarning struct {
+	Owner       string    `json:"owner"`
+	TypeCovered string    `json:"type_covered"`
+	KeyTag      uint16    `json:"key_tag"`
+	SignerName  string    `json:"signer_name"`
+	Expiration  time.Time `json:"expiration"`
+	// ExpiresInSec 是距离过期的秒数，已经过期时为负数
+	ExpiresInSec int64 `json:"expires_in_sec"`
+	Expired      bool  `json:"expired,omitempty"`
+}
+
+// checkSigExpiry 对同一签名（属主、类型、key tag、过期时间都相同）只记录一次，不论它来自几台服务器
+func (tr *Tracer) checkSigExpiry(results []Result, now time.Time) *SigExpiry {
+	check := &SigExpiry{WindowSec: tr.rrsigWarn.Seconds()}
+	type key struct {
+		owner, qtype string
+		tag          uint16
+		exp          time.Time
+	}
+	seen := make(map[key]bool)
+	for _, res := range results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				for _, sig := range qr.RRSIGs {
+					k := key{sig.Owner, sig.TypeCovered, sig.KeyTag, sig.Expiration}
+					if seen[k] {
+						continue
+					}
+					seen[k] = true
+					w := SigWarning{
+						Owner: sig.Owner, TypeCovered: sig.TypeCovered, KeyTag: sig.KeyTag, SignerName: sig.SignerName,
+						Expiration: sig.Expiration, ExpiresInSec: int64(sig.Expiration.Sub(now).Seconds()),
+					}
+					w.Expired = !now.Before(sig.Expiration)
+					if check.Soonest == nil || w.Expiration.Before(check.Soonest.Expiration) {
+						check.Soonest = &w
+					}
+					if w.Expired || sig.Expiration.Sub(now) < tr.rrsigWarn {
+						check.Warnings = append(check.Warnings, w)
+					}
+				}
+			}
+		}
+	}
+	return check
+}
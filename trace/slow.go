@@ -0,0 +1,56 @@
+package trace
+
+import "time"
+
+// SlowCheck 是设置了 Options.WarnRTT 时超过阈值的查询，超时的查询也算在内
+type SlowCheck struct {
+	ThresholdMs float64     `json:"threshold_ms"`
+	Queries     []SlowQuery `json:"queries"`
+	// FinalBreach 表示最终一级（没有再往下委派的级别）有权威应答或超时的查询超过了阈值
+	FinalBreach bool `json:"final_breach"`
+}
+
+type SlowQuery struct {
+	Level    int     `json:"level"`
+	Zone     string  `json:"zone"`
+	Domain   string  `json:"domain"`
+	Hostname string  `json:"hostname"`
+	IP       string  `json:"ip"`
+	Qtype    string  `json:"qtype"`
+	RTTMs    float64 `json:"rtt_ms"`
+	TimedOut bool    `json:"timed_out,omitempty"`
+	Final    bool    `json:"final,omitempty"`
+}
+
+// slowQuery 用查询自己的收发耗时判断是否超过阈值，不含排队等待并发名额的时间
+func slowQuery(qr QueryResult, threshold time.Duration) bool {
+	return threshold > 0 && (qr.TimedOut || qr.RTT > threshold)
+}
+
+// collectSlow 按追踪顺序列出标为 Slow 的查询
+func collectSlow(results []Result, threshold time.Duration) *SlowCheck {
+	check := &SlowCheck{ThresholdMs: millis(threshold), Queries: []SlowQuery{}}
+	for _, res := range results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				if !qr.Slow {
+					continue
+				}
+				q := SlowQuery{
+					Level:    res.Level,
+					Zone:     res.Zone,
+					Domain:   res.Domain,
+					Hostname: auth.Hostname,
+					IP:       qr.ServerIP,
+					Qtype:    qr.Qtype,
+					RTTMs:    qr.RTTMs,
+					TimedOut: qr.TimedOut,
+					Final:    res.Child == "" && (qr.Flags.AA || qr.TimedOut),
+				}
+				check.FinalBreach = check.FinalBreach || q.Final
+				check.Queries = append(check.Queries, q)
+			}
+		}
+	}
+	return check
+}
@@ -0,0 +1,202 @@
+package trace
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Change.Kind 的取值
+const (
+	ChangeNS           = "ns"
+	ChangeAddress      = "address"
+	ChangeAnswer       = "answer"
+	ChangeSerial       = "serial"
+	ChangeReachability = "reachability"
+)
+
+// Change 是两次追踪之间的一项变化。集合类的变化（NS、地址、应答）只有 New（新增）或只有 Old（消失）；
+// serial 两者都有；可达性的 Old 和 New 是 "reachable" 或 "unreachable"
+type Change struct {
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+var changeLabels = map[string]string{
+	ChangeNS:      "NS for",
+	ChangeAddress: "address of",
+	ChangeAnswer:  "answer for",
+	ChangeSerial:  "serial of",
+}
+
+// String 返回一行说明，新增以 + 开头，消失以 - 开头，serial 以 ~ 开头，可达性翻转以 ! 开头
+func (c Change) String() string {
+	switch {
+	case c.Kind == ChangeReachability && c.New == "reachable":
+		return fmt.Sprintf("! %s is reachable again", c.Key)
+	case c.Kind == ChangeReachability:
+		return fmt.Sprintf("! %s became unreachable", c.Key)
+	case c.Kind == ChangeSerial:
+		return fmt.Sprintf("~ %s %s: %s → %s", changeLabels[c.Kind], c.Key, c.Old, c.New)
+	case c.New != "":
+		return fmt.Sprintf("+ %s %s: %s", changeLabels[c.Kind], c.Key, c.New)
+	}
+	return fmt.Sprintf("- %s %s: %s", changeLabels[c.Kind], c.Key, c.Old)
+}
+
+// SnapshotDiff 是一次追踪和之前保存的追踪相比的变化，Against 说明之前的追踪从哪里来（例如文件名），
+// Changes 为空表示没有变化
+type SnapshotDiff struct {
+	Against string   `json:"against,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// Snapshot 是一次追踪的规范化表示：每一项都是排好序的集合，与服务器应答和并发完成的先后无关，
+// RTT、时间等每次都不同的字段不在其中，两次追踪的快照可以逐项比较
+type Snapshot struct {
+	// NS 按委派出去的子区记录父域给出的 NS 名字
+	NS map[string][]string
+	// Addresses 按 NS 主机名记录用来查询它的地址
+	Addresses map[string][]string
+	// Answers 按 "名字 类型" 记录最终一级所有服务器应答的并集
+	Answers map[string][]string
+	// Serials 按区记录权威应答里看到的 SOA serial
+	Serials map[string][]string
+	// Reachable 按 "主机名 (IP)" 记录这个地址是否给出了应答
+	Reachable map[string]bool
+}
+
+// NewSnapshot 从追踪结果生成快照；serial 来自最终一级 SOA 类型的权威应答，设置了 Options.CheckSerial 时还有各服务器的 serial
+func NewSnapshot(report Report) *Snapshot {
+	s := &Snapshot{
+		NS:        make(map[string][]string),
+		Addresses: make(map[string][]string),
+		Answers:   make(map[string][]string),
+		Serials:   make(map[string][]string),
+		Reachable: make(map[string]bool),
+	}
+	for _, res := range report.Results {
+		for _, auth := range res.Authorities {
+			host := dns.CanonicalName(auth.Hostname)
+			for _, ip := range auth.IPs {
+				s.Addresses[host] = append(s.Addresses[host], ip.String())
+			}
+			for _, qr := range auth.QueryResults {
+				key := fmt.Sprintf("%s (%s)", host, qr.ServerIP)
+				s.Reachable[key] = s.Reachable[key] || qr.Error == ""
+				if res.Child != "" {
+					for _, ns := range qr.NS {
+						s.NS[res.Child] = append(s.NS[res.Child], dns.CanonicalName(ns))
+					}
+				} else if qr.Error == "" {
+					name := dns.CanonicalName(res.Domain) + " " + qr.Qtype
+					s.Answers[name] = append(s.Answers[name], qr.Answers...)
+				}
+				if qr.SOA != nil && qr.Flags.AA && res.Zone != "" {
+					zone := dns.CanonicalName(res.Zone)
+					s.Serials[zone] = append(s.Serials[zone], fmt.Sprint(qr.SOA.Serial))
+				}
+			}
+		}
+	}
+	if c := report.Serial; c != nil {
+		zone := dns.CanonicalName(c.Zone)
+		for _, srv := range c.Servers {
+			if srv.Error == "" && !srv.NotAuthoritative {
+				s.Serials[zone] = append(s.Serials[zone], fmt.Sprint(srv.Serial))
+			}
+		}
+	}
+	for _, m := range []map[string][]string{s.NS, s.Addresses, s.Answers, s.Serials} {
+		for k, v := range m {
+			slices.Sort(v)
+			m[k] = slices.Compact(v)
+		}
+	}
+	return s
+}
+
+// CompareReports 比较两次追踪，等同于 CompareSnapshots(NewSnapshot(prev), NewSnapshot(cur))
+func CompareReports(prev, cur Report) []Change {
+	return CompareSnapshots(NewSnapshot(prev), NewSnapshot(cur))
+}
+
+// CompareSnapshots 列出从 prev 到 cur 的变化：各级 NS 的增减、NS 地址的变化、最终应答的变化、serial 的变化和可达性的翻转。
+// 同一类变化按键排序，结果与追踪中服务器的先后无关
+func CompareSnapshots(prev, cur *Snapshot) []Change {
+	var changes []Change
+	sections := []struct {
+		kind     string
+		old, new map[string][]string
+	}{
+		{ChangeNS, prev.NS, cur.NS},
+		{ChangeAddress, prev.Addresses, cur.Addresses},
+		{ChangeAnswer, prev.Answers, cur.Answers},
+	}
+	for _, sec := range sections {
+		for _, key := range sortedKeys(sec.old, sec.new) {
+			added, removed := diffSets(sec.old[key], sec.new[key])
+			for _, v := range added {
+				changes = append(changes, Change{Kind: sec.kind, Key: key, New: v})
+			}
+			for _, v := range removed {
+				changes = append(changes, Change{Kind: sec.kind, Key: key, Old: v})
+			}
+		}
+	}
+	for _, zone := range sortedKeys(prev.Serials, cur.Serials) {
+		was, now := prev.Serials[zone], cur.Serials[zone]
+		// 只有一边看到 SOA 时无从比较
+		if len(was) > 0 && len(now) > 0 && !slices.Equal(was, now) {
+			changes = append(changes, Change{Kind: ChangeSerial, Key: zone, Old: strings.Join(was, ", "), New: strings.Join(now, ", ")})
+		}
+	}
+	for _, key := range sortedKeys(prev.Reachable, cur.Reachable) {
+		was, ok1 := prev.Reachable[key]
+		now, ok2 := cur.Reachable[key]
+		if !ok1 || !ok2 || was == now {
+			continue
+		}
+		c := Change{Kind: ChangeReachability, Key: key, Old: "reachable", New: "unreachable"}
+		if now {
+			c.Old, c.New = c.New, c.Old
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// diffSets 返回 b 相对 a 新增和消失的元素，a 和 b 都已排序去重
+func diffSets(a, b []string) (added, removed []string) {
+	in := func(list []string, v string) bool {
+		i := sort.SearchStrings(list, v)
+		return i < len(list) && list[i] == v
+	}
+	for _, v := range b {
+		if !in(a, v) {
+			added = append(added, v)
+		}
+	}
+	for _, v := range a {
+		if !in(b, v) {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+func sortedKeys[V any](maps ...map[string]V) []string {
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
@@ -0,0 +1,187 @@
+package trace
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// snapshotReport 每次返回一份新的 www.example.test. 追踪：test. 把 example.test. 委派给两台服务器，
+// 最终一级两台服务器都给出 A 应答和 SOA
+func snapshotReport() Report {
+	final := func(host, ip string, addrs ...string) AuthorityServer {
+		auth := AuthorityServer{Hostname: host}
+		for _, a := range addrs {
+			auth.IPs = append(auth.IPs, net.ParseIP(a))
+		}
+		auth.QueryResults = []QueryResult{
+			{ServerIP: ip, Qtype: "A", Flags: MsgFlags{AA: true}, Answers: []string{"192.0.2.10", "192.0.2.11"}, RTTMs: 12.5,
+				TTLs: []RRsetTTL{{Name: "www.example.test.", Type: "A", Section: "answer", TTL: 300}}},
+			{ServerIP: ip, Qtype: "SOA", Flags: MsgFlags{AA: true}, SOA: &SOAInfo{Mname: "ns1.example.test.", Serial: 2024010101}, RTTMs: 11},
+		}
+		return auth
+	}
+	return Report{
+		Domain: "www.example.test.",
+		Results: []Result{
+			{Domain: "www.example.test.", Zone: "test.", Child: "example.test.", Authorities: []AuthorityServer{{
+				Hostname:     "ns.test.",
+				IPs:          []net.IP{net.ParseIP("192.0.2.1")},
+				QueryResults: []QueryResult{{ServerIP: "192.0.2.1", Qtype: "A", NS: []string{"ns1.example.test.", "ns2.example.test."}, RTTMs: 30}},
+			}}},
+			{Domain: "www.example.test.", Zone: "example.test.", Authorities: []AuthorityServer{
+				final("ns1.example.test.", "192.0.2.2", "192.0.2.2", "2001:db8::2"),
+				final("ns2.example.test.", "192.0.2.3", "192.0.2.3"),
+			}},
+		},
+		Rate: &QueryRate{Sent: 5, ElapsedMs: 80},
+	}
+}
+
+// eachQuery 对报告里的每个查询调用 f
+func eachQuery(r *Report, f func(res *Result, auth *AuthorityServer, qr *QueryResult)) {
+	for i := range r.Results {
+		res := &r.Results[i]
+		for j := range res.Authorities {
+			auth := &res.Authorities[j]
+			for k := range auth.QueryResults {
+				f(res, auth, &auth.QueryResults[k])
+			}
+		}
+	}
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(r *Report)
+		want []Change
+	}{
+		{name: "unchanged", edit: func(r *Report) {}},
+		{
+			name: "servers, NS, addresses and answers in another order",
+			edit: func(r *Report) {
+				for i := range r.Results {
+					slices.Reverse(r.Results[i].Authorities)
+				}
+				eachQuery(r, func(_ *Result, auth *AuthorityServer, qr *QueryResult) {
+					slices.Reverse(auth.IPs)
+					slices.Reverse(qr.NS)
+					slices.Reverse(qr.Answers)
+				})
+				slices.Reverse(r.Results[1].Authorities[0].QueryResults)
+			},
+		},
+		{
+			name: "names differ only in case",
+			edit: func(r *Report) {
+				eachQuery(r, func(_ *Result, auth *AuthorityServer, qr *QueryResult) {
+					auth.Hostname = "NS" + auth.Hostname[2:]
+					for i, ns := range qr.NS {
+						qr.NS[i] = "NS" + ns[2:]
+					}
+				})
+			},
+		},
+		{
+			name: "RTT, TTL countdown and timestamps",
+			edit: func(r *Report) {
+				eachQuery(r, func(_ *Result, _ *AuthorityServer, qr *QueryResult) {
+					qr.RTT, qr.RTTMs = 250*time.Millisecond, 250
+					for i := range qr.TTLs {
+						qr.TTLs[i].TTL -= 120
+					}
+					qr.RRSIGs = []SigInfo{{Owner: "www.example.test.", TypeCovered: "A", Inception: time.Now(), Expiration: time.Now().Add(time.Hour)}}
+				})
+				r.Rate = &QueryRate{Sent: 9, ElapsedMs: 412}
+			},
+		},
+		{
+			name: "NS replaced",
+			edit: func(r *Report) {
+				r.Results[0].Authorities[0].QueryResults[0].NS = []string{"ns1.example.test.", "ns3.example.test."}
+			},
+			want: []Change{
+				{Kind: ChangeNS, Key: "example.test.", New: "ns3.example.test."},
+				{Kind: ChangeNS, Key: "example.test.", Old: "ns2.example.test."},
+			},
+		},
+		{
+			name: "address changed",
+			edit: func(r *Report) {
+				r.Results[1].Authorities[0].IPs[1] = net.ParseIP("2001:db8::53")
+			},
+			want: []Change{
+				{Kind: ChangeAddress, Key: "ns1.example.test.", New: "2001:db8::53"},
+				{Kind: ChangeAddress, Key: "ns1.example.test.", Old: "2001:db8::2"},
+			},
+		},
+		{
+			name: "answer changed",
+			edit: func(r *Report) {
+				eachQuery(r, func(_ *Result, _ *AuthorityServer, qr *QueryResult) {
+					if qr.Qtype == "A" && qr.Answers != nil {
+						qr.Answers = []string{"192.0.2.10"}
+					}
+				})
+			},
+			want: []Change{{Kind: ChangeAnswer, Key: "www.example.test. A", Old: "192.0.2.11"}},
+		},
+		{
+			name: "serial changed",
+			edit: func(r *Report) {
+				eachQuery(r, func(_ *Result, _ *AuthorityServer, qr *QueryResult) {
+					if qr.SOA != nil {
+						qr.SOA = &SOAInfo{Mname: qr.SOA.Mname, Serial: 2024010102}
+					}
+				})
+			},
+			want: []Change{{Kind: ChangeSerial, Key: "example.test.", Old: "2024010101", New: "2024010102"}},
+		},
+		{
+			name: "serial seen on only one side",
+			edit: func(r *Report) {
+				eachQuery(r, func(_ *Result, _ *AuthorityServer, qr *QueryResult) { qr.SOA = nil })
+			},
+		},
+		{
+			name: "server became unreachable",
+			edit: func(r *Report) {
+				for i := range r.Results[1].Authorities[1].QueryResults {
+					qr := &r.Results[1].Authorities[1].QueryResults[i]
+					qr.Error, qr.TimedOut, qr.Answers, qr.SOA = "timeout after 3s", true, nil, nil
+				}
+			},
+			want: []Change{{Kind: ChangeReachability, Key: "ns2.example.test. (192.0.2.3)", Old: "reachable", New: "unreachable"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := snapshotReport()
+			tt.edit(&cur)
+			got := CompareReports(snapshotReport(), cur)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("changes = %v\nwant      %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	tests := []struct {
+		change Change
+		want   string
+	}{
+		{Change{Kind: ChangeNS, Key: "example.test.", New: "ns3.example.test."}, "+ NS for example.test.: ns3.example.test."},
+		{Change{Kind: ChangeAddress, Key: "ns1.example.test.", Old: "192.0.2.2"}, "- address of ns1.example.test.: 192.0.2.2"},
+		{Change{Kind: ChangeSerial, Key: "example.test.", Old: "1", New: "2"}, "~ serial of example.test.: 1 → 2"},
+		{Change{Kind: ChangeReachability, Key: "ns2.example.test. (192.0.2.3)", Old: "reachable", New: "unreachable"}, "! ns2.example.test. (192.0.2.3) became unreachable"},
+		{Change{Kind: ChangeReachability, Key: "ns2.example.test. (192.0.2.3)", Old: "unreachable", New: "reachable"}, "! ns2.example.test. (192.0.2.3) is reachable again"},
+	}
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"sort"
+	"time"
+)
+
+type ServerSummary struct {
+	Hostname  string  `json:"hostname"`
+	IP        string  `json:"ip"`
+	Queries   int     `json:"queries"`
+	Successes int     `json:"successes"`
+	Failures  int     `json:"failures"`
+	MinRTTMs  float64 `json:"min_rtt_ms"`
+	AvgRTTMs  float64 `json:"avg_rtt_ms"`
+	MaxRTTMs  float64 `json:"max_rtt_ms"`
+}
+
+// summarize 按 (hostname, ip) 汇总每台权威服务器的查询情况
+func summarize(results []Result) []ServerSummary {
+	type key struct{ host, ip string }
+	type agg struct {
+		queries, ok   int
+		min, max, sum time.Duration
+	}
+	stats := make(map[key]*agg)
+	for _, res := range results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				if qr.Code == ErrSkipped {
+					continue
+				}
+				k := key{auth.Hostname, qr.ServerIP}
+				a, exists := stats[k]
+				if !exists {
+					a = &agg{}
+					stats[k] = a
+				}
+				a.queries++
+				if qr.Error != "" || RcodeFailure(qr.Rcode) {
+					continue
+				}
+				if a.ok == 0 || qr.RTT < a.min {
+					a.min = qr.RTT
+				}
+				if qr.RTT > a.max {
+					a.max = qr.RTT
+				}
+				a.sum += qr.RTT
+				a.ok++
+			}
+		}
+	}
+
+	summary := make([]ServerSummary, 0, len(stats))
+	for k, a := range stats {
+		s := ServerSummary{
+			Hostname:  k.host,
+			IP:        k.ip,
+			Queries:   a.queries,
+			Successes: a.ok,
+			Failures:  a.queries - a.ok,
+		}
+		if a.ok > 0 {
+			s.MinRTTMs = millis(a.min)
+			s.AvgRTTMs = millis(a.sum / time.Duration(a.ok))
+			s.MaxRTTMs = millis(a.max)
+		}
+		summary = append(summary, s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Hostname != summary[j].Hostname {
+			return summary[i].Hostname < summary[j].Hostname
+		}
+		return summary[i].IP < summary[j].IP
+	})
+	return summary
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
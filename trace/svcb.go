@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+type SVCBInfo struct {
+	Priority uint16            `json:"priority"`
+	Target   string            `json:"target"`
+	Alias    bool              `json:"alias"`
+	ALPN     []string          `json:"alpn,omitempty"`
+	Port     uint16            `json:"port,omitempty"`
+	IPv4Hint []string          `json:"ipv4hint,omitempty"`
+	IPv6Hint []string          `json:"ipv6hint,omitempty"`
+	ECH      string            `json:"ech,omitempty"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+func newSVCBInfo(r *dns.SVCB) SVCBInfo {
+	info := SVCBInfo{Priority: r.Priority, Target: r.Target, Alias: r.Priority == 0}
+	for _, kv := range r.Value {
+		switch v := kv.(type) {
+		case *dns.SVCBAlpn:
+			info.ALPN = v.Alpn
+		case *dns.SVCBPort:
+			info.Port = v.Port
+		case *dns.SVCBIPv4Hint:
+			for _, ip := range v.Hint {
+				info.IPv4Hint = append(info.IPv4Hint, ip.String())
+			}
+		case *dns.SVCBIPv6Hint:
+			for _, ip := range v.Hint {
+				info.IPv6Hint = append(info.IPv6Hint, ip.String())
+			}
+		case *dns.SVCBECHConfig:
+			info.ECH = v.String()
+		default:
+			if info.Params == nil {
+				info.Params = make(map[string]string)
+			}
+			info.Params[kv.Key().String()] = kv.String()
+		}
+	}
+	return info
+}
+
+// formatSVCB 输出 priority、target 以及各 SvcParam，AliasMode 记录会单独标出
+func formatSVCB(r *dns.SVCB) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s", r.Priority, r.Target)
+	if r.Priority == 0 {
+		b.WriteString(" (AliasMode)")
+	}
+	for _, kv := range r.Value {
+		fmt.Fprintf(&b, " %s=%s", kv.Key(), kv.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,175 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// 每个 UDP 查询改用 TCP 重发的结果
+const (
+	TCPMatch         = "match"
+	TCPMismatch      = "mismatch"
+	TCPConnectFailed = "connect-failed"
+	TCPNoAnswer      = "no-answer"
+)
+
+// TCPCheck 记录对追踪中每个走 UDP 的查询用 TCP 重发一次的结果
+type TCPCheck struct {
+	Queries []TCPResult `json:"queries"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type TCPResult struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Zone     string `json:"zone"`
+	Domain   string `json:"domain"`
+	Qtype    string `json:"qtype"`
+	Status   string `json:"status"`
+	// UDPFailed 表示原来的 UDP 查询没有拿到应答，这时无法比较两边的内容
+	UDPFailed bool    `json:"udp_failed,omitempty"`
+	UDP       string  `json:"udp,omitempty"`
+	TCP       string  `json:"tcp,omitempty"`
+	RTTMs     float64 `json:"rtt_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// UDPOnly 列出 UDP 能应答但 TCP 连不上或不应答的服务器 IP，应答一旦超过 UDP 大小就会失败
+func (c *TCPCheck) UDPOnly() []TCPResult {
+	if c == nil {
+		return nil
+	}
+	var out []TCPResult
+	seen := make(map[string]bool)
+	for _, q := range c.Queries {
+		if q.UDPFailed || q.Status != TCPConnectFailed && q.Status != TCPNoAnswer || seen[q.IP] {
+			continue
+		}
+		seen[q.IP] = true
+		out = append(out, q)
+	}
+	return out
+}
+
+// Mismatch 判断是否有查询的 TCP 应答和 UDP 应答不同
+func (c *TCPCheck) Mismatch() bool {
+	if c == nil {
+		return false
+	}
+	for _, q := range c.Queries {
+		if q.Status == TCPMismatch {
+			return true
+		}
+	}
+	return false
+}
+
+// answerDigest 把应答码、应答记录和转介的 NS 归纳成一个可比较的字符串，和 queryServer 的取值方式一致
+func answerDigest(rcode int, answers, ns []string) string {
+	parts := []string{dns.RcodeToString[rcode]}
+	if len(answers) > 0 {
+		answers = slices.Clone(answers)
+		slices.Sort(answers)
+		parts = append(parts, strings.Join(answers, ", "))
+	}
+	if len(ns) > 0 {
+		ns = slices.Clone(ns)
+		slices.Sort(ns)
+		parts = append(parts, "NS "+strings.Join(ns, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+// msgDigest 对一个应答做 answerDigest；和 queryServer 一样不计 NS 属主越出 zone 或不是 qname 祖先的 NS，
+// 否则重发的应答会和追踪时记下的 QueryResult.NS 对不上
+func msgDigest(r *dns.Msg, zone, qname string) string {
+	var answers, ns []string
+	for _, rr := range r.Answer {
+		if value, ok := formatRecord(rr); ok {
+			answers = append(answers, value)
+		}
+	}
+	if len(r.Answer) == 0 && r.Rcode == dns.RcodeSuccess {
+		for _, rr := range r.Ns {
+			if n, ok := rr.(*dns.NS); ok && nsOutOfBailiwick(strings.ToLower(n.Hdr.Name), zone, qname) == "" {
+				ns = append(ns, n.Ns)
+			}
+		}
+	}
+	return answerDigest(r.Rcode, uniqueStrings(answers), ns)
+}
+
+// checkTCP 对追踪里每个走 UDP 的查询用 TCP 重发一次；已经走 TCP 的查询（-tcp 或截断后重试）不再重复
+func (tr *Tracer) checkTCP(ctx context.Context, results []Result) *TCPCheck {
+	check := &TCPCheck{}
+	for _, res := range results {
+		for _, auth := range res.Authorities {
+			for _, qr := range auth.QueryResults {
+				if qr.Protocol != "udp" {
+					continue
+				}
+				q := TCPResult{
+					Hostname: normalizeName(auth.Hostname), IP: qr.ServerIP, Zone: res.Zone,
+					Domain: res.Domain, Qtype: qr.Qtype, UDPFailed: qr.Error != "",
+				}
+				if !q.UDPFailed {
+					q.UDP = answerDigest(qr.Rcode, qr.Answers, qr.NS)
+				}
+				check.Queries = append(check.Queries, q)
+			}
+		}
+	}
+	if len(check.Queries) == 0 {
+		check.Error = "no query in the trace was sent over UDP"
+		if tr.proxy != nil {
+			check.Error += ", every query goes over TCP through the proxy"
+		}
+		return check
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tr.queryTCP(ctx, &check.Queries[i])
+		}()
+	}
+	wg.Wait()
+	return check
+}
+
+func (tr *Tracer) queryTCP(ctx context.Context, q *TCPResult) {
+	m, _ := tr.newAuthorityQuery(q.Domain, q.IP, dns.StringToType[q.Qtype])
+	var r *dns.Msg
+	var rtt time.Duration
+	_, err := tr.retry(ctx, func() (err error) {
+		qctx, cancel := context.WithTimeout(ctx, tr.queryTimeout)
+		defer cancel()
+		r, rtt, err = tr.exchangeOnce(qctx, "tcp", m, tr.authAddr(q.IP))
+		return err
+	})
+	q.RTTMs = millis(rtt)
+	if err != nil {
+		var connErr *connectError
+		err = classifyTCPError(err)
+		q.Status, q.Error = TCPNoAnswer, err.Error()
+		if errors.As(err, &connErr) {
+			q.Status = TCPConnectFailed
+		}
+		return
+	}
+	q.TCP = msgDigest(r, q.Zone, q.Domain)
+	q.Status = TCPMatch
+	if !q.UDPFailed && q.TCP != q.UDP {
+		q.Status = TCPMismatch
+	}
+}
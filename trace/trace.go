@@ -0,0 +1,1486 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+type Result struct {
+	Level       int               `json:"level"`
+	Domain      string            `json:"domain"`
+	Zone        string            `json:"zone,omitempty"`
+	Child       string            `json:"child,omitempty"`
+	Authorities []AuthorityServer `json:"authorities"`
+	Error       string            `json:"error,omitempty"`
+	Code        ErrorCode         `json:"code,omitempty"`
+	Notes       []string          `json:"notes,omitempty"`
+	Lame        []string          `json:"lame,omitempty"`
+	Unreachable []string          `json:"unreachable,omitempty"`
+	Delegation  *DelegationKeys   `json:"delegation_keys,omitempty"`
+	Validation  *ValidationResult `json:"validation,omitempty"`
+	NSCheck     *NSConsistency    `json:"ns_consistency,omitempty"`
+	GlueCheck   *GlueCheck        `json:"glue_check,omitempty"`
+	// Skipped 是 Options.Fast 时拿到第一个可用应答后没有再用到的服务器数
+	Skipped int `json:"skipped,omitempty"`
+	// QName 是 Options.QMin 时本级实际发出的最小化查询名，和 Domain 相同时已经在问完整的名字
+	QName string `json:"qname,omitempty"`
+	// BudgetExceeded 表示 Options.LevelTimeout 用完时本级还有服务器没有应答
+	BudgetExceeded bool `json:"budget_exceeded,omitempty"`
+	// ApexCNAME 是最终一级在区顶点返回了 CNAME 的服务器
+	ApexCNAME *ApexCNAME `json:"apex_cname,omitempty"`
+	// FromCache 表示本级没有查询，转介来自 Options.CacheDir 的磁盘缓存或 Options.ShareReferrals 时之前的追踪
+	FromCache bool `json:"from_cache,omitempty"`
+}
+
+type AuthorityServer struct {
+	Hostname     string   `json:"hostname"`
+	IPs          []net.IP `json:"ips"`
+	AddrSource   string   `json:"addr_source,omitempty"`
+	AddrCached   bool     `json:"addr_cached,omitempty"`
+	AddrAD       bool     `json:"addr_ad,omitempty"`
+	AddrResolver string   `json:"addr_resolver,omitempty"`
+	AddrStatus   string   `json:"addr_status,omitempty"`
+	// AddrQueries 是没有胶水时解析这台服务器的地址花费的查询数，地址来自缓存时按当初查询的花费计算，磁盘缓存为 0
+	AddrQueries int64 `json:"addr_queries,omitempty"`
+	// DNS64 是 -dns 服务器合成的 AAAA 地址（NAT64 网络上），不是服务器真实的 IPv6 地址，不在 IPs 里也不查询
+	DNS64        []net.IP      `json:"dns64_synthesized,omitempty"`
+	Bailiwick    string        `json:"bailiwick,omitempty"`
+	Responses    []string      `json:"responses"`
+	QueryResults []QueryResult `json:"query_results"`
+	Error        string        `json:"error,omitempty"`
+	Code         ErrorCode     `json:"code,omitempty"`
+	// Answers 是应答区的记录，Referrals 是授权区转介里的 NS 名字，上面的 Responses 是两者的并集
+	Answers   []string `json:"answers,omitempty"`
+	Referrals []string `json:"referrals,omitempty"`
+	// Authoritative 表示给出 Answers 的应答都带 AA 位
+	Authoritative bool `json:"authoritative,omitempty"`
+	// AddrEDE 是地址查询时 -dns 服务器应答里的扩展错误（RFC 8914），包括成功、NODATA 和 NXDOMAIN 的应答
+	AddrEDE []ExtendedError `json:"addr_ede,omitempty"`
+	// PTRNames 是 Options.PTRNames 时各个 IP 的反向解析名字，以 IP 为键，查不到的 IP 不出现
+	PTRNames map[string]string `json:"ptr_names,omitempty"`
+}
+
+// collectResponses 按 QueryResults 重新汇总 Answers、Referrals 和 Responses
+func (auth *AuthorityServer) collectResponses() {
+	var answers, referrals []string
+	aa := true
+	for _, qr := range auth.QueryResults {
+		referrals = append(referrals, qr.NS...)
+		if len(qr.Answers) > 0 {
+			answers = append(answers, qr.Answers...)
+			aa = aa && qr.Flags.AA
+		}
+	}
+	auth.Answers, auth.Referrals = uniqueStrings(answers), uniqueStrings(referrals)
+	auth.Authoritative = len(answers) > 0 && aa
+	auth.Responses = uniqueStrings(slices.Concat(referrals, answers))
+}
+
+type QueryResult struct {
+	ServerIP    string        `json:"server_ip"`
+	Server      string        `json:"server"`
+	Attempts    int           `json:"attempts"`
+	Qtype       string        `json:"qtype"`
+	Response    string        `json:"response,omitempty"`
+	NextLevel   *Result       `json:"next_level,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Code        ErrorCode     `json:"code,omitempty"`
+	TimedOut    bool          `json:"timed_out,omitempty"`
+	Flags       MsgFlags      `json:"flags"`
+	SentRD      bool          `json:"sent_rd"`
+	Rcode       int           `json:"rcode"`
+	Protocol    string        `json:"protocol"`
+	MsgSize     int           `json:"msg_size"`
+	EDNSBufSize uint16        `json:"edns_bufsize"`
+	RTT         time.Duration `json:"-"`
+	// RTTMs 是最后一次尝试的耗时，超时和出错的查询也记录等待了多久
+	RTTMs   float64  `json:"rtt_ms"`
+	Answers []string `json:"answers,omitempty"`
+	// AnswerTypes 是 Answers 中每条记录的类型，文本输出据此把 RRSIGs 画在所签名的 RRset 下面
+	AnswerTypes   []string        `json:"-"`
+	SOA           *SOAInfo        `json:"soa,omitempty"`
+	Referral      string          `json:"referral,omitempty"`
+	Zone          string          `json:"zone,omitempty"`
+	Class         string          `json:"class,omitempty"`
+	LameReason    string          `json:"lame_reason,omitempty"`
+	SVCB          []SVCBInfo      `json:"svcb,omitempty"`
+	NAPTR         []NAPTRInfo     `json:"naptr,omitempty"`
+	Identity      []ChaosReply    `json:"identity,omitempty"`
+	RRSIGs        []SigInfo       `json:"rrsigs,omitempty"`
+	Denial        *DenialProof    `json:"denial,omitempty"`
+	TTLs          []RRsetTTL      `json:"ttls,omitempty"`
+	Negative      *NegativeAnswer `json:"negative,omitempty"`
+	TCPFallback   bool            `json:"tcp_fallback,omitempty"`
+	FallbackError string          `json:"fallback_error,omitempty"`
+	UDPMalformed  string          `json:"udp_malformed,omitempty"`
+	Cookie        *CookieInfo     `json:"cookie,omitempty"`
+	NSID          string          `json:"nsid,omitempty"`
+	EDE           []ExtendedError `json:"ede,omitempty"`
+	EDNSOptions   []EDNSOption    `json:"edns_options,omitempty"`
+	ECSScope      *uint8          `json:"ecs_scope,omitempty"`
+	Glue          []GlueRecord    `json:"glue,omitempty"`
+	Ignored       []IgnoredRecord `json:"ignored,omitempty"`
+	NS            []string        `json:"ns,omitempty"`
+	CNAMEs        []string        `json:"cnames,omitempty"`
+	CNAMEDone     bool            `json:"-"`
+	CaseMismatch  bool            `json:"case_mismatch,omitempty"`
+	Untrusted     bool            `json:"untrusted,omitempty"`
+	// Additional 是应答附加区的全部记录（不含 OPT），胶水之外还可能有服务器主动附带的地址等
+	Additional []string `json:"additional,omitempty"`
+	// Records 是设置了 Options.KeepRecords 时应答三个区里的全部记录（不含 OPT），不进入 JSON
+	Records []dns.RR `json:"-"`
+	// Slow 表示设置了 Options.WarnRTT 时这次查询超时或 RTT 超过了阈值
+	Slow bool `json:"slow,omitempty"`
+	// Subtree 标识转介的区和 NS 集合；Options.Tree 的树里同一个 Subtree 只在第一次出现时展开 NextLevel，到了 MaxDepth 或追踪被取消时不展开
+	Subtree string `json:"subtree,omitempty"`
+}
+
+type NAPTRInfo struct {
+	Order       uint16 `json:"order"`
+	Preference  uint16 `json:"preference"`
+	Flags       string `json:"flags"`
+	Service     string `json:"service"`
+	Regexp      string `json:"regexp"`
+	Replacement string `json:"replacement"`
+}
+
+type SOAInfo struct {
+	Mname   string `json:"mname"`
+	Rname   string `json:"rname"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	Minimum uint32 `json:"minimum"`
+}
+
+func newSOAInfo(soa *dns.SOA) *SOAInfo {
+	return &SOAInfo{
+		Mname:   soa.Ns,
+		Rname:   soa.Mbox,
+		Serial:  soa.Serial,
+		Refresh: soa.Refresh,
+		Retry:   soa.Retry,
+		Expire:  soa.Expire,
+		Minimum: soa.Minttl,
+	}
+}
+
+type MsgFlags struct {
+	AA bool `json:"aa"`
+	TC bool `json:"tc"`
+	RD bool `json:"rd"`
+	RA bool `json:"ra"`
+	AD bool `json:"ad"`
+}
+
+type Report struct {
+	Domain        string          `json:"domain"`
+	UnicodeDomain string          `json:"unicode_domain,omitempty"`
+	Results       []Result        `json:"results"`
+	Summary       []ServerSummary `json:"summary"`
+	Diff          *AnswerDiff     `json:"diff,omitempty"`
+	Rate          *QueryRate      `json:"rate,omitempty"`
+	Rank          *LatencyRank    `json:"rank,omitempty"`
+	// Usage 是这次追踪（包括各项检查）发出的全部查询的开销
+	Usage *Usage `json:"usage,omitempty"`
+	// Tree 是设置了 Options.Tree 时按每个转介分别展开的委派树，根节点是追踪的第一级
+	Tree *Result `json:"tree,omitempty"`
+	// CNAMEChain 按顺序列出从查询名到最终记录经过的每个名字
+	CNAMEChain []CNAMEHop `json:"cname_chain,omitempty"`
+	CNAMEError string     `json:"cname_error,omitempty"`
+	// Resolvers 是设置了 Options.CompareResolvers 时各递归服务器的应答对比
+	Resolvers *ResolverComparison `json:"resolvers,omitempty"`
+	// Hijack 是设置了 Options.CheckHijack 时 -dns 递归服务器的应答和权威应答的比较
+	Hijack *HijackCheck `json:"hijack_check,omitempty"`
+	// Serial 是设置了 Options.CheckSerial 时各权威服务器的 SOA serial
+	Serial *SerialCheck `json:"serial_check,omitempty"`
+	// AXFR 是设置了 Options.CheckAXFR 时各权威服务器的区传送结果
+	AXFR *AXFRCheck `json:"axfr_check,omitempty"`
+	// Recursion 是设置了 Options.CheckRecursion 时各权威服务器对递归查询的处理
+	Recursion *RecursionCheck `json:"recursion_check,omitempty"`
+	// EDNS 是设置了 Options.CheckEDNS 时各权威服务器的 EDNS 测试结果
+	EDNS *EDNSCheck `json:"edns_check,omitempty"`
+	// TCP 是设置了 Options.CheckTCP 时每个查询用 TCP 重发的结果
+	TCP *TCPCheck `json:"tcp_check,omitempty"`
+	// IPv6 是设置了 Options.CheckV6 时各权威服务器的 IPv6 可达性
+	IPv6 *V6Check `json:"ipv6_check,omitempty"`
+	// Diversity 是设置了 Options.CheckDiversity 时各权威服务器在网络上的分布
+	Diversity *DiversityCheck `json:"diversity_check,omitempty"`
+	// RFC2182 是设置了 Options.CheckRFC2182 时委派对 RFC 2182 各项建议的满足情况
+	RFC2182 *RFC2182Check `json:"rfc2182_check,omitempty"`
+	// Dangling 是地址查询得到 NXDOMAIN 的 NS 主机名，委派指向不存在的名字
+	Dangling []DanglingNS `json:"dangling_ns,omitempty"`
+	// DelegationGlue 是追踪经过的每个委派的胶水情况
+	DelegationGlue []DelegationGlue `json:"delegation_glue,omitempty"`
+	// Wildcard 是设置了 Options.CheckWildcard 时随机标签探测的结果
+	Wildcard *WildcardCheck `json:"wildcard_check,omitempty"`
+	// Verify 是设置了 Options.Verify 时最终一级查询重复发送的结果
+	Verify *VerifyCheck `json:"verify,omitempty"`
+	// Probe 是设置了 Options.Count 时最终一级各服务器的丢包和 RTT 统计
+	Probe *ProbeCheck `json:"probe,omitempty"`
+	// ECSProbe 是设置了 Options.ECSProbe 时各个客户端子网在最终一级各服务器上得到的应答
+	ECSProbe *ECSProbe `json:"ecs_probe,omitempty"`
+	// RRSIGExpiry 是查询带 DO 位时追踪中所有签名的过期情况
+	RRSIGExpiry *SigExpiry `json:"rrsig_expiry,omitempty"`
+	// TTL 是设置了 Options.CheckTTL 时各服务器之间不一致或超出范围的 TTL
+	TTL *TTLCheck `json:"ttl_check,omitempty"`
+	// Propagation 是设置了 Options.Propagation 时委派各项 TTL 和更换 NS 后旧数据最多保留的时间
+	Propagation *Propagation `json:"propagation,omitempty"`
+	// Health 是设置了 Options.Health 时根据以上各项检查给出的总体判断
+	Health *Health `json:"health,omitempty"`
+	// Slow 是设置了 Options.WarnRTT 时超过阈值的查询
+	Slow *SlowCheck `json:"slow,omitempty"`
+	// Since 是调用方用 CompareReports 和之前保存的追踪比较的结果，Run 不填写
+	Since *SnapshotDiff `json:"changes_since,omitempty"`
+	// Expect 是调用方用 Expectations.Check 检查断言的结果，Run 不填写
+	Expect *ExpectResult `json:"expect,omitempty"`
+	// Exchanges 是设置了 Options.KeepMessages 时发往权威服务器的全部查询，不进入 JSON
+	Exchanges []Exchange `json:"-"`
+}
+
+func (f MsgFlags) String() string {
+	var flags []string
+	if f.AA {
+		flags = append(flags, "aa")
+	}
+	if f.TC {
+		flags = append(flags, "tc")
+	}
+	if f.RD {
+		flags = append(flags, "rd")
+	}
+	if f.RA {
+		flags = append(flags, "ra")
+	}
+	if f.AD {
+		flags = append(flags, "ad")
+	}
+	return strings.Join(flags, " ")
+}
+
+type Status int
+
+const (
+	StatusAnswer Status = iota
+	StatusNXDomain
+	StatusNoData
+	StatusNetworkError
+	StatusInvalid
+	StatusAborted
+	StatusServerFailure
+	StatusBrokenDelegation
+)
+
+var statusNames = [...]string{"answer", "nxdomain", "nodata", "network_error", "invalid", "aborted", "server_failure", "broken_delegation"}
+
+func (s Status) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return fmt.Sprintf("status %d", int(s))
+}
+
+// traceDNS 逐级追踪 domain 的 types 类型（格式同 -dnstype），每完成一级就通过 emit 输出该级结果
+func (tr *Tracer) traceDNS(ctx context.Context, domain, types string, emit func(Result)) ([]Result, Status) {
+	var results []Result
+	addResult := func(result Result) {
+		results = append(results, result)
+		if result.Error != "" {
+			tr.logger.Info("trace stopped", "domain", result.Domain, "level", result.Level, "zone", result.Zone, "code", result.Code, "error", result.Error)
+		}
+		if emit != nil {
+			emit(result)
+		}
+	}
+	prevServers := tr.rootHints
+	var prevGlue glueAddrs
+	if tr.noRecursor || tr.hintsFile != "" {
+		// 不依赖递归服务器时根服务器的地址只能用内置的；-hints 文件自带地址时也直接使用
+		prevGlue = tr.rootGlue()
+	}
+	visited := make(map[string]bool)
+	i := 0
+	zone := "."
+	// -from 时直接从起始区开始，层号按区的标签数计算，与从根追踪时同一个区的层号一致；
+	// CNAME 目标不在起始区之内时仍从根开始
+	if tr.fromZone != "" && dns.IsSubDomain(tr.fromZone, dns.Fqdn(domain)) {
+		prevServers, prevGlue, zone = tr.fromServers, tr.fromGlue, tr.fromZone
+		i = dns.CountLabel(tr.fromZone)
+	}
+	var chain *chainValidator
+	if tr.validate {
+		chain = tr.newChainValidator()
+	}
+	qtypes := parseQueryTypes(types)
+	var typeNames []string
+	for _, t := range qtypes {
+		typeNames = append(typeNames, dns.Type(t).String())
+	}
+	tr.logger.Info("tracing", "domain", domain, "resolver", tr.bootstrap.addr, "types", strings.Join(typeNames, ","), "timeout", tr.queryTimeout, "concurrency", tr.concurrency)
+	// 任何语法上合法的名字都可以追踪：根、公共后缀（com、co.uk 等）、反向域名和 _dmarc 这类服务名字都一样从根开始逐级往下，
+	// 可注册域名只用于区切分的说明，算不出来时不影响追踪
+	if _, ok := dns.IsDomainName(domain); !ok {
+		result := Result{Error: fmt.Sprintf("%s is not a valid domain name", domain), Code: ErrInvalidName}
+		addResult(result)
+		return results, StatusInvalid
+	}
+	suffix := IsPublicSuffix(domain)
+	registrable := registrableDomain(domain)
+	domain = dns.Fqdn(domain)
+	for {
+		if len(prevServers) == 0 {
+			break
+		}
+		i++
+		// Zone 是本级服务器所在的区，Child 是它们委派出去的下一级区
+		result := Result{
+			Level:  i,
+			Domain: domain,
+			Zone:   zone,
+		}
+		if tld, ok := tr.useDiskCache(zone, domain); ok {
+			servers, glue, hit := tr.diskCache.referral(tld)
+			onDisk := tr.diskCache.onDisk()
+			tr.meter(ctx, func(u *Usage) {
+				switch {
+				case hit:
+					u.CacheHits++
+					if onDisk {
+						u.DiskHits++
+					}
+				case onDisk:
+					u.DiskMisses++
+				}
+			})
+			if hit {
+				source := "the disk cache (-cache-dir)"
+				if !onDisk {
+					source = "an earlier trace"
+				}
+				result.Child, result.FromCache, result.Authorities = tld, true, []AuthorityServer{}
+				result.Notes = append(result.Notes, fmt.Sprintf("referral to %s from %s, root servers not queried", tld, source))
+				tr.logger.Info("referral from cache", "domain", domain, "level", i, "zone", zone, "child", tld, "disk", onDisk)
+				addResult(result)
+				visited[delegationKey(tld, servers)] = true
+				tr.zoneCuts.add(tld, servers, glue)
+				prevServers, prevGlue, zone = servers, glue, tld
+				continue
+			}
+		}
+		tr.logger.Info("processing level", "domain", domain, "level", i, "zone", zone, "servers", len(prevServers))
+		tr.emitLevelStarted(domain, zone, i, len(prevServers))
+		// 委派只需用第一个类型走一遍，到达最终一级后再对其余类型逐一查询
+		var authorities []AuthorityServer
+		var nextServers []string
+		var nextGlue glueAddrs
+		var err error
+		queried, limited := tr.limitServers(prevServers)
+		lctx, lcancel := tr.levelContext(ctx)
+		qname := domain
+		for labels := 1; ; labels++ {
+			qtype := qtypes[0]
+			if tr.qmin {
+				qname = minimizedName(domain, zone, labels)
+				if qname != domain {
+					qtype = dns.TypeNS
+				}
+			}
+			authorities, nextServers, nextGlue, err = tr.getAuthorities(lctx, qname, zone, queried, prevGlue, qtype)
+			if qname == domain || err != nil || len(nextServers) > 0 || !qminExtend(authorities) {
+				break
+			}
+			result.Notes = append(result.Notes, fmt.Sprintf("qname minimization: %s is not a zone cut, adding a label", qname))
+		}
+		if tr.qmin {
+			result.QName = qname
+		}
+		if i == 1 && zone == "." && tr.rootsNote != "" {
+			result.Notes = append(result.Notes, tr.rootsNote)
+		}
+		if len(limited) > 0 {
+			result.Notes = append(result.Notes, fmt.Sprintf("queried %d of %d servers (-max-ns)", len(queried), len(prevServers)))
+		}
+		if ctx.Err() != nil {
+			lcancel()
+			result.Authorities = tr.sortAuthorities(append(authorities, limitedAuthorities(zone, limited)...))
+			result.Error, result.Code = abortMessage(ctx.Err()), ErrAborted
+			addResult(result)
+			return results, StatusAborted
+		}
+		if err != nil {
+			lcancel()
+			result.Error, result.Code = err.Error(), queryErrorCode(err)
+			addResult(result)
+			return results, StatusNetworkError
+		}
+
+		if len(authorities) == 0 {
+			lcancel()
+			result.Error, result.Code = "no authority servers found", ErrNoAuthority
+			addResult(result)
+			return results, StatusNetworkError
+		}
+		finalServers := queried
+		if tr.fast && len(authorities) < len(queried) {
+			// 只剩下给出可用应答的那台服务器，其余类型也只问它
+			result.Skipped = len(queried) - len(authorities)
+			finalServers = []string{authorities[0].Hostname}
+			result.Notes = append(result.Notes, fmt.Sprintf("fast mode: %s answered first, %d of %d servers skipped", authorities[0].Hostname, result.Skipped, len(queried)))
+		}
+
+		// 权威服务器明确返回 NXDOMAIN 时名字不存在，即使其他服务器给出委派也不再继续
+		if servers := nxdomainServers(authorities); len(servers) > 0 {
+			result.Notes = append(result.Notes, fmt.Sprintf("NXDOMAIN: %s does not exist (authoritative answer from %s)", qname, strings.Join(servers, ", ")))
+			if qname != domain {
+				// RFC 8020：名字不存在时它下面的名字也都不存在
+				result.Notes = append(result.Notes, fmt.Sprintf("%s does not exist either, since it is below %s", domain, qname))
+			}
+			nextServers = nil
+		}
+
+		if len(nextServers) == 0 && qname == domain {
+			for _, qt := range qtypes[1:] {
+				more, _, _, _ := tr.getAuthorities(lctx, domain, zone, finalServers, prevGlue, qt)
+				authorities = mergeAuthorities(authorities, more)
+			}
+		}
+		lcancel()
+
+		result.Authorities = tr.sortAuthorities(append(authorities, limitedAuthorities(zone, limited)...))
+		if len(nextServers) > 0 {
+			result.Child = delegatedZone(result)
+		}
+		tr.noteLevelBudget(&result)
+		classifyLevel(&result)
+		// 个别服务器失败只记在它自己的条目上，整级服务器都失败才停止追踪
+		note, failure := levelFailures(result)
+		if failure != "" {
+			result.Error, result.Code = failure, levelErrorCode(result)
+			addResult(result)
+			return results, failedLevelStatus(result)
+		}
+		if note != "" {
+			result.Notes = append(result.Notes, note)
+		}
+		result.Notes = append(result.Notes, zoneCutNotes(result, registrable)...)
+		if len(nextServers) == 0 && qname == domain {
+			if result.ApexCNAME = findApexCNAME(result, domain); result.ApexCNAME != nil {
+				result.Notes = append(result.Notes, result.ApexCNAME.String())
+			}
+		}
+		if tr.showDS && result.Child != "" {
+			result.Delegation = tr.fetchDelegationKeys(ctx, result.Child, prevServers, prevGlue, nextServers, nextGlue)
+		}
+		if result.Child != "" && !tr.fast {
+			// 委派里的 NS 来自父域，再向这些服务器要子域顶点的 NS 做对比
+			result.NSCheck = tr.checkNSConsistency(ctx, result.Child, nextServers, nextGlue)
+			result.GlueCheck = tr.checkGlue(ctx, result.Child, result, nextServers, nextGlue)
+		}
+		if chain != nil {
+			result.Validation = chain.validateLevel(ctx, zone, prevServers, prevGlue, result.Child, domain, qtypes[0])
+		}
+		if len(nextServers) == 0 && caaMissing(result) {
+			// CAA 会沿域名树向上查找，空应答意味着签发机构会继续检查父域
+			if parent, ok := parentName(domain); ok {
+				result.Notes = append(result.Notes, fmt.Sprintf("no CAA at this name; issuers will check %s", parent))
+			}
+		}
+		if ctx.Err() != nil {
+			result.Error, result.Code = abortMessage(ctx.Err()), ErrAborted
+			addResult(result)
+			return results, StatusAborted
+		}
+		if len(nextServers) > 0 {
+			// 同一个区配同一组 NS 再次出现说明委派绕回去了，继续追踪只会死循环
+			next := result.Child
+			key := delegationKey(next, nextServers)
+			if visited[key] {
+				result.Error, result.Code = fmt.Sprintf("delegation loop detected involving %s", next), ErrLoop
+				addResult(result)
+				return results, StatusBrokenDelegation
+			}
+			visited[key] = true
+			if suffix && strings.EqualFold(next, domain) {
+				result.Notes = append(result.Notes, fmt.Sprintf("%s is a public suffix; stopping at its delegation from the parent zone", domain))
+				addResult(result)
+				return results, StatusAnswer
+			}
+			if i >= tr.maxDepth {
+				result.Error, result.Code = fmt.Sprintf("maximum delegation depth %d reached (-maxdepth), stopping at %s", tr.maxDepth, next), ErrMaxDepth
+				addResult(result)
+				return results, StatusBrokenDelegation
+			}
+		}
+		addResult(result)
+		if zone == "." && tr.diskCache != nil {
+			tr.rememberRootLevel(result, nextServers, nextGlue)
+		}
+		tr.zoneCuts.add(result.Child, nextServers, nextGlue)
+		prevServers = nextServers
+		prevGlue = nextGlue
+		zone = result.Child
+
+	}
+	return results, finalStatus(results)
+}
+
+func abortMessage(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "trace aborted: deadline exceeded"
+	}
+	return "trace aborted: interrupted"
+}
+
+// IsPublicSuffix 判断目标是否为根或公共后缀，这类名字没有 eTLD+1
+func IsPublicSuffix(domain string) bool {
+	name := strings.ToLower(strings.TrimSuffix(domain, "."))
+	if name == "" {
+		return true
+	}
+	ps, _ := publicsuffix.PublicSuffix(name)
+	return ps == name
+}
+
+// registrableDomain 只看最右边一个服务标签之后的部分计算 eTLD+1：_443._tcp.mail.example.com、
+// selector._domainkey.example.com 都得到 example.com。公共后缀本身、反向域名等算不出 eTLD+1 时返回空串
+func registrableDomain(domain string) string {
+	labels := dns.SplitDomainName(strings.ToLower(domain))
+	for i := len(labels) - 1; i >= 0; i-- {
+		if strings.HasPrefix(labels[i], "_") {
+			labels = labels[i+1:]
+			break
+		}
+	}
+	if isReverseName(domain) || len(labels) == 0 {
+		return ""
+	}
+	reg, err := publicsuffix.EffectiveTLDPlusOne(strings.Join(labels, "."))
+	if err != nil {
+		return ""
+	}
+	return reg
+}
+
+// parseQueryTypes 解析以逗号或斜杠分隔的类型列表，无法识别的类型会被忽略
+func parseQueryTypes(s string) []uint16 {
+	var qtypes []uint16
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '/' }) {
+		if t, ok := parseQueryType(strings.TrimSpace(name)); ok {
+			qtypes = append(qtypes, t)
+		}
+	}
+	if len(qtypes) == 0 {
+		qtypes = []uint16{dns.TypeA}
+	}
+	return qtypes
+}
+
+// ValidateQueryTypes 检查 Options.QueryType 里的每个类型都能识别，未知类型直接报错而不是被悄悄丢掉
+func ValidateQueryTypes(s string) error {
+	names := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '/' })
+	if len(names) == 0 {
+		return fmt.Errorf("-dnstype is empty; accepted values: a, aaaa, mx, txt, ns, soa, srv, caa, ptr, any type mnemonic or TYPEnnn, separated by , or /")
+	}
+	for _, name := range names {
+		if _, ok := parseQueryType(strings.TrimSpace(name)); !ok {
+			return fmt.Errorf("unknown -dnstype %q; accepted values: a, aaaa, mx, txt, ns, soa, srv, caa, ptr, any type mnemonic or TYPEnnn, separated by , or /", name)
+		}
+	}
+	return nil
+}
+
+// NormalizeIPType 检查 Options.AddressFamily，并把 4/6 这类写法统一成 all
+func NormalizeIPType(s string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(s)); v {
+	case "4", "6", "all":
+		return v, nil
+	case "4/6", "6/4", "4,6", "6,4":
+		return "all", nil
+	}
+	return "", fmt.Errorf("unknown -iptype %q; accepted values: 4, 6, all (or 4/6)", s)
+}
+
+// parseQueryType 支持 miekg/dns 认识的所有类型助记符，以及 RFC 3597 的 TYPEnnn 写法
+func parseQueryType(s string) (uint16, bool) {
+	name := strings.ToUpper(s)
+	if t, ok := dns.StringToType[name]; ok {
+		return t, true
+	}
+	if strings.HasPrefix(name, "TYPE") {
+		if n, err := strconv.ParseUint(name[len("TYPE"):], 10, 16); err == nil {
+			return uint16(n), true
+		}
+	}
+	return 0, false
+}
+
+// mergeAuthorities 把同一服务器 IP 上其它类型的查询结果并入已有条目
+func mergeAuthorities(authorities, more []AuthorityServer) []AuthorityServer {
+	for _, m := range more {
+		merged := false
+		for i := range authorities {
+			if authorities[i].Hostname == m.Hostname {
+				authorities[i].QueryResults = append(authorities[i].QueryResults, m.QueryResults...)
+				authorities[i].collectResponses()
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			authorities = append(authorities, m)
+		}
+	}
+	return authorities
+}
+
+// sortAuthorities 按主机名排列服务器、按 IP 排列各自的查询结果，使每次运行的输出顺序一致；-no-sort 时保留到达顺序
+func (tr *Tracer) sortAuthorities(authorities []AuthorityServer) []AuthorityServer {
+	if tr.noSort {
+		return authorities
+	}
+	sort.SliceStable(authorities, func(i, j int) bool {
+		return authorities[i].Hostname < authorities[j].Hostname
+	})
+	for i := range authorities {
+		auth := &authorities[i]
+		sort.SliceStable(auth.IPs, func(a, b int) bool {
+			return compareIP(auth.IPs[a], auth.IPs[b]) < 0
+		})
+		sort.SliceStable(auth.QueryResults, func(a, b int) bool {
+			return compareIP(net.ParseIP(auth.QueryResults[a].ServerIP), net.ParseIP(auth.QueryResults[b].ServerIP)) < 0
+		})
+		// Responses 是各结果的并集，按排好的结果重新拼出来
+		auth.collectResponses()
+	}
+	return authorities
+}
+
+// compareIP 让 IPv4 地址排在 IPv6 前面，同一地址族内按字节比较
+func compareIP(a, b net.IP) int {
+	a4, b4 := a.To4(), b.To4()
+	switch {
+	case a4 != nil && b4 == nil:
+		return -1
+	case a4 == nil && b4 != nil:
+		return 1
+	case a4 != nil:
+		return bytes.Compare(a4, b4)
+	}
+	return bytes.Compare(a.To16(), b.To16())
+}
+
+// zoneCutNotes 指出本级中不以委派形式出现的区切分：服务器直接以子区身份作答，或在可注册域名之下另有委派
+func zoneCutNotes(result Result, registrable string) []string {
+	var notes []string
+	hidden := make(map[string][]string)
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Zone != "" && !strings.EqualFold(qr.Zone, result.Zone) && dns.IsSubDomain(result.Zone, qr.Zone) {
+				hidden[qr.Zone] = append(hidden[qr.Zone], auth.Hostname)
+			}
+		}
+	}
+	zones := make([]string, 0, len(hidden))
+	for z := range hidden {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	for _, z := range zones {
+		notes = append(notes, fmt.Sprintf("zone cut at %s: %s answered for the child zone directly instead of referring", z, strings.Join(uniqueStrings(hidden[z]), ", ")))
+	}
+	if result.Child != "" && registrable != "" {
+		reg := dns.Fqdn(registrable)
+		if !strings.EqualFold(result.Child, reg) && dns.IsSubDomain(reg, result.Child) {
+			notes = append(notes, fmt.Sprintf("%s is delegated separately below the registrable domain %s", result.Child, reg))
+		}
+	}
+	return notes
+}
+
+// delegationKey 用区名加排好序的 NS 集合标识一次委派，用于发现委派循环
+func delegationKey(zone string, servers []string) string {
+	names := make([]string, len(servers))
+	for i, s := range servers {
+		names[i] = strings.ToLower(dns.Fqdn(s))
+	}
+	sort.Strings(names)
+	return strings.ToLower(zone) + " " + strings.Join(uniqueStrings(names), ",")
+}
+
+// nxdomainServers 返回本级给出权威 NXDOMAIN 应答的服务器
+func nxdomainServers(authorities []AuthorityServer) []string {
+	var servers []string
+	for _, auth := range authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Error == "" && qr.Rcode == dns.RcodeNameError && qr.Flags.AA {
+				servers = append(servers, auth.Hostname)
+			}
+		}
+	}
+	servers = uniqueStrings(servers)
+	sort.Strings(servers)
+	return servers
+}
+
+// RcodeFailure 判断应答码是否表示服务器本身出错，NOERROR 和 NXDOMAIN 都是正常的应答
+func RcodeFailure(rcode int) bool {
+	return rcode != dns.RcodeSuccess && rcode != dns.RcodeNameError
+}
+
+// delegatedZone 返回本级服务器委派出去的子域（取出现次数最多的 NS 属主名）
+func delegatedZone(result Result) string {
+	counts := make(map[string]int)
+	zone := ""
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Referral == "" {
+				continue
+			}
+			counts[qr.Referral]++
+			if counts[qr.Referral] > counts[zone] || (counts[qr.Referral] == counts[zone] && qr.Referral < zone) {
+				zone = qr.Referral
+			}
+		}
+	}
+	return zone
+}
+
+func caaMissing(result Result) bool {
+	for _, auth := range result.Authorities {
+		for _, qr := range auth.QueryResults {
+			if qr.Qtype == "CAA" && qr.Error == "" && qr.Rcode == dns.RcodeSuccess && len(qr.Answers) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isReverseName(domain string) bool {
+	return dns.IsSubDomain("in-addr.arpa.", dns.Fqdn(domain)) || dns.IsSubDomain("ip6.arpa.", dns.Fqdn(domain))
+}
+
+func parentName(domain string) (string, bool) {
+	i, end := dns.NextLabel(domain, 0)
+	if end || domain[i:] == "." {
+		return "", false
+	}
+	return domain[i:], true
+}
+
+// finalStatus 根据最后一级的查询结果判断整个追踪的结论
+func finalStatus(results []Result) Status {
+	if len(results) == 0 {
+		return StatusNetworkError
+	}
+	status := StatusNetworkError
+	for _, auth := range results[len(results)-1].Authorities {
+		for _, qr := range auth.QueryResults {
+			switch {
+			case qr.Error != "":
+			case RcodeFailure(qr.Rcode):
+				if status == StatusNetworkError {
+					status = StatusServerFailure
+				}
+			case len(qr.Answers) > 0:
+				return StatusAnswer
+			case qr.Rcode == dns.RcodeNameError:
+				status = StatusNXDomain
+			case qr.Rcode == dns.RcodeSuccess && status != StatusNXDomain:
+				status = StatusNoData
+			}
+		}
+	}
+	return status
+}
+
+// GroupByIP 按服务器 IP 把查询结果分组，保持 IP 第一次出现的顺序
+func GroupByIP(qrs []QueryResult) [][]QueryResult {
+	var groups [][]QueryResult
+	index := make(map[string]int)
+	for _, qr := range qrs {
+		i, ok := index[qr.ServerIP]
+		if !ok {
+			i = len(groups)
+			index[qr.ServerIP] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], qr)
+	}
+	return groups
+}
+
+// getAuthorities 并发查询负责 zone 的各个服务器，返回每台服务器的结果以及它们给出的下一级 NS 和胶水
+func (tr *Tracer) getAuthorities(ctx context.Context, domain, zone string, servers []string, glue glueAddrs, dnstype uint16) ([]AuthorityServer, []string, glueAddrs, error) {
+	var authServers []AuthorityServer
+	var nextNS []string
+	nextGlue := make(glueAddrs)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// -fast 时第一个可用的应答（转介或权威应答）到达后取消其余查询，只保留给出它的服务器
+	qctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var winner string
+	// 限制整个层级同时进行的查询数（含地址查询和每个 IP 的查询），由 -concurrency 指定
+	sem := make(chan struct{}, tr.concurrency)
+	acquire := func(c context.Context) bool {
+		select {
+		case sem <- struct{}{}:
+			return true
+		case <-c.Done():
+			return false
+		}
+	}
+	release := func() { <-sem }
+	for _, server := range servers {
+		// time.Sleep(1 * time.Second)
+		wg.Add(1)
+		go func(srv string) {
+			defer wg.Done()
+			// 每台服务器的结果先在本地收集，结束时在锁内一次性合并；每个主机名只对应一个 AuthorityServer
+			auth := AuthorityServer{Hostname: srv, Bailiwick: zone}
+			var localNS []string
+			localGlue := make(glueAddrs)
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if winner != "" && winner != srv {
+					return
+				}
+				authServers = append(authServers, auth)
+				nextNS = append(nextNS, localNS...)
+				nextGlue.merge(localGlue)
+			}()
+			if !acquire(qctx) {
+				// 已取消时不再发起新的查询
+				auth.Error, auth.Code = "not queried: "+abortMessage(ctx.Err()), ErrAborted
+				if overBudget(qctx) {
+					auth.Error, auth.Code = errLevelBudget.Error(), ErrLevelBudget
+				}
+				return
+			}
+			ips, info, err := tr.serverAddrs(qctx, srv, glue)
+			release()
+			auth.AddrSource, auth.AddrCached, auth.AddrAD, auth.AddrResolver, auth.AddrStatus = info.source, info.cached, info.ad, info.resolver, info.status
+			auth.DNS64, auth.AddrQueries, auth.AddrEDE = info.dns64, info.queries, info.ede
+			if err != nil && overBudget(qctx) {
+				auth.Error, auth.Code = errLevelBudget.Error(), ErrLevelBudget
+				return
+			}
+			if err != nil {
+				auth.Error, auth.Code = "IP lookup failed: "+err.Error(), ErrNoIP
+				if info.status == AddrNXDomain || info.status == AddrNoData {
+					// 查询本身成功了，只是没有地址，和超时等查询失败分开
+					auth.Error = err.Error()
+				}
+				if dns.IsSubDomain(zone, srv) {
+					// 主机名在它服务的区之内，只能靠胶水找到
+					auth.Code = ErrNoGlue
+				}
+				return
+			}
+			// IPs 记录该主机的全部地址，实际查询过的地址各有一个 QueryResult
+			auth.IPs = ips
+			ips = tr.filterFamily(ips)
+			if len(ips) == 0 {
+				auth.Error, auth.Code = fmt.Sprintf("skipped: no IPv%s address to query over (-net %s)", tr.netFamily, tr.netFamily), ErrSkipped
+				return
+			}
+			// 双栈服务器的两个地址族同时查询时，结果由 amu 保护
+			var amu sync.Mutex
+			queryIP := func(fctx context.Context, ip net.IP) (answered, stop bool) {
+				if !acquire(fctx) {
+					return false, true
+				}
+				tr.logger.Debug("query sent", "domain", domain, "zone", zone, "server", srv, "ip", ip.String(), "type", dns.TypeToString[dnstype])
+				qr, ipGlue := tr.queryServer(fctx, domain, zone, ip, dnstype)
+				release()
+				tr.logResponse(domain, zone, srv, qr)
+				amu.Lock()
+				defer amu.Unlock()
+				if qr.Error != "" && overBudget(qctx) {
+					// 本级时限用完时还没有应答，记在这台服务器上，其余地址不再查询
+					qr.Error, qr.Code = errLevelBudget.Error(), ErrLevelBudget
+					auth.QueryResults = append(auth.QueryResults, qr)
+					return false, true
+				}
+				if lost := (*raceLost)(nil); qr.Error != "" && errors.As(context.Cause(fctx), &lost) {
+					// 另一个地址族已经应答，这个地址的查询被放弃；照样记录，看得出这个地址族不通，但算作跳过而不是失败
+					qr.Error, qr.Code, qr.TimedOut = lost.Error(), ErrSkipped, false
+					auth.QueryResults = append(auth.QueryResults, qr)
+					return false, false
+				}
+				if qr.Error != "" && qctx.Err() != nil && ctx.Err() == nil {
+					// 被 -fast 取消的查询不是服务器的问题，不记录
+					return false, true
+				}
+				if tr.fast && fastUsable(qr) {
+					mu.Lock()
+					if winner == "" {
+						winner = srv
+						cancel()
+					}
+					mu.Unlock()
+				}
+				if tr.onQuery != nil {
+					tr.onQuery(zone, srv, qr)
+				}
+				auth.QueryResults = append(auth.QueryResults, qr)
+				auth.collectResponses()
+				localNS = append(localNS, qr.NS...)
+				localGlue.merge(ipGlue)
+				return qr.Error == "", false
+			}
+			if tr.noHappyEyeballs {
+				for _, ip := range ips {
+					if _, stop := queryIP(qctx, ip); stop {
+						break
+					}
+				}
+				return
+			}
+			raceFamilies(qctx, ips, queryIP)
+		}(server)
+	}
+
+	wg.Wait()
+	if winner != "" {
+		// 在它之前结束的服务器（出错或没有可用应答）已经合并进来了，同样算作跳过
+		authServers = slices.DeleteFunc(authServers, func(a AuthorityServer) bool { return a.Hostname != winner })
+	}
+	nextNS = uniqueStrings(nextNS)
+	if !tr.noSort {
+		sort.Strings(nextNS)
+	}
+	if overBudget(ctx) {
+		return authServers, nextNS, nextGlue, nil
+	}
+	return authServers, nextNS, nextGlue, ctx.Err()
+}
+
+// fastUsable 判断 -fast 时能否根据这个应答继续：带 NS 的转介，或者没有失败的权威应答
+func fastUsable(qr QueryResult) bool {
+	return qr.Error == "" && !RcodeFailure(qr.Rcode) && (len(qr.NS) > 0 || qr.Flags.AA)
+}
+
+// queryServer 向负责 zone 的一个服务器 IP 发出查询并解析应答，返回该 IP 的查询结果和委派里带的胶水地址；
+// 超出 zone 管辖范围的 NS 和胶水不采信，记录在 Ignored 里
+func (tr *Tracer) queryServer(ctx context.Context, domain, zone string, ip net.IP, dnstype uint16) (QueryResult, glueAddrs) {
+	dest := zoneDestination(zone)
+	tr.serverRoles.Store(ip.String(), dest)
+	ctx = withDestination(ctx, dest)
+	if tr.ptrNames != nil {
+		// 服务器 IP 一确定就开始反向解析，和这次查询以及之后各级的查询同时进行
+		tr.reverseLookup(ctx, ip.String())
+	}
+	var identity <-chan []ChaosReply
+	if tr.identify {
+		identity = tr.probeIdentity(ctx, ip.String())
+	}
+	r, qr, err := tr.queryAuthorities(ctx, domain, ip.String(), dnstype)
+	if identity != nil {
+		qr.Identity = <-identity
+	}
+	glue := make(glueAddrs)
+	if err != nil {
+		var connErr *connectError
+		var srcErr *sourceMismatchError
+		if !errors.As(err, &connErr) && !errors.As(err, &srcErr) {
+			qr.Error = "query failed: " + err.Error()
+		}
+		if qr.Attempts > 1 {
+			qr.Error += fmt.Sprintf(" (after %d attempts)", qr.Attempts)
+		}
+		return qr, glue
+	}
+
+	// 应答区的记录是查询结果，只有没有应答时才把授权区的 NS 当作下一级委派
+	var answers []string
+	for _, rr := range orderWithSignatures(tr.sortRecords(r.Answer)) {
+		if value, ok := formatRecord(rr); ok {
+			answers = append(answers, value)
+			qr.AnswerTypes = append(qr.AnswerTypes, dns.Type(rr.Header().Rrtype).String())
+		}
+		switch rec := rr.(type) {
+		case *dns.SOA:
+			qr.SOA = newSOAInfo(rec)
+		case *dns.SVCB:
+			qr.SVCB = append(qr.SVCB, newSVCBInfo(rec))
+		case *dns.HTTPS:
+			qr.SVCB = append(qr.SVCB, newSVCBInfo(&rec.SVCB))
+		case *dns.RRSIG:
+			qr.RRSIGs = append(qr.RRSIGs, newSigInfo("answer", rec))
+		case *dns.NAPTR:
+			qr.NAPTR = append(qr.NAPTR, NAPTRInfo{rec.Order, rec.Preference, rec.Flags, rec.Service, rec.Regexp, rec.Replacement})
+		}
+	}
+	// 授权区的 RRSIG（SOA、NSEC、DS 的签名）也记下来，用于检查签名是否快要过期
+	for _, rr := range r.Ns {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			qr.RRSIGs = append(qr.RRSIGs, newSigInfo("authority", sig))
+		}
+	}
+	qr.CNAMEs, qr.CNAMEDone = followCNAMEs(domain, dnstype, r.Answer)
+	qr.Negative = negativeAnswer(r)
+	if len(r.Answer) == 0 && tr.dnssec {
+		qr.Denial = analyzeDenial(domain, dnstype, r.Rcode, r.Ns)
+	}
+	if r.Authoritative {
+		// 权威应答的授权区里 SOA 或 NS 的属主名就是服务器自认为负责的区
+		for _, rr := range r.Ns {
+			if t := rr.Header().Rrtype; t == dns.TypeSOA || t == dns.TypeNS {
+				qr.Zone = strings.ToLower(rr.Header().Name)
+				break
+			}
+		}
+	}
+	if len(r.Answer) == 0 && r.Rcode == dns.RcodeSuccess {
+		for _, rr := range r.Ns {
+			if ns, ok := rr.(*dns.NS); ok {
+				// 开启 0x20 时服务器可能沿用查询名的大小写，统一转成小写
+				owner := strings.ToLower(ns.Hdr.Name)
+				if reason := nsOutOfBailiwick(owner, zone, domain); reason != "" {
+					qr.Ignored = append(qr.Ignored, newIgnoredRecord(ns, reason))
+					continue
+				}
+				qr.Referral = owner
+				qr.NS = append(qr.NS, ns.Ns)
+			}
+		}
+	}
+	qr.TTLs = rrsetTTLs("answer", r.Answer)
+	if qr.Referral != "" {
+		for _, t := range rrsetTTLs("authority", r.Ns) {
+			if t.Type == "NS" && t.Name == qr.Referral {
+				qr.TTLs = append(qr.TTLs, t)
+			}
+		}
+	}
+	var ignoredGlue []IgnoredRecord
+	qr.Glue, ignoredGlue = collectGlue(r.Extra, qr.NS, zone, glue)
+	qr.Additional = additionalRecords(r.Extra)
+	if tr.keepRecords {
+		for _, rr := range slices.Concat(r.Answer, r.Ns, r.Extra) {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				qr.Records = append(qr.Records, rr)
+			}
+		}
+	}
+	if !tr.noSort {
+		// 按整条记录排序，同一个主机名的地址排在一起
+		slices.Sort(qr.Additional)
+	}
+	qr.Ignored = append(qr.Ignored, ignoredGlue...)
+	qr.Answers = uniqueStrings(answers)
+	qr.Response = strings.Join(slices.Concat(qr.NS, qr.Answers), ", ")
+	return qr, glue
+}
+
+func (tr *Tracer) queryAuthorities(ctx context.Context, domain, server string, dnstype uint16) (*dns.Msg, QueryResult, error) {
+	qr := QueryResult{ServerIP: server, Server: tr.authAddr(server), Qtype: dns.Type(dnstype).String()}
+	m, sentCookie := tr.newAuthorityQuery(domain, server, dnstype)
+	qr.SentRD = m.RecursionDesired
+
+	tr.emitQuerySent(domain, server, dnstype)
+	defer func() { tr.emitResponse(domain, dnstype, qr) }()
+	var r *dns.Msg
+	var info exchangeInfo
+	var err error
+	if ts := transcriptFrom(ctx); ts != nil {
+		sent := time.Now()
+		defer func() {
+			ts.add(Exchange{Start: sent, Server: server, Query: m, Response: r, RTT: info.RTT, Protocol: info.Protocol, Error: qr.Error, TimedOut: qr.TimedOut})
+		}()
+	}
+	qr.Attempts, err = tr.retry(ctx, func() (err error) {
+		r, info, err = tr.exchange(ctx, m, qr.Server, tr.queryTimeout)
+		return err
+	})
+	if err == nil && tr.cookies != nil {
+		qr.Cookie = tr.cookies.store(server, sentCookie, r)
+		// BADCOOKIE 时带上服务器刚返回的 cookie 重试一次
+		if qr.Cookie.BadCookie && qr.Cookie.Full {
+			m, sentCookie = tr.newAuthorityQuery(domain, server, dnstype)
+			var attempts int
+			attempts, err = tr.retry(ctx, func() (err error) {
+				r, info, err = tr.exchange(ctx, m, qr.Server, tr.queryTimeout)
+				return err
+			})
+			qr.Attempts += attempts
+			if err == nil {
+				qr.Cookie = tr.cookies.store(server, sentCookie, r)
+				qr.Cookie.Retried = true
+			}
+		}
+	}
+	qr.Protocol = tr.protocolLabel(info.Protocol)
+	qr.RTT = info.RTT
+	qr.RTTMs = millis(info.RTT)
+	qr.TCPFallback = info.TCPFallback
+	qr.FallbackError = info.FallbackError
+	qr.UDPMalformed = info.UDPMalformed
+	if err != nil {
+		var netErr net.Error
+		qr.Error, qr.Code = err.Error(), queryErrorCode(err)
+		qr.TimedOut = errors.As(err, &netErr) && netErr.Timeout()
+		qr.Slow = slowQuery(qr, tr.warnRTT)
+		return nil, qr, err
+	}
+	qr.Slow = slowQuery(qr, tr.warnRTT)
+	qr.Flags = MsgFlags{
+		AA: r.Authoritative,
+		TC: r.Truncated,
+		RD: r.RecursionDesired,
+		RA: r.RecursionAvailable,
+		AD: r.AuthenticatedData,
+	}
+	qr.Rcode = r.Rcode
+	qr.Code = rcodeErrorCode(r.Rcode)
+	qr.EDE = responseEDE(r)
+	qr.EDNSOptions = tr.undecodedOptions(r)
+	qr.MsgSize = r.Len()
+	if opt := r.IsEdns0(); opt != nil {
+		qr.EDNSBufSize = opt.UDPSize()
+	}
+	if tr.use0x20 && (len(r.Question) == 0 || r.Question[0].Name != m.Question[0].Name) {
+		qr.CaseMismatch = true
+		qr.Untrusted = true
+	}
+	if tr.nsid {
+		qr.NSID = responseNSID(r)
+	}
+	if tr.ecsOption != nil {
+		qr.ECSScope = responseScope(r)
+	}
+	return r, qr, nil
+}
+
+// authAddr 返回权威服务器的 ip:port，端口由 -port 指定
+func (tr *Tracer) authAddr(server string) string {
+	return net.JoinHostPort(server, strconv.Itoa(tr.port))
+}
+
+// newAuthorityQuery 构造发往权威服务器的查询，附带命令行要求的 EDNS 选项
+func (tr *Tracer) newAuthorityQuery(domain, server string, dnstype uint16) (*dns.Msg, string) {
+	m := tr.newQuery(domain, dnstype, dns.ClassINET)
+	// 迭代查询不应要求权威服务器递归，否则冒充权威的开放递归会掩盖委派问题；-rd 恢复旧行为
+	m.RecursionDesired = tr.recursionDesired
+	if tr.use0x20 {
+		m.Question[0].Name = randomizeCase(domain)
+	}
+	if tr.nsid {
+		addNSID(m)
+	}
+	if tr.ecsOption != nil {
+		addSubnet(m, tr.ecsOption)
+	}
+	var sentCookie string
+	if tr.cookies != nil {
+		sentCookie = tr.cookies.attach(m, server)
+	}
+	return m, sentCookie
+}
+
+// newQuery 构造所有发出的查询报文，-bufsize 不为 0 时附带 EDNS0 和 -ednsopt 的选项
+func (tr *Tracer) newQuery(name string, qtype, qclass uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Question[0].Qclass = qclass
+	if tr.bufsize > 0 {
+		m.SetEdns0(uint16(tr.bufsize), tr.dnssec)
+		tr.addEDNSOptions(m)
+	}
+	return m
+}
+
+// sortRecords 按类型再按记录值排列应答，CNAME 和 DNAME 放在最前面以保持别名链在先；MX、SRV 和 NAPTR 先按
+// 数字的优先级排列（见 preferenceKey），所有输出格式看到的顺序相同；-no-sort 时保留服务器给出的顺序
+func (tr *Tracer) sortRecords(rrs []dns.RR) []dns.RR {
+	if tr.noSort {
+		return rrs
+	}
+	rank := func(rr dns.RR) int {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeCNAME, dns.TypeDNAME:
+			return -1
+		default:
+			return int(t)
+		}
+	}
+	sorted := make([]dns.RR, len(rrs))
+	copy(sorted, rrs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i]), rank(sorted[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if c := slices.Compare(preferenceKey(sorted[i]), preferenceKey(sorted[j])); c != 0 {
+			return c < 0
+		}
+		vi, _ := formatRecord(sorted[i])
+		vj, _ := formatRecord(sorted[j])
+		return vi < vj
+	})
+	return sorted
+}
+
+// preferenceKey 返回记录按优先级排序用的数字：MX 的 preference，SRV 的 priority 和取反的 weight（同一优先级里
+// 权重大的在前），NAPTR 的 order 和 preference；其他类型为空
+func preferenceKey(rr dns.RR) []int {
+	switch r := rr.(type) {
+	case *dns.MX:
+		return []int{int(r.Preference)}
+	case *dns.SRV:
+		return []int{int(r.Priority), -int(r.Weight)}
+	case *dns.NAPTR:
+		return []int{int(r.Order), int(r.Preference)}
+	}
+	return nil
+}
+
+// formatRecord 把应答区记录转换成用于显示的字符串
+func formatRecord(rr dns.RR) (string, bool) {
+	switch r := rr.(type) {
+	case *dns.NS:
+		return r.Ns, true
+	case *dns.A:
+		return r.A.String(), true
+	case *dns.AAAA:
+		return r.AAAA.String(), true
+	case *dns.CNAME:
+		return r.Target, true
+	case *dns.MX:
+		return fmt.Sprintf("%d %s", r.Preference, r.Mx), true
+	case *dns.SRV:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target), true
+	case *dns.TXT:
+		// 长 TXT 记录会被拆成多个 255 字节的字符串，显示时需要拼接
+		return strconv.Quote(strings.Join(r.Txt, "")), true
+	case *dns.PTR:
+		return r.Ptr, true
+	case *dns.CAA:
+		return fmt.Sprintf("%d %s %q", r.Flag, r.Tag, r.Value), true
+	case *dns.NAPTR:
+		// regexp 里的 ! \ 等字符会和树形输出混在一起，统一加引号转义
+		return fmt.Sprintf("%d %d %s %s %s %s", r.Order, r.Preference,
+			strconv.Quote(r.Flags), strconv.Quote(r.Service), strconv.Quote(r.Regexp), r.Replacement), true
+	case *dns.SVCB:
+		return formatSVCB(r), true
+	case *dns.HTTPS:
+		return formatSVCB(&r.SVCB), true
+	case *dns.TLSA:
+		return fmt.Sprintf("%d %d %d %s", r.Usage, r.Selector, r.MatchingType, strings.ToLower(r.Certificate)), true
+	case *dns.DS:
+		return fmt.Sprintf("%d %d %d %s", r.KeyTag, r.Algorithm, r.DigestType, strings.ToLower(r.Digest)), true
+	case *dns.DNSKEY:
+		return fmt.Sprintf("%d %d %d (key tag %d, %s)", r.Flags, r.Protocol, r.Algorithm, r.KeyTag(), KeyRole(r.Flags)), true
+	case *dns.SOA:
+		return fmt.Sprintf("mname: %s, rname: %s, serial: %d, refresh: %d, retry: %d, expire: %d, minimum: %d",
+			r.Ns, r.Mbox, r.Serial, r.Refresh, r.Retry, r.Expire, r.Minttl), true
+	case *dns.RRSIG, *dns.OPT:
+		// RRSIG 只记在 QueryResult.RRSIGs 里
+		return "", false
+	}
+	// 没有专门处理的类型直接用标准表示形式，未知类型会以 RFC 3597 的 \# 十六进制格式输出
+	return rr.String(), true
+}
+
+// filterFamily 按 -net 只保留用来实际发送查询的地址族
+func (tr *Tracer) filterFamily(ips []net.IP) []net.IP {
+	if tr.netFamily == "any" {
+		return ips
+	}
+	var kept []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (tr.netFamily == "4") {
+			kept = append(kept, ip)
+		}
+	}
+	return kept
+}
+
+// addressTypes 返回 -iptype 对应的地址查询类型
+func (tr *Tracer) addressTypes() []uint16 {
+	switch tr.iptype {
+	case "4":
+		return []uint16{dns.TypeA}
+	case "6":
+		return []uint16{dns.TypeAAAA}
+	default:
+		// 无论如何都不应该用其他类型查地址，未知取值按 all 处理
+		return []uint16{dns.TypeA, dns.TypeAAAA}
+	}
+}
+
+// lookupSpecificIP 通过 -dns 服务器（-no-recursor 时从根迭代）查询 NS 主机名的地址，结果按 TTL 缓存；所有类型都命中缓存时 info.cached 为 true，
+// 所有拿到地址的应答都带 AD 位时 info.ad 为 true
+func (tr *Tracer) lookupSpecificIP(ctx context.Context, hostname string) (ips []net.IP, info addrLookup, err error) {
+	var lastErr error
+	var nxdomain bool
+	var resolvers, nxResolvers []string
+	var ede []ExtendedError
+	addEDE := func(list []ExtendedError) {
+		for _, e := range list {
+			if !slices.Contains(ede, e) {
+				ede = append(ede, e)
+			}
+		}
+	}
+	info.cached, info.ad = true, true
+	for _, qtype := range tr.addressTypes() {
+		answer, hit, err := tr.lookupAddresses(ctx, hostname, qtype)
+		info.queries += answer.queries
+		if err != nil {
+			if rerr := (*resolverError)(nil); errors.As(err, &rerr) {
+				addEDE(rerr.ede)
+			}
+			lastErr = err
+			info.cached = false
+			continue
+		}
+		addEDE(answer.ede)
+		info.cached = info.cached && hit
+		if answer.nxdomain {
+			nxdomain = true
+			if answer.resolver != "" {
+				nxResolvers = append(nxResolvers, answer.resolver)
+			}
+		}
+		if len(answer.ips) > 0 {
+			info.ad = info.ad && answer.ad
+			if answer.resolver != "" {
+				resolvers = append(resolvers, answer.resolver)
+			}
+		}
+		ips = append(ips, answer.ips...)
+		info.dns64 = append(info.dns64, answer.dns64...)
+	}
+	switch {
+	case len(ips) > 0:
+		info.status, info.resolver, info.ede = AddrResolved, strings.Join(uniqueStrings(resolvers), ", "), ede
+		return ips, info, nil
+	case nxdomain:
+		// NXDOMAIN 说明名字本身不存在，比另一种类型的查询失败更能说明问题
+		return nil, addrLookup{status: AddrNXDomain, resolver: strings.Join(uniqueStrings(nxResolvers), ", "), ede: ede, queries: info.queries}, fmt.Errorf("no IP found for %s: the name does not exist (NXDOMAIN)", hostname)
+	case lastErr != nil:
+		return nil, addrLookup{status: AddrFailed, ede: ede, queries: info.queries}, fmt.Errorf("no IP found for %s: %w", hostname, lastErr)
+	}
+	if len(info.dns64) > 0 {
+		return nil, addrLookup{status: AddrNoData, dns64: info.dns64, ede: ede, queries: info.queries}, fmt.Errorf("no IP found for %s: the resolver only returned DNS64-synthesized AAAA records", hostname)
+	}
+	return nil, addrLookup{status: AddrNoData, ede: ede, queries: info.queries}, fmt.Errorf("no IP found for %s: the name exists but has no %s records", hostname, addressTypeNames(tr.addressTypes()))
+}
+
+func addressTypeNames(qtypes []uint16) string {
+	names := make([]string, len(qtypes))
+	for i, t := range qtypes {
+		names[i] = dns.TypeToString[t]
+	}
+	return strings.Join(names, " or ")
+}
+
+// lookupAddresses 查询一种地址类型，先查缓存；-no-recursor 时从根开始迭代解析
+func (tr *Tracer) lookupAddresses(ctx context.Context, hostname string, qtype uint16) (addrAnswer, bool, error) {
+	answer, hit, err := tr.nsAddrCache.lookup(ctx, hostname, qtype, func() (addrAnswer, uint32, error) {
+		fctx, cost := withUsage(ctx)
+		if tr.noRecursor {
+			ips, err := tr.resolveIterative(fctx, hostname, qtype)
+			return addrAnswer{ips: ips, queries: cost.snapshot().Total}, iterativeCacheTTL, err
+		}
+		answer, ttl, err := tr.fetchAddresses(fctx, hostname, qtype)
+		answer.queries = cost.snapshot().Total
+		return answer, ttl, err
+	})
+	if hit {
+		tr.meter(ctx, func(u *Usage) {
+			u.CacheHits++
+			if answer.fromDisk {
+				u.DiskHits++
+			}
+		})
+	}
+	return answer, hit, err
+}
+
+// fetchAddresses 向 -dns 服务器查询一种地址类型，返回地址和可缓存的秒数（没有地址时取 SOA 的否定 TTL）。
+// 查询带 AD 位，让递归服务器报告应答是否通过了验证（RFC 6840 5.7）；-cd 时再带上 CD 位，验证失败的名字也能拿到地址
+func (tr *Tracer) fetchAddresses(ctx context.Context, hostname string, qtype uint16) (addrAnswer, uint32, error) {
+	m := tr.newQuery(dns.Fqdn(hostname), qtype, dns.ClassINET)
+	m.AuthenticatedData = true
+	m.CheckingDisabled = tr.checkingDisabled
+	resp, b, err := tr.queryBootstrap(ctx, m)
+	if err != nil {
+		return addrAnswer{}, 0, err
+	}
+	ede := responseEDE(resp)
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+	case dns.RcodeServerFailure:
+		// 验证失败的名字在验证型递归服务器上也是 SERVFAIL，和名字不存在（NXDOMAIN）区分开；带了 EDE 时原因以 EDE 为准
+		switch {
+		case len(ede) > 0:
+			return addrAnswer{}, 0, &resolverError{fmt.Sprintf("resolver %s returned %s", b.addr, RcodeText(resp.Rcode, ede)), ede}
+		case !tr.checkingDisabled:
+			return addrAnswer{}, 0, fmt.Errorf("resolver %s returned SERVFAIL, possibly a DNSSEC validation failure (retry with -cd)", b.addr)
+		}
+		return addrAnswer{}, 0, fmt.Errorf("resolver %s returned SERVFAIL even with CD set", b.addr)
+	default:
+		return addrAnswer{}, 0, &resolverError{fmt.Sprintf("resolver %s returned %s", b.addr, RcodeText(resp.Rcode, ede)), ede}
+	}
+	answer := addrAnswer{ad: resp.AuthenticatedData, nxdomain: resp.Rcode == dns.RcodeNameError, resolver: b.addr, ede: ede}
+	for _, ans := range resp.Answer {
+		switch record := ans.(type) {
+		case *dns.A:
+			answer.ips = append(answer.ips, record.A)
+		case *dns.AAAA:
+			answer.ips = append(answer.ips, record.AAAA)
+		}
+	}
+	if qtype == dns.TypeAAAA {
+		answer.ips, answer.dns64 = tr.splitDNS64(ctx, answer.ips)
+	}
+	if len(answer.ips) > 0 || len(answer.dns64) > 0 {
+		return answer, minTTL(resp.Answer), nil
+	}
+	if neg := negativeAnswer(resp); neg != nil {
+		return answer, neg.TTL, nil
+	}
+	return answer, 0, nil
+}
+
+// additionalRecords 把附加区的记录格式化成一行一条；OPT 是 EDNS 的伪记录，已经在统计行里显示
+func additionalRecords(extra []dns.RR) []string {
+	var records []string
+	for _, rr := range extra {
+		if rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+		records = append(records, strings.ReplaceAll(rr.String(), "\t", " "))
+	}
+	return records
+}
+
+func uniqueStrings(input []string) []string {
+	seen := make(map[string]struct{})
+	var result []string
+	for _, s := range input {
+		if _, exists := seen[s]; !exists {
+			seen[s] = struct{}{}
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,862 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeZones 是测试用的假层级：根把 test. 委派给 ns.nic.test.，test. 之下是各个测试场景用的区。
+// 每个区列出负责它的服务器 IP 和区数据，区数据里子区的 NS 和胶水构成委派；127.0.53.53 是递归服务器，
+// 用全部区的数据回答没有胶水的 NS 的地址查询
+var fakeZones = []struct {
+	zone string
+	ips  []string
+	data string
+}{
+	{".", []string{"127.0.53.1"}, `
+test. 86400 IN NS ns.nic.test.
+ns.nic.test. 86400 IN A 127.0.53.2`},
+	{"test.", []string{"127.0.53.2"}, `
+test. 86400 IN NS ns.nic.test.
+ns.nic.test. 86400 IN A 127.0.53.2
+example.test. 3600 IN NS ns1.example.test.
+example.test. 3600 IN NS ns2.example.test.
+ns1.example.test. 3600 IN A 127.0.53.3
+ns2.example.test. 3600 IN A 127.0.53.4
+other.test. 3600 IN NS ns.hosting.example.test.
+slow.test. 3600 IN NS ns1.slow.test.
+slow.test. 3600 IN NS ns2.slow.test.
+ns1.slow.test. 3600 IN A 127.0.53.5
+ns2.slow.test. 3600 IN A 127.0.53.6
+dead.test. 3600 IN NS ns1.dead.test.
+dead.test. 3600 IN NS ns2.dead.test.
+ns1.dead.test. 3600 IN A 127.0.53.7
+ns2.dead.test. 3600 IN A 127.0.53.8
+mixed.test. 3600 IN NS ns1.mixed.test.
+mixed.test. 3600 IN NS ns2.mixed.test.
+mixed.test. 3600 IN NS ns3.mixed.test.
+ns1.mixed.test. 3600 IN A 127.0.53.11
+ns2.mixed.test. 3600 IN A 127.0.53.12
+ns3.mixed.test. 3600 IN A 127.0.53.13
+dual.test. 3600 IN NS ns.dual.test.
+ns.dual.test. 3600 IN A 127.0.53.14
+ns.dual.test. 3600 IN AAAA fd00:53::14
+` + manyNS("many.test.", 20, 12)},
+	{"example.test.", []string{"127.0.53.3", "127.0.53.4"}, `
+example.test. 3600 IN NS ns1.example.test.
+example.test. 3600 IN NS ns2.example.test.
+example.test. 3600 IN MX 10 mx1.example.test.
+example.test. 3600 IN MX 5 mx2.example.test.
+example.test. 3600 IN MX 20 mx3.example.test.
+ns1.example.test. 3600 IN A 127.0.53.3
+ns2.example.test. 3600 IN A 127.0.53.4
+ns.hosting.example.test. 3600 IN A 127.0.53.9
+www.example.test. 300 IN A 192.0.2.10
+www.example.test. 300 IN TXT "v=spf1 -all"
+alias.example.test. 300 IN CNAME www.example.test.
+far.example.test. 300 IN CNAME www.other.test.
+b.c.example.test. 300 IN A 192.0.2.11`},
+	{"other.test.", []string{"127.0.53.9"}, `
+other.test. 3600 IN NS ns.hosting.example.test.
+www.other.test. 300 IN A 192.0.2.20`},
+	{"slow.test.", []string{"127.0.53.5", "127.0.53.6"}, `
+slow.test. 3600 IN NS ns1.slow.test.
+slow.test. 3600 IN NS ns2.slow.test.
+ns1.slow.test. 3600 IN A 127.0.53.5
+ns2.slow.test. 3600 IN A 127.0.53.6
+www.slow.test. 300 IN A 192.0.2.30`},
+	{"dead.test.", []string{"127.0.53.7", "127.0.53.8"}, `
+dead.test. 3600 IN NS ns1.dead.test.
+dead.test. 3600 IN NS ns2.dead.test.
+www.dead.test. 300 IN A 192.0.2.40`},
+	{"mixed.test.", []string{"127.0.53.11", "127.0.53.12", "127.0.53.13"}, `
+mixed.test. 3600 IN NS ns1.mixed.test.
+mixed.test. 3600 IN NS ns2.mixed.test.
+mixed.test. 3600 IN NS ns3.mixed.test.
+www.mixed.test. 300 IN A 192.0.2.60`},
+	{"dual.test.", []string{"127.0.53.14"}, `
+dual.test. 3600 IN NS ns.dual.test.
+ns.dual.test. 3600 IN A 127.0.53.14
+ns.dual.test. 3600 IN AAAA fd00:53::14
+www.dual.test. 300 IN A 192.0.2.70`},
+	{"many.test.", manyIPs(20, 12), manyNS("many.test.", 20, 12) + `
+www.many.test. 300 IN A 192.0.2.50
+sub.many.test. 3600 IN NS ns.sub.many.test.
+ns.sub.many.test. 3600 IN A 127.0.53.10`},
+	{"sub.many.test.", []string{"127.0.53.10"}, `
+sub.many.test. 3600 IN NS ns.sub.many.test.
+ns.sub.many.test. 3600 IN A 127.0.53.10
+www.sub.many.test. 300 IN A 192.0.2.51`},
+	// 反向区没有权威服务器，只有递归服务器用它回答 Options.PTRNames 的查询
+	{"in-addr.arpa.", nil, `
+1.53.0.127.in-addr.arpa. 300 IN PTR a.root.test.
+2.53.0.127.in-addr.arpa. 300 IN PTR ns.nic.test.
+3.53.0.127.in-addr.arpa. 300 IN PTR host-3.hosting.test.
+4.53.0.127.in-addr.arpa. 300 IN PTR host-4.hosting.test.
+11.53.0.127.in-addr.arpa. 300 IN PTR host-11.hosting.test.
+12.53.0.127.in-addr.arpa. 300 IN PTR host-12.hosting.test.
+13.53.0.127.in-addr.arpa. 300 IN PTR host-13.hosting.test.`},
+}
+
+// silentServers 收到查询后不应答，用来模拟超时；rcodeServers 对所有查询返回固定的应答码
+var (
+	silentServers = map[string]bool{"127.0.53.5": true, "127.0.53.7": true, "127.0.53.8": true, "127.0.53.11": true}
+	rcodeServers  = map[string]int{"127.0.53.12": dns.RcodeServerFailure}
+)
+
+const (
+	fakeRootHints = ". 3600000 IN NS a.root.test.\na.root.test. 3600000 IN A 127.0.53.1\n"
+	fakeResolver  = "127.0.53.53"
+)
+
+// manyNS 生成 zone 的 n 个 NS 和胶水，地址从 127.0.53.first 开始
+func manyNS(zone string, first, n int) string {
+	var b strings.Builder
+	for i, ip := range manyIPs(first, n) {
+		fmt.Fprintf(&b, "%s 3600 IN NS ns%02d.%s\nns%02d.%s 3600 IN A %s\n", zone, i+1, zone, i+1, zone, ip)
+	}
+	return b.String()
+}
+
+func manyIPs(first, n int) []string {
+	ips := make([]string, n)
+	for i := range ips {
+		ips[i] = "127.0.53." + strconv.Itoa(first+i)
+	}
+	return ips
+}
+
+// fakeServer 是假层级里的一台服务器：权威服务器按区数据给出转介、应答、NODATA 或 NXDOMAIN，
+// recursive 时按所有区的数据直接回答；rcode 不为 0 时只返回这个应答码
+type fakeServer struct {
+	zone      string
+	records   []dns.RR
+	recursive bool
+	silent    bool
+	rcode     int
+	queries   atomic.Int64
+}
+
+func (s *fakeServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.queries.Add(1)
+	if s.silent || len(r.Question) != 1 {
+		return
+	}
+	w.WriteMsg(s.answer(r))
+}
+
+func (s *fakeServer) answer(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	qname := strings.ToLower(q.Name)
+	if s.rcode != 0 {
+		m.Rcode = s.rcode
+		return m
+	}
+	if s.recursive {
+		m.RecursionAvailable = true
+		m.Answer = s.lookup(qname, q.Qtype)
+		if len(m.Answer) == 0 && !s.exists(qname) {
+			m.Rcode = dns.RcodeNameError
+		}
+		return m
+	}
+	if !dns.IsSubDomain(s.zone, qname) {
+		m.Rcode = dns.RcodeRefused
+		return m
+	}
+	// qname 在某个子区之内时给出委派：NS 放在授权区，有胶水时放在附加区
+	if cut := s.zoneCut(qname); cut != "" {
+		m.Ns = s.lookup(cut, dns.TypeNS)
+		for _, rr := range m.Ns {
+			ns := strings.ToLower(rr.(*dns.NS).Ns)
+			m.Extra = append(m.Extra, s.lookup(ns, dns.TypeA)...)
+			m.Extra = append(m.Extra, s.lookup(ns, dns.TypeAAAA)...)
+		}
+		return m
+	}
+	m.Authoritative = true
+	if m.Answer = s.lookup(qname, q.Qtype); len(m.Answer) == 0 && q.Qtype != dns.TypeCNAME {
+		m.Answer = s.lookup(qname, dns.TypeCNAME)
+	}
+	if len(m.Answer) == 0 {
+		if !s.exists(qname) {
+			m.Rcode = dns.RcodeNameError
+		}
+		m.Ns = []dns.RR{s.soa()}
+	}
+	return m
+}
+
+// zoneCut 返回 qname 所在的最深的子区，qname 在本区之内时为空
+func (s *fakeServer) zoneCut(qname string) string {
+	cut := ""
+	for _, rr := range s.records {
+		owner := strings.ToLower(rr.Header().Name)
+		if rr.Header().Rrtype == dns.TypeNS && owner != s.zone && dns.IsSubDomain(owner, qname) && len(owner) > len(cut) {
+			cut = owner
+		}
+	}
+	return cut
+}
+
+func (s *fakeServer) lookup(name string, qtype uint16) []dns.RR {
+	var out []dns.RR
+	for _, rr := range s.records {
+		if strings.EqualFold(rr.Header().Name, name) && rr.Header().Rrtype == qtype {
+			out = append(out, dns.Copy(rr))
+		}
+	}
+	return out
+}
+
+// exists 表示名字有记录或者是空非终端
+func (s *fakeServer) exists(name string) bool {
+	return slices.ContainsFunc(s.records, func(rr dns.RR) bool {
+		return dns.IsSubDomain(name, strings.ToLower(rr.Header().Name))
+	})
+}
+
+func (s *fakeServer) soa() dns.RR {
+	rr, _ := dns.NewRR(fmt.Sprintf("%s 3600 IN SOA ns.%s hostmaster.%s 2024010101 7200 3600 1209600 300", s.zone, s.zone, s.zone))
+	return rr
+}
+
+// fakeNet 是假层级的全部服务器，同时是把查询交给它们的 Exchanger：按目标 IP 找到服务器，
+// 改发到它在 127.0.0.1 上实际监听的地址
+type fakeNet struct {
+	servers map[string]*fakeServer
+	udp     map[string]string
+	tcp     map[string]string
+	// port 不为 0 时服务器直接监听 127.0.53.x:port，不经过 Exchanger 也能访问
+	port  int
+	hints string
+	// asked 按顺序记录经过 Exchanger 的每个查询的问题
+	mu    sync.Mutex
+	asked []dns.Question
+}
+
+func (n *fakeNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	n.mu.Lock()
+	n.asked = append(n.asked, m.Question...)
+	n.mu.Unlock()
+	target := n.udp[host]
+	if network == "tcp" {
+		target = n.tcp[host]
+	}
+	if target == "" {
+		return nil, 0, &net.OpError{Op: "dial", Net: network, Addr: &net.UDPAddr{IP: net.ParseIP(host)}, Err: fmt.Errorf("no fake server at %s", host)}
+	}
+	c := &dns.Client{Net: network}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.Timeout = time.Until(deadline)
+	}
+	// dns.Client 只在超时时返回，和 connPool 一样在 ctx 取消时立即放弃等待
+	type reply struct {
+		r   *dns.Msg
+		rtt time.Duration
+		err error
+	}
+	done := make(chan reply, 1)
+	go func() {
+		r, rtt, err := c.ExchangeContext(ctx, m, target)
+		done <- reply{r, rtt, err}
+	}()
+	select {
+	case rep := <-done:
+		return rep.r, rep.rtt, rep.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, 0, os.ErrDeadlineExceeded
+		}
+		return nil, 0, ctx.Err()
+	}
+}
+
+// queries 返回 ip 上的服务器收到的查询数
+func (n *fakeNet) queries(ip string) int64 {
+	return n.servers[ip].queries.Load()
+}
+
+// newFakeNet 启动假层级。port 为 0 时每台服务器监听 127.0.0.1 的随机端口，只能通过 Exchanger 访问；
+// 否则监听 127.0.53.x:port，供测试默认的网络实现（不支持这些回环地址的系统上跳过测试）
+func newFakeNet(t *testing.T, port int) *fakeNet {
+	t.Helper()
+	n := &fakeNet{servers: make(map[string]*fakeServer), udp: make(map[string]string), tcp: make(map[string]string), port: port}
+	all := &fakeServer{recursive: true}
+	for _, z := range fakeZones {
+		var records []dns.RR
+		zp := dns.NewZoneParser(strings.NewReader(z.data), z.zone, "")
+		for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+			records = append(records, rr)
+		}
+		if err := zp.Err(); err != nil {
+			t.Fatalf("zone %s: %v", z.zone, err)
+		}
+		all.records = append(all.records, records...)
+		for _, ip := range z.ips {
+			n.servers[ip] = &fakeServer{zone: z.zone, records: records, silent: silentServers[ip], rcode: rcodeServers[ip]}
+		}
+	}
+	n.servers[fakeResolver] = all
+	for ip, s := range n.servers {
+		n.listen(t, ip, s)
+	}
+	n.hints = filepath.Join(t.TempDir(), "named.root")
+	if err := os.WriteFile(n.hints, []byte(fakeRootHints), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func (n *fakeNet) listen(t *testing.T, ip string, s *fakeServer) {
+	t.Helper()
+	host := "127.0.0.1"
+	if n.port != 0 {
+		host = ip
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(n.port))
+	pc, err := net.ListenPacket("udp", addr)
+	var l net.Listener
+	if err == nil {
+		if l, err = net.Listen("tcp", addr); err != nil {
+			pc.Close()
+		}
+	}
+	if err != nil {
+		if n.port != 0 {
+			t.Skipf("cannot listen on %s: %v", addr, err)
+		}
+		t.Fatal(err)
+	}
+	n.udp[ip], n.tcp[ip] = pc.LocalAddr().String(), l.Addr().String()
+	for _, srv := range []*dns.Server{{PacketConn: pc, Handler: s}, {Listener: l, Handler: s}} {
+		go srv.ActivateAndServe()
+		t.Cleanup(func() { srv.Shutdown() })
+	}
+}
+
+// options 返回使用假层级的 Options；port 为 0 时查询经过 Exchanger
+func (n *fakeNet) options() Options {
+	opts := Options{
+		HintsFile:     n.hints,
+		Resolver:      fakeResolver,
+		AddressFamily: "4",
+		Timeout:       300 * time.Millisecond,
+		NoDNS64Check:  true,
+		Exchanger:     n,
+	}
+	if n.port != 0 {
+		opts.Exchanger = nil
+		opts.Port = n.port
+		opts.Resolver = net.JoinHostPort(fakeResolver, strconv.Itoa(n.port))
+	}
+	return opts
+}
+
+func newFakeTracer(t *testing.T, n *fakeNet, edit func(*Options)) *Tracer {
+	t.Helper()
+	opts := n.options()
+	if edit != nil {
+		edit(&opts)
+	}
+	tr, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tr.Close)
+	return tr
+}
+
+// finalAnswers 返回最后一级所有服务器给出的应答记录，去重并排序
+func finalAnswers(results []Result) []string {
+	if len(results) == 0 {
+		return nil
+	}
+	var out []string
+	for _, auth := range results[len(results)-1].Authorities {
+		out = append(out, auth.Answers...)
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func zonePath(results []Result) []string {
+	var out []string
+	for _, res := range results {
+		out = append(out, res.Zone)
+	}
+	return out
+}
+
+func TestTraceDNS(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tests := []struct {
+		name        string
+		domain      string
+		types       string
+		wantStatus  Status
+		wantZones   []string
+		wantAnswers []string
+		wantNote    string
+		wantError   string
+	}{
+		{
+			name:        "two-level delegation",
+			domain:      "www.example.test",
+			types:       "a",
+			wantStatus:  StatusAnswer,
+			wantZones:   []string{".", "test.", "example.test."},
+			wantAnswers: []string{"192.0.2.10"},
+		},
+		{
+			name:       "NXDOMAIN",
+			domain:     "missing.example.test",
+			types:      "a",
+			wantStatus: StatusNXDomain,
+			wantZones:  []string{".", "test.", "example.test."},
+			wantNote:   "NXDOMAIN: missing.example.test. does not exist",
+		},
+		{
+			name:       "NODATA",
+			domain:     "www.example.test",
+			types:      "aaaa",
+			wantStatus: StatusNoData,
+			wantZones:  []string{".", "test.", "example.test."},
+		},
+		{
+			name:        "CNAME in the same zone",
+			domain:      "alias.example.test",
+			types:       "a",
+			wantStatus:  StatusAnswer,
+			wantZones:   []string{".", "test.", "example.test."},
+			wantAnswers: []string{"www.example.test."},
+		},
+		{
+			name:        "glueless delegation",
+			domain:      "www.other.test",
+			types:       "a",
+			wantStatus:  StatusAnswer,
+			wantZones:   []string{".", "test.", "other.test."},
+			wantAnswers: []string{"192.0.2.20"},
+		},
+		{
+			name:        "one server times out",
+			domain:      "www.slow.test",
+			types:       "a",
+			wantStatus:  StatusAnswer,
+			wantZones:   []string{".", "test.", "slow.test."},
+			wantAnswers: []string{"192.0.2.30"},
+			wantNote:    "1/2 slow.test. servers answered, 1 timed out",
+		},
+		{
+			name:       "every server times out",
+			domain:     "www.dead.test",
+			types:      "a",
+			wantStatus: StatusNetworkError,
+			wantZones:  []string{".", "test.", "dead.test."},
+			wantError:  "all 2 dead.test. servers failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newFakeTracer(t, n, nil)
+			results, status := tr.traceDNS(context.Background(), tt.domain, tt.types, nil)
+			if status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", status, tt.wantStatus)
+			}
+			if got := zonePath(results); !slices.Equal(got, tt.wantZones) {
+				t.Fatalf("zones = %v, want %v", got, tt.wantZones)
+			}
+			final := results[len(results)-1]
+			if tt.wantAnswers != nil {
+				if got := finalAnswers(results); !slices.Equal(got, tt.wantAnswers) {
+					t.Errorf("answers = %v, want %v", got, tt.wantAnswers)
+				}
+			}
+			if tt.wantNote != "" && !slices.ContainsFunc(final.Notes, func(s string) bool { return strings.HasPrefix(s, tt.wantNote) }) {
+				t.Errorf("notes = %q, want one starting with %q", final.Notes, tt.wantNote)
+			}
+			if !strings.HasPrefix(final.Error, tt.wantError) || (tt.wantError == "") != (final.Error == "") {
+				t.Errorf("error = %q, want %q", final.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+// CNAME 指向另一个区时 Run 从根开始追踪目标，报告里是完整的 CNAME 链
+func TestRunFollowsCNAME(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, nil)
+	report, status := tr.Run(context.Background(), "far.example.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	if len(report.CNAMEChain) == 0 {
+		t.Fatal("no CNAME chain in the report")
+	}
+	last := report.CNAMEChain[len(report.CNAMEChain)-1]
+	if !slices.Contains(last.Answers, "192.0.2.20") {
+		t.Errorf("last CNAME hop answers = %v, want 192.0.2.20", last.Answers)
+	}
+	if got := finalAnswers(report.Results); !slices.Equal(got, []string{"192.0.2.20"}) {
+		t.Errorf("final answers = %v, want [192.0.2.20]", got)
+	}
+}
+
+// 同一个 Tracer 上的每次 Run 的 Rate 只算这次 Run 发出的查询，和它的 Usage 一致
+func TestRunRatePerRun(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, nil)
+	var sent int64
+	for _, name := range []string{"www.example.test", "www.other.test", "www.example.test"} {
+		report, _ := tr.Run(context.Background(), name, "a", nil)
+		if report.Rate == nil || report.Usage == nil {
+			t.Fatalf("%s: no rate or usage in the report", name)
+		}
+		if report.Rate.Sent != report.Usage.Total || report.Rate.CacheHits != report.Usage.CacheHits {
+			t.Errorf("%s: rate %+v does not match usage %+v", name, report.Rate, report.Usage)
+		}
+		if report.Rate.Sent == 0 {
+			t.Errorf("%s: no queries counted", name)
+		}
+		sent += report.Rate.Sent
+	}
+	if total := tr.Usage().Total; sent != total {
+		t.Errorf("per-run queries add up to %d, tracer sent %d", sent, total)
+	}
+}
+
+// ShareReferrals 时第一个目标照常查询根服务器，之后同一顶级域下的目标直接用内存里的 test. 转介，不写缓存文件
+func TestShareReferrals(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, func(o *Options) { o.ShareReferrals = true })
+	for i, name := range []string{"www.example.test", "www.other.test", "alias.example.test"} {
+		results, status := tr.traceDNS(context.Background(), name, "a", nil)
+		if status != StatusAnswer {
+			t.Fatalf("%s: status %v", name, status)
+		}
+		first := results[0]
+		if first.Zone != "." || first.Child != "test." {
+			t.Fatalf("%s: first level %s → %s, want . → test.", name, first.Zone, first.Child)
+		}
+		if fromCache := i > 0; first.FromCache != fromCache || len(first.Authorities) > 0 == fromCache {
+			t.Errorf("%s: first level from cache = %v with %d servers, want %v", name, first.FromCache, len(first.Authorities), fromCache)
+		}
+	}
+	if u := tr.Usage(); u.CacheHits < 2 || u.DiskHits != 0 || u.DiskMisses != 0 {
+		t.Errorf("usage %+v, want two cache hits and no disk cache counts", u)
+	}
+	if tr.diskCache.onDisk() {
+		t.Error("ShareReferrals without CacheDir uses a file")
+	}
+}
+
+// 已废弃的 Options.Log 仍然收到 Info 级别的日志；同时给出 Logger 时以 Logger 为准
+func TestDeprecatedLog(t *testing.T) {
+	n := newFakeNet(t, 0)
+	var log, other strings.Builder
+	tr := newFakeTracer(t, n, func(o *Options) { o.Log = &log })
+	tr.traceDNS(context.Background(), "www.example.test", "a", nil)
+	if !strings.Contains(log.String(), "processing level") || strings.Contains(log.String(), "level=DEBUG") {
+		t.Errorf("Options.Log got:\n%s", log.String())
+	}
+	log.Reset()
+	tr = newFakeTracer(t, n, func(o *Options) {
+		o.Log = &log
+		o.Logger = slog.New(slog.NewTextHandler(&other, nil))
+	})
+	tr.traceDNS(context.Background(), "www.example.test", "a", nil)
+	if log.Len() > 0 || other.Len() == 0 {
+		t.Errorf("with Logger set, Options.Log got %d bytes and Logger %d", log.Len(), other.Len())
+	}
+}
+
+// many.test. 的 12 台服务器同时返回 sub.many.test. 的委派，各个 goroutine 的 NS 和胶水在锁内合并；
+// 用 go test -race 运行时能发现合并时的数据竞争，同一个 Tracer 上的并发追踪还覆盖了共用的缓存
+func TestGetAuthoritiesManyNS(t *testing.T) {
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, func(o *Options) { o.Concurrency = 4 })
+	servers := make([]string, 12)
+	glue := make(glueAddrs)
+	for i, ip := range manyIPs(20, 12) {
+		servers[i] = fmt.Sprintf("ns%02d.many.test.", i+1)
+		glue[servers[i]] = []net.IP{net.ParseIP(ip)}
+	}
+	auths, nextNS, nextGlue, err := tr.getAuthorities(context.Background(), "www.sub.many.test.", "many.test.", servers, glue, dns.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auths) != len(servers) {
+		t.Errorf("got %d authorities, want %d", len(auths), len(servers))
+	}
+	for _, auth := range auths {
+		if len(auth.QueryResults) != 1 || auth.QueryResults[0].Referral != "sub.many.test." {
+			t.Errorf("%s: query results %+v, want one referral to sub.many.test.", auth.Hostname, auth.QueryResults)
+		}
+	}
+	if got := slices.Compact(slices.Sorted(slices.Values(nextNS))); !slices.Equal(got, []string{"ns.sub.many.test."}) {
+		t.Errorf("next NS = %v, want [ns.sub.many.test.]", got)
+	}
+	if got := nextGlue["ns.sub.many.test."]; len(got) == 0 || !got[0].Equal(net.ParseIP("127.0.53.10")) {
+		t.Errorf("next glue = %v, want 127.0.53.10", got)
+	}
+	for _, ip := range manyIPs(20, 12) {
+		if q := n.queries(ip); q == 0 {
+			t.Errorf("%s was not queried", ip)
+		}
+	}
+
+	done := make(chan []Result)
+	for range 8 {
+		go func() {
+			results, _ := tr.traceDNS(context.Background(), "www.sub.many.test", "a", nil)
+			done <- results
+		}()
+	}
+	for range 8 {
+		results := <-done
+		if got := zonePath(results); !slices.Equal(got, []string{".", "test.", "many.test.", "sub.many.test."}) {
+			t.Errorf("zones = %v", got)
+			continue
+		}
+		if got := len(results[2].Authorities); got != 12 {
+			t.Errorf("many.test. level has %d authorities, want 12", got)
+		}
+		if got := finalAnswers(results); !slices.Equal(got, []string{"192.0.2.51"}) {
+			t.Errorf("answers = %v, want [192.0.2.51]", got)
+		}
+	}
+}
+
+func TestNormalizeIPType(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "4", want: "4"},
+		{in: "6", want: "6"},
+		{in: "all", want: "all"},
+		{in: " ALL ", want: "all"},
+		{in: "4/6", want: "all"},
+		{in: "6/4", want: "all"},
+		{in: "4,6", want: "all"},
+		{in: "6,4", want: "all"},
+		{in: "ipv4", wantErr: true},
+		{in: "ipv6", wantErr: true},
+		{in: "v4", wantErr: true},
+		{in: "5", wantErr: true},
+		{in: "4/6/8", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeIPType(tt.in)
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("NormalizeIPType(%q) = %q, want an error", tt.in, got)
+		case tt.wantErr && !strings.Contains(err.Error(), "accepted values: 4, 6, all"):
+			t.Errorf("NormalizeIPType(%q) error %q does not list the accepted values", tt.in, err)
+		case !tt.wantErr && (err != nil || got != tt.want):
+			t.Errorf("NormalizeIPType(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateQueryTypes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []uint16
+	}{
+		{"a", []uint16{dns.TypeA}},
+		{"AAAA", []uint16{dns.TypeAAAA}},
+		{"a/aaaa", []uint16{dns.TypeA, dns.TypeAAAA}},
+		{"mx, txt", []uint16{dns.TypeMX, dns.TypeTXT}},
+		{"ns,soa,srv,caa,ptr", []uint16{dns.TypeNS, dns.TypeSOA, dns.TypeSRV, dns.TypeCAA, dns.TypePTR}},
+		{"https", []uint16{dns.TypeHTTPS}},
+		{"TYPE65", []uint16{65}},
+		{"type65534", []uint16{65534}},
+		{"any", []uint16{dns.TypeANY}},
+	}
+	for _, tt := range tests {
+		if err := ValidateQueryTypes(tt.in); err != nil {
+			t.Errorf("ValidateQueryTypes(%q) = %v", tt.in, err)
+		}
+		if got := parseQueryTypes(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parseQueryTypes(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", "/", "ipv4", "a/bogus", "TYPE70000", "TYPEx", "cname2"} {
+		err := ValidateQueryTypes(in)
+		if err == nil {
+			t.Errorf("ValidateQueryTypes(%q) accepted an unknown type", in)
+			continue
+		}
+		if !strings.Contains(err.Error(), "accepted values") {
+			t.Errorf("ValidateQueryTypes(%q) error %q does not list the accepted values", in, err)
+		}
+	}
+}
+
+// 以前 -iptype 写错时地址查询会落到 CNAME，所有 NS 都报告 no IP found；现在 New 直接拒绝，
+// 内部出现未知取值时也按 A 和 AAAA 查询
+func TestAddressTypes(t *testing.T) {
+	for iptype, want := range map[string][]uint16{
+		"4":    {dns.TypeA},
+		"6":    {dns.TypeAAAA},
+		"all":  {dns.TypeA, dns.TypeAAAA},
+		"ipv4": {dns.TypeA, dns.TypeAAAA},
+		"":     {dns.TypeA, dns.TypeAAAA},
+	} {
+		tr := &Tracer{iptype: iptype}
+		if got := tr.addressTypes(); !slices.Equal(got, want) {
+			t.Errorf("addressTypes(%q) = %v, want %v", iptype, got, want)
+		}
+	}
+	for _, tt := range []struct {
+		opts   Options
+		option string
+	}{
+		{Options{AddressFamily: "ipv4"}, "AddressFamily"},
+		{Options{AddressFamily: "4/6/8"}, "AddressFamily"},
+		{Options{QueryType: "a/bogus"}, "QueryType"},
+		{Options{QueryType: "TYPE70000"}, "QueryType"},
+		{Options{Network: "ipv6"}, "Network"},
+	} {
+		_, err := New(tt.opts)
+		var optErr *OptionError
+		if !errors.As(err, &optErr) || optErr.Option != tt.option {
+			t.Errorf("New(%+v) error = %v, want an OptionError for %s", tt.opts, err, tt.option)
+		}
+	}
+	n := newFakeNet(t, 0)
+	tr := newFakeTracer(t, n, func(o *Options) { o.AddressFamily = "all" })
+	results, status := tr.traceDNS(context.Background(), "www.other.test", "a", nil)
+	if status != StatusAnswer {
+		t.Fatalf("status = %v, want %v", status, StatusAnswer)
+	}
+	auth := results[len(results)-1].Authorities[0]
+	if auth.AddrSource != "recursor" || len(auth.IPs) != 1 || auth.IPs[0].String() != "127.0.53.9" {
+		t.Errorf("glueless NS looked up via %q as %v, want 127.0.53.9 via the recursor", auth.AddrSource, auth.IPs)
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"_dmarc.example.com", "example.com"},
+		{"_dmarc.example.com.", "example.com"},
+		{"_443._tcp.example.com", "example.com"},
+		{"_443._tcp.mail.example.com", "example.com"},
+		{"_acme-challenge.app.example.org", "example.org"},
+		{"selector._domainkey.example.com", "example.com"},
+		{"a.b.c.d.example.co.uk", "example.co.uk"},
+		{"www.a.b.c.example.com", "example.com"},
+		{"WWW.Example.COM", "example.com"},
+		{"example.com", "example.com"},
+		{"com", ""},
+		{"co.uk", ""},
+		{"_dmarc.co.uk", ""},
+		{"_tcp", ""},
+		{"4.3.2.1.in-addr.arpa", ""},
+		{".", ""},
+	}
+	for _, tt := range tests {
+		if got := registrableDomain(tt.name); got != tt.want {
+			t.Errorf("registrableDomain(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// 服务标签和很深的名字照常从根逐级追踪，查询名始终是完整的原始名字
+func TestTraceServiceNames(t *testing.T) {
+	for _, name := range []string{"_dmarc.example.test", "_443._tcp.www.example.test", "a.b.c.www.example.test"} {
+		t.Run(name, func(t *testing.T) {
+			n := newFakeNet(t, 0)
+			tr := newFakeTracer(t, n, nil)
+			results, status := tr.traceDNS(context.Background(), name, "txt", nil)
+			if status != StatusNXDomain {
+				t.Errorf("status = %v, want %v", status, StatusNXDomain)
+			}
+			if got := zonePath(results); !slices.Equal(got, []string{".", "test.", "example.test."}) {
+				t.Fatalf("zones = %v", got)
+			}
+			for _, res := range results {
+				if res.Domain != name+"." || res.Error != "" {
+					t.Errorf("level %d: domain %q error %q, want %q without error", res.Level, res.Domain, res.Error, name+".")
+				}
+			}
+			// 每一级的 TXT 查询都用完整的名字，NS 和胶水的核对查询不算在内
+			txt := 0
+			for _, q := range n.asked {
+				if q.Qtype != dns.TypeTXT {
+					continue
+				}
+				txt++
+				if !strings.EqualFold(q.Name, name+".") {
+					t.Errorf("asked %q, want the full name", q.Name)
+				}
+			}
+			if txt < 4 {
+				t.Errorf("%d TXT queries, want one per server on each level", txt)
+			}
+		})
+	}
+}
+
+// MX、SRV 按数字的优先级排列，按字符串比较时 100 会排在 20 前面
+func TestSortRecords(t *testing.T) {
+	rrs := func(s ...string) (out []dns.RR) {
+		for _, v := range s {
+			rr, err := dns.NewRR(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, rr)
+		}
+		return out
+	}
+	in := rrs(
+		"example.test. 300 IN MX 100 mx4.example.test.",
+		"example.test. 300 IN MX 20 mx1.example.test.",
+		"example.test. 300 IN MX 5 mx3.example.test.",
+		"_sip._tcp.example.test. 300 IN SRV 10 5 5060 b.example.test.",
+		"_sip._tcp.example.test. 300 IN SRV 10 60 5060 a.example.test.",
+		"_sip._tcp.example.test. 300 IN SRV 2 0 5060 c.example.test.",
+		"example.test. 300 IN MX 20 mx0.example.test.",
+		"www.example.test. 300 IN CNAME example.test.",
+	)
+	want := []string{
+		"example.test.",
+		"5 mx3.example.test.", "20 mx0.example.test.", "20 mx1.example.test.", "100 mx4.example.test.",
+		"2 0 5060 c.example.test.", "10 60 5060 a.example.test.", "10 5 5060 b.example.test.",
+	}
+	var got []string
+	for _, rr := range (&Tracer{}).sortRecords(in) {
+		s, _ := formatRecord(rr)
+		got = append(got, s)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted = %q\nwant     %q", got, want)
+	}
+	if got := (&Tracer{noSort: true}).sortRecords(in); !slices.Equal(got, in) {
+		t.Error("-no-sort reordered the answers")
+	}
+}
@@ -0,0 +1,791 @@
+// Package trace 从根区开始逐级追踪一个名字的 DNS 委派，记录每一级每台权威服务器的应答。
+// 用 New 创建 Tracer，再调用 Trace 或 Run；命令行工具 mdig 在 cmd/mdig。
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/proxy"
+)
+
+// Options 是创建 Tracer 的选项，零值字段使用和命令行相同的默认值
+type Options struct {
+	// Resolver 是查询 NS 地址用的递归服务器：host、host:port、tls://host[:port] 或 https:// 开头的 DoH 地址，默认 8.8.8.8
+	Resolver string
+	// FallbackResolvers 是 Resolver 超时或出现网络错误时依次改用的递归服务器；失败过的服务器在这个 Tracer 之后的查询里排到最后
+	FallbackResolvers []string
+	// FailoverOnServfail 时递归服务器返回 SERVFAIL 也换下一个服务器，默认 SERVFAIL 算作它的应答
+	FailoverOnServfail bool
+	// CompareResolvers 不为空时，Run 结束后向这些递归服务器查询同一个名字并和权威应答比较
+	CompareResolvers []string
+	// QueryType 是 Trace 查询的类型，多个类型用 , 或 / 分隔，默认 a/aaaa
+	QueryType string
+	// AddressFamily 决定查询 NS 的哪些地址：4、6 或 all（默认）
+	AddressFamily string
+	// NoHappyEyeballs 时双栈服务器的地址逐个查询，不再让 IPv6 和 IPv4 赛跑
+	NoHappyEyeballs bool
+	// Network 限制向权威服务器发送查询的地址族：4、6 或 any（默认）
+	Network string
+	// Timeout 是单个查询的超时，默认 3s
+	Timeout time.Duration
+	// KeepRecords 在每个 QueryResult.Records 里保留应答的原始记录，供导出等需要完整记录的用途
+	KeepRecords bool
+	// KeepMessages 在 Report.Exchanges 里按顺序保留发往权威服务器的每个查询和应答报文，供导出给其他分析工具
+	KeepMessages bool
+	// WarnRTT 不为 0 时把超时或 RTT 超过它的查询标为 Slow，并在 Report.Slow 里列出
+	WarnRTT time.Duration
+	// LevelTimeout 不为 0 时是每一级全部查询的总时限，用完后取消本级还没完成的查询，用已经收到的转介继续追踪
+	LevelTimeout time.Duration
+	// Retries 是查询超时或遇到网络错误后的重试次数
+	Retries int
+	// Concurrency 是每一级同时进行的查询数上限，默认 10
+	Concurrency int
+	// MaxDepth 是最多跟随的委派层数，默认 16
+	MaxDepth int
+	// MaxNS 限制每一级实际查询的服务器数，0 表示不限制；其余的服务器仍列在结果里，标为没有查询
+	MaxNS int
+	// NSSample 选择 MaxNS 时查询哪些服务器：first（默认）取排序后的前几台，random 随机选取
+	NSSample string
+	// Port 是权威服务器的端口，默认 53
+	Port int
+	// BufSize 是 EDNS0 通告的 UDP 缓冲区大小，默认 1232；NoEDNS 时查询不带 EDNS
+	BufSize uint16
+	NoEDNS  bool
+	// DNSSEC 在查询里设置 DO 位；Validate 从根开始校验信任链（隐含 DNSSEC），TrustAnchors 为空时使用内置的根区 KSK
+	DNSSEC       bool
+	Validate     bool
+	TrustAnchors []*dns.DS
+	// DelegationKeys 在每个区切分处取父域的 DS 和子域的 DNSKEY
+	DelegationKeys bool
+	// RRSIGWarn 是签名过期的预警时间，带 DO 位查询时在这个时间内过期的 RRSIG 会被列出，0 时只列出已经过期的
+	RRSIGWarn time.Duration
+	// Diff 比较最终一级各权威服务器的应答
+	Diff bool
+	// Fast 时每一级并发查询各服务器，拿到第一个可用的转介或权威应答就取消其余查询继续下一级，
+	// 结果里只有实际走过的服务器；这时不再比较父子区的 NS 和胶水
+	Fast bool
+	// Tree 在追踪之后沿每台服务器各自的转介分别往下查询，生成 Report.Tree；
+	// 委派一致时树只比平铺的追踪多出很少的查询
+	Tree bool
+	// Health 在追踪和已启用的检查之后给出总体判断（healthy、degraded、broken）、问题列表和分数，见 Report.Health
+	Health bool
+	// QMin 按 RFC 9156 做查询名最小化：每一级只向服务器询问比所在区多一个标签的名字的 NS，
+	// 到了完整的名字才用原来的查询类型；中间的名字不是区切分（空非终端或没有 NS）时加一个标签再问
+	QMin bool
+	// Rank 按 RTT 给每一级的服务器排序，并估算每级都选最快服务器时的总耗时
+	Rank bool
+	// CheckSerial 向名字所在区的每台权威服务器查询 SOA，比较各自的 serial
+	CheckSerial bool
+	// CheckAXFR 通过 TCP 向区的每台权威服务器请求区传送，只报告是否被拒绝和记录数
+	CheckAXFR bool
+	// CheckRecursion 向追踪经过的每台权威服务器发送 RD=1 的区外查询，找出开放递归的服务器
+	CheckRecursion bool
+	// CheckEDNS 向区的每台权威服务器发送一组 EDNS 测试查询，检查服务器是否正确处理 EDNS
+	CheckEDNS bool
+	// CheckTCP 把追踪里每个走 UDP 的查询用 TCP 再发一次，找出只能用 UDP 访问的服务器
+	CheckTCP bool
+	// CheckV6 检查区的每台权威服务器是否有 AAAA 记录、能否通过 IPv6 查询，不受 IPType 和 Network 限制
+	CheckV6 bool
+	// CheckDiversity 按 /24、/48 前缀和起源 AS 比较区的权威服务器的地址，所有服务器（或只差一台）集中在一处时给出警告
+	CheckDiversity bool
+	// NoASN 时 CheckDiversity 不查询起源 AS，只比较前缀
+	NoASN bool
+	// CheckRFC2182 按 RFC 2182 的基本建议检查区的委派：NS 数量、是否同一台主机、是否有区外的 NS、NS 是否指向 CNAME
+	CheckRFC2182 bool
+	// CheckHijack 向 Resolver 和 FallbackResolvers 查询追踪的名字，和权威应答比较，发现被篡改、重定向或过滤的应答
+	CheckHijack bool
+	// CheckWildcard 用同一父域下的随机标签重复最终一级的查询，判断应答是否来自通配符
+	CheckWildcard bool
+	// Count 大于 0 时向最终一级的每个服务器 IP 发送这么多个相同的查询，统计丢包和 RTT，不影响追踪本身
+	Count int
+	// CountInterval 是 Count 的相邻两次查询之间的间隔，0 表示 1 秒
+	CountInterval time.Duration
+	// Verify 是最终一级每个查询额外重复发送的次数，用来发现被篡改或不稳定的应答，0 表示不重复
+	Verify int
+	// CheckTTL 在每一级比较同一 RRset 在各台服务器上的 TTL，并检查委派 NS 和区顶点记录的 TTL 是否在 TTLMin 和 TTLMax 之间；
+	// TTLMax 为 0 时不检查上限
+	CheckTTL bool
+	TTLMin   time.Duration
+	TTLMax   time.Duration
+	// Propagation 汇总名字所在区的父域 NS、子域 NS 和胶水的 TTL，估算更换 NS 后旧数据最多还会被使用多久
+	Propagation bool
+	// TCP 让所有查询都走 TCP；IgnoreTC 时截断的 UDP 应答不再用 TCP 重试
+	TCP      bool
+	IgnoreTC bool
+	// NoTCPRecovery 时无法解析或为 FORMERR/NOTIMP 的 UDP 应答不再用 TCP 重试，用于诊断路径上的问题
+	NoTCPRecovery bool
+	// Cookies 发送 DNS Cookie（RFC 7873），NSID 请求服务器返回实例标识
+	Cookies bool
+	NSID    bool
+	// EDNSOptions 是附加到每个查询 OPT 记录的任意选项，写法同 dig 的 +ednsopt：code[:hexvalue]，例如 65001:c0ffee
+	EDNSOptions []string
+	// Subnet 是附带的 EDNS Client Subnet 前缀，例如 203.0.113.0/24
+	Subnet string
+	// NoDNS64Check 时不再识别 -dns 服务器合成的 DNS64 地址（64:ff9b::/96 和通过 ipv4only.arpa 发现的前缀），
+	// 合成的 AAAA 当作服务器真实的地址使用
+	NoDNS64Check bool
+	// ECSProbe 是一组 EDNS Client Subnet 前缀，向最终一级的每个服务器 IP 分别以每个前缀查询一次，
+	// 比较不同地区的客户端得到的应答；查询数是前缀数乘以服务器 IP 数，受 QPS 限制
+	ECSProbe []string
+	// Use0x20 随机化查询名的大小写，并检查服务器是否原样返回
+	Use0x20 bool
+	// Source 和 Source6 是发送查询使用的源地址
+	Source  string
+	Source6 string
+	// Proxy 是 socks5://[user:pass@]host:port 形式的 SOCKS5 代理，所有查询（包括 DoT、DoH 的 -dns 服务器）
+	// 都通过它以 TCP 发出，相当于设置了 TCP；不能和 Source、Source6 同时使用。自定义 Exchanger 不经过代理
+	Proxy string
+	// QPS 限制这个 Tracer 每秒发出的查询数，0 表示不限制
+	QPS float64
+	// NoRecursor 时从根迭代解析没有胶水的 NS 地址，不经过 Resolver
+	NoRecursor bool
+	// CheckingDisabled 在发往 Resolver 的地址查询里设置 CD 位，即使它验证失败也能拿到地址
+	CheckingDisabled bool
+	// RecursionDesired 在发往权威服务器的查询里设置 RD 位
+	RecursionDesired bool
+	// NoSort 保留服务器和记录的到达顺序
+	NoSort bool
+	// Identify 向每台服务器发送 CHAOS TXT 身份查询
+	Identify bool
+	// PTRNames 为每个联系过的权威服务器 IP 通过 Resolver 查询 PTR，结果放在 AuthorityServer.PTRNames；
+	// 查询在每一级完成时于后台发出，不拖慢追踪，查不到时不记录
+	PTRNames bool
+	// CacheDir 不为空时在这个目录里保存根区给出的顶级域转介和根服务器的地址，下次运行时直接使用，按记录的 TTL 过期
+	CacheDir string
+	// ShareReferrals 在 CacheDir 为空时把根区给出的顶级域转介只保存在内存里，同一个 Tracer 之后追踪的目标按 TTL 直接从顶级域开始，
+	// 一次追踪多个域名时不必为每个域名重复查询根服务器
+	ShareReferrals bool
+	// HintsFile 是 named.root 格式的根提示文件，为空时使用内置的根服务器
+	HintsFile string
+	// Roots 选择第一级查询哪些根服务器：数字表示随机选这么多台，或者逗号分隔的字母（a,k,m）或主机名；为空时全部查询
+	Roots string
+	// From 让追踪从这个区开始：zone，或 zone=ns1,ns2 直接给出它的服务器
+	From string
+	// Servers 不为空时不做追踪，直接向这些服务器（主机名或 IP）查询，结果只有一级
+	Servers []string
+	// Exchanger 替换发送查询的方式，为 nil 时直接通过网络发送
+	Exchanger Exchanger
+	// Logger 接收追踪过程的日志，每条都带上 domain、zone 或 level、server，并发追踪时也能分清；为 nil 时丢弃。
+	// Info 是每一级的进度和导致追踪停止的失败，Debug 还包括每个发出的查询和收到的应答
+	Logger *slog.Logger
+	// Log 接收 Info 级别的文本日志，只在 Logger 为 nil 时使用。
+	//
+	// Deprecated: 使用 Logger。
+	Log io.Writer
+	// OnQuery 在每次查询权威服务器之后调用，zone 是这一级负责的区，host 是服务器名；会被并发调用
+	OnQuery func(zone, host string, qr QueryResult)
+	// OnEvent 接收查询发出、应答收到、追踪完成等事件；会被并发调用
+	OnEvent func(Event)
+}
+
+// OptionError 说明 Options 里哪个字段无效
+type OptionError struct {
+	Option string
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Option, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// Tracer 保存追踪用的选项，以及在多次追踪之间共用的状态（NS 地址缓存、已知的区切分、服务器 cookie 等）。
+// 同一个 Tracer 可以并发追踪多个名字，不同的 Tracer 之间互不影响
+type Tracer struct {
+	bootstrap        *bootstrapResolver
+	bootstraps       []*bootstrapResolver
+	failoverServfail bool
+	resolvers        []*bootstrapResolver
+	qtypes           string
+	iptype           string
+	netFamily        string
+	queryTimeout     time.Duration
+	warnRTT          time.Duration
+	levelTimeout     time.Duration
+	keepRecords      bool
+	keepMessages     bool
+	retries          int
+	concurrency      int
+	maxDepth         int
+	maxNS            int
+	nsSample         string
+	port             int
+	bufsize          uint
+	dnssec           bool
+	validate         bool
+	trustAnchors     []*dns.DS
+	showDS           bool
+	diffMode         bool
+	rank             bool
+	fast             bool
+	qmin             bool
+	tree             bool
+	health           bool
+	serialCheck      bool
+	axfrCheck        bool
+	recursionCheck   bool
+	ednsCheck        bool
+	tcpCheck         bool
+	v6Check          bool
+	diversityCheck   bool
+	noASN            bool
+	rfc2182Check     bool
+	hijackCheck      bool
+	asns             *asnCache
+	wildcardCheck    bool
+	verify           int
+	count            int
+	countInterval    time.Duration
+	ttlCheck         bool
+	ttlMin           time.Duration
+	ttlMax           time.Duration
+	propagation      bool
+	rrsigWarn        time.Duration
+	forceTCP         bool
+	ignoreTC         bool
+	noTCPRecovery    bool
+	noHappyEyeballs  bool
+	cookies          *cookieJar
+	nsid             bool
+	ecsOption        *dns.EDNS0_SUBNET
+	ednsOptions      []*dns.EDNS0_LOCAL
+	ecsProbe         []*dns.EDNS0_SUBNET
+	use0x20          bool
+	source4          net.IP
+	source6          net.IP
+	proxy            proxy.ContextDialer
+	proxyName        string
+	qps              float64
+	limiter          *rateLimiter
+	usage            *usageMeter
+	noDNS64Check     bool
+	dns64Mu          sync.Mutex
+	dns64Warn        sync.Once
+	// dns64 是发现到的 DNS64 前缀，发现成功之前为 nil
+	dns64 []netip.Prefix
+	// serverRoles 记录 queryServer 查询过的服务器 IP 属于哪一类（根、顶级域或权威），用于 Usage 的分类
+	serverRoles      sync.Map
+	noRecursor       bool
+	checkingDisabled bool
+	recursionDesired bool
+	noSort           bool
+	identify         bool
+	hintsFile        string
+	rootsNote        string
+	rootHints        []string
+	rootHintAddrs    map[string][]string
+	nsAddrCache      *addrCache
+	diskCache        *diskCache
+	ptrNames         *ptrCache
+	zoneCuts         *zoneCutCache
+	fromZone         string
+	fromServers      []string
+	servers          []string
+	serverGlue       glueAddrs
+	fromGlue         glueAddrs
+	fromOnce         sync.Once
+	fromErr          error
+	exchanger        Exchanger
+	pool             *connPool
+	logger           *slog.Logger
+	onQuery          func(zone, host string, qr QueryResult)
+	onEvent          func(Event)
+}
+
+// New 检查 opts 并创建 Tracer；需要网络的初始化留到 Prepare 或第一次追踪时进行
+func New(opts Options) (*Tracer, error) {
+	tr := &Tracer{
+		usage:            newUsageMeter(),
+		noDNS64Check:     opts.NoDNS64Check,
+		qtypes:           opts.QueryType,
+		iptype:           opts.AddressFamily,
+		netFamily:        opts.Network,
+		queryTimeout:     opts.Timeout,
+		warnRTT:          opts.WarnRTT,
+		levelTimeout:     opts.LevelTimeout,
+		keepRecords:      opts.KeepRecords,
+		keepMessages:     opts.KeepMessages,
+		retries:          opts.Retries,
+		concurrency:      opts.Concurrency,
+		maxDepth:         opts.MaxDepth,
+		maxNS:            opts.MaxNS,
+		nsSample:         opts.NSSample,
+		port:             opts.Port,
+		bufsize:          uint(opts.BufSize),
+		dnssec:           opts.DNSSEC || opts.Validate,
+		validate:         opts.Validate,
+		trustAnchors:     opts.TrustAnchors,
+		showDS:           opts.DelegationKeys,
+		diffMode:         opts.Diff,
+		rank:             opts.Rank,
+		fast:             opts.Fast,
+		tree:             opts.Tree,
+		health:           opts.Health,
+		qmin:             opts.QMin,
+		serialCheck:      opts.CheckSerial,
+		axfrCheck:        opts.CheckAXFR,
+		recursionCheck:   opts.CheckRecursion,
+		ednsCheck:        opts.CheckEDNS,
+		tcpCheck:         opts.CheckTCP,
+		v6Check:          opts.CheckV6,
+		diversityCheck:   opts.CheckDiversity,
+		noASN:            opts.NoASN,
+		rfc2182Check:     opts.CheckRFC2182,
+		hijackCheck:      opts.CheckHijack,
+		asns:             &asnCache{entries: make(map[string]*asnLookup)},
+		wildcardCheck:    opts.CheckWildcard,
+		verify:           opts.Verify,
+		count:            opts.Count,
+		countInterval:    opts.CountInterval,
+		ttlCheck:         opts.CheckTTL,
+		ttlMin:           opts.TTLMin,
+		ttlMax:           opts.TTLMax,
+		propagation:      opts.Propagation,
+		rrsigWarn:        opts.RRSIGWarn,
+		forceTCP:         opts.TCP,
+		ignoreTC:         opts.IgnoreTC,
+		noTCPRecovery:    opts.NoTCPRecovery,
+		noHappyEyeballs:  opts.NoHappyEyeballs,
+		nsid:             opts.NSID,
+		use0x20:          opts.Use0x20,
+		qps:              opts.QPS,
+		noRecursor:       opts.NoRecursor,
+		checkingDisabled: opts.CheckingDisabled,
+		recursionDesired: opts.RecursionDesired,
+		noSort:           opts.NoSort,
+		identify:         opts.Identify,
+		hintsFile:        opts.HintsFile,
+		rootHints:        defaultRootHints,
+		rootHintAddrs:    defaultRootHintAddrs,
+		nsAddrCache:      &addrCache{entries: make(map[addrKey]*addrEntry)},
+		zoneCuts:         &zoneCutCache{cuts: make(map[string]zoneServers)},
+		logger:           opts.Logger,
+		onQuery:          opts.OnQuery,
+		onEvent:          opts.OnEvent,
+	}
+	if tr.qtypes == "" {
+		tr.qtypes = "a/aaaa"
+	}
+	if tr.iptype == "" {
+		tr.iptype = "all"
+	}
+	if tr.netFamily == "" {
+		tr.netFamily = "any"
+	}
+	if tr.queryTimeout == 0 {
+		tr.queryTimeout = 3 * time.Second
+	}
+	if tr.concurrency == 0 {
+		tr.concurrency = 10
+	}
+	if tr.countInterval == 0 {
+		tr.countInterval = time.Second
+	}
+	if tr.maxDepth == 0 {
+		tr.maxDepth = 16
+	}
+	if tr.port == 0 {
+		tr.port = 53
+	}
+	if tr.bufsize == 0 {
+		tr.bufsize = 1232
+	}
+	if opts.NoEDNS {
+		tr.bufsize = 0
+	}
+	if tr.logger == nil {
+		out := opts.Log
+		if out == nil {
+			out = io.Discard
+		}
+		tr.logger = slog.New(slog.NewTextHandler(out, nil))
+	}
+	tr.exchanger = opts.Exchanger
+	if tr.exchanger == nil {
+		tr.pool = newConnPool(tr)
+		tr.exchanger = clientExchanger{tr, tr.pool}
+	}
+
+	var err error
+	if tr.iptype, err = NormalizeIPType(tr.iptype); err != nil {
+		return nil, &OptionError{"AddressFamily", err}
+	}
+	if err := ValidateQueryTypes(tr.qtypes); err != nil {
+		return nil, &OptionError{"QueryType", err}
+	}
+	switch {
+	case tr.netFamily != "4" && tr.netFamily != "6" && tr.netFamily != "any":
+		return nil, &OptionError{"Network", fmt.Errorf("%q is not 4, 6 or any", tr.netFamily)}
+	case tr.queryTimeout < 0:
+		return nil, &OptionError{"Timeout", errors.New("must be positive")}
+	case tr.warnRTT < 0:
+		return nil, &OptionError{"WarnRTT", errors.New("cannot be negative")}
+	case tr.levelTimeout < 0:
+		return nil, &OptionError{"LevelTimeout", errors.New("cannot be negative")}
+	case tr.retries < 0:
+		return nil, &OptionError{"Retries", errors.New("cannot be negative")}
+	case tr.concurrency < 0:
+		return nil, &OptionError{"Concurrency", errors.New("cannot be negative")}
+	case tr.maxDepth < 0:
+		return nil, &OptionError{"MaxDepth", errors.New("cannot be negative")}
+	case tr.maxNS < 0:
+		return nil, &OptionError{"MaxNS", errors.New("cannot be negative")}
+	case tr.nsSample != "" && tr.nsSample != "first" && tr.nsSample != "random":
+		return nil, &OptionError{"NSSample", fmt.Errorf("%q is not first or random", tr.nsSample)}
+	case tr.port < 0 || tr.port > 65535:
+		return nil, &OptionError{"Port", errors.New("must be between 1 and 65535")}
+	case tr.qps < 0:
+		return nil, &OptionError{"QPS", errors.New("cannot be negative")}
+	case tr.verify < 0:
+		return nil, &OptionError{"Verify", errors.New("cannot be negative")}
+	case tr.count < 0:
+		return nil, &OptionError{"Count", errors.New("cannot be negative")}
+	case tr.countInterval < 0:
+		return nil, &OptionError{"CountInterval", errors.New("cannot be negative")}
+	case tr.rrsigWarn < 0:
+		return nil, &OptionError{"RRSIGWarn", errors.New("cannot be negative")}
+	case tr.ttlMin < 0:
+		return nil, &OptionError{"TTLMin", errors.New("cannot be negative")}
+	case tr.ttlMax < 0:
+		return nil, &OptionError{"TTLMax", errors.New("cannot be negative")}
+	case tr.ttlMax > 0 && tr.ttlMin > tr.ttlMax:
+		return nil, &OptionError{"TTLMin", errors.New("is greater than TTLMax")}
+	case tr.tree && tr.fast:
+		return nil, &OptionError{"Tree", errors.New("cannot be combined with Fast, which follows only one referral per level")}
+	case opts.NoEDNS && (tr.dnssec || opts.NSID || opts.Subnet != "" || len(opts.ECSProbe) > 0 || opts.Cookies || len(opts.EDNSOptions) > 0):
+		return nil, &OptionError{"NoEDNS", errors.New("DNSSEC, NSID, Subnet, ECSProbe, Cookies and EDNSOptions need EDNS")}
+	}
+	if err := tr.parseSources(opts.Source, opts.Source6); err != nil {
+		return nil, &OptionError{"Source", err}
+	}
+	if opts.Proxy != "" {
+		if opts.Source != "" || opts.Source6 != "" {
+			return nil, &OptionError{"Proxy", errors.New("cannot be combined with Source or Source6, the proxy chooses the source address")}
+		}
+		if tr.proxy, tr.proxyName, err = parseProxy(opts.Proxy); err != nil {
+			return nil, &OptionError{"Proxy", err}
+		}
+		tr.forceTCP = true
+	}
+	resolver := opts.Resolver
+	if resolver == "" {
+		resolver = "8.8.8.8"
+	}
+	if tr.bootstrap, err = tr.newBootstrapResolver(resolver); err != nil {
+		return nil, &OptionError{"Resolver", err}
+	}
+	tr.bootstraps = []*bootstrapResolver{tr.bootstrap}
+	for _, spec := range opts.FallbackResolvers {
+		r, err := tr.newBootstrapResolver(spec)
+		if err != nil {
+			return nil, &OptionError{"FallbackResolvers", err}
+		}
+		tr.bootstraps = append(tr.bootstraps, r)
+	}
+	tr.failoverServfail = opts.FailoverOnServfail
+	for _, spec := range opts.CompareResolvers {
+		r, err := tr.newBootstrapResolver(spec)
+		if err != nil {
+			return nil, &OptionError{"CompareResolvers", err}
+		}
+		tr.resolvers = append(tr.resolvers, r)
+	}
+	if tr.qps > 0 {
+		tr.limiter = newRateLimiter(tr.qps)
+	}
+	if tr.validate && tr.trustAnchors == nil {
+		if tr.trustAnchors, err = LoadTrustAnchors(""); err != nil {
+			return nil, &OptionError{"TrustAnchors", err}
+		}
+	}
+	if opts.Subnet != "" {
+		if tr.ecsOption, err = ParseSubnet(opts.Subnet); err != nil {
+			return nil, &OptionError{"Subnet", err}
+		}
+	}
+	for _, prefix := range opts.ECSProbe {
+		e, err := ParseSubnet(prefix)
+		if err != nil {
+			return nil, &OptionError{"ECSProbe", err}
+		}
+		tr.ecsProbe = append(tr.ecsProbe, e)
+	}
+	if err := tr.parseEDNSOptions(opts.EDNSOptions, opts.NSID, opts.Subnet != "", len(opts.ECSProbe) > 0, opts.Cookies); err != nil {
+		return nil, &OptionError{"EDNSOptions", err}
+	}
+	if opts.Cookies {
+		if tr.cookies, err = newCookieJar(); err != nil {
+			return nil, &OptionError{"Cookies", fmt.Errorf("cannot generate client cookie: %v", err)}
+		}
+	}
+	if tr.hintsFile != "" {
+		if err := tr.loadRootHints(tr.hintsFile); err != nil {
+			return nil, &OptionError{"HintsFile", err}
+		}
+	}
+	if opts.Roots != "" {
+		if tr.rootHints, err = selectRoots(opts.Roots, tr.rootHints); err != nil {
+			return nil, &OptionError{"Roots", err}
+		}
+		// 随机选取时记下选中的字母，用 -roots a,k,m 可以重现同样的追踪
+		letters := make([]string, len(tr.rootHints))
+		for i, h := range tr.rootHints {
+			letters[i] = rootLetter(h)
+		}
+		tr.rootsNote = fmt.Sprintf("using root servers %s (reproduce with -roots %s)", strings.Join(tr.rootHints, ", "), strings.Join(letters, ","))
+		tr.logger.Info("selected root servers", "roots", strings.Join(letters, ","))
+	}
+	if opts.From != "" {
+		if err := tr.parseFrom(opts.From); err != nil {
+			return nil, &OptionError{"From", err}
+		}
+		switch {
+		case tr.validate:
+			return nil, &OptionError{"From", errors.New("Validate builds the chain of trust from the root and cannot start at another zone")}
+		case tr.noRecursor && len(tr.fromServers) == 0:
+			return nil, &OptionError{"From", errors.New("NoRecursor needs the nameservers of the zone (zone=ns1,ns2)")}
+		}
+	}
+	switch {
+	case opts.CacheDir != "":
+		tr.diskCache = tr.openDiskCache(opts.CacheDir)
+	case opts.ShareReferrals:
+		tr.diskCache = newMemoryCache(tr.logger)
+	}
+	if opts.PTRNames {
+		if tr.noRecursor {
+			return nil, &OptionError{"PTRNames", errors.New("looks the names up via Resolver and cannot be combined with NoRecursor")}
+		}
+		tr.ptrNames = newPTRCache()
+	}
+	if len(opts.Servers) > 0 {
+		if tr.servers, tr.serverGlue, err = parseServerList(opts.Servers); err != nil {
+			return nil, &OptionError{"Servers", err}
+		}
+		switch {
+		case len(tr.servers) == 0:
+			return nil, &OptionError{"Servers", errors.New("needs at least one nameserver")}
+		case opts.From != "":
+			return nil, &OptionError{"Servers", errors.New("queries the listed servers directly and cannot be combined with From")}
+		case tr.validate:
+			return nil, &OptionError{"Servers", errors.New("Validate builds the chain of trust from the root and needs a full trace")}
+		}
+	}
+	return tr, nil
+}
+
+// Prepare 完成需要网络的初始化：From 没有给出服务器时通过 Resolver 查询起始区的 NS。
+// 追踪会在需要时自动调用它，单独调用可以在开始追踪前发现问题
+func (tr *Tracer) Prepare(ctx context.Context) error {
+	if tr.fromZone == "" {
+		return nil
+	}
+	tr.fromOnce.Do(func() {
+		tr.fromErr = tr.lookupFromServers(ctx)
+	})
+	return tr.fromErr
+}
+
+// StartZone 返回追踪开始的区，没有设置 From 时是根
+func (tr *Tracer) StartZone() string {
+	if tr.fromZone == "" {
+		return "."
+	}
+	return tr.fromZone
+}
+
+// Close 关闭 Tracer 共用的 UDP 套接字和空闲的 TCP 连接。用完的 Tracer 应当关闭，
+// 否则套接字要等空闲超时后才释放；关闭后再追踪会重新建立连接
+func (tr *Tracer) Close() {
+	if tr.pool != nil {
+		tr.pool.close()
+	}
+}
+
+// ResolverAddr 返回查询 NS 地址用的递归服务器地址
+func (tr *Tracer) ResolverAddr() string {
+	return tr.bootstrap.addr
+}
+
+// Run 追踪 domain 的 types 类型（为空时使用 QueryType）并生成完整的报告，包括 CNAME 链、
+// 应答差异和递归服务器比较；emit 不为 nil 时每完成一级就调用一次
+func (tr *Tracer) Run(ctx context.Context, domain, types string, emit func(Result)) (Report, Status) {
+	if types == "" {
+		types = tr.qtypes
+	}
+	report := Report{Domain: domain}
+	if u := ToUnicode(domain); u != domain {
+		report.UnicodeDomain = u
+	}
+	ctx, usage := withUsage(ctx)
+	if err := tr.Prepare(ctx); err != nil {
+		report.Results = []Result{{Domain: domain, Error: fmt.Sprintf("cannot start at %s: %v", tr.fromZone, err), Code: ErrNoAuthority}}
+		report.Usage = usage.snapshot()
+		return report, StatusNetworkError
+	}
+	var ts *transcript
+	if tr.keepMessages {
+		ctx, ts = withTranscript(ctx)
+	}
+	var results []Result
+	var status Status
+	var chain []CNAMEHop
+	var chainErr string
+	if len(tr.servers) > 0 {
+		results, status = tr.queryDirect(ctx, domain, types, emit)
+	} else {
+		results, status, chain, chainErr = tr.traceCNAMEChain(ctx, domain, types, emit)
+	}
+	if tr.ptrNames != nil {
+		// 反向解析在查询各服务器时就已经开始；这里先补上没经过 queryServer 的 IP，再一起等待，总共最多等 ptrTimeout
+		for _, res := range results {
+			tr.startReverseLookups(ctx, res)
+		}
+		for i := range results {
+			tr.ReverseNames(ctx, &results[i])
+		}
+	}
+	ev := Event{Event: "trace_complete", Domain: domain, Levels: len(results)}
+	if len(results) > 0 {
+		ev.Error = results[len(results)-1].Error
+	}
+	tr.emitEvent(ev)
+	report.Results, report.Summary = results, summarize(results)
+	report.CNAMEChain, report.CNAMEError = chain, chainErr
+	if tr.diffMode {
+		report.Diff = diffAnswers(results)
+	}
+	if tr.rank {
+		report.Rank = rankLatency(results)
+	}
+	if tr.tree && len(results) > 0 && ctx.Err() == nil {
+		report.Tree = tr.buildTree(ctx, domain, parseQueryTypes(types)[0], results)
+	}
+	if tr.dnssec {
+		report.RRSIGExpiry = tr.checkSigExpiry(results, time.Now())
+	}
+	if tr.ttlCheck {
+		report.TTL = tr.checkTTL(results)
+	}
+	if tr.diskCache != nil {
+		tr.diskCache.save()
+	}
+	if tr.propagation && ctx.Err() == nil {
+		report.Propagation = tr.checkPropagation(ctx, domain, results)
+	}
+	if tr.serialCheck && ctx.Err() == nil {
+		report.Serial = tr.checkSerial(ctx, domain, results)
+	}
+	if tr.axfrCheck && ctx.Err() == nil {
+		report.AXFR = tr.checkAXFR(ctx, domain, results)
+	}
+	if tr.recursionCheck && ctx.Err() == nil {
+		report.Recursion = tr.checkRecursion(ctx, results)
+	}
+	if tr.ednsCheck && ctx.Err() == nil {
+		report.EDNS = tr.checkEDNS(ctx, domain, results)
+	}
+	if tr.tcpCheck && ctx.Err() == nil {
+		report.TCP = tr.checkTCP(ctx, results)
+	}
+	if tr.v6Check && ctx.Err() == nil {
+		report.IPv6 = tr.checkV6(ctx, domain, results)
+	}
+	if tr.diversityCheck && ctx.Err() == nil {
+		report.Diversity = tr.checkDiversity(ctx, domain, results)
+	}
+	if tr.rfc2182Check && ctx.Err() == nil {
+		report.RFC2182 = tr.checkRFC2182(ctx, domain, results)
+	}
+	if tr.wildcardCheck && ctx.Err() == nil {
+		report.Wildcard = tr.checkWildcard(ctx, domain, results)
+	}
+	if tr.verify > 0 && ctx.Err() == nil {
+		report.Verify = tr.verifyAnswers(ctx, domain, results)
+	}
+	if tr.count > 0 && ctx.Err() == nil {
+		report.Probe = tr.probeServers(ctx, domain, results)
+	}
+	if len(tr.ecsProbe) > 0 && ctx.Err() == nil {
+		report.ECSProbe = tr.probeSubnets(ctx, domain, results)
+	}
+	if len(tr.resolvers) > 0 && ctx.Err() == nil {
+		report.Resolvers = tr.compareResolvers(ctx, domain, types, report, status)
+	}
+	if tr.hijackCheck && ctx.Err() == nil {
+		report.Hijack = tr.checkHijack(ctx, domain, types, report, status)
+	}
+	report.Dangling = tr.findDangling(ctx, results)
+	report.DelegationGlue = classifyGlue(results, tr.StartZone())
+	if tr.warnRTT > 0 {
+		report.Slow = collectSlow(results, tr.warnRTT)
+	}
+	if tr.health {
+		report.Health = assessHealth(report, status)
+	}
+	report.Exchanges = ts.list()
+	report.Usage = usage.snapshot()
+	report.Rate = tr.newQueryRate(report.Usage)
+	for _, res := range results {
+		if res.BudgetExceeded {
+			report.Rate.BudgetHits++
+		}
+	}
+	return report, status
+}
+
+// Error 是 Trace 没有得到应答时返回的错误
+type Error struct {
+	Status Status
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Trace 从根（或 From 指定的区）开始逐级追踪 domain 的 QueryType 记录，返回每一级的结果；
+// 追踪没有以应答结束（NXDOMAIN、NODATA、网络错误等）时同时返回 *Error
+func (tr *Tracer) Trace(ctx context.Context, domain string) ([]Result, error) {
+	report, status := tr.Run(ctx, domain, "", nil)
+	if status == StatusAnswer {
+		return report.Results, nil
+	}
+	msg := status.String()
+	if n := len(report.Results); n > 0 && report.Results[n-1].Error != "" {
+		msg = report.Results[n-1].Error
+	}
+	return report.Results, &Error{Status: status, Msg: msg}
+}
+
+// Requery 重新向 ip 发出 res 这一级的一个查询（qtype 是 QueryResult.Qtype），应答和追踪时一样解析；
+// 不会改变 res，也不继续追踪下一级
+func (tr *Tracer) Requery(ctx context.Context, res Result, ip, qtype string) (QueryResult, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return QueryResult{}, fmt.Errorf("invalid server address %q", ip)
+	}
+	t, ok := parseQueryType(qtype)
+	if !ok {
+		return QueryResult{}, fmt.Errorf("unknown query type %q", qtype)
+	}
+	name := res.Domain
+	if res.QName != "" {
+		name = res.QName
+	}
+	qr, _ := tr.queryServer(ctx, name, res.Zone, addr, t)
+	return qr, nil
+}
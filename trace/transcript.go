@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Exchange 是设置了 Options.KeepMessages 时记下的一次权威查询：实际发出的查询报文（含 0x20 大小写、EDNS 选项）、
+// 收到的应答和时间，用于把追踪原样交给其他工具分析
+type Exchange struct {
+	Start  time.Time
+	Server string
+	Query  *dns.Msg
+	// Response 是最后一次尝试收到的应答，没有应答时为 nil，Error 给出原因
+	Response *dns.Msg
+	RTT      time.Duration
+	Protocol string
+	Error    string
+	TimedOut bool
+}
+
+// transcript 收集一次 Run 里的全部 Exchange；放在 ctx 里，同一个 Tracer 上并发的 Run 各记各的
+type transcript struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+type transcriptKey struct{}
+
+func withTranscript(ctx context.Context) (context.Context, *transcript) {
+	ts := &transcript{}
+	return context.WithValue(ctx, transcriptKey{}, ts), ts
+}
+
+func transcriptFrom(ctx context.Context) *transcript {
+	ts, _ := ctx.Value(transcriptKey{}).(*transcript)
+	return ts
+}
+
+func (ts *transcript) add(ex Exchange) {
+	ts.mu.Lock()
+	ts.exchanges = append(ts.exchanges, ex)
+	ts.mu.Unlock()
+}
+
+// list 按发出的先后返回记下的查询，ts 为 nil（没有设置 Options.KeepMessages）时返回 nil
+func (ts *transcript) list() []Exchange {
+	if ts == nil {
+		return nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	out := make([]Exchange, len(ts.exchanges))
+	copy(out, ts.exchanges)
+	slices.SortStableFunc(out, func(a, b Exchange) int { return a.Start.Compare(b.Start) })
+	return out
+}
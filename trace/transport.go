@@ -0,0 +1,306 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Exchanger 向 addr 发送一个查询并等待应答，network 是 "udp" 或 "tcp"，超时由 ctx 的截止时间决定。
+// 所有发往权威服务器和 Resolver（DNS-over-TLS、DoH 除外）的查询都经过它，区传送检查除外，Options.Exchanger 可以替换成
+// 不访问网络的实现，例如进程内的假服务器
+type Exchanger interface {
+	Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error)
+}
+
+// clientExchanger 是默认的 Exchanger：同一目标地址的查询共用连接（见 connPool），按目标地址族绑定 Source/Source6；
+// withFreshConn 标记的查询每次新建连接
+type clientExchanger struct {
+	tr   *Tracer
+	pool *connPool
+}
+
+func (e clientExchanger) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	c := &dns.Client{Net: network}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.Timeout = time.Until(deadline)
+	}
+	switch {
+	case ctx.Value(freshConnKey{}) != nil:
+	case network == "udp":
+		return e.pool.exchangeUDP(ctx, m, addr)
+	default:
+		return e.pool.exchangeTCP(ctx, c, m, addr)
+	}
+	conn, err := e.pool.dial(ctx, c, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	return exchangeConn(ctx, c, m, conn)
+}
+
+type exchangeInfo struct {
+	Protocol      string
+	RTT           time.Duration
+	TCPFallback   bool
+	FallbackError string
+	// UDPMalformed 是 UDP 应答无法解析或为 FORMERR/NOTIMP 时的原始失败，随后改用 TCP 重试
+	UDPMalformed string
+}
+
+// connectError 表示 TCP 连接本身没有建立起来，和应答超时、报文错误区分开
+type connectError struct {
+	reason string
+	err    error
+}
+
+func (e *connectError) Error() string {
+	return "tcp connect " + e.reason + ": " + e.err.Error()
+}
+
+func (e *connectError) Unwrap() error {
+	return e.err
+}
+
+func classifyTCPError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, new(*proxyError)) || !errors.As(err, &opErr) || opErr.Op != "dial" {
+		return err
+	}
+	if opErr.Timeout() {
+		return &connectError{"timeout", err}
+	}
+	return &connectError{"refused", err}
+}
+
+// sourceMismatchError 表示 -source 没有和目标地址同一地址族的源地址，这个目标被跳过
+type sourceMismatchError struct {
+	dest string
+}
+
+func (e *sourceMismatchError) Error() string {
+	return "skipped: no source address of the same family as " + e.dest
+}
+
+// useSource 按目标地址族给客户端绑定 -source/-source6 指定的源地址
+func (tr *Tracer) useSource(c *dns.Client, addr string) error {
+	if tr.source4 == nil && tr.source6 == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	src := tr.source4
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil || ip == nil && src == nil {
+		src = tr.source6
+	}
+	if src == nil {
+		return &sourceMismatchError{host}
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+	d := &net.Dialer{Timeout: timeout}
+	if c.Net == "" || c.Net == "udp" {
+		d.LocalAddr = &net.UDPAddr{IP: src}
+	} else {
+		d.LocalAddr = &net.TCPAddr{IP: src}
+	}
+	c.Dialer = d
+	return nil
+}
+
+// retryBackoff 是第一次重试前的等待时间，之后每次翻倍并加上随机抖动
+const retryBackoff = 200 * time.Millisecond
+
+// retry 在超时或网络错误时按指数退避重试 fn，最多重试 -retries 次，返回实际尝试的次数
+func (tr *Tracer) retry(ctx context.Context, fn func() error) (int, error) {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= tr.retries || !retryable(err) || ctx.Err() != nil {
+			return attempt + 1, err
+		}
+		tr.meter(ctx, func(u *Usage) { u.Retries++ })
+		backoff := retryBackoff << attempt
+		t := time.NewTimer(backoff + rand.N(backoff/2))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return attempt + 1, err
+		}
+	}
+}
+
+// retryable 判断错误是否值得重试，配置或证书这类错误重试也不会成功
+func retryable(err error) bool {
+	var srcErr *sourceMismatchError
+	var dohErr *dohError
+	switch {
+	case errors.As(err, &srcErr), isCertError(err), errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &dohErr) && dohErr.Status >= 400 && dohErr.Status < 500:
+		return false
+	}
+	return true
+}
+
+// timeoutError 表示在 -timeout 时间内没有收到应答；它实现了 net.Error，QueryResult.TimedOut 和错误代码靠它识别超时
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return "timeout after " + e.timeout.String()
+}
+
+func (e *timeoutError) Timeout() bool {
+	return true
+}
+
+func (e *timeoutError) Temporary() bool {
+	return true
+}
+
+// exchangeConn 在 ctx 取消时关闭连接，让阻塞中的读写立即返回
+func exchangeConn(ctx context.Context, c *dns.Client, m *dns.Msg, conn *dns.Conn) (*dns.Msg, time.Duration, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	r, rtt, err := c.ExchangeWithConnContext(ctx, m, conn)
+	// 截止时间一到连接就被关闭，读写返回的是 net.ErrClosed，换回超时错误以便按超时处理
+	if err != nil && errors.Is(err, net.ErrClosed) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = os.ErrDeadlineExceeded
+	}
+	return r, rtt, err
+}
+
+func (tr *Tracer) exchangeOnce(ctx context.Context, network string, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	if err := tr.beforeSend(ctx); err != nil {
+		return nil, 0, err
+	}
+	if tr.proxy != nil {
+		// SOCKS5 代理只转发 TCP，UDP 查询会绕过代理。设置了代理时 forceTCP 也为真，exchange 记下的协议已经是 TCP，
+		// 这里兜住直接指定 "udp" 的调用方（例如 CHAOS 查询）
+		network = "tcp"
+	}
+	r, rtt, err := tr.exchanger.Exchange(ctx, m, network, addr)
+	received := 0
+	if r != nil {
+		received = r.Len()
+	}
+	tr.meterExchange(ctx, network, addr, m.Len(), received)
+	return r, rtt, err
+}
+
+// exchange 是所有查询共用的收发入口，UDP 应答被截断时自动改用 TCP 重试
+func (tr *Tracer) exchange(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, exchangeInfo, error) {
+	info := exchangeInfo{Protocol: "udp"}
+	if tr.forceTCP {
+		info.Protocol = "tcp"
+	}
+	start := time.Now()
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	r, rtt, err := tr.exchangeOnce(qctx, info.Protocol, m, addr)
+	if problem := malformedUDP(r, err); problem != "" && !tr.forceTCP && !tr.noTCPRecovery && ctx.Err() == nil {
+		return tr.recoverOverTCP(ctx, m, addr, timeout, r, rtt, err, problem)
+	}
+	if err != nil {
+		info.RTT = time.Since(start)
+		if ctx.Err() != nil {
+			return nil, info, ctx.Err()
+		}
+		if tr.forceTCP {
+			err = classifyTCPError(err)
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && !errors.As(err, new(*connectError)) && !errors.As(err, new(*proxyError)) {
+			err = &timeoutError{timeout}
+		}
+		return nil, info, err
+	}
+	info.RTT = rtt
+	if !r.Truncated || tr.ignoreTC || tr.forceTCP {
+		return r, info, nil
+	}
+
+	info.TCPFallback = true
+	tr.meter(ctx, func(u *Usage) { u.TCPFallbacks++ })
+	tctx, tcancel := context.WithTimeout(ctx, timeout)
+	defer tcancel()
+	tcpResp, tcpRTT, err := tr.exchangeOnce(tctx, "tcp", m, addr)
+	if err != nil {
+		// TCP 也失败时保留被截断的 UDP 应答，并记录失败原因
+		info.FallbackError = classifyTCPError(err).Error()
+		return r, info, nil
+	}
+	info.Protocol = "tcp"
+	info.RTT = tcpRTT
+	return tcpResp, info, nil
+}
+
+// malformedUDP 判断 UDP 应答是否被中间设备破坏：报文无法解析，或者服务器说看不懂查询（FORMERR、NOTIMP）。
+// 中间设备改写 UDP 报文时往往不碰 TCP，这类失败值得换 TCP 再试一次
+func malformedUDP(r *dns.Msg, err error) string {
+	var dnsErr *dns.Error
+	switch {
+	case err != nil && errors.As(err, &dnsErr):
+		return err.Error()
+	case err != nil:
+		return ""
+	case r.Rcode == dns.RcodeFormatError, r.Rcode == dns.RcodeNotImplemented:
+		return dns.RcodeToString[r.Rcode]
+	}
+	return ""
+}
+
+// recoverOverTCP 在 UDP 应答损坏时用 TCP 重发一次，成功时采用 TCP 的应答；失败时仍返回原来的 UDP 结果，两次的失败都记录下来
+func (tr *Tracer) recoverOverTCP(ctx context.Context, m *dns.Msg, addr string, timeout time.Duration, r *dns.Msg, rtt time.Duration, udpErr error, problem string) (*dns.Msg, exchangeInfo, error) {
+	info := exchangeInfo{Protocol: "udp", RTT: rtt, TCPFallback: true, UDPMalformed: problem}
+	tr.logger.Debug("udp response malformed, retrying over tcp", "server", addr, "problem", problem)
+	tr.meter(ctx, func(u *Usage) { u.TCPFallbacks++ })
+	tctx, tcancel := context.WithTimeout(ctx, timeout)
+	defer tcancel()
+	tcpResp, tcpRTT, err := tr.exchangeOnce(tctx, "tcp", m, addr)
+	if err != nil {
+		info.FallbackError = classifyTCPError(err).Error()
+		if udpErr != nil {
+			udpErr = fmt.Errorf("%w; tcp retry failed: %s", udpErr, info.FallbackError)
+		}
+		return r, info, udpErr
+	}
+	info.Protocol = "tcp"
+	info.RTT = tcpRTT
+	return tcpResp, info, nil
+}
+
+func (tr *Tracer) parseSources(source, src6 string) error {
+	if source != "" {
+		ip := net.ParseIP(source)
+		if ip == nil {
+			return fmt.Errorf("invalid -source %q: not an IP address", source)
+		}
+		if ip.To4() != nil {
+			tr.source4 = ip
+		} else {
+			tr.source6 = ip
+		}
+	}
+	if src6 != "" {
+		ip := net.ParseIP(src6)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid -source6 %q: not an IPv6 address", src6)
+		}
+		tr.source6 = ip
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// buildTree 从追踪的第一级开始，沿每台服务器给出的转介分别往下查询，而不是把各服务器的 NS 合并成一个列表；
+// 同一个区配同一组 NS 的子树只展开一次，和平铺追踪里某一级一致的子树直接复用那一级的结果，不再重复查询
+func (tr *Tracer) buildTree(ctx context.Context, domain string, qtype uint16, results []Result) *Result {
+	domain = dns.Fqdn(domain)
+	known := make(map[string]Result)
+	for _, res := range results {
+		// CNAME 目标的追踪也在 results 里，只复用同一个名字的级别
+		if !strings.EqualFold(res.Domain, domain) {
+			continue
+		}
+		hosts := make([]string, len(res.Authorities))
+		for i, auth := range res.Authorities {
+			hosts[i] = auth.Hostname
+		}
+		known[delegationKey(res.Zone, hosts)] = res
+	}
+	seen := make(map[string]bool)
+	var expand func(res Result) *Result
+	expand = func(res Result) *Result {
+		node := res
+		node.Authorities = slices.Clone(res.Authorities)
+		for i := range node.Authorities {
+			auth := &node.Authorities[i]
+			auth.QueryResults = slices.Clone(auth.QueryResults)
+			for j := range auth.QueryResults {
+				qr := &auth.QueryResults[j]
+				if qr.Error != "" || len(qr.NS) == 0 {
+					continue
+				}
+				qr.Subtree = delegationKey(qr.Referral, qr.NS)
+				if seen[qr.Subtree] || ctx.Err() != nil || node.Level >= tr.maxDepth {
+					continue
+				}
+				seen[qr.Subtree] = true
+				child, ok := known[qr.Subtree]
+				if !ok {
+					child = tr.treeLevel(ctx, domain, qtype, node.Level+1, *qr)
+				}
+				qr.NextLevel = expand(child)
+			}
+		}
+		return &node
+	}
+	return expand(results[0])
+}
+
+// treeLevel 只向 qr 转介里的 NS 查询下一级，胶水也只用这个转介自己带的
+func (tr *Tracer) treeLevel(ctx context.Context, domain string, qtype uint16, level int, qr QueryResult) Result {
+	glue := make(glueAddrs)
+	for _, g := range qr.Glue {
+		if ip := net.ParseIP(g.Address); ip != nil {
+			name := strings.ToLower(g.Name)
+			glue[name] = append(glue[name], ip)
+		}
+	}
+	result := Result{Level: level, Domain: domain, Zone: qr.Referral}
+	queried, limited := tr.limitServers(qr.NS)
+	lctx, cancel := tr.levelContext(ctx)
+	defer cancel()
+	authorities, nextNS, _, err := tr.getAuthorities(lctx, domain, qr.Referral, queried, glue, qtype)
+	result.Authorities = tr.sortAuthorities(append(authorities, limitedAuthorities(qr.Referral, limited)...))
+	if err != nil {
+		result.Error, result.Code = abortMessage(err), queryErrorCode(err)
+		return result
+	}
+	if len(nextNS) > 0 {
+		result.Child = delegatedZone(result)
+	}
+	tr.noteLevelBudget(&result)
+	classifyLevel(&result)
+	if _, failure := levelFailures(result); failure != "" {
+		result.Error, result.Code = failure, levelErrorCode(result)
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TTL 检查针对的记录类别，只有这两类会和 TTLMin、TTLMax 比较
+const (
+	TTLDelegation = "delegation"
+	TTLApex       = "apex"
+)
+
+// RRsetTTL 是一台服务器应答里一个 RRset 的 TTL；Section 为 answer 或 authority（转介的 NS）
+type RRsetTTL struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Section string `json:"section"`
+	TTL     uint32 `json:"ttl"`
+}
+
+// TTLCheck 比较每一级同一个 RRset 在各台服务器上的 TTL，只列出有问题的 RRset
+type TTLCheck struct {
+	// MinSec 和 MaxSec 是 Options.TTLMin 和 TTLMax，MaxSec 为 0 表示不检查上限
+	MinSec  uint32     `json:"min_sec"`
+	MaxSec  uint32     `json:"max_sec,omitempty"`
+	Checked int        `json:"checked"`
+	RRsets  []TTLRRset `json:"rrsets,omitempty"`
+}
+
+type TTLRRset struct {
+	Zone    string `json:"zone"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Section string `json:"section"`
+	Kind    string `json:"kind,omitempty"`
+	// Disagree 表示各服务器给出的 TTL 不同，这时 Values 有多项，按给出它的服务器数从多到少排列
+	Disagree bool       `json:"disagree,omitempty"`
+	Values   []TTLValue `json:"values"`
+}
+
+type TTLValue struct {
+	TTL     uint32      `json:"ttl"`
+	Servers []TTLSource `json:"servers"`
+	// Problem 说明 TTL 超出了 TTLMin 或 TTLMax，只检查委派 NS 和区顶点的记录
+	Problem string `json:"problem,omitempty"`
+}
+
+type TTLSource struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+}
+
+// Problems 判断是否有 RRset 的 TTL 不一致或超出范围
+func (c *TTLCheck) Problems() bool {
+	return c != nil && len(c.RRsets) > 0
+}
+
+// rrsetTTLs 按 RRset 收集 TTL；同一 RRset 里的记录 TTL 本应相同，不同时取最小值，和缓存的做法一致（RFC 2181 5.2）
+func rrsetTTLs(section string, rrs []dns.RR) []RRsetTTL {
+	var out []RRsetTTL
+	index := make(map[[2]string]int)
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeRRSIG || h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		k := [2]string{strings.ToLower(h.Name), dns.Type(h.Rrtype).String()}
+		if i, ok := index[k]; ok {
+			out[i].TTL = min(out[i].TTL, h.Ttl)
+			continue
+		}
+		index[k] = len(out)
+		out = append(out, RRsetTTL{Name: k[0], Type: k[1], Section: section, TTL: h.Ttl})
+	}
+	return out
+}
+
+// checkTTL 在每一级内按 RRset 比较各服务器的 TTL：委派 NS 是转介里的 NS，区顶点记录是属主为区名的应答记录
+func (tr *Tracer) checkTTL(results []Result) *TTLCheck {
+	check := &TTLCheck{MinSec: uint32(tr.ttlMin / time.Second), MaxSec: uint32(tr.ttlMax / time.Second)}
+	for _, res := range results {
+		var sets []TTLRRset
+		index := make(map[[3]string]int)
+		for _, auth := range res.Authorities {
+			src := TTLSource{normalizeName(auth.Hostname), ""}
+			for _, qr := range auth.QueryResults {
+				src.IP = qr.ServerIP
+				for _, t := range qr.TTLs {
+					k := [3]string{t.Name, t.Type, t.Section}
+					i, ok := index[k]
+					if !ok {
+						i = len(sets)
+						index[k] = i
+						set := TTLRRset{Zone: res.Zone, Name: t.Name, Type: t.Type, Section: t.Section}
+						switch {
+						case t.Section == "authority" && t.Type == "NS":
+							set.Kind = TTLDelegation
+						case t.Section == "answer" && (t.Name == res.Zone || t.Name == qr.Zone):
+							set.Kind = TTLApex
+						}
+						sets = append(sets, set)
+					}
+					sets[i].add(t.TTL, src)
+				}
+			}
+		}
+		check.Checked += len(sets)
+		for _, set := range sets {
+			set.Disagree = len(set.Values) > 1
+			out := false
+			if set.Kind != "" {
+				for i := range set.Values {
+					set.Values[i].Problem = check.ttlProblem(set.Values[i].TTL)
+					out = out || set.Values[i].Problem != ""
+				}
+			}
+			if set.Disagree || out {
+				sort.SliceStable(set.Values, func(a, b int) bool { return len(set.Values[a].Servers) > len(set.Values[b].Servers) })
+				check.RRsets = append(check.RRsets, set)
+			}
+		}
+	}
+	return check
+}
+
+func (s *TTLRRset) add(ttl uint32, src TTLSource) {
+	for i, v := range s.Values {
+		if v.TTL == ttl {
+			// 同一个 IP 上 A 和 AAAA 两次查询会各带一份转介，只记一次
+			if !containsSource(v.Servers, src) {
+				s.Values[i].Servers = append(s.Values[i].Servers, src)
+			}
+			return
+		}
+	}
+	s.Values = append(s.Values, TTLValue{TTL: ttl, Servers: []TTLSource{src}})
+}
+
+func containsSource(srcs []TTLSource, src TTLSource) bool {
+	for _, s := range srcs {
+		if s == src {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *TTLCheck) ttlProblem(ttl uint32) string {
+	switch {
+	case ttl < c.MinSec:
+		return fmt.Sprintf("below the minimum of %ds", c.MinSec)
+	case c.MaxSec > 0 && ttl > c.MaxSec:
+		return fmt.Sprintf("above the maximum of %ds", c.MaxSec)
+	}
+	return ""
+}
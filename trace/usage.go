@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"context"
+	"maps"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Usage.Queries 的键：查询发往的服务器类别
+const (
+	DestRoot          = "root"
+	DestTLD           = "tld"
+	DestAuthoritative = "authoritative"
+	DestResolver      = "resolver"
+)
+
+// Usage 是一段时间内发出的全部查询的资源开销，由收发入口统一计数，任何功能发出的查询都计算在内。
+// Report.Usage 是一次 Run 的开销，包括追踪之后的各项检查；Tracer.Usage 是 New 以来的总数
+type Usage struct {
+	// Queries 按目的地类别统计发出的报文数，重试和 TCP 重发各算一次
+	Queries map[string]int64 `json:"queries"`
+	Total   int64            `json:"total_queries"`
+	// Exchanges 按传输协议（udp、tcp、tls、https）统计同样的报文
+	Exchanges     map[string]int64 `json:"exchanges"`
+	BytesSent     int64            `json:"bytes_sent"`
+	BytesReceived int64            `json:"bytes_received"`
+	Retries       int64            `json:"retries"`
+	TCPFallbacks  int64            `json:"tcp_fallbacks"`
+	// CacheHits 是 NS 地址缓存和磁盘缓存省掉的查询数，DiskHits 是其中来自磁盘缓存的，DiskMisses 是磁盘缓存里没有可用转介的次数
+	CacheHits  int64 `json:"cache_hits"`
+	DiskHits   int64 `json:"disk_cache_hits,omitempty"`
+	DiskMisses int64 `json:"disk_cache_misses,omitempty"`
+	// Connections 是默认 Exchanger 新打开的 UDP 套接字和 TCP 连接数
+	Connections int64   `json:"connections,omitempty"`
+	ElapsedMs   float64 `json:"elapsed_ms"`
+}
+
+// usageMeter 累计 Usage；Tracer 有一个总的，每次 Run 在 ctx 里再放一个，同一个 Tracer 上并发的 Run 各记各的。
+// ctx 里已经有计数时新放的一个以它为 parent，查询同时记入两者，用来单独统计其中一段（例如一个 NS 的地址查询）
+type usageMeter struct {
+	start  time.Time
+	mu     sync.Mutex
+	u      Usage
+	parent *usageMeter
+}
+
+type usageKey struct{}
+
+// destinationKey 标记 ctx 里的查询发往哪一类服务器，见 withDestination
+type destinationKey struct{}
+
+func newUsageMeter() *usageMeter {
+	return &usageMeter{start: time.Now(), u: Usage{Queries: make(map[string]int64), Exchanges: make(map[string]int64)}}
+}
+
+func withUsage(ctx context.Context) (context.Context, *usageMeter) {
+	u := newUsageMeter()
+	u.parent, _ = ctx.Value(usageKey{}).(*usageMeter)
+	return context.WithValue(ctx, usageKey{}, u), u
+}
+
+// withDestination 让 ctx 里发出的查询记入 dest 类别
+func withDestination(ctx context.Context, dest string) context.Context {
+	return context.WithValue(ctx, destinationKey{}, dest)
+}
+
+// zoneDestination 返回查询 zone 的服务器所属的类别
+func zoneDestination(zone string) string {
+	switch labels := strings.Count(strings.Trim(zone, "."), ".") + 1; {
+	case zone == "." || zone == "":
+		return DestRoot
+	case labels == 1:
+		return DestTLD
+	}
+	return DestAuthoritative
+}
+
+// meter 把 f 计入 Tracer 的总数和 ctx 里的各级计数
+func (tr *Tracer) meter(ctx context.Context, f func(u *Usage)) {
+	meters := []*usageMeter{tr.usage}
+	u, _ := ctx.Value(usageKey{}).(*usageMeter)
+	for ; u != nil; u = u.parent {
+		meters = append(meters, u)
+	}
+	for _, m := range meters {
+		m.mu.Lock()
+		f(&m.u)
+		m.mu.Unlock()
+	}
+}
+
+// meterExchange 记下一次发出的报文。目的地类别取 ctx 的标记，没有标记时按 queryServer 记下的服务器角色，都没有时算作权威服务器
+func (tr *Tracer) meterExchange(ctx context.Context, network, addr string, sent, received int) {
+	dest, _ := ctx.Value(destinationKey{}).(string)
+	if dest == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		if role, ok := tr.serverRoles.Load(host); ok {
+			dest = role.(string)
+		} else {
+			dest = DestAuthoritative
+		}
+	}
+	tr.meter(ctx, func(u *Usage) {
+		u.Queries[dest]++
+		u.Total++
+		u.Exchanges[network]++
+		u.BytesSent += int64(sent)
+		u.BytesReceived += int64(received)
+	})
+}
+
+func (m *usageMeter) snapshot() *Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u := m.u
+	u.Queries, u.Exchanges = maps.Clone(m.u.Queries), maps.Clone(m.u.Exchanges)
+	u.ElapsedMs = millis(time.Since(m.start))
+	return &u
+}
+
+// Usage 返回 New 以来这个 Tracer 发出的全部查询的开销，可以在 Run 进行中调用
+func (tr *Tracer) Usage() *Usage {
+	return tr.usage.snapshot()
+}
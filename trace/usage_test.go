@@ -0,0 +1,140 @@
+package trace
+
+import (
+	"context"
+	"maps"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// meteredNet 在假层级之前按目标 IP 和协议统计实际发出的报文，truncate 里的服务器的 UDP 应答被截断
+type meteredNet struct {
+	*fakeNet
+	truncate map[string]bool
+	mu       sync.Mutex
+	sent     map[string]int64
+	networks map[string]int64
+}
+
+func (n *meteredNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	host, _, _ := net.SplitHostPort(addr)
+	n.mu.Lock()
+	n.sent[host]++
+	n.networks[network]++
+	n.mu.Unlock()
+	r, rtt, err := n.fakeNet.Exchange(ctx, m, network, addr)
+	if err == nil && network == "udp" && n.truncate[host] {
+		r.Truncated, r.Answer = true, nil
+	}
+	return r, rtt, err
+}
+
+func TestZoneDestination(t *testing.T) {
+	tests := []struct {
+		zone, want string
+	}{
+		{".", DestRoot},
+		{"", DestRoot},
+		{"test.", DestTLD},
+		{"co.uk.", DestAuthoritative},
+		{"example.test.", DestAuthoritative},
+		{"sub.many.test.", DestAuthoritative},
+	}
+	for _, tt := range tests {
+		if got := zoneDestination(tt.zone); got != tt.want {
+			t.Errorf("zoneDestination(%q) = %q, want %q", tt.zone, got, tt.want)
+		}
+	}
+}
+
+// meterExchange 按 ctx 的标记、queryServer 记下的角色依次判断目的地，都没有时算作权威服务器
+func TestMeterExchangeDestination(t *testing.T) {
+	tr := newFakeTracer(t, newFakeNet(t, 0), nil)
+	tr.serverRoles.Store("192.0.2.1", DestTLD)
+	ctx, usage := withUsage(context.Background())
+	tr.meterExchange(withDestination(ctx, DestResolver), "tcp", "192.0.2.1:53", 40, 100)
+	tr.meterExchange(ctx, "udp", "192.0.2.1:53", 30, 200)
+	tr.meterExchange(ctx, "udp", "[2001:db8::1]:53", 20, 0)
+	u := usage.snapshot()
+	want := map[string]int64{DestResolver: 1, DestTLD: 1, DestAuthoritative: 1}
+	if !maps.Equal(u.Queries, want) {
+		t.Errorf("queries = %v, want %v", u.Queries, want)
+	}
+	if u.Total != 3 || u.BytesSent != 90 || u.BytesReceived != 300 || u.Exchanges["udp"] != 2 || u.Exchanges["tcp"] != 1 {
+		t.Errorf("usage = %+v", u)
+	}
+	if total := tr.Usage(); total.Total != 3 {
+		t.Errorf("tracer total = %d, want 3", total.Total)
+	}
+}
+
+// 经过收发入口的每个报文都按服务器的类别计数，和 Exchanger 实际看到的一致；超时重试和截断后改用 TCP 也计入
+func TestUsageCountsExchanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		domain    string
+		truncate  []string
+		retries   int
+		fallbacks bool
+	}{
+		// ns.hosting.example.test. 没有胶水，地址经递归服务器查询
+		{name: "glueless", domain: "www.other.test"},
+		// ns1.slow.test. 不应答
+		{name: "retries", domain: "www.slow.test", retries: 1},
+		{name: "tcp fallback", domain: "www.example.test", truncate: []string{"127.0.53.3", "127.0.53.4"}, fallbacks: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &meteredNet{fakeNet: newFakeNet(t, 0), truncate: make(map[string]bool), sent: make(map[string]int64), networks: make(map[string]int64)}
+			for _, ip := range tt.truncate {
+				n.truncate[ip] = true
+			}
+			tr := newFakeTracer(t, n.fakeNet, func(o *Options) {
+				o.Exchanger = n
+				o.Retries, o.Timeout = tt.retries, 100*time.Millisecond
+			})
+			report, _ := tr.Run(context.Background(), tt.domain, "a", nil)
+			u := report.Usage
+			want := map[string]int64{}
+			for host, sent := range n.sent {
+				switch host {
+				case "127.0.53.1":
+					want[DestRoot] += sent
+				case "127.0.53.2":
+					want[DestTLD] += sent
+				case fakeResolver:
+					want[DestResolver] += sent
+				default:
+					want[DestAuthoritative] += sent
+				}
+			}
+			// Prepare 对根提示的查询在 Run 之前，只记在 Tracer 的总数里
+			total := tr.Usage()
+			if !maps.Equal(total.Queries, want) {
+				t.Errorf("tracer queries = %v, exchanger saw %v", total.Queries, want)
+			}
+			if !maps.Equal(total.Exchanges, n.networks) {
+				t.Errorf("exchanges = %v, exchanger saw %v", total.Exchanges, n.networks)
+			}
+			for _, dest := range []string{DestRoot, DestTLD, DestAuthoritative} {
+				if u.Queries[dest] == 0 {
+					t.Errorf("no %s queries in the run: %v", dest, u.Queries)
+				}
+			}
+			if tt.name == "glueless" && u.Queries[DestResolver] == 0 {
+				t.Errorf("no resolver queries in the run: %v", u.Queries)
+			}
+			// 每个不应答的查询重试 tt.retries 次
+			if silent := n.queries("127.0.53.5"); u.Retries != silent-silent/int64(tt.retries+1) {
+				t.Errorf("retries = %d, silent server got %d queries", u.Retries, silent)
+			}
+			if got := u.TCPFallbacks > 0; got != tt.fallbacks || tt.fallbacks && u.TCPFallbacks != n.networks["tcp"] {
+				t.Errorf("tcp fallbacks = %d over %d tcp exchanges, want fallbacks %v", u.TCPFallbacks, n.networks["tcp"], tt.fallbacks)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// VerifyCheck 记录最终一级每个查询重复发送的结果，用于发现被篡改或不稳定的应答
+type VerifyCheck struct {
+	Repeats int            `json:"repeats"`
+	Queries []VerifyResult `json:"queries"`
+}
+
+type VerifyResult struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Qtype    string `json:"qtype"`
+	// Answers 按出现次数从多到少列出不同的应答（包括追踪时的那一次），一致时只有一项
+	Answers []VerifyAnswer `json:"answers"`
+	// Failures 是没有收到应答的次数（超时或网络错误），不算作内容不一致
+	Failures  int    `json:"failures,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+type VerifyAnswer struct {
+	Answer string `json:"answer"`
+	Count  int    `json:"count"`
+}
+
+// Consistent 判断收到的所有应答内容是否相同
+func (v VerifyResult) Consistent() bool {
+	return len(v.Answers) <= 1
+}
+
+// Disagrees 判断是否有查询的重复应答不一致
+func (c *VerifyCheck) Disagrees() bool {
+	if c == nil {
+		return false
+	}
+	for _, q := range c.Queries {
+		if !q.Consistent() {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAnswers 对 domain 最后一级的每个服务器 IP 和查询类型重复发送 tr.verify 次查询；
+// 每次都新建连接，源端口随之变化，也不做重试，超时单独计数
+func (tr *Tracer) verifyAnswers(ctx context.Context, domain string, results []Result) *VerifyCheck {
+	check := &VerifyCheck{Repeats: tr.verify}
+	level, ok := zoneLevel(domain, results)
+	if !ok {
+		return check
+	}
+	var counts []map[string]int
+	for _, auth := range level.Authorities {
+		for _, qr := range auth.QueryResults {
+			v := VerifyResult{Hostname: normalizeName(auth.Hostname), IP: qr.ServerIP, Qtype: qr.Qtype}
+			seen := make(map[string]int)
+			if qr.Error == "" {
+				seen[answerDigest(qr.Rcode, qr.Answers, qr.NS)]++
+			} else {
+				v.Failures, v.LastError = 1, qr.Error
+			}
+			check.Queries = append(check.Queries, v)
+			counts = append(counts, seen)
+		}
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			q := &check.Queries[i]
+			for range tr.verify {
+				if ctx.Err() != nil {
+					break
+				}
+				m, _ := tr.newAuthorityQuery(level.Domain, q.IP, dns.StringToType[q.Qtype])
+				r, _, err := tr.exchange(withFreshConn(ctx), m, tr.authAddr(q.IP), tr.queryTimeout)
+				if err != nil {
+					q.Failures++
+					q.LastError = err.Error()
+					continue
+				}
+				counts[i][msgDigest(r, level.Zone, level.Domain)]++
+			}
+			for answer, n := range counts[i] {
+				q.Answers = append(q.Answers, VerifyAnswer{answer, n})
+			}
+			sort.Slice(q.Answers, func(a, b int) bool {
+				x, y := q.Answers[a], q.Answers[b]
+				return x.Count > y.Count || x.Count == y.Count && x.Answer < y.Answer
+			})
+		}()
+	}
+	wg.Wait()
+	return check
+}
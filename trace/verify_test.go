@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// editNet 把假层级的每个应答交给 edit 修改后再返回
+type editNet struct {
+	*fakeNet
+	edit func(host string, r *dns.Msg)
+}
+
+func (n *editNet) Exchange(ctx context.Context, m *dns.Msg, network, addr string) (*dns.Msg, time.Duration, error) {
+	r, rtt, err := n.fakeNet.Exchange(ctx, m, network, addr)
+	if err == nil {
+		host, _, _ := net.SplitHostPort(addr)
+		n.edit(host, r)
+	}
+	return r, rtt, err
+}
+
+// example.test. 的服务器在 NODATA 应答的授权区里夹带一条越界的 NS：追踪时这条 NS 不采信，
+// 重复查询和 TCP 重发也不能因为它判定应答不一致
+func TestVerifyIgnoresOutOfBailiwickNS(t *testing.T) {
+	poison, _ := dns.NewRR("evil.test. 3600 IN NS ns.evil.test.")
+	n := &editNet{fakeNet: newFakeNet(t, 0), edit: func(host string, r *dns.Msg) {
+		if (host == "127.0.53.3" || host == "127.0.53.4") && len(r.Answer) == 0 && r.Rcode == dns.RcodeSuccess {
+			r.Ns = append(r.Ns, dns.Copy(poison))
+		}
+	}}
+	tr := newFakeTracer(t, n.fakeNet, func(o *Options) {
+		o.Exchanger = n
+		o.Verify = 2
+		o.CheckTCP = true
+	})
+	report, status := tr.Run(context.Background(), "www.example.test", "mx", nil)
+	if status != StatusNoData {
+		t.Fatalf("status = %v, want %v", status, StatusNoData)
+	}
+	if report.Verify == nil || len(report.Verify.Queries) == 0 {
+		t.Fatal("no -verify results")
+	}
+	for _, q := range report.Verify.Queries {
+		if !q.Consistent() {
+			t.Errorf("%s %s: repeated answers disagree: %v", q.IP, q.Qtype, q.Answers)
+		}
+	}
+	if report.TCP.Mismatch() {
+		t.Errorf("tcp check reports a mismatch: %+v", report.TCP.Queries)
+	}
+}
@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// 每个最终查询和对应随机标签探测的比较结果
+const (
+	WildcardMatch   = "match"
+	WildcardDiffers = "differs"
+	WildcardNone    = "none"
+	WildcardFailed  = "failed"
+)
+
+// WildcardCheck 用同一父域下不存在的随机标签重复最终一级有应答的查询，判断应答是否来自通配符
+type WildcardCheck struct {
+	Domain   string           `json:"domain"`
+	Probe    string           `json:"probe"`
+	Wildcard string           `json:"wildcard"`
+	Servers  []WildcardResult `json:"servers"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type WildcardResult struct {
+	Hostname string   `json:"hostname"`
+	IP       string   `json:"ip"`
+	Qtype    string   `json:"qtype"`
+	Status   string   `json:"status"`
+	Answers  []string `json:"answers,omitempty"`
+	Rcode    string   `json:"rcode,omitempty"`
+	// Synthesized 表示原应答的 RRSIG 标签数少于查询名的标签数，DNSSEC 证实应答由通配符合成
+	Synthesized bool   `json:"synthesized,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Matches 判断是否有服务器对随机标签给出了和查询名相同的应答
+func (c *WildcardCheck) Matches() bool {
+	if c == nil {
+		return false
+	}
+	for _, s := range c.Servers {
+		if s.Status == WildcardMatch || s.Synthesized {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSet 把应答排序去重以便比较。formatRecord 不输出 RRSIG，只比较记录本身：通配符合成的记录属主名不同，签名值不参与比较
+func recordSet(values []string) []string {
+	out := slices.Clone(values)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func (tr *Tracer) checkWildcard(ctx context.Context, domain string, results []Result) *WildcardCheck {
+	name := dns.Fqdn(strings.ToLower(domain))
+	check := &WildcardCheck{Domain: name}
+	level, ok := zoneLevel(domain, results)
+	if !ok || level.Zone == "" {
+		check.Error = "the trace did not reach the zone's authoritative servers"
+		return check
+	}
+	labels := dns.SplitDomainName(name)
+	if strings.EqualFold(name, level.Zone) || len(labels) < 2 {
+		check.Error = name + " is the zone apex, a wildcard cannot match it"
+		return check
+	}
+	parent := dns.Fqdn(strings.Join(labels[1:], "."))
+	check.Wildcard = "*." + parent
+	check.Probe = fmt.Sprintf("mdig-probe-%06x.%s", rand.Uint32()&0xffffff, parent)
+	var expected [][]string
+	for _, auth := range level.Authorities {
+		for _, qr := range auth.QueryResults {
+			answers := recordSet(qr.Answers)
+			if qr.Error != "" || len(answers) == 0 {
+				continue
+			}
+			res := WildcardResult{Hostname: normalizeName(auth.Hostname), IP: qr.ServerIP, Qtype: qr.Qtype}
+			for _, sig := range qr.RRSIGs {
+				if sig.Owner == name && sig.TypeCovered == qr.Qtype && int(sig.Labels) < len(labels) {
+					res.Synthesized = true
+				}
+			}
+			check.Servers = append(check.Servers, res)
+			expected = append(expected, answers)
+		}
+	}
+	if len(check.Servers) == 0 {
+		check.Error = "no server returned an answer for " + name
+		return check
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tr.concurrency)
+	for i := range check.Servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tr.probeWildcard(ctx, check.Probe, &check.Servers[i], expected[i])
+		}()
+	}
+	wg.Wait()
+	return check
+}
+
+func (tr *Tracer) probeWildcard(ctx context.Context, probe string, s *WildcardResult, expected []string) {
+	r, _, err := tr.queryAuthorities(ctx, probe, s.IP, dns.StringToType[s.Qtype])
+	if err != nil {
+		s.Status, s.Error = WildcardFailed, err.Error()
+		return
+	}
+	s.Rcode = dns.RcodeToString[r.Rcode]
+	var answers []string
+	for _, rr := range r.Answer {
+		if value, ok := formatRecord(rr); ok {
+			answers = append(answers, value)
+		}
+	}
+	s.Answers = recordSet(answers)
+	switch {
+	case len(s.Answers) == 0:
+		s.Status = WildcardNone
+	case slices.Equal(s.Answers, expected):
+		s.Status = WildcardMatch
+	default:
+		s.Status = WildcardDiffers
+	}
+}